@@ -0,0 +1,320 @@
+package account
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/mail"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/carlbennett/gobncs/bsha1"
+)
+
+type Account struct {
+	CreatedAt         time.Time
+	Email             string
+	LastLogon         time.Time
+	PasswordHash      [bsha1.Size]byte // single broken SHA-1 hash of the lowercased password
+	ResetTokenExpires time.Time
+	ResetTokenHash    string // hex broken SHA-1 hash of the pending reset token, hashed like a password
+	Username          string
+}
+
+const (
+	USERNAME_MAX_LENGTH = 15
+	USERNAME_MIN_LENGTH = 2
+)
+
+const RESET_TOKEN_LIFETIME = time.Hour
+
+const usernamePunctuation = "`~!$^&*()-_+={}[]|:;'\"<>,.?"
+
+var (
+	ErrAccountExists   = errors.New("account already exists")
+	ErrAccountNotFound = errors.New("account not found")
+	ErrEmailMismatch   = errors.New("email address mismatch")
+	ErrEmailNotSet     = errors.New("email address not set")
+	ErrInvalidEmail    = errors.New("invalid email address")
+	ErrInvalidToken    = errors.New("invalid or expired reset token")
+	ErrInvalidPassword = errors.New("invalid password")
+	ErrInvalidUsername = errors.New("invalid username")
+)
+
+var (
+	accounts      = map[string]*Account{}
+	accountsMutex = sync.RWMutex{}
+	storePath     string
+)
+
+func normalizeUsername(username string) string {
+	return strings.ToLower(username)
+}
+
+func ValidateUsername(username string) error {
+	if len(username) < USERNAME_MIN_LENGTH || len(username) > USERNAME_MAX_LENGTH {
+		return ErrInvalidUsername
+	}
+	for _, r := range username {
+		isAlnum := (r >= '0' && r <= '9') || (r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z')
+		if !isAlnum && !strings.ContainsRune(usernamePunctuation, r) {
+			return ErrInvalidUsername
+		}
+	}
+	return nil
+}
+
+// Open loads the account store from path and persists every later change to it.
+// A missing file is treated as an empty store.
+func Open(path string) error {
+	loaded := map[string]*Account{}
+	raw, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to read account store: %v", err)
+	}
+	if err == nil {
+		var list []*Account
+		if err = json.Unmarshal(raw, &list); err != nil {
+			return fmt.Errorf("failed to parse account store: %v", err)
+		}
+		for _, account := range list {
+			loaded[normalizeUsername(account.Username)] = account
+		}
+	}
+
+	accountsMutex.Lock()
+	defer accountsMutex.Unlock()
+	accounts = loaded
+	storePath = path
+	return nil
+}
+
+// Flush writes the account store to disk.
+func Flush() error {
+	accountsMutex.RLock()
+	defer accountsMutex.RUnlock()
+	return save()
+}
+
+// save must be called with accountsMutex held.
+func save() error {
+	if storePath == "" {
+		return nil
+	}
+
+	list := make([]*Account, 0, len(accounts))
+	for _, account := range accounts {
+		list = append(list, account)
+	}
+	raw, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := storePath + ".tmp"
+	if err = os.WriteFile(tmp, raw, 0600); err != nil {
+		return fmt.Errorf("failed to write account store: %v", err)
+	}
+	return os.Rename(tmp, storePath)
+}
+
+func Get(username string) (Account, bool) {
+	accountsMutex.RLock()
+	defer accountsMutex.RUnlock()
+	account, ok := accounts[normalizeUsername(username)]
+	if !ok {
+		return Account{}, false
+	}
+	return *account, true
+}
+
+func Create(username string, passwordHash [bsha1.Size]byte) (Account, error) {
+	if err := ValidateUsername(username); err != nil {
+		return Account{}, err
+	}
+
+	accountsMutex.Lock()
+	defer accountsMutex.Unlock()
+
+	key := normalizeUsername(username)
+	if _, ok := accounts[key]; ok {
+		return Account{}, ErrAccountExists
+	}
+
+	account := &Account{
+		CreatedAt:    time.Now().UTC(),
+		PasswordHash: passwordHash,
+		Username:     username,
+	}
+	accounts[key] = account
+	return *account, save()
+}
+
+// Logon verifies a password proof, which is the broken SHA-1 hash of the client
+// token, server token and stored password hash.
+func Logon(username string, clientToken uint32, serverToken uint32, proof [bsha1.Size]byte) (Account, error) {
+	accountsMutex.Lock()
+	defer accountsMutex.Unlock()
+
+	account, ok := accounts[normalizeUsername(username)]
+	if !ok {
+		return Account{}, ErrAccountNotFound
+	}
+	expected := bsha1.SumTokens(account.PasswordHash[:], clientToken, serverToken)
+	if subtle.ConstantTimeCompare(expected[:], proof[:]) != 1 {
+		return Account{}, ErrInvalidPassword
+	}
+
+	account.LastLogon = time.Now().UTC()
+	return *account, save()
+}
+
+// CheckPassword verifies a plaintext password, for logons outside the game
+// protocol such as the admin API. Unlike Logon it does not record a logon.
+func CheckPassword(username string, password string) (Account, error) {
+	accountsMutex.RLock()
+	defer accountsMutex.RUnlock()
+
+	account, ok := accounts[normalizeUsername(username)]
+	if !ok {
+		return Account{}, ErrAccountNotFound
+	}
+	hash := HashPassword(password)
+	if subtle.ConstantTimeCompare(hash[:], account.PasswordHash[:]) != 1 {
+		return Account{}, ErrInvalidPassword
+	}
+	return *account, nil
+}
+
+// ChangePassword replaces the password hash of an account. The old password
+// proof may be made from a pending reset token instead of the old password,
+// which consumes the token.
+func ChangePassword(username string, clientToken uint32, serverToken uint32, oldProof [bsha1.Size]byte, newPasswordHash [bsha1.Size]byte) error {
+	accountsMutex.Lock()
+	defer accountsMutex.Unlock()
+
+	account, ok := accounts[normalizeUsername(username)]
+	if !ok {
+		return ErrAccountNotFound
+	}
+	expected := bsha1.SumTokens(account.PasswordHash[:], clientToken, serverToken)
+	if subtle.ConstantTimeCompare(expected[:], oldProof[:]) != 1 && !resetTokenProof(account, clientToken, serverToken, oldProof) {
+		return ErrInvalidPassword
+	}
+
+	account.PasswordHash = newPasswordHash
+	account.ResetTokenHash = ""
+	account.ResetTokenExpires = time.Time{}
+	return save()
+}
+
+// resetTokenProof reports whether proof was made from the account's pending
+// reset token in place of its password.
+func resetTokenProof(account *Account, clientToken uint32, serverToken uint32, proof [bsha1.Size]byte) bool {
+	if account.ResetTokenHash == "" || time.Now().After(account.ResetTokenExpires) {
+		return false
+	}
+	hash, err := hex.DecodeString(account.ResetTokenHash)
+	if err != nil {
+		return false
+	}
+	expected := bsha1.SumTokens(hash, clientToken, serverToken)
+	return subtle.ConstantTimeCompare(expected[:], proof[:]) == 1
+}
+
+func ValidateEmail(email string) error {
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return ErrInvalidEmail
+	}
+	return nil
+}
+
+// SetEmail registers an email address on an account that does not have one yet.
+func SetEmail(username string, email string) error {
+	if err := ValidateEmail(email); err != nil {
+		return err
+	}
+
+	accountsMutex.Lock()
+	defer accountsMutex.Unlock()
+
+	account, ok := accounts[normalizeUsername(username)]
+	if !ok {
+		return ErrAccountNotFound
+	}
+	if account.Email != "" {
+		return ErrEmailMismatch
+	}
+
+	account.Email = email
+	return save()
+}
+
+func ChangeEmail(username string, oldEmail string, newEmail string) error {
+	if err := ValidateEmail(newEmail); err != nil {
+		return err
+	}
+
+	accountsMutex.Lock()
+	defer accountsMutex.Unlock()
+
+	account, ok := accounts[normalizeUsername(username)]
+	if !ok {
+		return ErrAccountNotFound
+	}
+	if account.Email == "" {
+		return ErrEmailNotSet
+	}
+	if !strings.EqualFold(account.Email, oldEmail) {
+		return ErrEmailMismatch
+	}
+
+	account.Email = newEmail
+	return save()
+}
+
+// CreateResetToken issues a single-use password reset token for an account
+// whose registered email matches, replacing any earlier token. The token is
+// consumed by ChangePassword.
+func CreateResetToken(username string, email string) (Account, string, error) {
+	accountsMutex.Lock()
+	defer accountsMutex.Unlock()
+
+	account, ok := accounts[normalizeUsername(username)]
+	if !ok {
+		return Account{}, "", ErrAccountNotFound
+	}
+	if account.Email == "" {
+		return Account{}, "", ErrEmailNotSet
+	}
+	if !strings.EqualFold(account.Email, email) {
+		return Account{}, "", ErrEmailMismatch
+	}
+
+	var raw [16]byte
+	_, err := rand.Read(raw[:])
+	if err != nil {
+		return Account{}, "", err
+	}
+	token := hex.EncodeToString(raw[:])
+
+	account.ResetTokenHash = hashResetToken(token)
+	account.ResetTokenExpires = time.Now().UTC().Add(RESET_TOKEN_LIFETIME)
+	return *account, token, save()
+}
+
+func HashPassword(password string) [bsha1.Size]byte {
+	return bsha1.Sum([]byte(strings.ToLower(password)))
+}
+
+func hashResetToken(token string) string {
+	hash := HashPassword(token)
+	return hex.EncodeToString(hash[:])
+}
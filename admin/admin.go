@@ -0,0 +1,186 @@
+// Package admin serves a JSON API for managing the running server without a
+// game client. Requests authenticate with HTTP basic auth as an account, and
+// each route requires the operator permissions granted to that account.
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/carlbennett/gobncs/account"
+	"github.com/carlbennett/gobncs/ban"
+	"github.com/carlbennett/gobncs/logging"
+	"github.com/carlbennett/gobncs/permission"
+)
+
+// largest request body accepted
+const MAX_BODY_SIZE = 64 * 1024
+
+var logger = logging.For(logging.ADMIN)
+
+// Error is returned by route handlers to reply with a status other than 500.
+type Error struct {
+	Message string
+	Status  int
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// request is an authenticated request matched to a route.
+type request struct {
+	*http.Request
+	args     []string // path segments matched by wildcards
+	operator string   // account the request authenticated as
+}
+
+type route struct {
+	method     string
+	path       []string // segments; "*" matches any single segment
+	permission permission.Permission
+	handle     func(r *request) (int, any, error)
+}
+
+var routes = []route{
+	{http.MethodGet, []string{"clients"}, permission.PERMISSION_VIEW, listClients},
+	{http.MethodPost, []string{"clients", "*", "kick"}, permission.PERMISSION_KICK, kickClient},
+	{http.MethodGet, []string{"users", "*"}, permission.PERMISSION_VIEW, getUser},
+	{http.MethodPost, []string{"users", "*", "kick"}, permission.PERMISSION_KICK, kickUser},
+	{http.MethodPost, []string{"announcements"}, permission.PERMISSION_ANNOUNCE, announce},
+	{http.MethodGet, []string{"channels"}, permission.PERMISSION_VIEW, listChannels},
+	{http.MethodGet, []string{"games"}, permission.PERMISSION_VIEW, listGames},
+	{http.MethodGet, []string{"bans"}, permission.PERMISSION_VIEW, listBans},
+	{http.MethodPost, []string{"bans"}, permission.PERMISSION_BAN, addBan},
+	{http.MethodDelete, []string{"bans", "*", "*"}, permission.PERMISSION_BAN, removeBan},
+	{http.MethodGet, []string{"versioncheck"}, permission.PERMISSION_CONFIG, listVersionChecks},
+}
+
+// Handler serves the admin API.
+func Handler() http.Handler {
+	return http.HandlerFunc(serve)
+}
+
+func serve(w http.ResponseWriter, r *http.Request) {
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	matched, args, methodAllowed := match(r.Method, segments)
+	if matched == nil {
+		if methodAllowed {
+			writeError(w, &Error{Message: "method not allowed", Status: http.StatusMethodNotAllowed})
+		} else {
+			writeError(w, &Error{Message: "not found", Status: http.StatusNotFound})
+		}
+		return
+	}
+
+	operator, err := authenticate(r)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Basic realm="gobncs", charset="UTF-8"`)
+		writeError(w, err)
+		return
+	}
+	if !permission.Allowed(operator, matched.permission) {
+		logger.Warn("permission denied", "operator", operator, "method", r.Method, "path", r.URL.Path)
+		writeError(w, &Error{Message: "permission denied", Status: http.StatusForbidden})
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, MAX_BODY_SIZE)
+	status, value, err := matched.handle(&request{Request: r, args: args, operator: operator})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, status, value)
+}
+
+// match finds the route for a path. If none matches, methodAllowed reports
+// whether the path exists for another method.
+func match(method string, segments []string) (*route, []string, bool) {
+	methodAllowed := false
+	for i := range routes {
+		args, ok := matchPath(routes[i].path, segments)
+		if !ok {
+			continue
+		}
+		if routes[i].method == method {
+			return &routes[i], args, false
+		}
+		methodAllowed = true
+	}
+	return nil, nil, methodAllowed
+}
+
+func matchPath(pattern []string, segments []string) ([]string, bool) {
+	if len(pattern) != len(segments) {
+		return nil, false
+	}
+	var args []string
+	for i, segment := range pattern {
+		switch {
+		case segment == "*" && segments[i] != "":
+			args = append(args, segments[i])
+		case segment != segments[i]:
+			return nil, false
+		}
+	}
+	return args, true
+}
+
+// authenticate checks the basic auth credentials against the account store.
+// Banned accounts are refused even if they hold permissions.
+func authenticate(r *http.Request) (string, error) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return "", &Error{Message: "authentication required", Status: http.StatusUnauthorized}
+	}
+	acct, err := account.CheckPassword(username, password)
+	if err != nil {
+		logger.Warn("authentication failed", "username", username, "remote", r.RemoteAddr, "error", err)
+		return "", &Error{Message: "invalid username or password", Status: http.StatusUnauthorized}
+	}
+	if _, banned := ban.Get(ban.KIND_ACCOUNT, acct.Username); banned {
+		logger.Warn("authentication refused; account banned", "username", acct.Username, "remote", r.RemoteAddr)
+		return "", &Error{Message: "account banned", Status: http.StatusForbidden}
+	}
+	return acct.Username, nil
+}
+
+// decode reads a JSON request body into value, rejecting unknown fields.
+func (r *request) decode(value any) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(value)
+	if errors.Is(err, io.EOF) {
+		return &Error{Message: "request body required", Status: http.StatusBadRequest}
+	}
+	if err != nil {
+		return &Error{Message: fmt.Sprintf("invalid request body: %v", err), Status: http.StatusBadRequest}
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	if value == nil {
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(value)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		logger.Error("admin request failed", "error", err)
+		apiErr = &Error{Message: "internal error", Status: http.StatusInternalServerError}
+	}
+	writeJSON(w, apiErr.Status, map[string]string{"error": apiErr.Message})
+}
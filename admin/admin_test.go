@@ -0,0 +1,243 @@
+package admin
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/carlbennett/gobncs/account"
+	"github.com/carlbennett/gobncs/ban"
+	"github.com/carlbennett/gobncs/channel"
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/game"
+	"github.com/carlbennett/gobncs/logging"
+	"github.com/carlbennett/gobncs/permission"
+)
+
+const testPassword = "password"
+
+// setup opens empty account and ban stores with an operator holding every
+// permission, a viewer and a banned operator.
+func setup(t *testing.T) {
+	t.Helper()
+	logging.Configure(io.Discard, logging.Options{})
+	dir := t.TempDir()
+	if err := account.Open(filepath.Join(dir, "accounts.json")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ban.Open(filepath.Join(dir, "bans.json")); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"ops", "viewer", "banned"} {
+		if _, err := account.Create(name, account.HashPassword(testPassword)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := ban.Add(ban.KIND_ACCOUNT, "banned", "testing", 0); err != nil {
+		t.Fatal(err)
+	}
+	permission.SetOperators(map[string]permission.Permission{
+		"banned": permission.PERMISSION_ALL,
+		"ops":    permission.PERMISSION_ALL,
+		"viewer": permission.PERMISSION_VIEW,
+	})
+	t.Cleanup(func() { permission.SetOperators(nil) })
+}
+
+// serveAs sends a request authenticated as username, or without credentials
+// if username is empty.
+func serveAs(t *testing.T, username string, method string, path string, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	r := httptest.NewRequest(method, path, reader)
+	if username != "" {
+		r.SetBasicAuth(username, testPassword)
+	}
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, r)
+	return w
+}
+
+func decodeBody(t *testing.T, w *httptest.ResponseRecorder, value any) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), value); err != nil {
+		t.Fatalf("invalid response body %q: %v", w.Body.String(), err)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	setup(t)
+
+	w := serveAs(t, "", http.MethodGet, "/clients", "")
+	if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("without credentials: expected 401 with a challenge, got %d", w.Code)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/clients", nil)
+	r.SetBasicAuth("ops", "wrong")
+	w = httptest.NewRecorder()
+	Handler().ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong password: expected 401, got %d", w.Code)
+	}
+
+	if w = serveAs(t, "nobody", http.MethodGet, "/clients", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("unknown account: expected 401, got %d", w.Code)
+	}
+	if w = serveAs(t, "banned", http.MethodGet, "/clients", ""); w.Code != http.StatusForbidden {
+		t.Errorf("banned account: expected 403, got %d", w.Code)
+	}
+	if w = serveAs(t, "ops", http.MethodGet, "/clients", ""); w.Code != http.StatusOK {
+		t.Errorf("operator: expected 200, got %d", w.Code)
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	setup(t)
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{http.MethodGet, "/clients", "", http.StatusOK},
+		{http.MethodGet, "/bans", "", http.StatusOK},
+		{http.MethodGet, "/channels", "", http.StatusOK},
+		{http.MethodGet, "/games", "", http.StatusOK},
+		{http.MethodGet, "/users/viewer", "", http.StatusOK},
+		{http.MethodPost, "/announcements", `{"text": "hello"}`, http.StatusForbidden},
+		{http.MethodPost, "/bans", `{"kind": "account", "target": "ops"}`, http.StatusForbidden},
+		{http.MethodDelete, "/bans/account/banned", "", http.StatusForbidden},
+		{http.MethodPost, "/users/ops/kick", "", http.StatusForbidden},
+		{http.MethodGet, "/versioncheck", "", http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		w := serveAs(t, "viewer", test.method, test.path, test.body)
+		if w.Code != test.status {
+			t.Errorf("%s %s as a viewer: expected %d, got %d (%s)", test.method, test.path, test.status, w.Code, w.Body)
+		}
+	}
+}
+
+func TestRouting(t *testing.T) {
+	setup(t)
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{http.MethodGet, "/nothing", "", http.StatusNotFound},
+		{http.MethodGet, "/users", "", http.StatusNotFound},
+		{http.MethodGet, "/users/nobody", "", http.StatusNotFound},
+		{http.MethodDelete, "/clients", "", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/clients/abc/kick", "", http.StatusBadRequest},
+		{http.MethodPost, "/clients/999999/kick", "", http.StatusNotFound},
+		{http.MethodPost, "/announcements", "", http.StatusBadRequest},
+		{http.MethodPost, "/announcements", `{"text": "hello", "extra": 1}`, http.StatusBadRequest},
+		{http.MethodPost, "/announcements", `{"text": "   "}`, http.StatusBadRequest},
+		{http.MethodPost, "/announcements", `{"text": "hello"}`, http.StatusNoContent},
+		{http.MethodPost, "/bans", `{"kind": "host", "target": "x"}`, http.StatusBadRequest},
+		{http.MethodPost, "/bans", `{"kind": "ip", "target": "not an address"}`, http.StatusBadRequest},
+		{http.MethodPost, "/bans", `{"kind": "ip", "target": "192.0.2.1", "duration": "-1h"}`, http.StatusBadRequest},
+		{http.MethodDelete, "/bans/ip/192.0.2.99", "", http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		w := serveAs(t, "ops", test.method, test.path, test.body)
+		if w.Code != test.status {
+			t.Errorf("%s %s: expected %d, got %d (%s)", test.method, test.path, test.status, w.Code, w.Body)
+		}
+	}
+}
+
+func TestBans(t *testing.T) {
+	setup(t)
+
+	w := serveAs(t, "ops", http.MethodPost, "/bans", `{"kind": "ip", "target": "::ffff:192.0.2.1", "reason": "spam", "duration": "1h"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d (%s)", w.Code, w.Body)
+	}
+	var result banResult
+	decodeBody(t, w, &result)
+	if result.Ban.Target != "192.0.2.1" || result.Ban.ExpiresAt == nil {
+		t.Errorf("expected a normalised, expiring ban, got %+v", result.Ban)
+	}
+
+	var list []banView
+	decodeBody(t, serveAs(t, "ops", http.MethodGet, "/bans", ""), &list)
+	if len(list) != 2 || list[0].Kind != ban.KIND_ACCOUNT || list[1].Target != "192.0.2.1" {
+		t.Fatalf("expected the account and address bans, got %+v", list)
+	}
+
+	if w = serveAs(t, "ops", http.MethodDelete, "/bans/ip/192.0.2.1", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d (%s)", w.Code, w.Body)
+	}
+	if _, banned := ban.Get(ban.KIND_IP, "192.0.2.1"); banned {
+		t.Error("ban was not removed")
+	}
+}
+
+func TestChannelsAndGames(t *testing.T) {
+	setup(t)
+	conn, peer := net.Pipe()
+	host := clientstate.NewClientState(conn)
+	t.Cleanup(func() {
+		channel.Leave(host)
+		game.Stop(host)
+		conn.Close()
+		peer.Close()
+	})
+
+	channel.Join("Lobby", channel.Member{Flags: 0x02, Ping: 35, State: host, Username: []byte("alice")})
+	var channels []channelView
+	decodeBody(t, serveAs(t, "viewer", http.MethodGet, "/channels", ""), &channels)
+	if len(channels) != 1 || channels[0].Name != "Lobby" || len(channels[0].Members) != 1 {
+		t.Fatalf("expected Lobby with one member, got %+v", channels)
+	}
+	if member := channels[0].Members[0]; member.Username != "alice" || member.Flags != 0x02 || member.Ping != 35 {
+		t.Errorf("unexpected member %+v", member)
+	}
+
+	channel.Leave(host)
+	err := game.Advertise(game.Game{
+		Host:     host,
+		HostName: "alice",
+		IP:       net.ParseIP("198.51.100.7"),
+		Name:     "1v1",
+		Password: "secret",
+		Port:     6112,
+		Product:  clientstate.PRODUCT_STAR,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := serveAs(t, "viewer", http.MethodGet, "/games", "")
+	if strings.Contains(w.Body.String(), "secret") {
+		t.Error("game password was shown")
+	}
+	var games []gameView
+	decodeBody(t, w, &games)
+	if len(games) != 1 {
+		t.Fatalf("expected one game, got %+v", games)
+	}
+	if g := games[0]; g.Name != "1v1" || g.Host != "alice" || g.Address != "198.51.100.7:6112" || !g.Private || g.Product != "STAR" {
+		t.Errorf("unexpected game %+v", g)
+	}
+
+	decodeBody(t, serveAs(t, "viewer", http.MethodGet, "/channels", ""), &channels)
+	if len(channels) != 0 {
+		t.Errorf("expected no channels once the host left, got %+v", channels)
+	}
+}
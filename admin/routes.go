@@ -0,0 +1,390 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/carlbennett/gobncs/account"
+	"github.com/carlbennett/gobncs/ban"
+	"github.com/carlbennett/gobncs/cdkey"
+	"github.com/carlbennett/gobncs/channel"
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/game"
+	"github.com/carlbennett/gobncs/permission"
+	"github.com/carlbennett/gobncs/server"
+	"github.com/carlbennett/gobncs/versioncheck"
+)
+
+type accountView struct {
+	CreatedAt   time.Time `json:"created_at"`
+	Email       string    `json:"email,omitempty"`
+	LastLogon   time.Time `json:"last_logon"`
+	Permissions []string  `json:"permissions"`
+	Username    string    `json:"username"`
+}
+
+type banView struct {
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // omitted for permanent bans
+	Kind      ban.Kind   `json:"kind"`
+	Reason    string     `json:"reason"`
+	Target    string     `json:"target"`
+}
+
+type channelView struct {
+	Members []memberView `json:"members"` // in the order they joined
+	Name    string       `json:"name"`
+}
+
+type memberView struct {
+	Flags    uint32 `json:"flags"`
+	Ping     uint32 `json:"ping"`
+	Username string `json:"username"`
+}
+
+type clientView struct {
+	Account     string `json:"account,omitempty"`
+	ID          uint64 `json:"id"`
+	Pending     int    `json:"pending"` // messages queued but not yet written
+	Phase       string `json:"phase"`
+	Ping        int32  `json:"ping"` // milliseconds; -1 until measured
+	Platform    string `json:"platform"`
+	Product     string `json:"product"`
+	Protocol    string `json:"protocol"`
+	Remote      string `json:"remote"`
+	VersionByte uint32 `json:"version_byte"`
+}
+
+type gameView struct {
+	Address string    `json:"address"` // players connect here
+	Created time.Time `json:"created"`
+	Host    string    `json:"host"`
+	Ladder  bool      `json:"ladder"`
+	Name    string    `json:"name"`
+	Private bool      `json:"private"` // the password itself is not shown
+	Product string    `json:"product"`
+	Type    uint16    `json:"type"`
+}
+
+type userView struct {
+	Account accountView  `json:"account"`
+	Ban     *banView     `json:"ban,omitempty"`
+	Clients []clientView `json:"clients"`
+}
+
+type versionCheckView struct {
+	ExeHash     uint32 `json:"exe_hash,omitempty"`
+	ExeVersion  uint32 `json:"exe_version,omitempty"`
+	MPQFileName string `json:"mpq_file_name"`
+	PatchPath   string `json:"patch_path,omitempty"`
+	ValueString string `json:"value_string"`
+	VersionByte uint32 `json:"version_byte"`
+}
+
+type kickRequest struct {
+	Reason string `json:"reason"`
+}
+
+type kickResult struct {
+	Kicked int `json:"kicked"`
+}
+
+type announceRequest struct {
+	Text string `json:"text"`
+}
+
+type banRequest struct {
+	Duration string   `json:"duration"` // e.g. "72h"; empty for a permanent ban
+	Kind     ban.Kind `json:"kind"`
+	Reason   string   `json:"reason"`
+	Target   string   `json:"target"`
+}
+
+type banResult struct {
+	Ban    banView `json:"ban"`
+	Kicked int     `json:"kicked"`
+}
+
+// maximum announcement length; longer chat events are cut off by clients
+const MAX_ANNOUNCEMENT_LENGTH = 200
+
+func listClients(r *request) (int, any, error) {
+	return http.StatusOK, clients(nil), nil
+}
+
+func kickClient(r *request) (int, any, error) {
+	id, err := strconv.ParseUint(r.args[0], 10, 64)
+	if err != nil {
+		return 0, nil, &Error{Message: fmt.Sprintf("invalid client id (%s)", r.args[0]), Status: http.StatusBadRequest}
+	}
+	reason, err := r.kickReason()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	kicked := server.Kick(nil, reason, func(state *clientstate.ClientState) bool {
+		return state.ID == id
+	})
+	if kicked == 0 {
+		return 0, nil, &Error{Message: "client not connected", Status: http.StatusNotFound}
+	}
+	logger.Info("client kicked", "operator", r.operator, "conn", id, "reason", reason)
+	return http.StatusOK, kickResult{Kicked: kicked}, nil
+}
+
+func getUser(r *request) (int, any, error) {
+	acct, ok := account.Get(r.args[0])
+	if !ok {
+		return 0, nil, &Error{Message: "account not found", Status: http.StatusNotFound}
+	}
+
+	view := userView{
+		Account: accountView{
+			CreatedAt:   acct.CreatedAt,
+			Email:       acct.Email,
+			LastLogon:   acct.LastLogon,
+			Permissions: permission.Get(acct.Username).Strings(),
+			Username:    acct.Username,
+		},
+		Clients: clients(func(state *clientstate.ClientState) bool {
+			return strings.EqualFold(string(state.Username), acct.Username)
+		}),
+	}
+	if entry, banned := ban.Get(ban.KIND_ACCOUNT, acct.Username); banned {
+		b := newBanView(entry)
+		view.Ban = &b
+	}
+	return http.StatusOK, view, nil
+}
+
+func kickUser(r *request) (int, any, error) {
+	reason, err := r.kickReason()
+	if err != nil {
+		return 0, nil, err
+	}
+	username := r.args[0]
+
+	kicked := server.Kick(nil, reason, func(state *clientstate.ClientState) bool {
+		return strings.EqualFold(string(state.Username), username)
+	})
+	if kicked == 0 {
+		return 0, nil, &Error{Message: "user not logged on", Status: http.StatusNotFound}
+	}
+	logger.Info("user kicked", "operator", r.operator, "username", username, "clients", kicked, "reason", reason)
+	return http.StatusOK, kickResult{Kicked: kicked}, nil
+}
+
+func announce(r *request) (int, any, error) {
+	var body announceRequest
+	if err := r.decode(&body); err != nil {
+		return 0, nil, err
+	}
+	text := strings.TrimSpace(body.Text)
+	if text == "" || len(text) > MAX_ANNOUNCEMENT_LENGTH {
+		return 0, nil, &Error{Message: fmt.Sprintf("text must be 1-%d characters", MAX_ANNOUNCEMENT_LENGTH), Status: http.StatusBadRequest}
+	}
+
+	if err := server.Broadcast(nil, text); err != nil {
+		return 0, nil, err
+	}
+	logger.Info("announcement sent", "operator", r.operator, "text", text)
+	return http.StatusNoContent, nil, nil
+}
+
+func listChannels(r *request) (int, any, error) {
+	views := []channelView{}
+	for _, c := range channel.List() {
+		view := channelView{Members: make([]memberView, len(c.Members)), Name: c.Name}
+		for i, m := range c.Members {
+			view.Members[i] = memberView{Flags: m.Flags, Ping: m.Ping, Username: string(m.Username)}
+		}
+		views = append(views, view)
+	}
+	return http.StatusOK, views, nil
+}
+
+func listGames(r *request) (int, any, error) {
+	views := []gameView{}
+	for _, g := range game.List() {
+		views = append(views, gameView{
+			Address: net.JoinHostPort(g.IP.String(), strconv.Itoa(int(g.Port))),
+			Created: g.Created,
+			Host:    g.HostName,
+			Ladder:  g.Ladder,
+			Name:    g.Name,
+			Private: g.Password != "",
+			Product: clientstate.ProductToCode(g.Product),
+			Type:    g.Type,
+		})
+	}
+	return http.StatusOK, views, nil
+}
+
+func listBans(r *request) (int, any, error) {
+	list := ban.List()
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Kind != list[j].Kind {
+			return list[i].Kind < list[j].Kind
+		}
+		return strings.ToLower(list[i].Target) < strings.ToLower(list[j].Target)
+	})
+	views := make([]banView, 0, len(list))
+	for _, entry := range list {
+		views = append(views, newBanView(entry))
+	}
+	return http.StatusOK, views, nil
+}
+
+// addBan bans an account or address and disconnects the clients it covers.
+func addBan(r *request) (int, any, error) {
+	var body banRequest
+	if err := r.decode(&body); err != nil {
+		return 0, nil, err
+	}
+	target, err := banTarget(body.Kind, body.Target)
+	if err != nil {
+		return 0, nil, err
+	}
+	var duration time.Duration
+	if body.Duration != "" {
+		duration, err = time.ParseDuration(body.Duration)
+		if err != nil || duration <= 0 {
+			return 0, nil, &Error{Message: fmt.Sprintf("invalid duration (%s)", body.Duration), Status: http.StatusBadRequest}
+		}
+	}
+
+	entry, err := ban.Add(body.Kind, target, body.Reason, duration)
+	if err != nil {
+		return 0, nil, err
+	}
+	kicked := server.Kick(nil, body.Reason, func(state *clientstate.ClientState) bool {
+		switch body.Kind {
+		case ban.KIND_IP:
+			return state.RemoteIP() == target
+		case ban.KIND_KEY:
+			identity, ok := cdkey.IdentityOf(state)
+			return ok && identity == target
+		default:
+			return strings.EqualFold(string(state.Username), target)
+		}
+	})
+	logger.Info("ban added", "operator", r.operator, "kind", body.Kind, "target", target, "duration", duration, "reason", body.Reason, "kicked", kicked)
+	return http.StatusCreated, banResult{Ban: newBanView(entry), Kicked: kicked}, nil
+}
+
+func removeBan(r *request) (int, any, error) {
+	kind := ban.Kind(r.args[0])
+	target, err := banTarget(kind, r.args[1])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	err = ban.Remove(kind, target)
+	if errors.Is(err, ban.ErrBanNotFound) {
+		return 0, nil, &Error{Message: "ban not found", Status: http.StatusNotFound}
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	logger.Info("ban removed", "operator", r.operator, "kind", kind, "target", target)
+	return http.StatusNoContent, nil, nil
+}
+
+func listVersionChecks(r *request) (int, any, error) {
+	views := map[string]versionCheckView{}
+	for product, value := range versioncheck.ListSettings() {
+		views[clientstate.ProductToCode(product)] = versionCheckView{
+			ExeHash:     value.ExeHash,
+			ExeVersion:  value.ExeVersion,
+			MPQFileName: value.MPQFileName,
+			PatchPath:   value.PatchPath,
+			ValueString: value.ValueString,
+			VersionByte: value.VersionByte,
+		}
+	}
+	return http.StatusOK, views, nil
+}
+
+// kickReason reads the optional reason of a kick request.
+func (r *request) kickReason() (string, error) {
+	if r.ContentLength == 0 {
+		return "", nil
+	}
+	var body kickRequest
+	if err := r.decode(&body); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(body.Reason), nil
+}
+
+// clients lists connected clients matching filter, which is called with the
+// client's read lock held, ordered by connection id.
+func clients(filter func(state *clientstate.ClientState) bool) []clientView {
+	views := []clientView{}
+	clientstate.EachClientState(func(state *clientstate.ClientState) bool {
+		state.RLock()
+		defer state.RUnlock()
+		if filter != nil && !filter(state) {
+			return true
+		}
+		views = append(views, clientView{
+			Account:     string(state.Username),
+			ID:          state.ID,
+			Pending:     state.Pending(),
+			Phase:       clientstate.PhaseToName(state.Phase),
+			Ping:        state.Ping,
+			Platform:    clientstate.PlatformToName(state.Platform),
+			Product:     clientstate.ProductToCode(state.Product),
+			Protocol:    clientstate.ProtocolTypeToName(state.ProtocolType),
+			Remote:      state.RemoteAddr.String(),
+			VersionByte: state.VersionId,
+		})
+		return true
+	})
+	sort.Slice(views, func(i, j int) bool {
+		return views[i].ID < views[j].ID
+	})
+	return views
+}
+
+// banTarget validates a ban target and normalises addresses the way
+// ClientState.RemoteIP formats them and keys the way cdkey identifies them.
+func banTarget(kind ban.Kind, target string) (string, error) {
+	switch kind {
+	case ban.KIND_ACCOUNT:
+		if err := account.ValidateUsername(target); err != nil {
+			return "", &Error{Message: fmt.Sprintf("invalid account (%s)", target), Status: http.StatusBadRequest}
+		}
+		return target, nil
+	case ban.KIND_IP:
+		ip := net.ParseIP(target)
+		if ip == nil {
+			return "", &Error{Message: fmt.Sprintf("invalid address (%s)", target), Status: http.StatusBadRequest}
+		}
+		return ip.String(), nil
+	case ban.KIND_KEY:
+		// hashed key identities are "product:public value" in hex
+		identity := cdkey.PlainKeyIdentity([]byte(target))
+		if identity == "" {
+			return "", &Error{Message: fmt.Sprintf("invalid cd-key (%s)", target), Status: http.StatusBadRequest}
+		}
+		return identity, nil
+	default:
+		return "", &Error{Message: fmt.Sprintf("unknown ban kind (%s); expected %s, %s or %s", kind, ban.KIND_ACCOUNT, ban.KIND_IP, ban.KIND_KEY), Status: http.StatusBadRequest}
+	}
+}
+
+func newBanView(entry ban.Ban) banView {
+	view := banView{CreatedAt: entry.CreatedAt, Kind: entry.Kind, Reason: entry.Reason, Target: entry.Target}
+	if !entry.ExpiresAt.IsZero() {
+		expires := entry.ExpiresAt
+		view.ExpiresAt = &expires
+	}
+	return view
+}
@@ -0,0 +1,175 @@
+package ban
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Kind string
+
+const (
+	KIND_ACCOUNT Kind = "account"
+	KIND_IP      Kind = "ip"
+	KIND_KEY     Kind = "key" // a CD-key identity, see cdkey.PlainKeyIdentity and cdkey.HashedKeyIdentity
+)
+
+type Ban struct {
+	CreatedAt time.Time
+	ExpiresAt time.Time // zero for permanent bans
+	Kind      Kind
+	Reason    string
+	Target    string
+}
+
+var ErrBanNotFound = errors.New("ban not found")
+
+var (
+	bans      = map[string]*Ban{}
+	bansMutex = sync.RWMutex{}
+	pending   = map[string]*Ban{} // changes not yet written to disk; nil marks a removal
+	storePath string
+)
+
+func key(kind Kind, target string) string {
+	return string(kind) + ":" + strings.ToLower(target)
+}
+
+func (b *Ban) Expired() bool {
+	return !b.ExpiresAt.IsZero() && time.Now().After(b.ExpiresAt)
+}
+
+// Open loads the ban list from path and persists every later change to it.
+// A missing file is treated as an empty ban list. Changes that could not be
+// written yet are applied over the loaded list, so reopening the file does not
+// lose them.
+func Open(path string) error {
+	loaded := map[string]*Ban{}
+	raw, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to read ban list: %v", err)
+	}
+	if err == nil {
+		var list []*Ban
+		if err = json.Unmarshal(raw, &list); err != nil {
+			return fmt.Errorf("failed to parse ban list: %v", err)
+		}
+		for _, entry := range list {
+			loaded[key(entry.Kind, entry.Target)] = entry
+		}
+	}
+
+	bansMutex.Lock()
+	defer bansMutex.Unlock()
+	for k, entry := range pending {
+		if entry == nil {
+			delete(loaded, k)
+		} else {
+			loaded[k] = entry
+		}
+	}
+	bans = loaded
+	storePath = path
+	if len(pending) > 0 {
+		return save()
+	}
+	return nil
+}
+
+// Flush writes the ban list to disk.
+func Flush() error {
+	bansMutex.Lock()
+	defer bansMutex.Unlock()
+	return save()
+}
+
+// save must be called with bansMutex held.
+func save() error {
+	if storePath == "" {
+		return nil
+	}
+
+	raw, err := json.MarshalIndent(listLocked(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := storePath + ".tmp"
+	if err = os.WriteFile(tmp, raw, 0600); err != nil {
+		return fmt.Errorf("failed to write ban list: %v", err)
+	}
+	if err = os.Rename(tmp, storePath); err != nil {
+		return err
+	}
+	pending = map[string]*Ban{}
+	return nil
+}
+
+func Add(kind Kind, target string, reason string, duration time.Duration) (Ban, error) {
+	entry := &Ban{
+		CreatedAt: time.Now().UTC(),
+		Kind:      kind,
+		Reason:    reason,
+		Target:    target,
+	}
+	if duration > 0 {
+		entry.ExpiresAt = entry.CreatedAt.Add(duration)
+	}
+
+	bansMutex.Lock()
+	defer bansMutex.Unlock()
+	k := key(kind, target)
+	bans[k] = entry
+	pending[k] = entry
+	return *entry, save()
+}
+
+func Remove(kind Kind, target string) error {
+	bansMutex.Lock()
+	defer bansMutex.Unlock()
+
+	k := key(kind, target)
+	if _, ok := bans[k]; !ok {
+		return ErrBanNotFound
+	}
+	delete(bans, k)
+	pending[k] = nil
+	return save()
+}
+
+func Get(kind Kind, target string) (Ban, bool) {
+	bansMutex.RLock()
+	defer bansMutex.RUnlock()
+
+	entry, ok := bans[key(kind, target)]
+	if !ok || entry.Expired() {
+		return Ban{}, false
+	}
+	return *entry, true
+}
+
+func List() []Ban {
+	bansMutex.RLock()
+	defer bansMutex.RUnlock()
+
+	list := make([]Ban, 0, len(bans))
+	for _, entry := range listLocked() {
+		list = append(list, *entry)
+	}
+	return list
+}
+
+func listLocked() []*Ban {
+	list := make([]*Ban, 0, len(bans))
+	for _, entry := range bans {
+		if !entry.Expired() {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
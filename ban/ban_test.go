@@ -0,0 +1,41 @@
+package ban
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenKeepsUnsavedChanges(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bans.json")
+	if err := Open(path); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		bansMutex.Lock()
+		bans, pending, storePath = map[string]*Ban{}, map[string]*Ban{}, ""
+		bansMutex.Unlock()
+	})
+
+	// a directory in the way of the temporary file makes every save fail
+	if err := os.Mkdir(path+".tmp", 0700); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Add(KIND_IP, "192.0.2.1", "flooding", 0); err == nil {
+		t.Fatal("expected the save to fail")
+	}
+	if err := os.Remove(path + ".tmp"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Open(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := Get(KIND_IP, "192.0.2.1"); !ok {
+		t.Fatal("reopening the ban list lost a ban that was not saved")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("reopening did not save the ban: %v", err)
+	}
+}
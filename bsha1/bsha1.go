@@ -0,0 +1,76 @@
+// Package bsha1 implements the non-standard SHA-1 variant used by Battle.net
+// for password hashing (also known as "broken SHA-1" or XSHA-1).
+package bsha1
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+const Size = 20
+
+func Sum(data []byte) [Size]byte {
+	state := [5]uint32{0x67452301, 0xEFCDAB89, 0x98BADCFE, 0x10325476, 0xC3D2E1F0}
+
+	for len(data) > 0 {
+		n := len(data)
+		if n > 64 {
+			n = 64
+		}
+		var block [64]byte
+		copy(block[:], data[:n])
+		transform(&state, &block)
+		data = data[n:]
+	}
+
+	var sum [Size]byte
+	for i, value := range state {
+		binary.LittleEndian.PutUint32(sum[i*4:], value)
+	}
+	return sum
+}
+
+// SumTokens computes the hash over the concatenation of the given tokens (as
+// little-endian DWORDs) and data, as used by the logon challenge.
+func SumTokens(data []byte, tokens ...uint32) [Size]byte {
+	buffer := make([]byte, 4*len(tokens), 4*len(tokens)+len(data))
+	for i, token := range tokens {
+		binary.LittleEndian.PutUint32(buffer[i*4:], token)
+	}
+	return Sum(append(buffer, data...))
+}
+
+func transform(state *[5]uint32, block *[64]byte) {
+	var w [80]uint32
+	for i := 0; i < 16; i++ {
+		w[i] = binary.LittleEndian.Uint32(block[i*4:])
+	}
+	for i := 0; i < 64; i++ {
+		// the original implementation swaps the rotate operands, rotating the
+		// constant 1 by the mixed word instead of the other way around
+		w[i+16] = bits.RotateLeft32(1, int((w[i]^w[i+8]^w[i+2]^w[i+13])%32))
+	}
+
+	a, b, c, d, e := state[0], state[1], state[2], state[3], state[4]
+	for i := 0; i < 80; i++ {
+		var f, k uint32
+		switch {
+		case i < 20:
+			f, k = (b&c)|(^b&d), 0x5A827999
+		case i < 40:
+			f, k = b^c^d, 0x6ED9EBA1
+		case i < 60:
+			f, k = (b&c)|(b&d)|(c&d), 0x8F1BBCDC
+		default:
+			f, k = b^c^d, 0xCA62C1D6
+		}
+		temp := bits.RotateLeft32(a, 5) + f + e + k + w[i]
+		a, b, c, d, e = temp, a, bits.RotateLeft32(b, 30), c, d
+	}
+
+	state[0] += a
+	state[1] += b
+	state[2] += c
+	state[3] += d
+	state[4] += e
+}
@@ -0,0 +1,167 @@
+package cdkey
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/carlbennett/gobncs/ban"
+	"github.com/carlbennett/gobncs/clientstate"
+)
+
+type Result uint32
+
+const (
+	RESULT_OK          Result = 0x01 // Ok
+	RESULT_INVALID     Result = 0x02 // Invalid key
+	RESULT_BAD_PRODUCT Result = 0x03 // Bad product
+	RESULT_BANNED      Result = 0x04 // Banned
+	RESULT_IN_USE      Result = 0x05 // In use
+)
+
+var (
+	ErrKeyBanned     = errors.New("cd-key banned")
+	ErrKeyInUse      = errors.New("cd-key in use")
+	ErrSpawnLimit    = errors.New("cd-key spawn limit reached")
+	ErrSpawnDisabled = errors.New("product does not support spawned installs")
+)
+
+type license struct {
+	holder *clientstate.ClientState
+	owner  string
+	spawns map[*clientstate.ClientState]struct{}
+}
+
+var (
+	// number of spawned installs that may be online concurrently under one key
+	maxSpawnsPerKey = 4
+
+	licenses      = map[string]*license{}
+	licenseKeys   = map[*clientstate.ClientState]string{}
+	licensesMutex = sync.Mutex{}
+)
+
+// Identity for keys sent in plain text (SID_CDKEY).
+func PlainKeyIdentity(key []byte) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(string(key)))
+}
+
+// Identity for hashed keys (SID_CDKEY2, SID_AUTH_CHECK).
+func HashedKeyIdentity(product uint32, publicValue uint32) string {
+	return fmt.Sprintf("%08X:%08X", product, publicValue)
+}
+
+func SpawnSupported(product clientstate.Product) bool {
+	switch product {
+	case clientstate.PRODUCT_JSTR, clientstate.PRODUCT_STAR, clientstate.PRODUCT_W2BN:
+		return true
+	default:
+		return false
+	}
+}
+
+func SetMaxSpawnsPerKey(value int) {
+	licensesMutex.Lock()
+	defer licensesMutex.Unlock()
+	maxSpawnsPerKey = value
+}
+
+// KeyCount returns the number of CD-keys a client of the product sends.
+// Expansions send the key of the original game followed by their own.
+func KeyCount(product clientstate.Product) int {
+	switch product {
+	case clientstate.PRODUCT_D2XP, clientstate.PRODUCT_W3XP:
+		return 2
+	case clientstate.PRODUCT_D2DV, clientstate.PRODUCT_JSTR, clientstate.PRODUCT_SEXP, clientstate.PRODUCT_STAR, clientstate.PRODUCT_W2BN, clientstate.PRODUCT_WAR3:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Acquire registers the key for the connection. A key may be held by one full
+// install and at most the configured number of spawned installs at the same time. The
+// returned string is the key owner name of the conflicting holder, if any.
+func Acquire(state *clientstate.ClientState, identity string, owner string, spawn bool) (string, error) {
+	if spawn && !SpawnSupported(state.Product) {
+		return "", ErrSpawnDisabled
+	}
+	if Banned(identity) {
+		return "", ErrKeyBanned
+	}
+
+	licensesMutex.Lock()
+	defer licensesMutex.Unlock()
+
+	releaseLocked(state)
+
+	entry, ok := licenses[identity]
+	if !ok {
+		entry = &license{spawns: map[*clientstate.ClientState]struct{}{}}
+		licenses[identity] = entry
+	}
+
+	if spawn {
+		if len(entry.spawns) >= maxSpawnsPerKey {
+			return entry.owner, ErrSpawnLimit
+		}
+		entry.spawns[state] = struct{}{}
+	} else {
+		if entry.holder != nil {
+			return entry.owner, ErrKeyInUse
+		}
+		entry.holder = state
+		entry.owner = owner
+	}
+
+	licenseKeys[state] = identity
+	return "", nil
+}
+
+// Banned reports whether a key identity is banned.
+func Banned(identity string) bool {
+	_, banned := ban.Get(ban.KIND_KEY, identity)
+	return banned
+}
+
+// IdentityOf returns the identity of the key a client holds or shares as a
+// spawn.
+func IdentityOf(state *clientstate.ClientState) (string, bool) {
+	licensesMutex.Lock()
+	defer licensesMutex.Unlock()
+	identity, ok := licenseKeys[state]
+	return identity, ok
+}
+
+func Release(state *clientstate.ClientState) {
+	licensesMutex.Lock()
+	defer licensesMutex.Unlock()
+	releaseLocked(state)
+}
+
+func releaseLocked(state *clientstate.ClientState) {
+	identity, ok := licenseKeys[state]
+	if !ok {
+		return
+	}
+	delete(licenseKeys, state)
+
+	entry := licenses[identity]
+	if entry.holder == state {
+		entry.holder = nil
+	}
+	delete(entry.spawns, state)
+	if entry.holder == nil && len(entry.spawns) == 0 {
+		delete(licenses, identity)
+	}
+}
+
+func SpawnCount(identity string) int {
+	licensesMutex.Lock()
+	defer licensesMutex.Unlock()
+	if entry, ok := licenses[identity]; ok {
+		return len(entry.spawns)
+	}
+	return 0
+}
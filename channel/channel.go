@@ -0,0 +1,139 @@
+// Package channel keeps the chat channels and the clients in them. Members are
+// recorded as they were when they joined, so the channels can be read and
+// messaged without taking any client's lock.
+package channel
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/carlbennett/gobncs/clientstate"
+)
+
+const NAME_MAX_LENGTH = 31
+
+type Member struct {
+	Flags      uint32
+	Ping       uint32
+	State      *clientstate.ClientState
+	Statstring []byte
+	Username   []byte
+}
+
+type Channel struct {
+	Members []Member // in the order they joined
+	Name    string
+}
+
+var (
+	channels      = map[string]*Channel{} // keyed by lowercased name
+	memberships   = map[*clientstate.ClientState]string{}
+	channelsMutex = sync.RWMutex{}
+)
+
+func key(name string) string {
+	return strings.ToLower(name)
+}
+
+// Join moves a member into the named channel, creating it if needed, and
+// returns the channel as it is after the join along with the name of the
+// channel the member left, if any.
+func Join(name string, member Member) (Channel, string) {
+	channelsMutex.Lock()
+	defer channelsMutex.Unlock()
+
+	left := ""
+	if current, ok := memberships[member.State]; ok {
+		left = leaveLocked(member.State, current)
+	}
+
+	c, ok := channels[key(name)]
+	if !ok {
+		c = &Channel{Name: name}
+		channels[key(name)] = c
+	}
+	c.Members = append(c.Members, member)
+	memberships[member.State] = key(name)
+	return copyChannel(c), left
+}
+
+// Leave removes a client from its channel and returns the channel as it is
+// after the client left. Empty channels are removed.
+func Leave(state *clientstate.ClientState) (Channel, bool) {
+	channelsMutex.Lock()
+	defer channelsMutex.Unlock()
+
+	current, ok := memberships[state]
+	if !ok {
+		return Channel{}, false
+	}
+	name := leaveLocked(state, current)
+	if c, ok := channels[current]; ok {
+		return copyChannel(c), true
+	}
+	return Channel{Name: name}, true
+}
+
+// leaveLocked must be called with channelsMutex held. It returns the name of
+// the channel that was left.
+func leaveLocked(state *clientstate.ClientState, k string) string {
+	delete(memberships, state)
+	c, ok := channels[k]
+	if !ok {
+		return ""
+	}
+	for i, member := range c.Members {
+		if member.State == state {
+			c.Members = append(c.Members[:i:i], c.Members[i+1:]...)
+			break
+		}
+	}
+	if len(c.Members) == 0 {
+		delete(channels, k)
+	}
+	return c.Name
+}
+
+// Of returns the channel a client is in.
+func Of(state *clientstate.ClientState) (Channel, bool) {
+	channelsMutex.RLock()
+	defer channelsMutex.RUnlock()
+	c, ok := channels[memberships[state]]
+	if !ok {
+		return Channel{}, false
+	}
+	return copyChannel(c), true
+}
+
+// Find looks up a member of any channel by username, ignoring case.
+func Find(username string) (Member, string, bool) {
+	channelsMutex.RLock()
+	defer channelsMutex.RUnlock()
+	for _, c := range channels {
+		for _, member := range c.Members {
+			if strings.EqualFold(string(member.Username), username) {
+				return member, c.Name, true
+			}
+		}
+	}
+	return Member{}, "", false
+}
+
+// List returns every channel, sorted by name.
+func List() []Channel {
+	channelsMutex.RLock()
+	defer channelsMutex.RUnlock()
+	list := make([]Channel, 0, len(channels))
+	for _, c := range channels {
+		list = append(list, copyChannel(c))
+	}
+	sort.Slice(list, func(i, j int) bool { return key(list[i].Name) < key(list[j].Name) })
+	return list
+}
+
+func copyChannel(c *Channel) Channel {
+	copied := Channel{Members: make([]Member, len(c.Members)), Name: c.Name}
+	copy(copied.Members, c.Members)
+	return copied
+}
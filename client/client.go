@@ -0,0 +1,332 @@
+// Package client implements the client side of the Battle.net protocol, for
+// bots and for exercising a running server.
+package client
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/carlbennett/gobncs/bsha1"
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/codec"
+	"github.com/carlbennett/gobncs/message"
+)
+
+const DEFAULT_TIMEOUT = 10 * time.Second
+
+const EVENT_QUEUE_SIZE = 64
+
+var ErrClosed = errors.New("connection closed")
+
+type Config struct {
+	ClientToken uint32 // zero picks a random token
+	Country     string
+	CountryAbbr string
+	ExeHash     uint32
+	ExeInfo     string
+	ExeVersion  uint32
+	KeyOwner    string
+	Keys        []codec.AuthCheckKey
+	Password    string
+	Platform    clientstate.Platform
+	Product     clientstate.Product
+	Spawn       bool
+	Timeout     time.Duration // how long to wait for each reply; zero means DEFAULT_TIMEOUT
+	Username    string
+	VersionByte uint32
+}
+
+type ChatEvent struct {
+	EventId  uint32
+	Flags    uint32
+	Ping     uint32
+	Text     string
+	Username string
+}
+
+// ResultError is returned when the server rejects a step of the logon.
+type ResultError struct {
+	Info   string
+	ID     message.MessageId
+	Result uint32
+}
+
+func (e *ResultError) Error() string {
+	if e.Info != "" {
+		return fmt.Sprintf("%s rejected (result 0x%X: %s)", message.MessageIdToName(e.ID), e.Result, e.Info)
+	}
+	return fmt.Sprintf("%s rejected (result 0x%X)", message.MessageIdToName(e.ID), e.Result)
+}
+
+type Client struct {
+	AccountName string
+	UniqueName  string
+
+	closeOnce   sync.Once
+	config      Config
+	conn        net.Conn
+	done        chan struct{}
+	err         error
+	events      chan ChatEvent
+	replies     chan *message.Message
+	serverToken uint32
+	writeMutex  sync.Mutex
+}
+
+func Dial(address string, config Config) (*Client, error) {
+	conn, err := net.DialTimeout("tcp", address, timeout(config))
+	if err != nil {
+		return nil, err
+	}
+	c, err := NewClient(conn, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// NewClient selects the game protocol on an established connection and starts
+// reading from it.
+func NewClient(conn net.Conn, config Config) (*Client, error) {
+	if config.ClientToken == 0 {
+		config.ClientToken = rand.Uint32()
+	}
+
+	c := &Client{
+		config:  config,
+		conn:    conn,
+		done:    make(chan struct{}),
+		events:  make(chan ChatEvent, EVENT_QUEUE_SIZE),
+		replies: make(chan *message.Message, EVENT_QUEUE_SIZE),
+	}
+
+	_, err := conn.Write([]byte{byte(clientstate.PROTOCOL_TYPE_GAME)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to write protocol type: %v", err)
+	}
+
+	go c.readMessages()
+	return c, nil
+}
+
+func timeout(config Config) time.Duration {
+	if config.Timeout <= 0 {
+		return DEFAULT_TIMEOUT
+	}
+	return config.Timeout
+}
+
+// Events returns the chat events received from the server. The channel is
+// closed when the connection ends; it must be drained, as a full queue holds
+// up every other message.
+func (c *Client) Events() <-chan ChatEvent {
+	return c.events
+}
+
+// Err returns the error that ended the connection, if any.
+func (c *Client) Err() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return nil
+	}
+}
+
+func (c *Client) Close() error {
+	return c.fail(nil)
+}
+
+func (c *Client) fail(err error) error {
+	c.closeOnce.Do(func() {
+		c.err = err
+		close(c.done)
+	})
+	return c.conn.Close()
+}
+
+func (c *Client) Send(p codec.Payload) error {
+	m, err := codec.Encode(p)
+	if err != nil {
+		return err
+	}
+
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	return message.WriteMessage(c.conn, m)
+}
+
+// Handshake identifies the client with SID_AUTH_INFO and passes the version
+// and CD-key check with SID_AUTH_CHECK.
+func (c *Client) Handshake() error {
+	err := c.Send(codec.ClientSID_AUTH_INFO{
+		Country:     []byte(c.config.Country),
+		CountryAbbr: []byte(c.config.CountryAbbr),
+		Platform:    codec.FourCC(c.config.Platform),
+		Product:     codec.FourCC(c.config.Product),
+		VersionByte: c.config.VersionByte,
+	})
+	if err != nil {
+		return err
+	}
+
+	var info codec.ServerSID_AUTH_INFO
+	err = c.expect(&info)
+	if err != nil {
+		return err
+	}
+	c.serverToken = info.ServerToken
+
+	err = c.Send(codec.ClientSID_AUTH_CHECK{
+		ClientToken: c.config.ClientToken,
+		ExeHash:     c.config.ExeHash,
+		ExeInfo:     []byte(c.config.ExeInfo),
+		ExeVersion:  c.config.ExeVersion,
+		KeyCount:    uint32(len(c.config.Keys)),
+		KeyOwner:    []byte(c.config.KeyOwner),
+		Keys:        c.config.Keys,
+		Spawn:       c.config.Spawn,
+	})
+	if err != nil {
+		return err
+	}
+
+	var check codec.ServerSID_AUTH_CHECK
+	err = c.expect(&check)
+	if err != nil {
+		return err
+	}
+	if check.Result != 0 {
+		return &ResultError{ID: message.SID_AUTH_CHECK, Info: string(check.Info), Result: check.Result}
+	}
+
+	return nil
+}
+
+// Logon proves the account password with SID_LOGONRESPONSE2.
+func (c *Client) Logon() error {
+	passwordHash := bsha1.Sum([]byte(strings.ToLower(c.config.Password)))
+	err := c.Send(codec.ClientSID_LOGONRESPONSE2{
+		ClientToken:   c.config.ClientToken,
+		PasswordProof: bsha1.SumTokens(passwordHash[:], c.config.ClientToken, c.serverToken),
+		ServerToken:   c.serverToken,
+		Username:      []byte(c.config.Username),
+	})
+	if err != nil {
+		return err
+	}
+
+	var reply codec.ServerSID_LOGONRESPONSE2
+	err = c.expect(&reply)
+	if err != nil {
+		return err
+	}
+	if reply.Status != 0 {
+		return &ResultError{ID: message.SID_LOGONRESPONSE2, Info: string(reply.Info), Result: reply.Status}
+	}
+
+	return nil
+}
+
+// EnterChat enters the chat environment and, if channel is not empty, joins
+// it.
+func (c *Client) EnterChat(channel string) error {
+	err := c.Send(codec.ClientSID_ENTERCHAT{Username: []byte(c.config.Username)})
+	if err != nil {
+		return err
+	}
+
+	var reply codec.ServerSID_ENTERCHAT
+	err = c.expect(&reply)
+	if err != nil {
+		return err
+	}
+	c.AccountName = string(reply.AccountName)
+	c.UniqueName = string(reply.UniqueName)
+
+	if channel == "" {
+		return nil
+	}
+	return c.Send(codec.ClientSID_JOINCHANNEL{Flags: 0x01, Channel: []byte(channel)}) // first join
+}
+
+func (c *Client) SendChat(text string) error {
+	return c.Send(codec.ClientSID_CHATCOMMAND{Text: []byte(text)})
+}
+
+// expect waits for the reply matching p and decodes it. Other replies that
+// arrive in the meantime are discarded.
+func (c *Client) expect(p codec.Payload) error {
+	timer := time.NewTimer(timeout(c.config))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			if c.err != nil {
+				return c.err
+			}
+			return ErrClosed
+		case <-timer.C:
+			return fmt.Errorf("timed out waiting for %s", message.MessageIdToName(p.MessageID()))
+		case m := <-c.replies:
+			if m.ID == p.MessageID() {
+				return codec.Decode(m, p)
+			}
+		}
+	}
+}
+
+func (c *Client) readMessages() {
+	defer close(c.events)
+
+	reader := message.NewReader(c.conn)
+	for {
+		m, err := reader.ReadMessage()
+		if err != nil {
+			c.fail(err)
+			return
+		}
+
+		switch m.ID {
+		case message.SID_NULL:
+		case message.SID_PING:
+			var ping codec.ServerSID_PING
+			if err = codec.Decode(m, &ping); err == nil {
+				err = c.Send(codec.ClientSID_PING{Cookie: ping.Cookie})
+			}
+		case message.SID_CHATEVENT:
+			var event codec.ServerSID_CHATEVENT
+			if err = codec.Decode(m, &event); err == nil {
+				select {
+				case c.events <- ChatEvent{
+					EventId:  event.EventId,
+					Flags:    event.Flags,
+					Ping:     event.Ping,
+					Text:     string(event.Text),
+					Username: string(event.Username),
+				}:
+				case <-c.done:
+					return
+				}
+			}
+		default:
+			// replies nobody is waiting for must not hold up pings
+			select {
+			case c.replies <- m:
+			default:
+			}
+		}
+
+		if err != nil {
+			c.fail(fmt.Errorf("failed to handle %s: %v", message.MessageIdToName(m.ID), err))
+			return
+		}
+	}
+}
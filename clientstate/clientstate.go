@@ -1,18 +1,47 @@
 package clientstate
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/carlbennett/gobncs/message"
 )
 
 type (
+	Capabilities uint32
+	Phase        byte
 	Platform     uint32
 	Product      uint32
 	ProtocolType byte
 )
 
+const (
+	CAPABILITY_CHAT         Capabilities = 0x00000001 // May enter chat
+	CAPABILITY_CREATE_GAMES Capabilities = 0x00000002 // May create (not only join) games
+	CAPABILITY_LADDER       Capabilities = 0x00000004 // May play ladder games
+)
+
+const (
+	PHASE_AWAITING_PROTOCOL      Phase = 0x00 // Waiting for the protocol type byte
+	PHASE_AWAITING_AUTH_INFO     Phase = 0x01 // Waiting for SID_AUTH_INFO or SID_CLIENTID(2)
+	PHASE_AWAITING_VERSION_CHECK Phase = 0x02 // Waiting for the version check to complete
+	PHASE_AWAITING_LOGON         Phase = 0x03 // Waiting for CD-keys and account logon
+	PHASE_CHAT                   Phase = 0x04 // Logged on and in chat
+	PHASE_GAME                   Phase = 0x05 // Logged on and in a game
+)
+
+const (
+	PROTOCOL_TYPE_GAME  ProtocolType = 0x01 // Game protocol
+	PROTOCOL_TYPE_BNFTP ProtocolType = 0x02 // Battle.net file transfer protocol
+	PROTOCOL_TYPE_CHAT  ProtocolType = 0x03 // Telnet chat protocol
+)
+
 const (
 	PLATFORM_IX86 Platform = 0x49583836 // Windows (x86)
 	PLATFORM_PMAC Platform = 0x504D4143 // macOS (PowerPC)
@@ -37,28 +66,107 @@ const (
 	PRODUCT_ZERO Product = 0x00000000 // Null (Zero)
 )
 
+// ClientState is owned by the connection's dispatcher goroutine, which holds
+// the write lock while it handles a message. Other goroutines must hold the
+// read lock while reading fields.
 type ClientState struct {
+	sync.RWMutex
+
+	Capabilities         Capabilities
+	CDKeyHash            [20]byte
+	CDKeyOwner           []byte
 	ClientLocalIP        uint32
+	ClientToken          uint32
 	Conn                 net.Conn
 	CountryCode          []byte
 	CountryCodeAbbr      []byte
 	CountryName          []byte
 	CountryNameAbbr      []byte
+	CountryNameLocal     []byte
+	ExeHash              uint32
+	ExeInfo              []byte
+	ExeVersion           uint32
+	ExtraWorkPending     bool   // an extra work archive was sent and its result not yet received
+	GamePort             uint16 // port the client hosts games on, from SID_NETGAMEPORT
+	ID                   uint64 // unique for the life of the process, for correlating log records
+	LANComputerName      []byte
+	LANUsername          []byte
+	LocaleLanguageAbbr   []byte
 	LocaleSystemLCID     uint32
 	LocaleUserLanguageId uint32
 	LocaleUserLCID       uint32
 	Ping                 int32
+	Phase                Phase
 	PingCookie           uint32
+	PingSent             time.Time // when PingCookie was sent, to measure Ping
 	Platform             Platform
 	Product              Product
 	ProtocolType         ProtocolType
+	Registration         Registration
 	RemoteAddr           net.Addr
+	ServerToken          uint32
+	Spawn                bool
+	Statstring           []byte // shown to other users in chat, from SID_ENTERCHAT
+	SystemInfo           SystemInfo
 	TimezoneBias         int32
+	UDPValue             uint32
 	Username             []byte
+	VersionChecked       bool
 	VersionId            uint32 // also known as "version byte" in other software
+	VersioningStarted    bool   // SID_STARTVERSIONING handed out a CheckRevision challenge
+
+	closeOnce sync.Once
+	done      chan struct{}
+	outbound  chan *message.Message
+}
+
+// sent by legacy clients in SID_CLIENTID and SID_CLIENTID2
+type Registration struct {
+	AccountNumber uint32
+	Authority     uint32
+	Token         uint32
+	Version       uint32
+}
+
+// sent by legacy clients in SID_SYSTEMINFO
+type SystemInfo struct {
+	FreeDiskSpace         uint32
+	NumberOfProcessors    uint32
+	ProcessorArchitecture uint32
+	ProcessorLevel        uint32
+	ProcessorTiming       uint32
+	TotalPageFile         uint32
+	TotalPhysicalMemory   uint32
+}
+
+// number of messages that may be queued for a client before it is
+// considered too slow and disconnected
+const OUTBOUND_QUEUE_SIZE = 256
+
+var (
+	ErrConnectionClosed = errors.New("connection closed")
+	ErrSendQueueFull    = errors.New("send queue full")
+)
+
+var (
+	clientStates = sync.Map{}
+	lastID       uint64
+)
+
+var phaseNames = map[Phase]string{
+	PHASE_AWAITING_PROTOCOL:      "awaiting protocol",
+	PHASE_AWAITING_AUTH_INFO:     "awaiting auth info",
+	PHASE_AWAITING_VERSION_CHECK: "awaiting version check",
+	PHASE_AWAITING_LOGON:         "awaiting logon",
+	PHASE_CHAT:                   "in chat",
+	PHASE_GAME:                   "in game",
 }
 
-var clientStates = sync.Map{}
+var protocolTypeNames = map[ProtocolType]string{
+	PROTOCOL_TYPE_BNFTP: "bnftp",
+	PROTOCOL_TYPE_CHAT:  "chat",
+	PROTOCOL_TYPE_GAME:  "game",
+}
 
 var platformNames = map[Platform]string{
 	PLATFORM_IX86: "Windows (x86)",
@@ -84,6 +192,68 @@ var productNames = map[Product]string{
 	PRODUCT_ZERO: "(null)",
 }
 
+func NewClientState(conn net.Conn) *ClientState {
+	return &ClientState{
+		Conn:       conn,
+		ID:         atomic.AddUint64(&lastID, 1),
+		RemoteAddr: conn.RemoteAddr(),
+		done:       make(chan struct{}),
+		outbound:   make(chan *message.Message, OUTBOUND_QUEUE_SIZE),
+	}
+}
+
+// Send queues a message for the connection's writer. It never blocks; a client
+// whose queue is full is disconnected.
+func (s *ClientState) Send(m *message.Message) error {
+	select {
+	case <-s.done:
+		return ErrConnectionClosed
+	default:
+	}
+
+	select {
+	case s.outbound <- m:
+		return nil
+	case <-s.done:
+		return ErrConnectionClosed
+	default:
+		s.Close()
+		return ErrSendQueueFull
+	}
+}
+
+// SendAndClose queues a final message; the writer closes the connection once
+// it was written.
+func (s *ClientState) SendAndClose(m *message.Message) error {
+	err := s.Send(m)
+	if err != nil {
+		return err
+	}
+	return s.Send(nil)
+}
+
+// Outbound is drained by the connection's single writer goroutine.
+func (s *ClientState) Outbound() <-chan *message.Message {
+	return s.outbound
+}
+
+// Pending returns the number of messages queued but not yet written.
+func (s *ClientState) Pending() int {
+	return len(s.outbound)
+}
+
+// Done is closed once the connection is closed.
+func (s *ClientState) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *ClientState) Close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.Conn.Close()
+	})
+}
+
 func AddClientState(conn net.Conn, state *ClientState) {
 	clientStates.Store(conn, state)
 }
@@ -100,6 +270,20 @@ func GetClientState(conn net.Conn) (*ClientState, bool) {
 	return state.(*ClientState), true
 }
 
+// EachClientState calls fn for every connected client until fn returns false.
+func EachClientState(fn func(state *ClientState) bool) {
+	clientStates.Range(func(_, value interface{}) bool {
+		return fn(value.(*ClientState))
+	})
+}
+
+func PhaseToName(value Phase) string {
+	if name, ok := phaseNames[value]; ok {
+		return name
+	}
+	return fmt.Sprintf("Unknown (%02X)", byte(value))
+}
+
 func PlatformToName(value Platform) string {
 	if name, ok := platformNames[value]; ok {
 		return name
@@ -107,6 +291,13 @@ func PlatformToName(value Platform) string {
 	return fmt.Sprintf("Unknown (%08X)", value)
 }
 
+func ProtocolTypeToName(value ProtocolType) string {
+	if name, ok := protocolTypeNames[value]; ok {
+		return name
+	}
+	return fmt.Sprintf("Unknown (%02X)", byte(value))
+}
+
 func ProductToName(value Product) string {
 	if name, ok := productNames[value]; ok {
 		return name
@@ -114,6 +305,107 @@ func ProductToName(value Product) string {
 	return fmt.Sprintf("Unknown (%08X)", value)
 }
 
+func ProductCapabilities(product Product, spawn bool) Capabilities {
+	switch {
+	case product == PRODUCT_ZERO:
+		return 0
+	case product == PRODUCT_CHAT || spawn:
+		return CAPABILITY_CHAT
+	case product == PRODUCT_DSHR || product == PRODUCT_SSHR || product == PRODUCT_W3DM:
+		return CAPABILITY_CHAT | CAPABILITY_CREATE_GAMES
+	default:
+		return CAPABILITY_CHAT | CAPABILITY_CREATE_GAMES | CAPABILITY_LADDER
+	}
+}
+
+// BaseProduct returns the original game of an expansion, or the product
+// itself. Clients may switch between the two with SID_SWITCHPRODUCT.
+func BaseProduct(product Product) Product {
+	switch product {
+	case PRODUCT_SEXP:
+		return PRODUCT_STAR
+	case PRODUCT_D2XP:
+		return PRODUCT_D2DV
+	case PRODUCT_W3XP:
+		return PRODUCT_WAR3
+	default:
+		return product
+	}
+}
+
+// ProductRequiresLogon reports whether clients of the product log on to an
+// account before entering chat. Diablo clients have no accounts and enter chat
+// under their character name once their version was checked.
+func ProductRequiresLogon(product Product) bool {
+	return product != PRODUCT_DRTL && product != PRODUCT_DSHR
+}
+
+// ProductMaxBodySize returns the largest message body accepted from a client
+// of the product. Clients that have not identified themselves yet are held to
+// the size of the logon messages.
+func ProductMaxBodySize(product Product) int {
+	switch product {
+	case PRODUCT_ZERO:
+		return 1024
+	case PRODUCT_D2DV, PRODUCT_D2XP, PRODUCT_W3DM, PRODUCT_W3XP, PRODUCT_WAR3:
+		return 8192 // Warden replies and longer statstrings
+	default:
+		return 4096
+	}
+}
+
+// Logger attaches the connection's ID and address to logger, and its product
+// and account once known. The caller must own the state or hold its read lock.
+func (s *ClientState) Logger(logger *slog.Logger) *slog.Logger {
+	args := []any{"conn", s.ID, "remote", s.RemoteAddr.String()}
+	if s.Product != PRODUCT_ZERO {
+		args = append(args, "product", ProductToCode(s.Product))
+	}
+	if len(s.Username) > 0 {
+		args = append(args, "account", string(s.Username))
+	}
+	return logger.With(args...)
+}
+
+func (s *ClientState) RemoteIP() string {
+	host, _, err := net.SplitHostPort(s.RemoteAddr.String())
+	if err != nil {
+		return s.RemoteAddr.String()
+	}
+	return host
+}
+
+// UpdateCapabilities re-evaluates what the client may do after its product or
+// spawn status changed.
+func (s *ClientState) UpdateCapabilities() {
+	s.Capabilities = ProductCapabilities(s.Product, s.Spawn)
+}
+
+func (s *ClientState) HasCapability(capability Capabilities) bool {
+	return s.Capabilities&capability == capability
+}
+
+// CodeToProduct looks up a known product by its four-character code.
+func CodeToProduct(code string) (Product, bool) {
+	for product := range productNames {
+		if product != PRODUCT_ZERO && ProductToCode(product) == code {
+			return product, true
+		}
+	}
+	return PRODUCT_ZERO, false
+}
+
+// ProductToCode returns the four-character code of a product, e.g. "STAR".
+func ProductToCode(value Product) string {
+	code := []byte{byte(value >> 24), byte(value >> 16), byte(value >> 8), byte(value)}
+	for _, b := range code {
+		if b < 0x20 || b > 0x7E {
+			return fmt.Sprintf("%08X", uint32(value))
+		}
+	}
+	return string(code)
+}
+
 func ReadProtocolType(conn io.Reader) (ProtocolType, error) {
 	var buf [1]byte
 	_, err := io.ReadFull(conn, buf[:])
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/carlbennett/gobncs/crashreport"
+)
+
+func main() {
+	dir := flag.String("dir", "crashes", "crash report directory")
+	flag.Parse()
+
+	summaries, err := crashreport.Summarize(*dir)
+	if err != nil {
+		log.Fatalf("failed to summarize crash reports: %v", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "COUNT\tSIGNATURE\tFIRST SEEN\tLAST SEEN")
+	for _, summary := range summaries {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", summary.Count, summary.Signature, summary.FirstSeen.Format(time.RFC3339), summary.LastSeen.Format(time.RFC3339))
+	}
+	w.Flush()
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/carlbennett/gobncs/account"
+	"github.com/carlbennett/gobncs/config"
+	"github.com/carlbennett/gobncs/datafile"
+	"github.com/carlbennett/gobncs/logging"
+	"github.com/carlbennett/gobncs/message"
+	"github.com/carlbennett/gobncs/replay"
+	"github.com/carlbennett/gobncs/trace"
+)
+
+func main() {
+	configPath := flag.String("config", "gobncs.json", "server configuration for version checks and data files")
+	accounts := flag.String("accounts", "", "account store to replay against; copied so that it is not modified (default: the configured store)")
+	timeout := flag.Duration("timeout", replay.DEFAULT_TIMEOUT, "how long to wait for each reply")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] trace...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load(*configPath, false)
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	// the server's own logging would be interleaved with the report
+	logging.Configure(io.Discard, logging.Options{})
+	applyConfig(cfg)
+
+	store := *accounts
+	if store == "" {
+		store = cfg.Data.Accounts
+	}
+
+	diverged := false
+	for _, path := range flag.Args() {
+		frames, err := trace.ReadFile(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// every trace starts from the same accounts
+		cleanup, err := openAccounts(store)
+		if err != nil {
+			log.Fatalf("failed to open account store: %v", err)
+		}
+		result, err := replay.Run(frames, replay.Options{Timeout: *timeout})
+		cleanup()
+		if err != nil {
+			log.Fatalf("failed to replay %s: %v", path, err)
+		}
+		fmt.Printf("%s: sent %d, compared %d, %d divergences\n", path, result.Sent, result.Compared, len(result.Divergences))
+		for _, d := range result.Divergences {
+			fmt.Printf("  %s\n", d)
+			if d.Expected != nil {
+				fmt.Printf("    expected %s\n", describe(d.Expected))
+			}
+			if d.Actual != nil {
+				fmt.Printf("    actual   %s\n", describe(d.Actual))
+			}
+		}
+		diverged = diverged || len(result.Divergences) > 0
+	}
+	if diverged {
+		os.Exit(1)
+	}
+}
+
+// applyConfig hands the settings that affect replies to the packages that use
+// them; limits and timeouts are left off so that replays are not throttled.
+func applyConfig(cfg *config.Config) {
+	cfg.ApplyProtocolSettings()
+	if err := datafile.Load(cfg.Data.Files); err != nil {
+		log.Printf("failed to load data files: %v", err)
+	}
+}
+
+// openAccounts opens a temporary copy of the account store at path. The
+// returned function removes the copy.
+func openAccounts(path string) (func(), error) {
+	raw, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp("", "gobncs-replay")
+	if err != nil {
+		return nil, err
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+	copied := filepath.Join(dir, "accounts.json")
+	if raw != nil {
+		err = os.WriteFile(copied, raw, 0600)
+	}
+	if err == nil {
+		err = account.Open(copied)
+	}
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+	return cleanup, nil
+}
+
+func describe(m *message.Message) string {
+	return fmt.Sprintf("%s (0x%02X) % x", message.MessageIdToName(m.ID), m.ID, m.Body)
+}
@@ -0,0 +1,659 @@
+package codec
+
+import "github.com/carlbennett/gobncs/message"
+
+// Client->Server message bodies.
+
+type ClientSID_NULL struct{}
+
+type ClientSID_PING struct {
+	Cookie uint32
+}
+
+type ClientSID_UDPPINGRESPONSE struct {
+	UDPCode FourCC // "bnet"
+}
+
+type ClientSID_AUTH_INFO struct {
+	ProtocolId     uint32
+	Platform       FourCC
+	Product        FourCC
+	VersionByte    uint32
+	LanguageCode   FourCC
+	LocalIP        uint32
+	TimezoneBias   int32
+	MPQLocaleId    uint32
+	UserLanguageId uint32
+	CountryAbbr    []byte
+	Country        []byte
+}
+
+type AuthCheckKey struct {
+	KeyLength   uint32
+	Product     uint32
+	PublicValue uint32
+	Unknown     uint32
+	Hash        [20]byte
+}
+
+type ClientSID_AUTH_CHECK struct {
+	ClientToken uint32
+	ExeVersion  uint32
+	ExeHash     uint32
+	KeyCount    uint32
+	Spawn       bool
+	Keys        []AuthCheckKey `bncs:"len=KeyCount"`
+	ExeInfo     []byte
+	KeyOwner    []byte
+}
+
+type ClientSID_CLIENTID struct {
+	RegistrationVersion   uint32
+	RegistrationAuthority uint32
+	AccountNumber         uint32
+	RegistrationToken     uint32
+	LANComputerName       []byte
+	LANUsername           []byte
+}
+
+// The order of the two registration fields depends on ServerVersion: version
+// 1 sends the registration version first, version 0 the authority.
+type ClientSID_CLIENTID2 struct {
+	ServerVersion      uint32
+	RegistrationFirst  uint32
+	RegistrationSecond uint32
+	AccountNumber      uint32
+	RegistrationToken  uint32
+	LANComputerName    []byte
+	LANUsername        []byte
+}
+
+type ClientSID_STARTVERSIONING struct {
+	Platform    FourCC
+	Product     FourCC
+	VersionByte uint32
+	Unknown     uint32
+}
+
+type ClientSID_REPORTVERSION struct {
+	Platform    FourCC
+	Product     FourCC
+	VersionByte uint32
+	ExeVersion  uint32
+	ExeHash     uint32
+	ExeInfo     []byte
+}
+
+type ClientSID_LOCALEINFO struct {
+	SystemTime       FileTime
+	LocalTime        FileTime
+	TimezoneBias     int32
+	SystemLCID       uint32
+	UserLCID         uint32
+	UserLanguageId   uint32
+	LanguageAbbr     []byte
+	CountryNameLocal []byte
+	CountryAbbr      []byte
+	Country          []byte
+}
+
+type ClientSID_SYSTEMINFO struct {
+	NumberOfProcessors    uint32
+	ProcessorArchitecture uint32
+	ProcessorLevel        uint32
+	ProcessorTiming       uint32
+	TotalPhysicalMemory   uint32
+	TotalPageFile         uint32
+	FreeDiskSpace         uint32
+}
+
+type ClientSID_LOGONRESPONSE struct {
+	ClientToken   uint32
+	ServerToken   uint32
+	PasswordProof [20]byte
+	Username      []byte
+}
+
+type ClientSID_LOGONRESPONSE2 struct {
+	ClientToken   uint32
+	ServerToken   uint32
+	PasswordProof [20]byte
+	Username      []byte
+}
+
+type ClientSID_CREATEACCOUNT struct {
+	PasswordHash [20]byte
+	Username     []byte
+}
+
+type ClientSID_CHANGEPASSWORD struct {
+	ClientToken      uint32
+	ServerToken      uint32
+	OldPasswordProof [20]byte
+	NewPasswordHash  [20]byte
+	Username         []byte
+}
+
+type ClientSID_SETEMAIL struct {
+	Email []byte
+}
+
+type ClientSID_CHANGEEMAIL struct {
+	Username []byte
+	OldEmail []byte
+	NewEmail []byte
+}
+
+type ClientSID_RESETPASSWORD struct {
+	Username []byte
+	Email    []byte
+}
+
+type ClientSID_CDKEY struct {
+	Spawn    bool
+	Key      []byte
+	KeyOwner []byte
+}
+
+type ClientSID_CDKEY2 struct {
+	Spawn       bool
+	KeyLength   uint32
+	KeyProduct  uint32
+	PublicValue uint32
+	ServerToken uint32
+	ClientToken uint32
+	Hash        [20]byte
+	KeyOwner    []byte
+}
+
+type ClientSID_SWITCHPRODUCT struct {
+	Product FourCC
+}
+
+type ClientSID_GETICONDATA struct{}
+
+type ClientSID_GETFILETIME struct {
+	RequestId uint32
+	Unknown   uint32
+	FileName  []byte
+}
+
+type ClientSID_CHECKDATAFILE2 struct {
+	FileSize uint32
+	Hash     [20]byte
+	FileName []byte
+}
+
+type ClientSID_WARDEN struct {
+	Data []byte `bncs:"void"`
+}
+
+type ClientSID_REPORTCRASH struct {
+	ReportVersion uint32
+	ExceptionCode uint32
+	ExceptionInfo [2]uint32
+}
+
+type ClientSID_EXTRAWORK struct {
+	GameType uint16
+	Length   uint16
+	Data     []byte `bncs:"len=Length"`
+}
+
+type ClientSID_GAMERESULT struct {
+	GameType    uint32
+	ResultCount uint32
+	Results     []uint32 `bncs:"len=ResultCount"`
+	Players     [][]byte `bncs:"len=ResultCount"`
+	MapName     []byte
+	PlayerScore []byte
+}
+
+type ClientSID_STARTADVEX3 struct {
+	GameState   uint32
+	ElapsedTime uint32
+	GameType    uint16
+	Parameter   uint16
+	Unknown     uint32 // always 0x1F
+	Ladder      uint32
+	GameName    []byte
+	Password    []byte
+	Statstring  []byte
+}
+
+type ClientSID_NOTIFYJOIN struct {
+	Product        FourCC
+	ProductVersion uint32
+	GameName       []byte
+	Password       []byte
+}
+
+type ClientSID_STOPADV struct{}
+
+type ClientSID_LEAVEGAME struct{}
+
+type ClientSID_ENTERCHAT struct {
+	Username   []byte
+	Statstring []byte
+}
+
+type ClientSID_GETCHANNELLIST struct {
+	Product FourCC
+}
+
+type ClientSID_JOINCHANNEL struct {
+	Flags   uint32
+	Channel []byte
+}
+
+type ClientSID_CHATCOMMAND struct {
+	Text []byte
+}
+
+type ClientSID_LEAVECHAT struct{}
+
+type ClientSID_SERVERLIST struct {
+	ServerVersion uint32
+}
+
+type ClientSID_STARTADVEX struct {
+	PasswordProtected bool
+	Unknown           [4]uint32
+	Port              uint32
+	GameName          []byte
+	Password          []byte
+	GameStats         []byte
+	MapName           []byte
+}
+
+type ClientSID_GETADVLISTEX struct {
+	Condition1 uint16
+	Condition2 uint16
+	Condition3 uint32
+	Condition4 uint32
+	ListCount  uint32
+	GameName   []byte
+	Password   []byte
+	Statstring []byte
+}
+
+type ClientSID_CHECKAD struct {
+	Platform    FourCC
+	Product     FourCC
+	LastAdId    uint32
+	CurrentTime uint32
+}
+
+type ClientSID_CLICKAD struct {
+	AdId        uint32
+	RequestType uint32
+}
+
+type ClientSID_READMEMORY struct {
+	RequestId uint32
+	Memory    []byte `bncs:"void"`
+}
+
+type ClientSID_REGISTRY struct {
+	Cookie uint32
+	Value  []byte
+}
+
+type ClientSID_STARTADVEX2 struct {
+	PasswordProtected bool
+	Unknown           [4]uint32
+	Port              uint32
+	GameName          []byte
+	Password          []byte
+	Unknown2          []byte
+	GameStats         []byte
+}
+
+// SockAddr is a Windows sockaddr_in.
+type SockAddr struct {
+	Family  uint16
+	Port    [2]byte // network byte order
+	Address [4]byte
+	Zero    [8]byte
+}
+
+type ClientSID_GAMEDATAADDRESS struct {
+	Address SockAddr
+}
+
+type ClientSID_DISPLAYAD struct {
+	Platform FourCC
+	Product  FourCC
+	AdId     uint32
+	FileName []byte
+	URL      []byte
+}
+
+type ClientSID_READCOOKIE struct {
+	Cookie   uint32
+	Unknown  uint32
+	KeyName  []byte
+	KeyValue []byte
+}
+
+type ClientSID_READUSERDATA struct {
+	AccountCount uint32
+	KeyCount     uint32
+	RequestId    uint32
+	Accounts     [][]byte `bncs:"len=AccountCount"`
+	Keys         [][]byte `bncs:"len=KeyCount"`
+}
+
+type ClientSID_WRITEUSERDATA struct {
+	AccountCount uint32
+	KeyCount     uint32
+	Accounts     [][]byte `bncs:"len=AccountCount"`
+	Keys         [][]byte `bncs:"len=KeyCount"`
+	Values       [][]byte `bncs:"void"` // one per account and key
+}
+
+type ClientSID_GETLADDERDATA struct {
+	Product      FourCC
+	League       uint32
+	SortMethod   uint32
+	StartingRank uint32
+	Count        uint32
+}
+
+type ClientSID_FINDLADDERUSER struct {
+	League     uint32
+	SortMethod uint32
+	Username   []byte
+}
+
+type ClientSID_CHECKDATAFILE struct {
+	Hash     [20]byte
+	FileName []byte
+}
+
+type ClientSID_QUERYREALMS struct {
+	Unused  [2]uint32
+	Unknown []byte
+}
+
+type ClientSID_PROFILE struct {
+	Cookie   uint32
+	Username []byte
+}
+
+type ClientSID_CREATEACCOUNT2 struct {
+	PasswordHash [20]byte
+	Username     []byte
+}
+
+type ClientSID_LOGONREALMEX struct {
+	ClientToken  uint32
+	PasswordHash [20]byte
+	RealmTitle   []byte
+}
+
+type ClientSID_STARTVERSIONING2 struct {
+	Platform    FourCC
+	Product     FourCC
+	VersionByte uint32
+	Unknown     uint32
+}
+
+type ClientSID_QUERYREALMS2 struct{}
+
+type ClientSID_QUERYADURL struct {
+	AdId uint32
+}
+
+// The layout of the key data is undocumented.
+type ClientSID_CDKEY3 struct {
+	ClientToken uint32
+	ServerToken uint32
+	KeyData     []byte `bncs:"void"`
+}
+
+type ClientSID_WARCRAFTUNKNOWN struct {
+	Unknown uint32
+}
+
+type ClientSID_WARCRAFTGENERAL struct {
+	Subcommand uint8
+	Data       []byte `bncs:"void"` // depends on the subcommand
+}
+
+type ClientSID_NETGAMEPORT struct {
+	Port uint16
+}
+
+type ClientSID_NEWS_INFO struct {
+	NewsTimestamp uint32
+}
+
+type ClientSID_AUTH_ACCOUNTCREATE struct {
+	Salt     [32]byte
+	Verifier [32]byte
+	Username []byte
+}
+
+type ClientSID_AUTH_ACCOUNTLOGON struct {
+	ClientKey [32]byte
+	Username  []byte
+}
+
+type ClientSID_AUTH_ACCOUNTLOGONPROOF struct {
+	ClientProof [20]byte
+}
+
+type ClientSID_AUTH_ACCOUNTCHANGE struct {
+	ClientKey [32]byte
+	Username  []byte
+}
+
+type ClientSID_AUTH_ACCOUNTCHANGEPROOF struct {
+	OldPasswordProof [20]byte
+	NewSalt          [32]byte
+	NewVerifier      [32]byte
+}
+
+type ClientSID_AUTH_ACCOUNTUPGRADE struct{}
+
+type ClientSID_AUTH_ACCOUNTUPGRADEPROOF struct {
+	ClientToken     uint32
+	OldPasswordHash [20]byte
+	NewSalt         [32]byte
+	NewVerifier     [32]byte
+}
+
+type ClientSID_GAMEPLAYERSEARCH struct{}
+
+type ClientSID_FRIENDSLIST struct{}
+
+type ClientSID_FRIENDSUPDATE struct {
+	Index uint8
+}
+
+type ClientSID_CLANFINDCANDIDATES struct {
+	Cookie  uint32
+	ClanTag FourCC
+}
+
+type ClientSID_CLANINVITEMULTIPLE struct {
+	Cookie    uint32
+	ClanName  []byte
+	ClanTag   FourCC
+	UserCount uint8
+	Usernames [][]byte `bncs:"len=UserCount"`
+}
+
+type ClientSID_CLANCREATIONINVITATION struct {
+	Cookie  uint32
+	ClanTag FourCC
+	Inviter []byte
+	Status  uint8
+}
+
+type ClientSID_CLANDISBAND struct {
+	Cookie uint32
+}
+
+type ClientSID_CLANMAKECHIEFTAIN struct {
+	Cookie    uint32
+	Chieftain []byte
+}
+
+type ClientSID_CLANINVITATION struct {
+	Cookie   uint32
+	Username []byte
+}
+
+type ClientSID_CLANREMOVEMEMBER struct {
+	Cookie   uint32
+	Username []byte
+}
+
+type ClientSID_CLANINVITATIONRESPONSE struct {
+	Cookie   uint32
+	ClanTag  FourCC
+	Inviter  []byte
+	Response uint8
+}
+
+type ClientSID_CLANRANKCHANGE struct {
+	Cookie   uint32
+	Username []byte
+	Rank     uint8
+}
+
+type ClientSID_CLANSETMOTD struct {
+	Cookie uint32
+	MOTD   []byte
+}
+
+type ClientSID_CLANMOTD struct {
+	Cookie uint32
+}
+
+type ClientSID_CLANMEMBERLIST struct {
+	Cookie uint32
+}
+
+type ClientSID_CLANMEMBERINFORMATION struct {
+	Cookie   uint32
+	ClanTag  FourCC
+	Username []byte
+}
+
+func (ClientSID_NULL) MessageID() message.MessageId             { return message.SID_NULL }
+func (ClientSID_PING) MessageID() message.MessageId             { return message.SID_PING }
+func (ClientSID_UDPPINGRESPONSE) MessageID() message.MessageId  { return message.SID_UDPPINGRESPONSE }
+func (ClientSID_AUTH_INFO) MessageID() message.MessageId        { return message.SID_AUTH_INFO }
+func (ClientSID_AUTH_CHECK) MessageID() message.MessageId       { return message.SID_AUTH_CHECK }
+func (ClientSID_CLIENTID) MessageID() message.MessageId         { return message.SID_CLIENTID }
+func (ClientSID_CLIENTID2) MessageID() message.MessageId        { return message.SID_CLIENTID2 }
+func (ClientSID_STARTVERSIONING) MessageID() message.MessageId  { return message.SID_STARTVERSIONING }
+func (ClientSID_REPORTVERSION) MessageID() message.MessageId    { return message.SID_REPORTVERSION }
+func (ClientSID_LOCALEINFO) MessageID() message.MessageId       { return message.SID_LOCALEINFO }
+func (ClientSID_SYSTEMINFO) MessageID() message.MessageId       { return message.SID_SYSTEMINFO }
+func (ClientSID_LOGONRESPONSE) MessageID() message.MessageId    { return message.SID_LOGONRESPONSE }
+func (ClientSID_LOGONRESPONSE2) MessageID() message.MessageId   { return message.SID_LOGONRESPONSE2 }
+func (ClientSID_CREATEACCOUNT) MessageID() message.MessageId    { return message.SID_CREATEACCOUNT }
+func (ClientSID_CHANGEPASSWORD) MessageID() message.MessageId   { return message.SID_CHANGEPASSWORD }
+func (ClientSID_SETEMAIL) MessageID() message.MessageId         { return message.SID_SETEMAIL }
+func (ClientSID_CHANGEEMAIL) MessageID() message.MessageId      { return message.SID_CHANGEEMAIL }
+func (ClientSID_RESETPASSWORD) MessageID() message.MessageId    { return message.SID_RESETPASSWORD }
+func (ClientSID_CDKEY) MessageID() message.MessageId            { return message.SID_CDKEY }
+func (ClientSID_CDKEY2) MessageID() message.MessageId           { return message.SID_CDKEY2 }
+func (ClientSID_SWITCHPRODUCT) MessageID() message.MessageId    { return message.SID_SWITCHPRODUCT }
+func (ClientSID_GETICONDATA) MessageID() message.MessageId      { return message.SID_GETICONDATA }
+func (ClientSID_GETFILETIME) MessageID() message.MessageId      { return message.SID_GETFILETIME }
+func (ClientSID_CHECKDATAFILE2) MessageID() message.MessageId   { return message.SID_CHECKDATAFILE2 }
+func (ClientSID_WARDEN) MessageID() message.MessageId           { return message.SID_WARDEN }
+func (ClientSID_REPORTCRASH) MessageID() message.MessageId      { return message.SID_REPORTCRASH }
+func (ClientSID_EXTRAWORK) MessageID() message.MessageId        { return message.SID_EXTRAWORK }
+func (ClientSID_GAMERESULT) MessageID() message.MessageId       { return message.SID_GAMERESULT }
+func (ClientSID_STARTADVEX3) MessageID() message.MessageId      { return message.SID_STARTADVEX3 }
+func (ClientSID_NOTIFYJOIN) MessageID() message.MessageId       { return message.SID_NOTIFYJOIN }
+func (ClientSID_STOPADV) MessageID() message.MessageId          { return message.SID_STOPADV }
+func (ClientSID_LEAVEGAME) MessageID() message.MessageId        { return message.SID_LEAVEGAME }
+func (ClientSID_ENTERCHAT) MessageID() message.MessageId        { return message.SID_ENTERCHAT }
+func (ClientSID_GETCHANNELLIST) MessageID() message.MessageId   { return message.SID_GETCHANNELLIST }
+func (ClientSID_JOINCHANNEL) MessageID() message.MessageId      { return message.SID_JOINCHANNEL }
+func (ClientSID_CHATCOMMAND) MessageID() message.MessageId      { return message.SID_CHATCOMMAND }
+func (ClientSID_LEAVECHAT) MessageID() message.MessageId        { return message.SID_LEAVECHAT }
+func (ClientSID_SERVERLIST) MessageID() message.MessageId       { return message.SID_SERVERLIST }
+func (ClientSID_STARTADVEX) MessageID() message.MessageId       { return message.SID_STARTADVEX }
+func (ClientSID_GETADVLISTEX) MessageID() message.MessageId     { return message.SID_GETADVLISTEX }
+func (ClientSID_CHECKAD) MessageID() message.MessageId          { return message.SID_CHECKAD }
+func (ClientSID_CLICKAD) MessageID() message.MessageId          { return message.SID_CLICKAD }
+func (ClientSID_READMEMORY) MessageID() message.MessageId       { return message.SID_READMEMORY }
+func (ClientSID_REGISTRY) MessageID() message.MessageId         { return message.SID_REGISTRY }
+func (ClientSID_STARTADVEX2) MessageID() message.MessageId      { return message.SID_STARTADVEX2 }
+func (ClientSID_GAMEDATAADDRESS) MessageID() message.MessageId  { return message.SID_GAMEDATAADDRESS }
+func (ClientSID_DISPLAYAD) MessageID() message.MessageId        { return message.SID_DISPLAYAD }
+func (ClientSID_READCOOKIE) MessageID() message.MessageId       { return message.SID_READCOOKIE }
+func (ClientSID_READUSERDATA) MessageID() message.MessageId     { return message.SID_READUSERDATA }
+func (ClientSID_WRITEUSERDATA) MessageID() message.MessageId    { return message.SID_WRITEUSERDATA }
+func (ClientSID_GETLADDERDATA) MessageID() message.MessageId    { return message.SID_GETLADDERDATA }
+func (ClientSID_FINDLADDERUSER) MessageID() message.MessageId   { return message.SID_FINDLADDERUSER }
+func (ClientSID_CHECKDATAFILE) MessageID() message.MessageId    { return message.SID_CHECKDATAFILE }
+func (ClientSID_QUERYREALMS) MessageID() message.MessageId      { return message.SID_QUERYREALMS }
+func (ClientSID_PROFILE) MessageID() message.MessageId          { return message.SID_PROFILE }
+func (ClientSID_CREATEACCOUNT2) MessageID() message.MessageId   { return message.SID_CREATEACCOUNT2 }
+func (ClientSID_LOGONREALMEX) MessageID() message.MessageId     { return message.SID_LOGONREALMEX }
+func (ClientSID_STARTVERSIONING2) MessageID() message.MessageId { return message.SID_STARTVERSIONING2 }
+func (ClientSID_QUERYREALMS2) MessageID() message.MessageId     { return message.SID_QUERYREALMS2 }
+func (ClientSID_QUERYADURL) MessageID() message.MessageId       { return message.SID_QUERYADURL }
+func (ClientSID_CDKEY3) MessageID() message.MessageId           { return message.SID_CDKEY3 }
+func (ClientSID_WARCRAFTUNKNOWN) MessageID() message.MessageId  { return message.SID_WARCRAFTUNKNOWN }
+func (ClientSID_WARCRAFTGENERAL) MessageID() message.MessageId  { return message.SID_WARCRAFTGENERAL }
+func (ClientSID_NETGAMEPORT) MessageID() message.MessageId      { return message.SID_NETGAMEPORT }
+func (ClientSID_NEWS_INFO) MessageID() message.MessageId        { return message.SID_NEWS_INFO }
+func (ClientSID_AUTH_ACCOUNTCREATE) MessageID() message.MessageId {
+	return message.SID_AUTH_ACCOUNTCREATE
+}
+func (ClientSID_AUTH_ACCOUNTLOGON) MessageID() message.MessageId {
+	return message.SID_AUTH_ACCOUNTLOGON
+}
+func (ClientSID_AUTH_ACCOUNTLOGONPROOF) MessageID() message.MessageId {
+	return message.SID_AUTH_ACCOUNTLOGONPROOF
+}
+func (ClientSID_AUTH_ACCOUNTCHANGE) MessageID() message.MessageId {
+	return message.SID_AUTH_ACCOUNTCHANGE
+}
+func (ClientSID_AUTH_ACCOUNTCHANGEPROOF) MessageID() message.MessageId {
+	return message.SID_AUTH_ACCOUNTCHANGEPROOF
+}
+func (ClientSID_AUTH_ACCOUNTUPGRADE) MessageID() message.MessageId {
+	return message.SID_AUTH_ACCOUNTUPGRADE
+}
+func (ClientSID_AUTH_ACCOUNTUPGRADEPROOF) MessageID() message.MessageId {
+	return message.SID_AUTH_ACCOUNTUPGRADEPROOF
+}
+func (ClientSID_GAMEPLAYERSEARCH) MessageID() message.MessageId { return message.SID_GAMEPLAYERSEARCH }
+func (ClientSID_FRIENDSLIST) MessageID() message.MessageId      { return message.SID_FRIENDSLIST }
+func (ClientSID_FRIENDSUPDATE) MessageID() message.MessageId    { return message.SID_FRIENDSUPDATE }
+func (ClientSID_CLANFINDCANDIDATES) MessageID() message.MessageId {
+	return message.SID_CLANFINDCANDIDATES
+}
+func (ClientSID_CLANINVITEMULTIPLE) MessageID() message.MessageId {
+	return message.SID_CLANINVITEMULTIPLE
+}
+func (ClientSID_CLANCREATIONINVITATION) MessageID() message.MessageId {
+	return message.SID_CLANCREATIONINVITATION
+}
+func (ClientSID_CLANDISBAND) MessageID() message.MessageId { return message.SID_CLANDISBAND }
+func (ClientSID_CLANMAKECHIEFTAIN) MessageID() message.MessageId {
+	return message.SID_CLANMAKECHIEFTAIN
+}
+func (ClientSID_CLANINVITATION) MessageID() message.MessageId   { return message.SID_CLANINVITATION }
+func (ClientSID_CLANREMOVEMEMBER) MessageID() message.MessageId { return message.SID_CLANREMOVEMEMBER }
+func (ClientSID_CLANINVITATIONRESPONSE) MessageID() message.MessageId {
+	return message.SID_CLANINVITATIONRESPONSE
+}
+func (ClientSID_CLANRANKCHANGE) MessageID() message.MessageId { return message.SID_CLANRANKCHANGE }
+func (ClientSID_CLANSETMOTD) MessageID() message.MessageId    { return message.SID_CLANSETMOTD }
+func (ClientSID_CLANMOTD) MessageID() message.MessageId       { return message.SID_CLANMOTD }
+func (ClientSID_CLANMEMBERLIST) MessageID() message.MessageId { return message.SID_CLANMEMBERLIST }
+func (ClientSID_CLANMEMBERINFORMATION) MessageID() message.MessageId {
+	return message.SID_CLANMEMBERINFORMATION
+}
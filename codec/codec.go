@@ -0,0 +1,423 @@
+// Package codec encodes and decodes Battle.net message bodies to and from
+// tagged Go structs. Every SID has a ClientSID_ type, a ServerSID_ type or
+// both, depending on the directions it is sent in.
+//
+// Field kinds map to protocol types as follows:
+//
+//	uint8, int8       BYTE
+//	uint16, int16     WORD
+//	uint32, int32     DWORD
+//	uint64, int64     FILETIME or QWORD
+//	bool              BOOL (DWORD)
+//	string, []byte    null-terminated STRING
+//	[N]T              N consecutive values of T
+//	struct            its exported fields in order
+//
+// Fields may carry a `bncs` tag: `bncs:"void"` consumes the remainder of the
+// body as raw bytes (or repeated elements for other slices), `bncs:"len=Name"`
+// sizes a slice by the earlier integer field Name, and `bncs:"-"` skips the
+// field.
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/carlbennett/gobncs/message"
+	"github.com/carlbennett/gobncs/util"
+)
+
+// FILETIME: 100-nanosecond intervals since 1601-01-01 UTC.
+type FileTime uint64
+
+func NewFileTime(t time.Time) FileTime {
+	return FileTime(util.TimeToFileTime(t))
+}
+
+func (ft FileTime) Time() time.Time {
+	return util.FileTimeToTime(uint64(ft))
+}
+
+// FourCC is a DWORD holding four characters, such as a product or platform
+// code. Sent little-endian, it appears reversed on the wire ("STAR" as "RATS").
+type FourCC uint32
+
+func NewFourCC(code string) FourCC {
+	var value FourCC
+	for i := 0; i < 4 && i < len(code); i++ {
+		value |= FourCC(code[i]) << (24 - 8*i)
+	}
+	return value
+}
+
+func (f FourCC) String() string {
+	return string([]byte{byte(f >> 24), byte(f >> 16), byte(f >> 8), byte(f)})
+}
+
+// Payload is a typed message body.
+type Payload interface {
+	MessageID() message.MessageId
+}
+
+var (
+	ErrLengthMismatch    = errors.New("slice length does not match its length field")
+	ErrMissingTerminator = errors.New("string is missing its null terminator")
+	ErrShortBuffer       = errors.New("message body too short")
+	ErrTrailingData      = errors.New("unexpected trailing data")
+	ErrUnsupportedType   = errors.New("unsupported field type")
+	ErrEmbeddedNull      = errors.New("string contains a null byte")
+)
+
+type FieldError struct {
+	Err    error
+	Field  string
+	Offset int
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("field %s at offset %d: %v", e.Field, e.Offset, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+type fieldTag struct {
+	length string
+	skip   bool
+	void   bool
+}
+
+func parseTag(tag string) fieldTag {
+	var parsed fieldTag
+	for _, option := range strings.Split(tag, ",") {
+		switch {
+		case option == "-":
+			parsed.skip = true
+		case option == "void":
+			parsed.void = true
+		case strings.HasPrefix(option, "len="):
+			parsed.length = strings.TrimPrefix(option, "len=")
+		}
+	}
+	return parsed
+}
+
+func Encode(p Payload) (*message.Message, error) {
+	body, err := Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > 0xFFFF-4 {
+		return nil, fmt.Errorf("message body too long (%d bytes)", len(body))
+	}
+	return &message.Message{
+		ID:     p.MessageID(),
+		Length: uint16(4 + len(body)),
+		Body:   body,
+	}, nil
+}
+
+func Decode(m *message.Message, p Payload) error {
+	if m.ID != p.MessageID() {
+		return fmt.Errorf("message id mismatch (expected 0x%02X, got 0x%02X)", p.MessageID(), m.ID)
+	}
+	return Unmarshal(m.Body, p)
+}
+
+func Marshal(v interface{}) ([]byte, error) {
+	value := reflect.Indirect(reflect.ValueOf(v))
+	e := &encoder{}
+	err := e.encode(value, fieldTag{}, value.Type().Name(), reflect.Value{})
+	if err != nil {
+		return nil, err
+	}
+	return e.buffer.Bytes(), nil
+}
+
+func Unmarshal(data []byte, v interface{}) error {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Ptr || value.IsNil() {
+		return fmt.Errorf("unmarshal target must be a non-nil pointer")
+	}
+	d := &decoder{data: data}
+	err := d.decode(value.Elem(), fieldTag{}, value.Elem().Type().Name(), reflect.Value{})
+	if err != nil {
+		return err
+	}
+	if d.offset != len(d.data) {
+		return &FieldError{Err: ErrTrailingData, Field: value.Elem().Type().Name(), Offset: d.offset}
+	}
+	return nil
+}
+
+func lengthOf(parent reflect.Value, name string) (int, error) {
+	if !parent.IsValid() {
+		return 0, fmt.Errorf("length field %s has no parent struct", name)
+	}
+	field := parent.FieldByName(name)
+	switch field.Kind() {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(field.Uint()), nil
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(field.Int()), nil
+	default:
+		return 0, fmt.Errorf("length field %s is not an integer", name)
+	}
+}
+
+type encoder struct {
+	buffer bytes.Buffer
+}
+
+func (e *encoder) fail(name string, err error) error {
+	return &FieldError{Err: err, Field: name, Offset: e.buffer.Len()}
+}
+
+func (e *encoder) encode(v reflect.Value, tag fieldTag, name string, parent reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return binary.Write(&e.buffer, binary.LittleEndian, v.Interface())
+	case reflect.Bool:
+		var value uint32
+		if v.Bool() {
+			value = 1
+		}
+		return binary.Write(&e.buffer, binary.LittleEndian, value)
+	case reflect.String:
+		return e.encodeBytes([]byte(v.String()), tag, name, parent)
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := e.encode(v.Index(i), fieldTag{}, fmt.Sprintf("%s[%d]", name, i), parent); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return e.encodeBytes(v.Bytes(), tag, name, parent)
+		}
+		if tag.length != "" {
+			length, err := lengthOf(parent, tag.length)
+			if err != nil {
+				return e.fail(name, err)
+			}
+			if length != v.Len() {
+				return e.fail(name, ErrLengthMismatch)
+			}
+		} else if !tag.void {
+			return e.fail(name, fmt.Errorf("%w: slice without len or void tag", ErrUnsupportedType))
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := e.encode(v.Index(i), fieldTag{}, fmt.Sprintf("%s[%d]", name, i), parent); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			fieldTag := parseTag(field.Tag.Get("bncs"))
+			if !field.IsExported() || fieldTag.skip {
+				continue
+			}
+			if err := e.encode(v.Field(i), fieldTag, field.Name, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return e.fail(name, fmt.Errorf("%w: %s", ErrUnsupportedType, v.Type()))
+	}
+}
+
+func (e *encoder) encodeBytes(value []byte, tag fieldTag, name string, parent reflect.Value) error {
+	if tag.void {
+		e.buffer.Write(value)
+		return nil
+	}
+	if tag.length != "" {
+		length, err := lengthOf(parent, tag.length)
+		if err != nil {
+			return e.fail(name, err)
+		}
+		if length != len(value) {
+			return e.fail(name, ErrLengthMismatch)
+		}
+		e.buffer.Write(value)
+		return nil
+	}
+	if bytes.IndexByte(value, 0) >= 0 {
+		return e.fail(name, ErrEmbeddedNull)
+	}
+	e.buffer.Write(value)
+	e.buffer.WriteByte(0)
+	return nil
+}
+
+type decoder struct {
+	data   []byte
+	offset int
+}
+
+func (d *decoder) fail(name string, err error) error {
+	return &FieldError{Err: err, Field: name, Offset: d.offset}
+}
+
+func (d *decoder) take(name string, n int) ([]byte, error) {
+	if n < 0 || len(d.data)-d.offset < n {
+		return nil, d.fail(name, ErrShortBuffer)
+	}
+	value := d.data[d.offset : d.offset+n]
+	d.offset += n
+	return value, nil
+}
+
+func (d *decoder) decode(v reflect.Value, tag fieldTag, name string, parent reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Uint8, reflect.Int8:
+		raw, err := d.take(name, 1)
+		if err != nil {
+			return err
+		}
+		setInteger(v, uint64(raw[0]))
+		return nil
+	case reflect.Uint16, reflect.Int16:
+		raw, err := d.take(name, 2)
+		if err != nil {
+			return err
+		}
+		setInteger(v, uint64(binary.LittleEndian.Uint16(raw)))
+		return nil
+	case reflect.Uint32, reflect.Int32:
+		raw, err := d.take(name, 4)
+		if err != nil {
+			return err
+		}
+		setInteger(v, uint64(binary.LittleEndian.Uint32(raw)))
+		return nil
+	case reflect.Uint64, reflect.Int64:
+		raw, err := d.take(name, 8)
+		if err != nil {
+			return err
+		}
+		setInteger(v, binary.LittleEndian.Uint64(raw))
+		return nil
+	case reflect.Bool:
+		raw, err := d.take(name, 4)
+		if err != nil {
+			return err
+		}
+		v.SetBool(binary.LittleEndian.Uint32(raw) != 0)
+		return nil
+	case reflect.String:
+		raw, err := d.decodeBytes(tag, name, parent)
+		if err != nil {
+			return err
+		}
+		v.SetString(string(raw))
+		return nil
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := d.decode(v.Index(i), fieldTag{}, fmt.Sprintf("%s[%d]", name, i), parent); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			raw, err := d.decodeBytes(tag, name, parent)
+			if err != nil {
+				return err
+			}
+			v.SetBytes(append([]byte{}, raw...))
+			return nil
+		}
+		if tag.length != "" {
+			length, err := lengthOf(parent, tag.length)
+			if err != nil {
+				return d.fail(name, err)
+			}
+			if length > len(d.data)-d.offset {
+				// every element takes at least one byte
+				return d.fail(name, ErrShortBuffer)
+			}
+			v.Set(reflect.MakeSlice(v.Type(), length, length))
+			for i := 0; i < length; i++ {
+				if err = d.decode(v.Index(i), fieldTag{}, fmt.Sprintf("%s[%d]", name, i), parent); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if !tag.void {
+			return d.fail(name, fmt.Errorf("%w: slice without len or void tag", ErrUnsupportedType))
+		}
+		v.Set(reflect.MakeSlice(v.Type(), 0, 0))
+		for i := 0; d.offset < len(d.data); i++ {
+			element := reflect.New(v.Type().Elem()).Elem()
+			if err := d.decode(element, fieldTag{}, fmt.Sprintf("%s[%d]", name, i), parent); err != nil {
+				return err
+			}
+			v.Set(reflect.Append(v, element))
+		}
+		return nil
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			fieldTag := parseTag(field.Tag.Get("bncs"))
+			if !field.IsExported() || fieldTag.skip {
+				continue
+			}
+			if err := d.decode(v.Field(i), fieldTag, field.Name, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return d.fail(name, fmt.Errorf("%w: %s", ErrUnsupportedType, v.Type()))
+	}
+}
+
+func (d *decoder) decodeBytes(tag fieldTag, name string, parent reflect.Value) ([]byte, error) {
+	if tag.void {
+		return d.take(name, len(d.data)-d.offset)
+	}
+	if tag.length != "" {
+		length, err := lengthOf(parent, tag.length)
+		if err != nil {
+			return nil, d.fail(name, err)
+		}
+		return d.take(name, length)
+	}
+	end := bytes.IndexByte(d.data[d.offset:], 0)
+	if end < 0 {
+		return nil, d.fail(name, ErrMissingTerminator)
+	}
+	value := d.data[d.offset : d.offset+end]
+	d.offset += end + 1
+	return value, nil
+}
+
+func setInteger(v reflect.Value, value uint64) {
+	switch v.Kind() {
+	case reflect.Int8:
+		v.SetInt(int64(int8(value)))
+	case reflect.Int16:
+		v.SetInt(int64(int16(value)))
+	case reflect.Int32:
+		v.SetInt(int64(int32(value)))
+	case reflect.Int64:
+		v.SetInt(int64(value))
+	default:
+		v.SetUint(value)
+	}
+}
@@ -0,0 +1,360 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/carlbennett/gobncs/message"
+)
+
+// payloads lists every message body type.
+var payloads = []Payload{
+	&ClientSID_NULL{},
+	&ClientSID_PING{},
+	&ClientSID_UDPPINGRESPONSE{},
+	&ClientSID_AUTH_INFO{},
+	&ClientSID_AUTH_CHECK{},
+	&ClientSID_CLIENTID{},
+	&ClientSID_CLIENTID2{},
+	&ClientSID_STARTVERSIONING{},
+	&ClientSID_REPORTVERSION{},
+	&ClientSID_LOCALEINFO{},
+	&ClientSID_SYSTEMINFO{},
+	&ClientSID_LOGONRESPONSE{},
+	&ClientSID_LOGONRESPONSE2{},
+	&ClientSID_CREATEACCOUNT{},
+	&ClientSID_CHANGEPASSWORD{},
+	&ClientSID_SETEMAIL{},
+	&ClientSID_CHANGEEMAIL{},
+	&ClientSID_RESETPASSWORD{},
+	&ClientSID_CDKEY{},
+	&ClientSID_CDKEY2{},
+	&ClientSID_SWITCHPRODUCT{},
+	&ClientSID_GETICONDATA{},
+	&ClientSID_GETFILETIME{},
+	&ClientSID_CHECKDATAFILE2{},
+	&ClientSID_WARDEN{},
+	&ClientSID_REPORTCRASH{},
+	&ClientSID_EXTRAWORK{},
+	&ClientSID_GAMERESULT{},
+	&ClientSID_STARTADVEX3{},
+	&ClientSID_NOTIFYJOIN{},
+	&ClientSID_STOPADV{},
+	&ClientSID_LEAVEGAME{},
+	&ClientSID_ENTERCHAT{},
+	&ClientSID_GETCHANNELLIST{},
+	&ClientSID_JOINCHANNEL{},
+	&ClientSID_CHATCOMMAND{},
+	&ClientSID_LEAVECHAT{},
+	&ClientSID_SERVERLIST{},
+	&ClientSID_STARTADVEX{},
+	&ClientSID_GETADVLISTEX{},
+	&ClientSID_CHECKAD{},
+	&ClientSID_CLICKAD{},
+	&ClientSID_READMEMORY{},
+	&ClientSID_REGISTRY{},
+	&ClientSID_STARTADVEX2{},
+	&ClientSID_GAMEDATAADDRESS{},
+	&ClientSID_DISPLAYAD{},
+	&ClientSID_READCOOKIE{},
+	&ClientSID_READUSERDATA{},
+	&ClientSID_WRITEUSERDATA{},
+	&ClientSID_GETLADDERDATA{},
+	&ClientSID_FINDLADDERUSER{},
+	&ClientSID_CHECKDATAFILE{},
+	&ClientSID_QUERYREALMS{},
+	&ClientSID_PROFILE{},
+	&ClientSID_CREATEACCOUNT2{},
+	&ClientSID_LOGONREALMEX{},
+	&ClientSID_STARTVERSIONING2{},
+	&ClientSID_QUERYREALMS2{},
+	&ClientSID_QUERYADURL{},
+	&ClientSID_CDKEY3{},
+	&ClientSID_WARCRAFTUNKNOWN{},
+	&ClientSID_WARCRAFTGENERAL{},
+	&ClientSID_NETGAMEPORT{},
+	&ClientSID_NEWS_INFO{},
+	&ClientSID_AUTH_ACCOUNTCREATE{},
+	&ClientSID_AUTH_ACCOUNTLOGON{},
+	&ClientSID_AUTH_ACCOUNTLOGONPROOF{},
+	&ClientSID_AUTH_ACCOUNTCHANGE{},
+	&ClientSID_AUTH_ACCOUNTCHANGEPROOF{},
+	&ClientSID_AUTH_ACCOUNTUPGRADE{},
+	&ClientSID_AUTH_ACCOUNTUPGRADEPROOF{},
+	&ClientSID_GAMEPLAYERSEARCH{},
+	&ClientSID_FRIENDSLIST{},
+	&ClientSID_FRIENDSUPDATE{},
+	&ClientSID_CLANFINDCANDIDATES{},
+	&ClientSID_CLANINVITEMULTIPLE{},
+	&ClientSID_CLANCREATIONINVITATION{},
+	&ClientSID_CLANDISBAND{},
+	&ClientSID_CLANMAKECHIEFTAIN{},
+	&ClientSID_CLANINVITATION{},
+	&ClientSID_CLANREMOVEMEMBER{},
+	&ClientSID_CLANINVITATIONRESPONSE{},
+	&ClientSID_CLANRANKCHANGE{},
+	&ClientSID_CLANSETMOTD{},
+	&ClientSID_CLANMOTD{},
+	&ClientSID_CLANMEMBERLIST{},
+	&ClientSID_CLANMEMBERINFORMATION{},
+	&ServerSID_NULL{},
+	&ServerSID_PING{},
+	&ServerSID_AUTH_INFO{},
+	&ServerSID_AUTH_CHECK{},
+	&ServerSID_CLIENTID{},
+	&ServerSID_LOGONCHALLENGE{},
+	&ServerSID_LOGONCHALLENGEEX{},
+	&ServerSID_STARTVERSIONING{},
+	&ServerSID_REPORTVERSION{},
+	&ServerSID_LOGONRESPONSE{},
+	&ServerSID_LOGONRESPONSE2{},
+	&ServerSID_CREATEACCOUNT{},
+	&ServerSID_CHANGEPASSWORD{},
+	&ServerSID_SETEMAIL{},
+	&ServerSID_CDKEY{},
+	&ServerSID_CDKEY2{},
+	&ServerSID_GETICONDATA{},
+	&ServerSID_GETFILETIME{},
+	&ServerSID_CHECKDATAFILE2{},
+	&ServerSID_WARDEN{},
+	&ServerSID_OPTIONALWORK{},
+	&ServerSID_REQUIREDWORK{},
+	&ServerSID_TOURNAMENT{},
+	&ServerSID_STARTADVEX3{},
+	&ServerSID_ENTERCHAT{},
+	&ServerSID_GETCHANNELLIST{},
+	&ServerSID_CHATEVENT{},
+	&ServerSID_FLOODDETECTED{},
+	&ServerSID_SERVERLIST{},
+	&ServerSID_STARTADVEX{},
+	&ServerSID_GETADVLISTEX{},
+	&ServerSID_CHECKAD{},
+	&ServerSID_READMEMORY{},
+	&ServerSID_REGISTRY{},
+	&ServerSID_MESSAGEBOX{},
+	&ServerSID_STARTADVEX2{},
+	&ServerSID_ANNOUNCEMENT{},
+	&ServerSID_WRITECOOKIE{},
+	&ServerSID_READCOOKIE{},
+	&ServerSID_READUSERDATA{},
+	&ServerSID_GETLADDERDATA{},
+	&ServerSID_FINDLADDERUSER{},
+	&ServerSID_CHECKDATAFILE{},
+	&ServerSID_QUERYREALMS{},
+	&ServerSID_PROFILE{},
+	&ServerSID_CREATEACCOUNT2{},
+	&ServerSID_LOGONREALMEX{},
+	&ServerSID_STARTVERSIONING2{},
+	&ServerSID_QUERYREALMS2{},
+	&ServerSID_QUERYADURL{},
+	&ServerSID_CDKEY3{},
+	&ServerSID_WARCRAFTGENERAL{},
+	&ServerSID_NEWS_INFO{},
+	&ServerSID_AUTH_ACCOUNTCREATE{},
+	&ServerSID_AUTH_ACCOUNTLOGON{},
+	&ServerSID_AUTH_ACCOUNTLOGONPROOF{},
+	&ServerSID_AUTH_ACCOUNTCHANGE{},
+	&ServerSID_AUTH_ACCOUNTCHANGEPROOF{},
+	&ServerSID_AUTH_ACCOUNTUPGRADE{},
+	&ServerSID_AUTH_ACCOUNTUPGRADEPROOF{},
+	&ServerSID_GAMEPLAYERSEARCH{},
+	&ServerSID_FRIENDSLIST{},
+	&ServerSID_FRIENDSUPDATE{},
+	&ServerSID_FRIENDSADD{},
+	&ServerSID_FRIENDSREMOVE{},
+	&ServerSID_FRIENDSPOSITION{},
+	&ServerSID_CLANFINDCANDIDATES{},
+	&ServerSID_CLANINVITEMULTIPLE{},
+	&ServerSID_CLANCREATIONINVITATION{},
+	&ServerSID_CLANDISBAND{},
+	&ServerSID_CLANMAKECHIEFTAIN{},
+	&ServerSID_CLANINFO{},
+	&ServerSID_CLANQUITNOTIFY{},
+	&ServerSID_CLANINVITATION{},
+	&ServerSID_CLANREMOVEMEMBER{},
+	&ServerSID_CLANINVITATIONRESPONSE{},
+	&ServerSID_CLANRANKCHANGE{},
+	&ServerSID_CLANMOTD{},
+	&ServerSID_CLANMEMBERLIST{},
+	&ServerSID_CLANMEMBERREMOVED{},
+	&ServerSID_CLANMEMBERSTATUSCHANGE{},
+	&ServerSID_CLANMEMBERRANKCHANGE{},
+	&ServerSID_CLANMEMBERINFORMATION{},
+}
+
+// fill sets every field of v to a distinct non-zero value, gives slices two
+// elements and sets the length fields that size them.
+func fill(v reflect.Value, tag fieldTag, next *uint64) {
+	switch v.Kind() {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		*next++
+		setInteger(v, *next%100+1)
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.String:
+		*next++
+		v.SetString(fmt.Sprintf("s%d", *next))
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			fill(v.Index(i), fieldTag{}, next)
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			*next++
+			value := []byte(fmt.Sprintf("b%d", *next))
+			if tag.void || tag.length != "" {
+				value = append(value, 0x00, 0xFF) // raw bytes may hold anything
+			}
+			v.SetBytes(value)
+			return
+		}
+		v.Set(reflect.MakeSlice(v.Type(), 2, 2))
+		for i := 0; i < v.Len(); i++ {
+			fill(v.Index(i), fieldTag{}, next)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			fieldTag := parseTag(t.Field(i).Tag.Get("bncs"))
+			if t.Field(i).IsExported() && !fieldTag.skip {
+				fill(v.Field(i), fieldTag, next)
+			}
+		}
+		for i := 0; i < t.NumField(); i++ {
+			fieldTag := parseTag(t.Field(i).Tag.Get("bncs"))
+			if fieldTag.length != "" {
+				setInteger(v.FieldByName(fieldTag.length), uint64(v.Field(i).Len()))
+			}
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, payload := range payloads {
+		payloadType := reflect.TypeOf(payload).Elem()
+		t.Run(payloadType.Name(), func(t *testing.T) {
+			original := reflect.New(payloadType)
+			var next uint64
+			fill(original.Elem(), fieldTag{}, &next)
+
+			m, err := Encode(original.Interface().(Payload))
+			if err != nil {
+				t.Fatalf("encode: %v", err)
+			}
+			if err = message.ValidateMessage(m); err != nil {
+				t.Fatalf("encoded message is invalid: %v", err)
+			}
+
+			decoded := reflect.New(payloadType)
+			if err = Decode(m, decoded.Interface().(Payload)); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if !reflect.DeepEqual(original.Interface(), decoded.Interface()) {
+				t.Fatalf("round trip changed the payload\nwant %+v\ngot  %+v", original.Elem(), decoded.Elem())
+			}
+
+			again, err := Encode(decoded.Interface().(Payload))
+			if err != nil {
+				t.Fatalf("re-encode: %v", err)
+			}
+			if !bytes.Equal(m.Body, again.Body) {
+				t.Fatalf("re-encoding changed the body\nwant % X\ngot  % X", m.Body, again.Body)
+			}
+		})
+	}
+}
+
+func TestEveryMessageHasPayload(t *testing.T) {
+	covered := map[message.MessageId]bool{}
+	for _, payload := range payloads {
+		name := reflect.TypeOf(payload).Elem().Name()
+		expected := message.MessageIdToName(payload.MessageID())
+		if !strings.HasSuffix(name, expected) {
+			t.Errorf("%s reports message id %s", name, expected)
+		}
+		covered[payload.MessageID()] = true
+	}
+
+	for id := 0; id <= 0xFF; id++ {
+		name := message.MessageIdToName(message.MessageId(id))
+		if !strings.HasPrefix(name, "SID_UNKNOWN_") && !covered[message.MessageId(id)] {
+			t.Errorf("%s has no payload type", name)
+		}
+	}
+}
+
+func TestFourCC(t *testing.T) {
+	code := NewFourCC("STAR")
+	if code.String() != "STAR" {
+		t.Errorf("expected STAR, got %s", code)
+	}
+
+	body, err := Marshal(&ClientSID_SWITCHPRODUCT{Product: code})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "RATS" {
+		t.Errorf("expected the code reversed on the wire, got %q", body)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    []byte
+		payload Payload
+		err     error
+	}{
+		{"short integer", []byte{0x01, 0x02}, &ClientSID_PING{}, ErrShortBuffer},
+		{"missing terminator", []byte("STAR"), &ClientSID_SETEMAIL{}, ErrMissingTerminator},
+		{"trailing data", []byte{1, 2, 3, 4, 5}, &ClientSID_PING{}, ErrTrailingData},
+		{"length beyond body", []byte{0, 0, 0xFF, 0x00, 'x'}, &ClientSID_EXTRAWORK{}, ErrShortBuffer},
+		{"count beyond body", []byte{1, 0, 0, 0, 0xFF, 0, 0, 0}, &ServerSID_QUERYREALMS{}, ErrShortBuffer},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := &message.Message{ID: test.payload.MessageID(), Length: uint16(4 + len(test.body)), Body: test.body}
+			err := Decode(m, test.payload)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected %v, got %v", test.err, err)
+			}
+			var fieldErr *FieldError
+			if !errors.As(err, &fieldErr) {
+				t.Fatalf("expected a *FieldError, got %T", err)
+			}
+		})
+	}
+}
+
+func TestDecodeWrongMessage(t *testing.T) {
+	m := &message.Message{ID: message.SID_NULL, Length: 4}
+	if err := Decode(m, &ClientSID_PING{}); err == nil {
+		t.Fatal("decoded SID_NULL as SID_PING")
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload Payload
+		err     error
+	}{
+		{"embedded null", &ClientSID_SETEMAIL{Email: []byte("a\x00b")}, ErrEmbeddedNull},
+		{"length mismatch", &ClientSID_EXTRAWORK{Length: 3, Data: []byte{1}}, ErrLengthMismatch},
+		{"count mismatch", &ServerSID_QUERYREALMS{RealmCount: 2, Realms: []Realm{{}}}, ErrLengthMismatch},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := Encode(test.payload); !errors.Is(err, test.err) {
+				t.Fatalf("expected %v, got %v", test.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,646 @@
+package codec
+
+import "github.com/carlbennett/gobncs/message"
+
+// Server->Client message bodies.
+
+type ServerSID_NULL struct{}
+
+type ServerSID_PING struct {
+	Cookie uint32
+}
+
+type ServerSID_AUTH_INFO struct {
+	LogonType       uint32
+	ServerToken     uint32
+	UDPValue        uint32
+	MPQFileTime     FileTime
+	MPQFileName     []byte
+	ValueString     []byte
+	ServerSignature []byte `bncs:"void"` // WAR3 and W3XP only
+}
+
+type ServerSID_AUTH_CHECK struct {
+	Result uint32
+	Info   []byte
+}
+
+type ServerSID_CLIENTID struct {
+	RegistrationVersion   uint32
+	RegistrationAuthority uint32
+	AccountNumber         uint32
+	RegistrationToken     uint32
+}
+
+type ServerSID_LOGONCHALLENGE struct {
+	ServerToken uint32
+}
+
+type ServerSID_LOGONCHALLENGEEX struct {
+	UDPValue    uint32
+	ServerToken uint32
+}
+
+type ServerSID_STARTVERSIONING struct {
+	MPQFileTime FileTime
+	MPQFileName []byte
+	ValueString []byte
+}
+
+type ServerSID_REPORTVERSION struct {
+	Result    uint32
+	PatchPath []byte
+}
+
+type ServerSID_LOGONRESPONSE struct {
+	Result uint32
+}
+
+type ServerSID_LOGONRESPONSE2 struct {
+	Status uint32
+	Info   []byte `bncs:"void"` // only sent with some statuses
+}
+
+type ServerSID_CREATEACCOUNT struct {
+	Result uint32
+}
+
+type ServerSID_CHANGEPASSWORD struct {
+	Result uint32
+}
+
+type ServerSID_SETEMAIL struct{}
+
+type ServerSID_CDKEY struct {
+	Result   uint32
+	KeyOwner []byte
+}
+
+type ServerSID_CDKEY2 struct {
+	Result   uint32
+	KeyOwner []byte
+}
+
+type ServerSID_GETICONDATA struct {
+	FileTime FileTime
+	FileName []byte
+}
+
+type ServerSID_GETFILETIME struct {
+	RequestId uint32
+	Unknown   uint32
+	FileTime  FileTime
+	FileName  []byte
+}
+
+type ServerSID_CHECKDATAFILE2 struct {
+	Result uint32
+}
+
+type ServerSID_WARDEN struct {
+	Data []byte `bncs:"void"`
+}
+
+type ServerSID_OPTIONALWORK struct {
+	MPQFileName []byte
+}
+
+type ServerSID_REQUIREDWORK struct {
+	MPQFileName []byte
+}
+
+type ServerSID_TOURNAMENT struct {
+	Status   uint8
+	Games    uint8
+	Unknown  uint16
+	Unknown2 uint8
+}
+
+type ServerSID_STARTADVEX3 struct {
+	Status uint32
+}
+
+type ServerSID_ENTERCHAT struct {
+	UniqueName  []byte
+	Statstring  []byte
+	AccountName []byte
+}
+
+type ServerSID_GETCHANNELLIST struct {
+	Channels [][]byte `bncs:"void"` // the list ends with an empty name
+}
+
+type ServerSID_CHATEVENT struct {
+	EventId               uint32
+	Flags                 uint32
+	Ping                  uint32
+	IPAddress             uint32 // defunct
+	AccountNumber         uint32 // defunct
+	RegistrationAuthority uint32 // defunct
+	Username              []byte
+	Text                  []byte
+}
+
+type ServerSID_FLOODDETECTED struct{}
+
+type ServerSID_SERVERLIST struct {
+	ServerVersion uint32
+	Servers       [][]byte `bncs:"void"`
+}
+
+type ServerSID_STARTADVEX struct {
+	Status uint32
+}
+
+type AdvListGame struct {
+	GameType   uint16
+	Parameter  uint16
+	LanguageId uint32
+	Host       SockAddr
+	GameStatus uint32
+	Elapsed    uint32
+	GameName   []byte
+	Password   []byte
+	Statstring []byte
+}
+
+type ServerSID_GETADVLISTEX struct {
+	GameCount uint32
+	Games     []AdvListGame `bncs:"len=GameCount"`
+	Status    []uint32      `bncs:"void"` // only sent when GameCount is zero
+}
+
+type ServerSID_CHECKAD struct {
+	AdId          uint32
+	FileExtension uint32
+	FileTime      FileTime
+	FileName      []byte
+	URL           []byte
+}
+
+type ServerSID_READMEMORY struct {
+	RequestId uint32
+	Address   uint32
+	Length    uint32
+}
+
+type ServerSID_REGISTRY struct {
+	Cookie  uint32
+	HKey    uint32
+	KeyPath []byte
+	KeyName []byte
+}
+
+type ServerSID_MESSAGEBOX struct {
+	Style   uint32
+	Text    []byte
+	Caption []byte
+}
+
+type ServerSID_STARTADVEX2 struct {
+	Status uint32
+}
+
+type ServerSID_ANNOUNCEMENT struct {
+	Text []byte
+}
+
+type ServerSID_WRITECOOKIE struct {
+	Unknown  [2]uint32
+	KeyName  []byte
+	KeyValue []byte
+}
+
+type ServerSID_READCOOKIE struct {
+	Cookie  uint32
+	Unknown uint32
+	KeyName []byte
+}
+
+type ServerSID_READUSERDATA struct {
+	AccountCount uint32
+	KeyCount     uint32
+	RequestId    uint32
+	Values       [][]byte `bncs:"void"` // one per account and key
+}
+
+type LadderEntry struct {
+	Wins                uint32
+	Losses              uint32
+	Disconnects         uint32
+	Rating              uint32
+	Rank                uint32
+	OfficialWins        uint32
+	OfficialLosses      uint32
+	OfficialDisconnects uint32
+	OfficialRating      uint32
+	Unknown             uint32
+	OfficialRank        uint32
+	Unknown2            [2]uint32
+	HighestRating       uint32
+	Unknown3            uint32
+	Season              uint32
+	LastGameTime        FileTime
+	OfficialLastGame    FileTime
+	Name                []byte
+}
+
+type ServerSID_GETLADDERDATA struct {
+	Product      FourCC
+	League       uint32
+	SortMethod   uint32
+	StartingRank uint32
+	Count        uint32
+	Entries      []LadderEntry `bncs:"len=Count"`
+}
+
+type ServerSID_FINDLADDERUSER struct {
+	Rank uint32 // zero-based; 0xFFFFFFFF when not ranked
+}
+
+type ServerSID_CHECKDATAFILE struct {
+	Status uint32
+}
+
+type Realm struct {
+	Unknown     uint32
+	Title       []byte
+	Description []byte
+}
+
+type ServerSID_QUERYREALMS struct {
+	Unknown    uint32
+	RealmCount uint32
+	Realms     []Realm `bncs:"len=RealmCount"`
+}
+
+type ServerSID_PROFILE struct {
+	Cookie      uint32
+	Success     uint8
+	Description []byte
+	Location    []byte
+	ClanTag     FourCC
+}
+
+type ServerSID_CREATEACCOUNT2 struct {
+	Status     uint32
+	Suggestion []byte
+}
+
+type RealmLogon struct {
+	Chunk1     [2]uint32
+	IP         [4]byte // network byte order
+	Port       uint32
+	Chunk2     [12]uint32
+	UniqueName []byte
+}
+
+type ServerSID_LOGONREALMEX struct {
+	Cookie uint32
+	Status uint32
+	Logon  []RealmLogon `bncs:"void"` // omitted when the realm logon failed
+}
+
+type ServerSID_STARTVERSIONING2 struct {
+	MPQFileTime FileTime
+	MPQFileName []byte
+	ValueString []byte
+}
+
+type ServerSID_QUERYREALMS2 struct {
+	Unknown    uint32
+	RealmCount uint32
+	Realms     []Realm `bncs:"len=RealmCount"`
+}
+
+type ServerSID_QUERYADURL struct {
+	AdId uint32
+	URL  []byte
+}
+
+type ServerSID_CDKEY3 struct {
+	Result uint32
+	Info   []byte
+}
+
+type ServerSID_WARCRAFTGENERAL struct {
+	Subcommand uint8
+	Data       []byte `bncs:"void"` // depends on the subcommand
+}
+
+type NewsEntry struct {
+	Timestamp uint32
+	Text      []byte
+}
+
+type ServerSID_NEWS_INFO struct {
+	EntryCount      uint8
+	LastLogon       uint32
+	OldestTimestamp uint32
+	NewestTimestamp uint32
+	Entries         []NewsEntry `bncs:"len=EntryCount"`
+}
+
+type ServerSID_AUTH_ACCOUNTCREATE struct {
+	Status uint32
+}
+
+type ServerSID_AUTH_ACCOUNTLOGON struct {
+	Status    uint32
+	Salt      [32]byte
+	ServerKey [32]byte
+}
+
+type ServerSID_AUTH_ACCOUNTLOGONPROOF struct {
+	Status      uint32
+	ServerProof [20]byte
+	Info        []byte
+}
+
+type ServerSID_AUTH_ACCOUNTCHANGE struct {
+	Status    uint32
+	Salt      [32]byte
+	ServerKey [32]byte
+}
+
+type ServerSID_AUTH_ACCOUNTCHANGEPROOF struct {
+	Status      uint32
+	ServerProof [20]byte
+}
+
+type ServerSID_AUTH_ACCOUNTUPGRADE struct {
+	Status      uint32
+	ServerToken uint32
+}
+
+type ServerSID_AUTH_ACCOUNTUPGRADEPROOF struct {
+	Status        uint32
+	PasswordProof [20]byte
+}
+
+type ServerSID_GAMEPLAYERSEARCH struct {
+	PlayerCount uint8
+	Players     [][]byte `bncs:"len=PlayerCount"`
+}
+
+type Friend struct {
+	Account      []byte
+	Status       uint8
+	Location     uint8
+	Product      FourCC
+	LocationName []byte
+}
+
+type ServerSID_FRIENDSLIST struct {
+	FriendCount uint8
+	Friends     []Friend `bncs:"len=FriendCount"`
+}
+
+type ServerSID_FRIENDSUPDATE struct {
+	Index        uint8
+	Location     uint8
+	Status       uint8
+	Product      FourCC
+	LocationName []byte
+}
+
+type ServerSID_FRIENDSADD struct {
+	Account      []byte
+	Location     uint8
+	Status       uint8
+	Product      FourCC
+	LocationName []byte
+}
+
+type ServerSID_FRIENDSREMOVE struct {
+	Index uint8
+}
+
+type ServerSID_FRIENDSPOSITION struct {
+	OldIndex uint8
+	NewIndex uint8
+}
+
+type ServerSID_CLANFINDCANDIDATES struct {
+	Cookie         uint32
+	Status         uint8
+	CandidateCount uint8
+	Candidates     [][]byte `bncs:"len=CandidateCount"`
+}
+
+type ServerSID_CLANINVITEMULTIPLE struct {
+	Cookie uint32
+	Result uint8
+	Failed [][]byte `bncs:"void"` // accounts that could not be invited
+}
+
+type ServerSID_CLANCREATIONINVITATION struct {
+	Cookie    uint32
+	ClanTag   FourCC
+	ClanName  []byte
+	Inviter   []byte
+	UserCount uint8
+	Usernames [][]byte `bncs:"len=UserCount"`
+}
+
+type ServerSID_CLANDISBAND struct {
+	Cookie uint32
+	Result uint8
+}
+
+type ServerSID_CLANMAKECHIEFTAIN struct {
+	Cookie uint32
+	Status uint8
+}
+
+type ServerSID_CLANINFO struct {
+	Unknown uint8
+	ClanTag FourCC
+	Rank    uint8
+}
+
+type ServerSID_CLANQUITNOTIFY struct {
+	Status uint8
+}
+
+type ServerSID_CLANINVITATION struct {
+	Cookie uint32
+	Result uint8
+}
+
+type ServerSID_CLANREMOVEMEMBER struct {
+	Cookie uint32
+	Status uint8
+}
+
+type ServerSID_CLANINVITATIONRESPONSE struct {
+	Cookie   uint32
+	ClanTag  FourCC
+	ClanName []byte
+	Inviter  []byte
+}
+
+type ServerSID_CLANRANKCHANGE struct {
+	Cookie uint32
+	Status uint8
+}
+
+type ServerSID_CLANMOTD struct {
+	Cookie  uint32
+	Unknown uint32
+	MOTD    []byte
+}
+
+type ClanMember struct {
+	Username []byte
+	Rank     uint8
+	Online   uint8
+	Location []byte
+}
+
+type ServerSID_CLANMEMBERLIST struct {
+	Cookie      uint32
+	MemberCount uint8
+	Members     []ClanMember `bncs:"len=MemberCount"`
+}
+
+type ServerSID_CLANMEMBERREMOVED struct {
+	Username []byte
+}
+
+type ServerSID_CLANMEMBERSTATUSCHANGE struct {
+	Username []byte
+	Rank     uint8
+	Status   uint8
+	Location []byte
+}
+
+type ServerSID_CLANMEMBERRANKCHANGE struct {
+	OldRank   uint8
+	NewRank   uint8
+	ChangedBy []byte
+}
+
+type ServerSID_CLANMEMBERINFORMATION struct {
+	Cookie     uint32
+	Status     uint8
+	ClanName   []byte
+	Rank       uint8
+	DateJoined FileTime
+}
+
+func (ServerSID_NULL) MessageID() message.MessageId             { return message.SID_NULL }
+func (ServerSID_PING) MessageID() message.MessageId             { return message.SID_PING }
+func (ServerSID_AUTH_INFO) MessageID() message.MessageId        { return message.SID_AUTH_INFO }
+func (ServerSID_AUTH_CHECK) MessageID() message.MessageId       { return message.SID_AUTH_CHECK }
+func (ServerSID_CLIENTID) MessageID() message.MessageId         { return message.SID_CLIENTID }
+func (ServerSID_LOGONCHALLENGE) MessageID() message.MessageId   { return message.SID_LOGONCHALLENGE }
+func (ServerSID_LOGONCHALLENGEEX) MessageID() message.MessageId { return message.SID_LOGONCHALLENGEEX }
+func (ServerSID_STARTVERSIONING) MessageID() message.MessageId  { return message.SID_STARTVERSIONING }
+func (ServerSID_REPORTVERSION) MessageID() message.MessageId    { return message.SID_REPORTVERSION }
+func (ServerSID_LOGONRESPONSE) MessageID() message.MessageId    { return message.SID_LOGONRESPONSE }
+func (ServerSID_LOGONRESPONSE2) MessageID() message.MessageId   { return message.SID_LOGONRESPONSE2 }
+func (ServerSID_CREATEACCOUNT) MessageID() message.MessageId    { return message.SID_CREATEACCOUNT }
+func (ServerSID_CHANGEPASSWORD) MessageID() message.MessageId   { return message.SID_CHANGEPASSWORD }
+func (ServerSID_SETEMAIL) MessageID() message.MessageId         { return message.SID_SETEMAIL }
+func (ServerSID_CDKEY) MessageID() message.MessageId            { return message.SID_CDKEY }
+func (ServerSID_CDKEY2) MessageID() message.MessageId           { return message.SID_CDKEY2 }
+func (ServerSID_GETICONDATA) MessageID() message.MessageId      { return message.SID_GETICONDATA }
+func (ServerSID_GETFILETIME) MessageID() message.MessageId      { return message.SID_GETFILETIME }
+func (ServerSID_CHECKDATAFILE2) MessageID() message.MessageId   { return message.SID_CHECKDATAFILE2 }
+func (ServerSID_WARDEN) MessageID() message.MessageId           { return message.SID_WARDEN }
+func (ServerSID_OPTIONALWORK) MessageID() message.MessageId     { return message.SID_OPTIONALWORK }
+func (ServerSID_REQUIREDWORK) MessageID() message.MessageId     { return message.SID_REQUIREDWORK }
+func (ServerSID_TOURNAMENT) MessageID() message.MessageId       { return message.SID_TOURNAMENT }
+func (ServerSID_STARTADVEX3) MessageID() message.MessageId      { return message.SID_STARTADVEX3 }
+func (ServerSID_ENTERCHAT) MessageID() message.MessageId        { return message.SID_ENTERCHAT }
+func (ServerSID_GETCHANNELLIST) MessageID() message.MessageId   { return message.SID_GETCHANNELLIST }
+func (ServerSID_CHATEVENT) MessageID() message.MessageId        { return message.SID_CHATEVENT }
+func (ServerSID_FLOODDETECTED) MessageID() message.MessageId    { return message.SID_FLOODDETECTED }
+func (ServerSID_SERVERLIST) MessageID() message.MessageId       { return message.SID_SERVERLIST }
+func (ServerSID_STARTADVEX) MessageID() message.MessageId       { return message.SID_STARTADVEX }
+func (ServerSID_GETADVLISTEX) MessageID() message.MessageId     { return message.SID_GETADVLISTEX }
+func (ServerSID_CHECKAD) MessageID() message.MessageId          { return message.SID_CHECKAD }
+func (ServerSID_READMEMORY) MessageID() message.MessageId       { return message.SID_READMEMORY }
+func (ServerSID_REGISTRY) MessageID() message.MessageId         { return message.SID_REGISTRY }
+func (ServerSID_MESSAGEBOX) MessageID() message.MessageId       { return message.SID_MESSAGEBOX }
+func (ServerSID_STARTADVEX2) MessageID() message.MessageId      { return message.SID_STARTADVEX2 }
+func (ServerSID_ANNOUNCEMENT) MessageID() message.MessageId     { return message.SID_ANNOUNCEMENT }
+func (ServerSID_WRITECOOKIE) MessageID() message.MessageId      { return message.SID_WRITECOOKIE }
+func (ServerSID_READCOOKIE) MessageID() message.MessageId       { return message.SID_READCOOKIE }
+func (ServerSID_READUSERDATA) MessageID() message.MessageId     { return message.SID_READUSERDATA }
+func (ServerSID_GETLADDERDATA) MessageID() message.MessageId    { return message.SID_GETLADDERDATA }
+func (ServerSID_FINDLADDERUSER) MessageID() message.MessageId   { return message.SID_FINDLADDERUSER }
+func (ServerSID_CHECKDATAFILE) MessageID() message.MessageId    { return message.SID_CHECKDATAFILE }
+func (ServerSID_QUERYREALMS) MessageID() message.MessageId      { return message.SID_QUERYREALMS }
+func (ServerSID_PROFILE) MessageID() message.MessageId          { return message.SID_PROFILE }
+func (ServerSID_CREATEACCOUNT2) MessageID() message.MessageId   { return message.SID_CREATEACCOUNT2 }
+func (ServerSID_LOGONREALMEX) MessageID() message.MessageId     { return message.SID_LOGONREALMEX }
+func (ServerSID_STARTVERSIONING2) MessageID() message.MessageId { return message.SID_STARTVERSIONING2 }
+func (ServerSID_QUERYREALMS2) MessageID() message.MessageId     { return message.SID_QUERYREALMS2 }
+func (ServerSID_QUERYADURL) MessageID() message.MessageId       { return message.SID_QUERYADURL }
+func (ServerSID_CDKEY3) MessageID() message.MessageId           { return message.SID_CDKEY3 }
+func (ServerSID_WARCRAFTGENERAL) MessageID() message.MessageId  { return message.SID_WARCRAFTGENERAL }
+func (ServerSID_NEWS_INFO) MessageID() message.MessageId        { return message.SID_NEWS_INFO }
+func (ServerSID_AUTH_ACCOUNTCREATE) MessageID() message.MessageId {
+	return message.SID_AUTH_ACCOUNTCREATE
+}
+func (ServerSID_AUTH_ACCOUNTLOGON) MessageID() message.MessageId {
+	return message.SID_AUTH_ACCOUNTLOGON
+}
+func (ServerSID_AUTH_ACCOUNTLOGONPROOF) MessageID() message.MessageId {
+	return message.SID_AUTH_ACCOUNTLOGONPROOF
+}
+func (ServerSID_AUTH_ACCOUNTCHANGE) MessageID() message.MessageId {
+	return message.SID_AUTH_ACCOUNTCHANGE
+}
+func (ServerSID_AUTH_ACCOUNTCHANGEPROOF) MessageID() message.MessageId {
+	return message.SID_AUTH_ACCOUNTCHANGEPROOF
+}
+func (ServerSID_AUTH_ACCOUNTUPGRADE) MessageID() message.MessageId {
+	return message.SID_AUTH_ACCOUNTUPGRADE
+}
+func (ServerSID_AUTH_ACCOUNTUPGRADEPROOF) MessageID() message.MessageId {
+	return message.SID_AUTH_ACCOUNTUPGRADEPROOF
+}
+func (ServerSID_GAMEPLAYERSEARCH) MessageID() message.MessageId { return message.SID_GAMEPLAYERSEARCH }
+func (ServerSID_FRIENDSLIST) MessageID() message.MessageId      { return message.SID_FRIENDSLIST }
+func (ServerSID_FRIENDSUPDATE) MessageID() message.MessageId    { return message.SID_FRIENDSUPDATE }
+func (ServerSID_FRIENDSADD) MessageID() message.MessageId       { return message.SID_FRIENDSADD }
+func (ServerSID_FRIENDSREMOVE) MessageID() message.MessageId    { return message.SID_FRIENDSREMOVE }
+func (ServerSID_FRIENDSPOSITION) MessageID() message.MessageId  { return message.SID_FRIENDSPOSITION }
+func (ServerSID_CLANFINDCANDIDATES) MessageID() message.MessageId {
+	return message.SID_CLANFINDCANDIDATES
+}
+func (ServerSID_CLANINVITEMULTIPLE) MessageID() message.MessageId {
+	return message.SID_CLANINVITEMULTIPLE
+}
+func (ServerSID_CLANCREATIONINVITATION) MessageID() message.MessageId {
+	return message.SID_CLANCREATIONINVITATION
+}
+func (ServerSID_CLANDISBAND) MessageID() message.MessageId { return message.SID_CLANDISBAND }
+func (ServerSID_CLANMAKECHIEFTAIN) MessageID() message.MessageId {
+	return message.SID_CLANMAKECHIEFTAIN
+}
+func (ServerSID_CLANINFO) MessageID() message.MessageId         { return message.SID_CLANINFO }
+func (ServerSID_CLANQUITNOTIFY) MessageID() message.MessageId   { return message.SID_CLANQUITNOTIFY }
+func (ServerSID_CLANINVITATION) MessageID() message.MessageId   { return message.SID_CLANINVITATION }
+func (ServerSID_CLANREMOVEMEMBER) MessageID() message.MessageId { return message.SID_CLANREMOVEMEMBER }
+func (ServerSID_CLANINVITATIONRESPONSE) MessageID() message.MessageId {
+	return message.SID_CLANINVITATIONRESPONSE
+}
+func (ServerSID_CLANRANKCHANGE) MessageID() message.MessageId { return message.SID_CLANRANKCHANGE }
+func (ServerSID_CLANMOTD) MessageID() message.MessageId       { return message.SID_CLANMOTD }
+func (ServerSID_CLANMEMBERLIST) MessageID() message.MessageId { return message.SID_CLANMEMBERLIST }
+func (ServerSID_CLANMEMBERREMOVED) MessageID() message.MessageId {
+	return message.SID_CLANMEMBERREMOVED
+}
+func (ServerSID_CLANMEMBERSTATUSCHANGE) MessageID() message.MessageId {
+	return message.SID_CLANMEMBERSTATUSCHANGE
+}
+func (ServerSID_CLANMEMBERRANKCHANGE) MessageID() message.MessageId {
+	return message.SID_CLANMEMBERRANKCHANGE
+}
+func (ServerSID_CLANMEMBERINFORMATION) MessageID() message.MessageId {
+	return message.SID_CLANMEMBERINFORMATION
+}
@@ -0,0 +1,668 @@
+// Package config loads the server configuration. Values are taken from the
+// defaults, then the JSON file, then GOBNCS_* environment variables and
+// finally command-line flags.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/carlbennett/gobncs/account"
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/extrawork"
+	"github.com/carlbennett/gobncs/logging"
+	"github.com/carlbennett/gobncs/message"
+	"github.com/carlbennett/gobncs/permission"
+	"github.com/carlbennett/gobncs/realm"
+	"github.com/carlbennett/gobncs/trace"
+	"github.com/carlbennett/gobncs/util"
+	"github.com/carlbennett/gobncs/versioncheck"
+)
+
+const (
+	ENV_PREFIX   = "GOBNCS_"
+	PROXY_PREFIX = "proxy+"
+)
+
+// Admin serves the admin API and grants operator permissions to accounts,
+// which apply to the API and in game alike.
+type Admin struct {
+	Address   string              `json:"address"`   // loopback address serving the admin API; empty disables
+	Operators map[string][]string `json:"operators"` // account name to permissions, e.g. {"Ops": ["view", "kick"]}
+}
+
+type Data struct {
+	Accounts    string `json:"accounts"`
+	Bans        string `json:"bans"`
+	Brackets    string `json:"brackets"`
+	Crashes     string `json:"crashes"`
+	Files       string `json:"files"`
+	Maildir     string `json:"maildir"`
+	News        string `json:"news"`
+	Tournaments string `json:"tournaments"`
+	Warden      string `json:"warden"`
+	WorkResults string `json:"work_results"`
+}
+
+type ExtraWork struct {
+	MPQFileName string `json:"mpq_file_name"`
+	Required    bool   `json:"required"`
+}
+
+type Limits struct {
+	CrashReportsPerHour int    `json:"crash_reports_per_hour"` // per address; zero disables
+	MaxCrashReportsMB   int    `json:"max_crash_reports_mb"`   // total size of data.crashes; zero disables
+	MaxSpawnsPerKey     int    `json:"max_spawns_per_key"`
+	OutOfPhaseAction    string `json:"out_of_phase_action"` // disconnect, error or ignore
+	ResyncPolicy        string `json:"resync_policy"`       // none or scan
+}
+
+// FloodLimits are token bucket rates per second and their bursts; a zero rate
+// disables the bucket.
+type FloodLimits struct {
+	ChatBurst    int     `json:"chat_burst"`
+	ChatRate     float64 `json:"chat_rate"`
+	MessageBurst int     `json:"message_burst"`
+	MessageRate  float64 `json:"message_rate"`
+}
+
+type Flood struct {
+	FloodLimits
+	ConnectionsPerMinute int                    `json:"connections_per_minute"` // per address; zero disables
+	ExemptAccounts       []string               `json:"exempt_accounts"`        // e.g. whitelisted bots
+	ExemptAddresses      []string               `json:"exempt_addresses"`       // CIDRs or addresses
+	MaxConnectionsPerIP  int                    `json:"max_connections_per_ip"` // zero disables
+	Products             map[string]FloodLimits `json:"products"`               // keyed by product code; non-zero fields override
+}
+
+// Listener is a listen address. In JSON it is either an object or a plain
+// address string; in flags and environment variables a "proxy+" prefix
+// enables the PROXY protocol, e.g. "proxy+[::]:6113", and keeps the trusted
+// proxies configured for that address.
+type Listener struct {
+	Address        string   `json:"address"`
+	ProxyProtocol  bool     `json:"proxy_protocol"`  // expect a PROXY v1/v2 header from trusted proxies
+	TrustedProxies []string `json:"trusted_proxies"` // CIDRs or addresses; required with proxy_protocol
+}
+
+func (l *Listener) UnmarshalJSON(raw []byte) error {
+	var address string
+	if json.Unmarshal(raw, &address) == nil {
+		*l = ParseListener(address)
+		return nil
+	}
+
+	type plain Listener
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode((*plain)(l))
+}
+
+func (l Listener) String() string {
+	if l.ProxyProtocol {
+		return PROXY_PREFIX + l.Address
+	}
+	return l.Address
+}
+
+func ParseListener(value string) Listener {
+	if strings.HasPrefix(value, PROXY_PREFIX) {
+		return Listener{Address: strings.TrimPrefix(value, PROXY_PREFIX), ProxyProtocol: true}
+	}
+	return Listener{Address: value}
+}
+
+type Log struct {
+	Format     string            `json:"format"`     // text or json
+	Level      string            `json:"level"`      // debug, info, warn or error
+	Prefix     string            `json:"prefix"`     // text format only
+	Source     bool              `json:"source"`     // include the file and line of each record
+	Subsystems map[string]string `json:"subsystems"` // levels overriding level, e.g. {"packet": "debug"}
+}
+
+type Mail struct {
+	From string `json:"from"`
+}
+
+type Metrics struct {
+	Address string `json:"address"` // serves /metrics over HTTP; empty disables
+}
+
+// Realm is offered to Diablo II clients, which are handed its address when
+// they log on to it.
+type Realm struct {
+	Address     string `json:"address"` // IPv4 address and port of the realm server
+	Description string `json:"description"`
+	Name        string `json:"name"`
+}
+
+type Shutdown struct {
+	Notice         string `json:"notice"` // broadcast to logged on clients; empty to skip
+	TimeoutSeconds int    `json:"timeout_seconds"`
+}
+
+// Timeouts are in seconds; zero disables a timeout.
+type Timeouts struct {
+	HandshakeSeconds int `json:"handshake_seconds"` // from connecting until logged on
+	IdleSeconds      int `json:"idle_seconds"`      // between messages once logged on
+	ProtocolSeconds  int `json:"protocol_seconds"`  // from connecting until the protocol type byte
+}
+
+// Trace records raw frames of matching connections for debugging. With no
+// filters every connection is traced.
+type Trace struct {
+	Accounts  []string `json:"accounts"`
+	Addresses []string `json:"addresses"` // CIDRs or addresses
+	Directory string   `json:"directory"`
+	Enabled   bool     `json:"enabled"`
+	Format    string   `json:"format"` // hex or pcapng
+}
+
+type VersionCheck struct {
+	ExeHash     uint32 `json:"exe_hash"`    // zero accepts any checksum
+	ExeVersion  uint32 `json:"exe_version"` // zero accepts any version
+	MPQFileName string `json:"mpq_file_name"`
+	PatchPath   string `json:"patch_path"`
+	ValueString string `json:"value_string"`
+	VersionByte uint32 `json:"version_byte"`
+}
+
+type Config struct {
+	Admin        Admin                   `json:"admin"`
+	Data         Data                    `json:"data"`
+	ExtraWork    map[string]ExtraWork    `json:"extra_work"` // keyed by product code, e.g. "STAR"
+	Flood        Flood                   `json:"flood"`
+	Limits       Limits                  `json:"limits"`
+	Listen       []Listener              `json:"listen"`
+	Log          Log                     `json:"log"`
+	Mail         Mail                    `json:"mail"`
+	Metrics      Metrics                 `json:"metrics"`
+	Realms       []Realm                 `json:"realms"`
+	Shutdown     Shutdown                `json:"shutdown"`
+	Timeouts     Timeouts                `json:"timeouts"`
+	Trace        Trace                   `json:"trace"`
+	VersionCheck map[string]VersionCheck `json:"version_check"` // keyed by product code; merged over the built-in settings
+}
+
+// ValidationError lists every problem found in a configuration.
+type ValidationError []string
+
+func (e ValidationError) Error() string {
+	return "invalid configuration:\n  " + strings.Join(e, "\n  ")
+}
+
+func Default() *Config {
+	return &Config{
+		Data: Data{
+			Accounts:    "accounts.json",
+			Bans:        "bans.json",
+			Brackets:    "brackets",
+			Crashes:     "crashes",
+			Files:       "files",
+			Maildir:     "maildir",
+			News:        "news.json",
+			Tournaments: "tournaments.json",
+			Warden:      "warden.json",
+			WorkResults: "workresults",
+		},
+		Flood: Flood{
+			FloodLimits: FloodLimits{
+				ChatBurst:    5,
+				ChatRate:     1,
+				MessageBurst: 40,
+				MessageRate:  10,
+			},
+			ConnectionsPerMinute: 30,
+			MaxConnectionsPerIP:  8,
+		},
+		Limits: Limits{
+			CrashReportsPerHour: 5,
+			MaxCrashReportsMB:   64,
+			MaxSpawnsPerKey:     4,
+			OutOfPhaseAction:    "disconnect",
+			ResyncPolicy:        "none",
+		},
+		Listen: []Listener{{Address: ":6112"}},
+		Log: Log{
+			Format: "text",
+			Level:  "info",
+		},
+		Mail: Mail{
+			From: "noreply@localhost",
+		},
+		Shutdown: Shutdown{
+			Notice:         "The server is shutting down.",
+			TimeoutSeconds: 10,
+		},
+		Timeouts: Timeouts{
+			HandshakeSeconds: 60,
+			IdleSeconds:      600, // clients send SID_NULL every 8 minutes
+			ProtocolSeconds:  10,
+		},
+		Trace: Trace{
+			Directory: "traces",
+			Format:    "hex",
+		},
+	}
+}
+
+// Load reads the configuration file over the defaults. A missing file is not
+// an error unless required is set.
+func Load(path string, required bool) (*Config, error) {
+	c := Default()
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) && !required {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %v", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(c); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %v", path, err)
+	}
+	return c, nil
+}
+
+// settable options, shared by environment variables and the -set flag
+var options = map[string]func(c *Config, value string) error{
+	"admin.address":                 func(c *Config, value string) error { c.Admin.Address = value; return nil },
+	"data.accounts":                 func(c *Config, value string) error { c.Data.Accounts = value; return nil },
+	"data.bans":                     func(c *Config, value string) error { c.Data.Bans = value; return nil },
+	"data.brackets":                 func(c *Config, value string) error { c.Data.Brackets = value; return nil },
+	"data.crashes":                  func(c *Config, value string) error { c.Data.Crashes = value; return nil },
+	"data.files":                    func(c *Config, value string) error { c.Data.Files = value; return nil },
+	"data.maildir":                  func(c *Config, value string) error { c.Data.Maildir = value; return nil },
+	"data.news":                     func(c *Config, value string) error { c.Data.News = value; return nil },
+	"data.tournaments":              func(c *Config, value string) error { c.Data.Tournaments = value; return nil },
+	"data.warden":                   func(c *Config, value string) error { c.Data.Warden = value; return nil },
+	"data.work_results":             func(c *Config, value string) error { c.Data.WorkResults = value; return nil },
+	"limits.out_of_phase_action":    func(c *Config, value string) error { c.Limits.OutOfPhaseAction = value; return nil },
+	"limits.resync_policy":          func(c *Config, value string) error { c.Limits.ResyncPolicy = value; return nil },
+	"log.format":                    func(c *Config, value string) error { c.Log.Format = value; return nil },
+	"log.level":                     func(c *Config, value string) error { c.Log.Level = value; return nil },
+	"log.prefix":                    func(c *Config, value string) error { c.Log.Prefix = value; return nil },
+	"mail.from":                     func(c *Config, value string) error { c.Mail.From = value; return nil },
+	"metrics.address":               func(c *Config, value string) error { c.Metrics.Address = value; return nil },
+	"shutdown.notice":               func(c *Config, value string) error { c.Shutdown.Notice = value; return nil },
+	"trace.directory":               func(c *Config, value string) error { c.Trace.Directory = value; return nil },
+	"trace.format":                  func(c *Config, value string) error { c.Trace.Format = value; return nil },
+	"flood.chat_burst":              intOption(func(c *Config) *int { return &c.Flood.ChatBurst }),
+	"flood.chat_rate":               floatOption(func(c *Config) *float64 { return &c.Flood.ChatRate }),
+	"flood.connections_per_minute":  intOption(func(c *Config) *int { return &c.Flood.ConnectionsPerMinute }),
+	"flood.max_connections_per_ip":  intOption(func(c *Config) *int { return &c.Flood.MaxConnectionsPerIP }),
+	"flood.message_burst":           intOption(func(c *Config) *int { return &c.Flood.MessageBurst }),
+	"flood.message_rate":            floatOption(func(c *Config) *float64 { return &c.Flood.MessageRate }),
+	"limits.crash_reports_per_hour": intOption(func(c *Config) *int { return &c.Limits.CrashReportsPerHour }),
+	"limits.max_crash_reports_mb":   intOption(func(c *Config) *int { return &c.Limits.MaxCrashReportsMB }),
+	"limits.max_spawns_per_key":     intOption(func(c *Config) *int { return &c.Limits.MaxSpawnsPerKey }),
+	"shutdown.timeout_seconds":      intOption(func(c *Config) *int { return &c.Shutdown.TimeoutSeconds }),
+	"timeouts.handshake_seconds":    intOption(func(c *Config) *int { return &c.Timeouts.HandshakeSeconds }),
+	"timeouts.idle_seconds":         intOption(func(c *Config) *int { return &c.Timeouts.IdleSeconds }),
+	"timeouts.protocol_seconds":     intOption(func(c *Config) *int { return &c.Timeouts.ProtocolSeconds }),
+	"log.source": func(c *Config, value string) error {
+		source, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean (%s)", value)
+		}
+		c.Log.Source = source
+		return nil
+	},
+	"log.subsystems": func(c *Config, value string) error {
+		c.Log.Subsystems = map[string]string{}
+		for _, item := range splitList(value) {
+			name, level, ok := strings.Cut(item, "=")
+			if !ok {
+				return fmt.Errorf("invalid subsystem level (%s); expected name=level", item)
+			}
+			c.Log.Subsystems[strings.TrimSpace(name)] = strings.TrimSpace(level)
+		}
+		return nil
+	},
+	"trace.accounts": func(c *Config, value string) error {
+		c.Trace.Accounts = splitList(value)
+		return nil
+	},
+	"trace.addresses": func(c *Config, value string) error {
+		c.Trace.Addresses = splitList(value)
+		return nil
+	},
+	"trace.enabled": func(c *Config, value string) error {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean (%s)", value)
+		}
+		c.Trace.Enabled = enabled
+		return nil
+	},
+	"admin.operators": func(c *Config, value string) error {
+		c.Admin.Operators = map[string][]string{}
+		for _, item := range strings.Split(value, ";") {
+			if strings.TrimSpace(item) == "" {
+				continue
+			}
+			name, permissions, ok := strings.Cut(item, "=")
+			if !ok {
+				return fmt.Errorf("invalid operator (%s); expected account=permission,...", item)
+			}
+			c.Admin.Operators[strings.TrimSpace(name)] = splitList(permissions)
+		}
+		return nil
+	},
+	"flood.exempt_accounts": func(c *Config, value string) error {
+		c.Flood.ExemptAccounts = splitList(value)
+		return nil
+	},
+	"flood.exempt_addresses": func(c *Config, value string) error {
+		c.Flood.ExemptAddresses = splitList(value)
+		return nil
+	},
+	"listen": func(c *Config, value string) error {
+		trusted := map[string][]string{}
+		for _, listener := range c.Listen {
+			trusted[listener.Address] = listener.TrustedProxies
+		}
+		c.Listen = nil
+		for _, address := range splitList(value) {
+			listener := ParseListener(address)
+			if listener.ProxyProtocol {
+				listener.TrustedProxies = trusted[listener.Address]
+			}
+			c.Listen = append(c.Listen, listener)
+		}
+		return nil
+	},
+}
+
+func intOption(field func(c *Config) *int) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid number (%s)", value)
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+func floatOption(field func(c *Config) *float64) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number (%s)", value)
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+// splitList splits a comma-separated option value, dropping empty entries.
+func splitList(value string) []string {
+	var values []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	return values
+}
+
+// Options returns the keys accepted by Set, sorted.
+func Options() []string {
+	keys := make([]string, 0, len(options))
+	for key := range options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func EnvName(key string) string {
+	return ENV_PREFIX + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+func (c *Config) Set(key string, value string) error {
+	set, ok := options[key]
+	if !ok {
+		return fmt.Errorf("unknown config option (%s)", key)
+	}
+	if err := set(c, value); err != nil {
+		return fmt.Errorf("config option %s: %v", key, err)
+	}
+	return nil
+}
+
+// ApplyEnv applies the GOBNCS_* variables named after each option, e.g.
+// GOBNCS_LOG_LEVEL for log.level.
+func (c *Config) ApplyEnv(lookup func(string) (string, bool)) error {
+	for _, key := range Options() {
+		if value, ok := lookup(EnvName(key)); ok {
+			if err := c.Set(key, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Config) Validate() error {
+	var problems ValidationError
+
+	if len(c.Listen) == 0 {
+		problems = append(problems, "listen: at least one address is required")
+	}
+	addresses := map[string]bool{}
+	for i, listener := range c.Listen {
+		if _, port, err := net.SplitHostPort(listener.Address); err != nil || port == "" {
+			problems = append(problems, fmt.Sprintf("listen[%d]: invalid address (%s)", i, listener.Address))
+		} else if addresses[listener.Address] {
+			problems = append(problems, fmt.Sprintf("listen[%d]: duplicate address (%s)", i, listener.Address))
+		}
+		addresses[listener.Address] = true
+		if len(listener.TrustedProxies) > 0 && !listener.ProxyProtocol {
+			problems = append(problems, fmt.Sprintf("listen[%d]: trusted_proxies requires proxy_protocol", i))
+		}
+		if listener.ProxyProtocol && len(listener.TrustedProxies) == 0 {
+			problems = append(problems, fmt.Sprintf("listen[%d]: proxy_protocol requires trusted_proxies", i))
+		}
+		if _, err := util.ParseNetworks(listener.TrustedProxies); err != nil {
+			problems = append(problems, fmt.Sprintf("listen[%d]: trusted_proxies: %v", i, err))
+		}
+	}
+
+	if c.Admin.Address != "" {
+		host, port, err := net.SplitHostPort(c.Admin.Address)
+		ip := net.ParseIP(host)
+		switch {
+		case err != nil || port == "":
+			problems = append(problems, fmt.Sprintf("admin.address: invalid address (%s)", c.Admin.Address))
+		case host != "localhost" && (ip == nil || !ip.IsLoopback()):
+			problems = append(problems, fmt.Sprintf("admin.address: must be a loopback address (%s)", c.Admin.Address))
+		case addresses[c.Admin.Address] || c.Admin.Address == c.Metrics.Address:
+			problems = append(problems, fmt.Sprintf("admin.address: already in use (%s)", c.Admin.Address))
+		}
+	}
+	for _, name := range sortedKeys(c.Admin.Operators) {
+		if err := account.ValidateUsername(name); err != nil {
+			problems = append(problems, fmt.Sprintf("admin.operators.%s: %v", name, err))
+		}
+		if _, err := permission.Parse(c.Admin.Operators[name]); err != nil {
+			problems = append(problems, fmt.Sprintf("admin.operators.%s: %v", name, err))
+		}
+	}
+
+	if c.Metrics.Address != "" {
+		if _, port, err := net.SplitHostPort(c.Metrics.Address); err != nil || port == "" {
+			problems = append(problems, fmt.Sprintf("metrics.address: invalid address (%s)", c.Metrics.Address))
+		} else if addresses[c.Metrics.Address] {
+			problems = append(problems, fmt.Sprintf("metrics.address: already used by listen (%s)", c.Metrics.Address))
+		}
+	}
+
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+		problems = append(problems, fmt.Sprintf("log.level: %v", err))
+	}
+	if _, err := logging.ParseFormat(c.Log.Format); err != nil {
+		problems = append(problems, fmt.Sprintf("log.format: %v", err))
+	}
+	for _, name := range sortedKeys(c.Log.Subsystems) {
+		if !logging.KnownSubsystem(name) {
+			problems = append(problems, fmt.Sprintf("log.subsystems.%s: unknown subsystem; expected one of %s", name, strings.Join(logging.Subsystems(), ", ")))
+		} else if _, err := logging.ParseLevel(c.Log.Subsystems[name]); err != nil {
+			problems = append(problems, fmt.Sprintf("log.subsystems.%s: %v", name, err))
+		}
+	}
+
+	switch c.Limits.OutOfPhaseAction {
+	case "disconnect", "error", "ignore":
+	default:
+		problems = append(problems, fmt.Sprintf("limits.out_of_phase_action: unknown action (%s)", c.Limits.OutOfPhaseAction))
+	}
+	if _, err := message.ParseResyncPolicy(c.Limits.ResyncPolicy); err != nil {
+		problems = append(problems, fmt.Sprintf("limits.resync_policy: %v", err))
+	}
+	if c.Limits.MaxSpawnsPerKey < 0 {
+		problems = append(problems, "limits.max_spawns_per_key: must not be negative")
+	}
+	if c.Limits.CrashReportsPerHour < 0 || c.Limits.MaxCrashReportsMB < 0 {
+		problems = append(problems, "limits: crash report limits must not be negative")
+	}
+
+	if c.Flood.ConnectionsPerMinute < 0 || c.Flood.MaxConnectionsPerIP < 0 {
+		problems = append(problems, "flood: connection limits must not be negative")
+	}
+	problems = append(problems, validateFloodLimits("flood", c.Flood.FloodLimits)...)
+	for _, code := range sortedKeys(c.Flood.Products) {
+		if _, ok := clientstate.CodeToProduct(code); !ok {
+			problems = append(problems, fmt.Sprintf("flood.products.%s: unknown product", code))
+		}
+		problems = append(problems, validateFloodLimits("flood.products."+code, c.Flood.Products[code])...)
+	}
+	if _, err := util.ParseNetworks(c.Flood.ExemptAddresses); err != nil {
+		problems = append(problems, fmt.Sprintf("flood.exempt_addresses: %v", err))
+	}
+
+	if c.Shutdown.TimeoutSeconds < 0 {
+		problems = append(problems, "shutdown.timeout_seconds: must not be negative")
+	}
+	if c.Timeouts.HandshakeSeconds < 0 || c.Timeouts.IdleSeconds < 0 || c.Timeouts.ProtocolSeconds < 0 {
+		problems = append(problems, "timeouts: must not be negative")
+	}
+
+	if _, err := trace.ParseFormat(c.Trace.Format); err != nil {
+		problems = append(problems, fmt.Sprintf("trace.format: %v", err))
+	}
+	if _, err := util.ParseNetworks(c.Trace.Addresses); err != nil {
+		problems = append(problems, fmt.Sprintf("trace.addresses: %v", err))
+	}
+	if c.Trace.Enabled && c.Trace.Directory == "" {
+		problems = append(problems, "trace.directory: a path is required when tracing is enabled")
+	}
+
+	required := []struct{ key, value string }{
+		{"data.accounts", c.Data.Accounts},
+		{"data.bans", c.Data.Bans},
+		{"data.brackets", c.Data.Brackets},
+		{"data.crashes", c.Data.Crashes},
+		{"data.work_results", c.Data.WorkResults},
+	}
+	for _, path := range required {
+		if path.value == "" {
+			problems = append(problems, fmt.Sprintf("%s: a path is required", path.key))
+		}
+	}
+
+	for _, code := range sortedKeys(c.VersionCheck) {
+		value := c.VersionCheck[code]
+		if _, ok := clientstate.CodeToProduct(code); !ok {
+			problems = append(problems, fmt.Sprintf("version_check.%s: unknown product", code))
+		}
+		if value.MPQFileName == "" || value.ValueString == "" {
+			problems = append(problems, fmt.Sprintf("version_check.%s: mpq_file_name and value_string are required", code))
+		}
+	}
+
+	for _, code := range sortedKeys(c.ExtraWork) {
+		if _, ok := clientstate.CodeToProduct(code); !ok {
+			problems = append(problems, fmt.Sprintf("extra_work.%s: unknown product", code))
+		}
+	}
+
+	realms := map[string]bool{}
+	for i, value := range c.Realms {
+		if value.Name == "" {
+			problems = append(problems, fmt.Sprintf("realms[%d]: name is required", i))
+		} else if realms[strings.ToLower(value.Name)] {
+			problems = append(problems, fmt.Sprintf("realms[%d]: duplicate name (%s)", i, value.Name))
+		}
+		realms[strings.ToLower(value.Name)] = true
+		if _, _, ok := realm.Parse(value.Address); !ok {
+			problems = append(problems, fmt.Sprintf("realms[%d]: invalid address (%s); expected an IPv4 address and port", i, value.Address))
+		}
+	}
+
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+// ApplyProtocolSettings replaces the settings that shape replies to clients,
+// the version checks, extra work and realms, with the validated ones from c.
+func (c *Config) ApplyProtocolSettings() {
+	versions := map[clientstate.Product]versioncheck.Settings{}
+	for code, value := range c.VersionCheck {
+		product, _ := clientstate.CodeToProduct(code)
+		versions[product] = versioncheck.Settings{
+			ExeHash:     value.ExeHash,
+			ExeVersion:  value.ExeVersion,
+			MPQFileName: value.MPQFileName,
+			PatchPath:   value.PatchPath,
+			ValueString: value.ValueString,
+			VersionByte: value.VersionByte,
+		}
+	}
+	versioncheck.ReplaceSettings(versions)
+
+	work := map[clientstate.Product]extrawork.Settings{}
+	for code, value := range c.ExtraWork {
+		product, _ := clientstate.CodeToProduct(code)
+		work[product] = extrawork.Settings{
+			MPQFileName: value.MPQFileName,
+			Required:    value.Required,
+		}
+	}
+	extrawork.ReplaceSettings(work)
+
+	realms := make([]realm.Realm, 0, len(c.Realms))
+	for _, value := range c.Realms {
+		ip, port, _ := realm.Parse(value.Address)
+		realms = append(realms, realm.Realm{Description: value.Description, IP: ip, Name: value.Name, Port: port})
+	}
+	realm.Set(realms)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func validateFloodLimits(key string, limits FloodLimits) []string {
+	var problems []string
+	if limits.ChatRate < 0 || limits.MessageRate < 0 || limits.ChatBurst < 0 || limits.MessageBurst < 0 {
+		problems = append(problems, key+": rates and bursts must not be negative")
+	}
+	return problems
+}
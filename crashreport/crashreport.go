@@ -0,0 +1,230 @@
+package crashreport
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/carlbennett/gobncs/clientstate"
+)
+
+// directory holding reports from clients whose product is not known; the
+// product code is chosen by the client, so it only names a directory when it
+// matches a known product
+const UNKNOWN_PRODUCT_DIR = "unknown"
+
+type Report struct {
+	Account       string    `json:"account,omitempty"`
+	ExceptionCode uint32    `json:"exception_code"`
+	ExceptionInfo [2]uint32 `json:"exception_info"` // undocumented values following the exception code
+	ExeInfo       string    `json:"exe_info,omitempty"`
+	ExeVersion    uint32    `json:"exe_version"`
+	Platform      string    `json:"platform"`
+	Product       string    `json:"product"` // four-character product code
+	ReceivedAt    time.Time `json:"received_at"`
+	RemoteIP      string    `json:"remote_ip"`
+	ReportVersion uint32    `json:"report_version"`
+	VersionByte   uint32    `json:"version_byte"`
+}
+
+// Limits keep clients from filling the disk with reports; a zero value
+// disables a limit.
+type Limits struct {
+	MaxBytes       int64 // total size of the reports below the directory
+	PerAddressHour int   // reports accepted from one address per hour
+}
+
+type Summary struct {
+	Count     int
+	FirstSeen time.Time
+	LastSeen  time.Time
+	Signature string
+}
+
+var (
+	ErrAddressLimit  = errors.New("too many crash reports from this address")
+	ErrDirectoryFull = errors.New("crash report directory is full")
+)
+
+var (
+	directory string
+	limits    Limits
+	mutex     = sync.Mutex{}
+	recent    = map[string][]time.Time{} // report times per address within the last hour
+	used      = int64(-1)                // bytes below directory; -1 until measured
+)
+
+// Signature groups crashes of the same client build failing the same way.
+func (r *Report) Signature() string {
+	return fmt.Sprintf("%s/%02X/%08X/%08X@%08X", r.Product, r.VersionByte, r.ExeVersion, r.ExceptionCode, r.ExceptionInfo[0])
+}
+
+func SetDirectory(dir string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	directory = dir
+	used = -1
+}
+
+func SetLimits(value Limits) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	limits = value
+}
+
+// Store writes the report to <directory>/<product>/<timestamp>-<random>.json,
+// or below UNKNOWN_PRODUCT_DIR if the product is not known. It returns
+// ErrAddressLimit or ErrDirectoryFull instead when a limit is reached.
+func Store(report *Report) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+	dir := directory
+	if dir == "" {
+		return fmt.Errorf("no crash report directory configured")
+	}
+
+	pruneLocked(report.ReceivedAt)
+	if limits.PerAddressHour > 0 && len(recent[report.RemoteIP]) >= limits.PerAddressHour {
+		return ErrAddressLimit
+	}
+
+	raw, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if limits.MaxBytes > 0 {
+		if used < 0 {
+			used, err = directorySize(dir)
+			if err != nil {
+				return fmt.Errorf("failed to measure crash report directory: %v", err)
+			}
+		}
+		if used+int64(len(raw)) > limits.MaxBytes {
+			return ErrDirectoryFull
+		}
+	}
+
+	productDir := filepath.Join(dir, UNKNOWN_PRODUCT_DIR)
+	if _, ok := clientstate.CodeToProduct(report.Product); ok {
+		productDir = filepath.Join(dir, report.Product)
+	}
+	err = os.MkdirAll(productDir, 0750)
+	if err != nil {
+		return fmt.Errorf("failed to create crash report directory: %v", err)
+	}
+
+	var unique [4]byte
+	_, err = rand.Read(unique[:])
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.json", report.ReceivedAt.UTC().Format("20060102T150405Z"), hex.EncodeToString(unique[:]))
+
+	err = os.WriteFile(filepath.Join(productDir, name), raw, 0640)
+	if err != nil {
+		return err
+	}
+	if used >= 0 {
+		used += int64(len(raw))
+	}
+	recent[report.RemoteIP] = append(recent[report.RemoteIP], report.ReceivedAt)
+	return nil
+}
+
+// pruneLocked forgets reports received more than an hour before now.
+func pruneLocked(now time.Time) {
+	for address, times := range recent {
+		kept := times[:0]
+		for _, received := range times {
+			if now.Sub(received) < time.Hour {
+				kept = append(kept, received)
+			}
+		}
+		if len(kept) == 0 {
+			delete(recent, address)
+		} else {
+			recent[address] = kept
+		}
+	}
+}
+
+func directorySize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if os.IsNotExist(err) && path == dir {
+			return nil
+		}
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
+
+// Summarize reads every report below dir and groups them by signature, most
+// frequent first.
+func Summarize(dir string) ([]Summary, error) {
+	summaries := map[string]*Summary{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".json") {
+			return nil
+		}
+
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		report := &Report{}
+		if err = json.Unmarshal(raw, report); err != nil {
+			return fmt.Errorf("failed to parse crash report %s: %v", path, err)
+		}
+
+		signature := report.Signature()
+		summary, ok := summaries[signature]
+		if !ok {
+			summary = &Summary{Signature: signature, FirstSeen: report.ReceivedAt, LastSeen: report.ReceivedAt}
+			summaries[signature] = summary
+		}
+		summary.Count++
+		if report.ReceivedAt.Before(summary.FirstSeen) {
+			summary.FirstSeen = report.ReceivedAt
+		}
+		if report.ReceivedAt.After(summary.LastSeen) {
+			summary.LastSeen = report.ReceivedAt
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]Summary, 0, len(summaries))
+	for _, summary := range summaries {
+		list = append(list, *summary)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		return list[i].Signature < list[j].Signature
+	})
+	return list, nil
+}
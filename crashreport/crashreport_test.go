@@ -0,0 +1,89 @@
+package crashreport
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStoreProductDirectory(t *testing.T) {
+	tests := []struct {
+		product string
+		dir     string
+	}{
+		{"STAR", "STAR"},
+		{"../x", UNKNOWN_PRODUCT_DIR},
+		{"ABCD", UNKNOWN_PRODUCT_DIR},
+		{"", UNKNOWN_PRODUCT_DIR},
+	}
+
+	for _, test := range tests {
+		root := t.TempDir()
+		dir := filepath.Join(root, "crashes")
+		SetDirectory(dir)
+		t.Cleanup(func() { SetDirectory("") })
+
+		err := Store(&Report{Product: test.product, ReceivedAt: time.Now()})
+		if err != nil {
+			t.Fatalf("product %q: %v", test.product, err)
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 || entries[0].Name() != test.dir {
+			t.Errorf("product %q: expected only %s below the crash directory, got %v", test.product, test.dir, entries)
+		}
+		if outside, _ := os.ReadDir(root); len(outside) != 1 {
+			t.Errorf("product %q: report written outside the crash directory", test.product)
+		}
+	}
+}
+
+func TestStoreAddressLimit(t *testing.T) {
+	SetDirectory(t.TempDir())
+	SetLimits(Limits{PerAddressHour: 2})
+	t.Cleanup(func() {
+		SetDirectory("")
+		SetLimits(Limits{})
+	})
+
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		if err := Store(&Report{Product: "STAR", ReceivedAt: now, RemoteIP: "192.0.2.1"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Store(&Report{Product: "STAR", ReceivedAt: now, RemoteIP: "192.0.2.1"}); !errors.Is(err, ErrAddressLimit) {
+		t.Fatalf("expected ErrAddressLimit, got %v", err)
+	}
+	if err := Store(&Report{Product: "STAR", ReceivedAt: now, RemoteIP: "192.0.2.2"}); err != nil {
+		t.Fatalf("limit applied to another address: %v", err)
+	}
+	if err := Store(&Report{Product: "STAR", ReceivedAt: now.Add(time.Hour), RemoteIP: "192.0.2.1"}); err != nil {
+		t.Fatalf("limit still applied an hour later: %v", err)
+	}
+}
+
+func TestStoreDirectoryFull(t *testing.T) {
+	dir := t.TempDir()
+	// a report left by an earlier run counts towards the limit
+	if err := os.WriteFile(filepath.Join(dir, "old.json"), make([]byte, 900), 0640); err != nil {
+		t.Fatal(err)
+	}
+	SetDirectory(dir)
+	SetLimits(Limits{MaxBytes: 1200})
+	t.Cleanup(func() {
+		SetDirectory("")
+		SetLimits(Limits{})
+	})
+
+	if err := Store(&Report{Product: "STAR", ReceivedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Store(&Report{Product: "STAR", ReceivedAt: time.Now()}); !errors.Is(err, ErrDirectoryFull) {
+		t.Fatalf("expected ErrDirectoryFull, got %v", err)
+	}
+}
@@ -0,0 +1,178 @@
+package datafile
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/util"
+)
+
+type Approval uint32
+
+const (
+	APPROVAL_NONE     Approval = 0x00 // Not approved
+	APPROVAL_BLIZZARD Approval = 0x01 // Blizzard approved
+	APPROVAL_LADDER   Approval = 0x02 // Approved for use on ladder
+)
+
+// name of the optional manifest inside the data directory, mapping file names
+// to their approval level and (optionally) a pinned SHA-1 checksum
+const ManifestName = "manifest.json"
+
+type File struct {
+	Name     string
+	Path     string
+	Size     int64
+	FileTime uint64 // Windows FILETIME of the last modification
+	Checksum [sha1.Size]byte
+	Approval Approval
+}
+
+type manifestEntry struct {
+	Approval Approval `json:"approval"`
+	SHA1     string   `json:"sha1,omitempty"`
+}
+
+var (
+	files      = map[string]*File{}
+	filesMutex = sync.RWMutex{}
+)
+
+// Load replaces the registry with every regular file found below dir. Files are
+// known by their base name, so two files with the same name in different
+// subdirectories are an error.
+func Load(dir string) error {
+	manifest := map[string]manifestEntry{}
+	raw, err := os.ReadFile(filepath.Join(dir, ManifestName))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to read manifest: %v", err)
+	}
+	if err == nil {
+		var entries map[string]manifestEntry
+		if err = json.Unmarshal(raw, &entries); err != nil {
+			return fmt.Errorf("failed to parse manifest: %v", err)
+		}
+		// looked up the same way clients name files
+		for name, entry := range entries {
+			key := normalizeName(name)
+			if _, ok := manifest[key]; ok {
+				return fmt.Errorf("duplicate manifest entry for %s", name)
+			}
+			manifest[key] = entry
+		}
+	}
+
+	loaded := map[string]*File{}
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || d.Name() == ManifestName {
+			return nil
+		}
+
+		file, err := loadFile(p)
+		if err != nil {
+			return err
+		}
+
+		key := normalizeName(file.Name)
+		if existing, ok := loaded[key]; ok {
+			return fmt.Errorf("%s and %s have the same name", existing.Path, file.Path)
+		}
+
+		file.Approval = APPROVAL_BLIZZARD
+		if entry, ok := manifest[key]; ok {
+			file.Approval = entry.Approval
+			if entry.SHA1 != "" {
+				sum, err := hex.DecodeString(entry.SHA1)
+				if err != nil || len(sum) != sha1.Size {
+					return fmt.Errorf("invalid manifest checksum for %s", file.Name)
+				}
+				copy(file.Checksum[:], sum)
+			}
+		}
+
+		loaded[key] = file
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	filesMutex.Lock()
+	files = loaded
+	filesMutex.Unlock()
+	return nil
+}
+
+func loadFile(p string) (*File, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha1.New()
+	if _, err = io.Copy(hash, f); err != nil {
+		return nil, fmt.Errorf("failed to hash %s: %v", p, err)
+	}
+
+	file := &File{
+		Name:     info.Name(),
+		Path:     p,
+		Size:     info.Size(),
+		FileTime: util.TimeToFileTime(info.ModTime()),
+	}
+	copy(file.Checksum[:], hash.Sum(nil))
+	return file, nil
+}
+
+// clients send both bare names and game-relative paths such as "maps\(2)Map.scm"
+func normalizeName(name string) string {
+	return strings.ToLower(path.Base(strings.ReplaceAll(name, "\\", "/")))
+}
+
+func Get(name string) (*File, bool) {
+	filesMutex.RLock()
+	defer filesMutex.RUnlock()
+	file, ok := files[normalizeName(name)]
+	return file, ok
+}
+
+// Validate returns the approval level of the named file, or APPROVAL_NONE when
+// the file is unknown or its size or checksum differ from the stored copy.
+func Validate(name string, size uint32, checksum [sha1.Size]byte) Approval {
+	file, ok := Get(name)
+	if !ok || file.Size != int64(size) || file.Checksum != checksum {
+		return APPROVAL_NONE
+	}
+	return file.Approval
+}
+
+func IconFileName(product clientstate.Product) string {
+	switch product {
+	case clientstate.PRODUCT_JSTR, clientstate.PRODUCT_SEXP, clientstate.PRODUCT_SSHR, clientstate.PRODUCT_STAR:
+		return "icons_STAR.bni"
+	case clientstate.PRODUCT_W3DM, clientstate.PRODUCT_W3XP, clientstate.PRODUCT_WAR3:
+		return "icons-WAR3.bni"
+	default:
+		return "icons.bni"
+	}
+}
@@ -0,0 +1,154 @@
+package extrawork
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/carlbennett/gobncs/clientstate"
+)
+
+type Settings struct {
+	MPQFileName string
+	Required    bool // sent as SID_REQUIREDWORK instead of SID_OPTIONALWORK
+}
+
+type Result struct {
+	Fields     map[string]string `json:"fields,omitempty"` // parsed "key=value" or "key: value" lines
+	GameType   uint16            `json:"game_type"`
+	Platform   string            `json:"platform"`
+	Product    string            `json:"product"`
+	Raw        string            `json:"raw"`
+	ReceivedAt time.Time         `json:"received_at"`
+	RemoteIP   string            `json:"remote_ip"`
+}
+
+// most results kept per account; older ones are dropped
+const MAX_HISTORY = 100
+
+var (
+	settings      = map[clientstate.Product]Settings{}
+	settingsMutex = sync.RWMutex{}
+	directory     string
+	storeMutex    = sync.Mutex{}
+)
+
+func GetSettings(product clientstate.Product) (Settings, bool) {
+	settingsMutex.RLock()
+	defer settingsMutex.RUnlock()
+	value, ok := settings[product]
+	return value, ok
+}
+
+func SetSettings(product clientstate.Product, value Settings) {
+	settingsMutex.Lock()
+	defer settingsMutex.Unlock()
+	settings[product] = value
+}
+
+// ReplaceSettings swaps the settings of every product for the given ones in a
+// single step.
+func ReplaceSettings(values map[clientstate.Product]Settings) {
+	replacement := make(map[clientstate.Product]Settings, len(values))
+	for product, value := range values {
+		replacement[product] = value
+	}
+	settingsMutex.Lock()
+	defer settingsMutex.Unlock()
+	settings = replacement
+}
+
+func SetDirectory(dir string) {
+	storeMutex.Lock()
+	defer storeMutex.Unlock()
+	directory = dir
+}
+
+// ParseFields extracts the key/value pairs that the game tracking and system
+// information payloads are made of.
+func ParseFields(data []byte) map[string]string {
+	fields := map[string]string{}
+	for _, line := range strings.FieldsFunc(string(data), func(r rune) bool { return r == '\n' || r == '\r' || r == 0 }) {
+		separator := strings.IndexAny(line, "=:")
+		if separator <= 0 {
+			continue
+		}
+		key := strings.TrimSpace(line[:separator])
+		if key != "" {
+			fields[key] = strings.TrimSpace(line[separator+1:])
+		}
+	}
+	return fields
+}
+
+// account names may contain characters that are not valid in file names
+func fileName(account string) string {
+	name := &strings.Builder{}
+	for _, b := range []byte(strings.ToLower(account)) {
+		if (b >= '0' && b <= '9') || (b >= 'a' && b <= 'z') || b == '-' || b == '.' {
+			name.WriteByte(b)
+		} else {
+			fmt.Fprintf(name, "_%02X", b)
+		}
+	}
+	return name.String() + ".json"
+}
+
+// Store appends a result to the per-account history file, keeping the most
+// recent MAX_HISTORY results.
+func Store(account string, result *Result) error {
+	storeMutex.Lock()
+	defer storeMutex.Unlock()
+
+	if directory == "" {
+		return fmt.Errorf("no extra work directory configured")
+	}
+	err := os.MkdirAll(directory, 0750)
+	if err != nil {
+		return fmt.Errorf("failed to create extra work directory: %v", err)
+	}
+
+	path := filepath.Join(directory, fileName(account))
+	var results []*Result
+	raw, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		if err = json.Unmarshal(raw, &results); err != nil {
+			return fmt.Errorf("failed to parse extra work history: %v", err)
+		}
+	}
+
+	results = append(results, result)
+	if len(results) > MAX_HISTORY {
+		results = results[len(results)-MAX_HISTORY:]
+	}
+
+	raw, err = json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, raw, 0640)
+}
+
+func Load(account string) ([]Result, error) {
+	storeMutex.Lock()
+	defer storeMutex.Unlock()
+
+	var results []Result
+	raw, err := os.ReadFile(filepath.Join(directory, fileName(account)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return results, json.Unmarshal(raw, &results)
+}
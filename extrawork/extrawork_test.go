@@ -0,0 +1,28 @@
+package extrawork
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestStoreKeepsRecentHistory(t *testing.T) {
+	SetDirectory(t.TempDir())
+	t.Cleanup(func() { SetDirectory("") })
+
+	for i := 0; i < MAX_HISTORY+5; i++ {
+		if err := Store("Tester", &Result{Raw: fmt.Sprint(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results, err := Load("tester")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != MAX_HISTORY {
+		t.Fatalf("expected %d results, got %d", MAX_HISTORY, len(results))
+	}
+	if results[0].Raw != "5" || results[len(results)-1].Raw != fmt.Sprint(MAX_HISTORY+4) {
+		t.Errorf("expected the most recent results, got %s to %s", results[0].Raw, results[len(results)-1].Raw)
+	}
+}
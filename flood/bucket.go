@@ -0,0 +1,81 @@
+package flood
+
+import "time"
+
+// Bucket is a token bucket holding up to burst tokens, refilled at rate tokens
+// per second. It is not safe for concurrent use.
+type Bucket struct {
+	burst  float64
+	last   time.Time
+	rate   float64
+	tokens float64
+}
+
+func NewBucket(rate float64, burst int, now time.Time) *Bucket {
+	b := &Bucket{last: now}
+	b.SetLimit(rate, burst)
+	b.tokens = b.burst
+	return b
+}
+
+// SetLimit changes the rate and capacity, keeping the tokens already earned.
+func (b *Bucket) SetLimit(rate float64, burst int) {
+	b.rate = rate
+	b.burst = float64(burst)
+	if b.burst < 1 {
+		b.burst = 1
+	}
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+// Allow takes a token if one is available. A bucket with a zero rate always
+// allows.
+func (b *Bucket) Allow(now time.Time) bool {
+	if b.rate <= 0 {
+		return true
+	}
+
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Limiter holds the buckets of one connection.
+type Limiter struct {
+	chat     *Bucket
+	messages *Bucket
+}
+
+func NewLimiter(limits Limits, now time.Time) *Limiter {
+	return &Limiter{
+		chat:     NewBucket(limits.ChatRate, limits.ChatBurst, now),
+		messages: NewBucket(limits.MessageRate, limits.MessageBurst, now),
+	}
+}
+
+// Allow charges a message, and a chat line if chat is set, against the
+// limits, which are re-read on every call so that a product switch or reload
+// applies immediately.
+func (l *Limiter) Allow(limits Limits, chat bool, now time.Time) bool {
+	l.messages.SetLimit(limits.MessageRate, limits.MessageBurst)
+	if !l.messages.Allow(now) {
+		return false
+	}
+	if !chat {
+		return true
+	}
+	l.chat.SetLimit(limits.ChatRate, limits.ChatBurst)
+	return l.chat.Allow(now)
+}
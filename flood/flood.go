@@ -0,0 +1,161 @@
+// Package flood limits how often an address may connect and how fast a
+// connection may send messages and chat lines.
+package flood
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/util"
+)
+
+// Limits are token bucket rates in units per second; a zero rate disables
+// the bucket.
+type Limits struct {
+	ChatBurst    int
+	ChatRate     float64
+	MessageBurst int
+	MessageRate  float64
+}
+
+type Settings struct {
+	ConnectionsPerMinute int // per address; zero disables
+	ExemptAccounts       []string
+	ExemptNetworks       []*net.IPNet
+	Limits               Limits
+	MaxConnectionsPerIP  int                            // zero disables
+	Products             map[clientstate.Product]Limits // non-zero fields override Limits
+}
+
+// window over which ConnectionsPerMinute is counted
+const CONNECTION_RATE_WINDOW = time.Minute
+
+var (
+	ErrConnectionRate     = errors.New("connecting too often")
+	ErrTooManyConnections = errors.New("too many connections")
+)
+
+type address struct {
+	active      int
+	count       int
+	windowStart time.Time
+}
+
+var (
+	addresses      = map[string]*address{}
+	addressesMutex = sync.Mutex{}
+	lastSweep      time.Time
+	settings       = Settings{}
+	settingsMutex  = sync.RWMutex{}
+)
+
+func GetSettings() Settings {
+	settingsMutex.RLock()
+	defer settingsMutex.RUnlock()
+	return settings
+}
+
+func SetSettings(value Settings) {
+	settingsMutex.Lock()
+	defer settingsMutex.Unlock()
+	settings = value
+}
+
+// ProductLimits returns the message limits that apply to a product.
+func ProductLimits(product clientstate.Product) Limits {
+	current := GetSettings()
+	limits := current.Limits
+	override, ok := current.Products[product]
+	if !ok {
+		return limits
+	}
+	if override.ChatBurst != 0 {
+		limits.ChatBurst = override.ChatBurst
+	}
+	if override.ChatRate != 0 {
+		limits.ChatRate = override.ChatRate
+	}
+	if override.MessageBurst != 0 {
+		limits.MessageBurst = override.MessageBurst
+	}
+	if override.MessageRate != 0 {
+		limits.MessageRate = override.MessageRate
+	}
+	return limits
+}
+
+// Exempt reports whether a connection from ip, logged on as username if not
+// empty, bypasses every limit.
+func Exempt(ip string, username string) bool {
+	current := GetSettings()
+	if parsed := net.ParseIP(ip); parsed != nil && util.NetworksContain(current.ExemptNetworks, parsed) {
+		return true
+	}
+	if username == "" {
+		return false
+	}
+	for _, account := range current.ExemptAccounts {
+		if strings.EqualFold(account, username) {
+			return true
+		}
+	}
+	return false
+}
+
+// Connect counts a new connection from ip against the per-address limits.
+// The returned release function must be called once the connection closes.
+func Connect(ip string, now time.Time) (func(), error) {
+	if Exempt(ip, "") {
+		return func() {}, nil
+	}
+	current := GetSettings()
+
+	addressesMutex.Lock()
+	defer addressesMutex.Unlock()
+	sweep(now)
+
+	entry, ok := addresses[ip]
+	if !ok {
+		entry = &address{windowStart: now}
+		addresses[ip] = entry
+	}
+	if now.Sub(entry.windowStart) >= CONNECTION_RATE_WINDOW {
+		entry.count, entry.windowStart = 0, now
+	}
+	entry.count++
+
+	switch {
+	case current.MaxConnectionsPerIP > 0 && entry.active >= current.MaxConnectionsPerIP:
+		return nil, ErrTooManyConnections
+	case current.ConnectionsPerMinute > 0 && entry.count > current.ConnectionsPerMinute:
+		return nil, ErrConnectionRate
+	}
+	entry.active++
+
+	once := sync.Once{}
+	return func() {
+		once.Do(func() {
+			addressesMutex.Lock()
+			defer addressesMutex.Unlock()
+			entry.active--
+		})
+	}, nil
+}
+
+// sweep forgets idle addresses whose rate window has passed; the caller must
+// hold addressesMutex.
+func sweep(now time.Time) {
+	if now.Sub(lastSweep) < CONNECTION_RATE_WINDOW {
+		return
+	}
+	lastSweep = now
+	for ip, entry := range addresses {
+		if entry.active == 0 && now.Sub(entry.windowStart) >= CONNECTION_RATE_WINDOW {
+			delete(addresses, ip)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// Package game keeps the games that clients advertise with SID_STARTADVEX3,
+// so that other clients can find them with SID_GETADVLISTEX.
+package game
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/carlbennett/gobncs/clientstate"
+)
+
+type Game struct {
+	Created    time.Time
+	Host       *clientstate.ClientState
+	HostName   string // username of the host
+	IP         net.IP // address other players connect to
+	Ladder     bool
+	Name       string
+	Parameter  uint16
+	Password   string
+	Port       uint16
+	Product    clientstate.Product
+	State      uint32
+	Statstring []byte
+	Type       uint16
+}
+
+var ErrNameTaken = errors.New("game name already taken")
+
+var (
+	games      = map[string]*Game{} // keyed by lowercased name
+	gamesMutex = sync.RWMutex{}
+)
+
+func key(name string) string {
+	return strings.ToLower(name)
+}
+
+// Advertise lists a game, or updates the game its host already advertises
+// under the same name. A host advertises one game at a time.
+func Advertise(g Game) error {
+	gamesMutex.Lock()
+	defer gamesMutex.Unlock()
+
+	if existing, ok := games[key(g.Name)]; ok && existing.Host != g.Host {
+		return ErrNameTaken
+	}
+	stopLocked(g.Host)
+	if g.Created.IsZero() {
+		g.Created = time.Now().UTC()
+	}
+	games[key(g.Name)] = &g
+	return nil
+}
+
+// Stop removes the game a client advertises, if any.
+func Stop(host *clientstate.ClientState) {
+	gamesMutex.Lock()
+	defer gamesMutex.Unlock()
+	stopLocked(host)
+}
+
+// stopLocked must be called with gamesMutex held.
+func stopLocked(host *clientstate.ClientState) {
+	for k, g := range games {
+		if g.Host == host {
+			delete(games, k)
+		}
+	}
+}
+
+// Find looks up an advertised game by name, ignoring case.
+func Find(name string) (Game, bool) {
+	gamesMutex.RLock()
+	defer gamesMutex.RUnlock()
+	g, ok := games[key(name)]
+	if !ok {
+		return Game{}, false
+	}
+	return *g, true
+}
+
+// List returns every advertised game, newest first.
+func List() []Game {
+	gamesMutex.RLock()
+	defer gamesMutex.RUnlock()
+	list := make([]Game, 0, len(games))
+	for _, g := range games {
+		list = append(list, *g)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.After(list[j].Created) })
+	return list
+}
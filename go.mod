@@ -1,3 +1,3 @@
 module github.com/carlbennett/gobncs
 
-go 1.18
+go 1.21
@@ -1,23 +1,381 @@
 package main
 
 import (
-	"log"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
 	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/carlbennett/gobncs/account"
+	"github.com/carlbennett/gobncs/admin"
+	"github.com/carlbennett/gobncs/ban"
+	"github.com/carlbennett/gobncs/cdkey"
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/config"
+	"github.com/carlbennett/gobncs/crashreport"
+	"github.com/carlbennett/gobncs/datafile"
+	"github.com/carlbennett/gobncs/extrawork"
+	"github.com/carlbennett/gobncs/flood"
+	"github.com/carlbennett/gobncs/logging"
+	"github.com/carlbennett/gobncs/mail"
+	"github.com/carlbennett/gobncs/message"
+	"github.com/carlbennett/gobncs/metrics"
+	"github.com/carlbennett/gobncs/news"
+	"github.com/carlbennett/gobncs/permission"
+	"github.com/carlbennett/gobncs/proxyproto"
 	"github.com/carlbennett/gobncs/server"
+	"github.com/carlbennett/gobncs/tournament"
+	"github.com/carlbennett/gobncs/trace"
+	"github.com/carlbennett/gobncs/util"
+	"github.com/carlbennett/gobncs/warden"
 )
 
+var logger = logging.For(logging.MAIN)
+
 func main() {
-	log.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds | log.Llongfile)
-	log.SetOutput(os.Stdout)
-	log.SetPrefix("[gobncs] ")
+	configPath := flag.String("config", "gobncs.json", "configuration file")
+	checkConfig := flag.Bool("check-config", false, "validate the configuration and exit")
+	listen := flag.String("listen", "", "comma-separated listen addresses, prefixed with proxy+ to expect PROXY protocol headers from the trusted_proxies configured for that address (overrides the config)")
+	logLevel := flag.String("log-level", "", "log level: debug, info, warn or error (overrides the config)")
+	var settings []string
+	flag.Func("set", "override a config option as key=value; may be repeated ("+strings.Join(config.Options(), ", ")+")", func(value string) error {
+		settings = append(settings, value)
+		return nil
+	})
+	flag.Parse()
+
+	configRequired := false
+	flag.Visit(func(f *flag.Flag) {
+		configRequired = configRequired || f.Name == "config"
+	})
+
+	load := func() (*config.Config, error) {
+		return loadConfig(*configPath, configRequired, *listen, *logLevel, settings)
+	}
+
+	cfg, err := load()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if *checkConfig {
+		fmt.Println("configuration ok")
+		return
+	}
+
+	applyConfig(cfg)
+
+	err = account.Open(cfg.Data.Accounts)
+	if err != nil {
+		fatal("failed to open account store", err)
+	}
+
+	err = ban.Open(cfg.Data.Bans)
+	if err != nil {
+		fatal("failed to open ban list", err)
+	}
+
+	err = loadWarden(cfg.Data.Warden)
+	if err != nil {
+		fatal("failed to load warden", err)
+	}
+
+	crashreport.SetDirectory(cfg.Data.Crashes)
+	extrawork.SetDirectory(cfg.Data.WorkResults)
+
+	err = news.Load(cfg.Data.News)
+	if err != nil {
+		fatal("failed to load news", err)
+	}
 
-	ln, _ := net.Listen("tcp", ":6112")
-	defer ln.Close()
+	tournament.SetDirectory(cfg.Data.Brackets)
+	err = loadTournaments(cfg.Data.Tournaments)
+	if err != nil {
+		fatal("failed to load tournaments", err)
+	}
+	tournament.Run(time.Minute, server.NotifyTournament)
+
+	mailSender, err := mail.NewMaildirSender(cfg.Data.Maildir, cfg.Mail.From)
+	if err != nil {
+		logger.Warn("failed to set up mail sender", "error", err)
+	} else {
+		mail.SetSender(mailSender)
+	}
+
+	err = datafile.Load(cfg.Data.Files)
+	if err != nil {
+		logger.Warn("failed to load data files", "error", err)
+	}
+
+	listeners := make([]net.Listener, 0, len(cfg.Listen))
+	for _, listener := range cfg.Listen {
+		ln, err := openListener(listener)
+		if err != nil {
+			fatal("failed to listen", err, "address", listener.Address)
+		}
+		listeners = append(listeners, ln)
+	}
+
+	var httpServers []*http.Server
+	if cfg.Metrics.Address != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		metricsServer, err := serveHTTP("metrics", cfg.Metrics.Address, mux)
+		if err != nil {
+			fatal("failed to serve metrics", err, "address", cfg.Metrics.Address)
+		}
+		httpServers = append(httpServers, metricsServer)
+	}
+	if cfg.Admin.Address != "" {
+		adminServer, err := serveHTTP("admin API", cfg.Admin.Address, admin.Handler())
+		if err != nil {
+			fatal("failed to serve admin API", err, "address", cfg.Admin.Address)
+		}
+		httpServers = append(httpServers, adminServer)
+	}
+
+	wg := sync.WaitGroup{}
+	for _, ln := range listeners {
+		wg.Add(1)
+		go func(ln net.Listener) {
+			defer wg.Done()
+			server.Serve(ln)
+		}(ln)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	for sig := range signals {
+		if sig == syscall.SIGHUP {
+			logger.Info("reloading", "signal", sig.String())
+			cfg = reload(cfg, load)
+			continue
+		}
+		logger.Info("shutting down", "signal", sig.String())
+		break
+	}
+	signal.Stop(signals)
+
+	for _, ln := range listeners {
+		ln.Close()
+	}
+	wg.Wait()
+	for _, httpServer := range httpServers {
+		httpServer.Close()
+	}
+
+	tournament.Stop()
+	server.Shutdown(cfg.Shutdown.Notice, time.Duration(cfg.Shutdown.TimeoutSeconds)*time.Second)
+
+	if err = account.Flush(); err != nil {
+		logger.Error("failed to flush account store", "error", err)
+	}
+	if err = ban.Flush(); err != nil {
+		logger.Error("failed to flush ban list", "error", err)
+	}
+	logger.Info("shutdown complete")
+}
+
+// fatal logs an error that prevents the server from starting and exits.
+func fatal(msg string, err error, args ...any) {
+	logger.Error(msg, append(args, "error", err)...)
+	os.Exit(1)
+}
+
+// reload re-reads the configuration, ban list, Warden config, data files, news
+// and tournaments without touching connected clients. A configuration that fails to load or
+// validate is rejected and the current one is kept.
+func reload(current *config.Config, load func() (*config.Config, error)) *config.Config {
+	cfg, err := load()
+	if err != nil {
+		logger.Error("failed to reload configuration; keeping the current one", "error", err)
+		return current
+	}
+	if !reflect.DeepEqual(cfg.Listen, current.Listen) {
+		logger.Warn("listen addresses changed; restart to apply")
+	}
+	if cfg.Metrics.Address != current.Metrics.Address || cfg.Admin.Address != current.Admin.Address {
+		logger.Warn("metrics or admin API address changed; restart to apply")
+	}
+
+	applyConfig(cfg)
+
+	if err = ban.Open(cfg.Data.Bans); err != nil {
+		logger.Error("failed to reload ban list", "error", err)
+	}
+	if err = loadWarden(cfg.Data.Warden); err != nil {
+		logger.Error("failed to reload warden", "error", err)
+	}
+	if err = datafile.Load(cfg.Data.Files); err != nil {
+		logger.Warn("failed to reload data files", "error", err)
+	}
+	if err = news.Load(cfg.Data.News); err != nil {
+		logger.Error("failed to reload news", "error", err)
+	}
+	tournament.SetDirectory(cfg.Data.Brackets)
+	if err = loadTournaments(cfg.Data.Tournaments); err != nil {
+		logger.Error("failed to reload tournaments", "error", err)
+	}
+
+	logger.Info("reload complete")
+	return cfg
+}
+
+// loadTournaments loads the tournament definitions if the file exists.
+// Running tournaments that are still defined keep their brackets.
+func loadTournaments(path string) error {
+	if _, err := os.Stat(path); path == "" || err != nil {
+		return nil
+	}
+	return tournament.Load(path)
+}
+
+// loadWarden loads the Warden config if the file exists and disables Warden
+// otherwise.
+func loadWarden(path string) error {
+	if _, err := os.Stat(path); path == "" || err != nil {
+		return warden.Load("")
+	}
+	return warden.Load(path)
+}
+
+// loadConfig layers the config file, environment and flags, then validates
+// the result.
+func loadConfig(path string, required bool, listen string, logLevel string, settings []string) (*config.Config, error) {
+	cfg, err := config.Load(path, required)
+	if err != nil {
+		return nil, err
+	}
+
+	err = cfg.ApplyEnv(os.LookupEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, setting := range settings {
+		key, value, ok := strings.Cut(setting, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid -set value (%s); expected key=value", setting)
+		}
+		if err = cfg.Set(key, value); err != nil {
+			return nil, err
+		}
+	}
+	if listen != "" {
+		cfg.Set("listen", listen)
+	}
+	if logLevel != "" {
+		cfg.Set("log.level", logLevel)
+	}
+
+	return cfg, cfg.Validate()
+}
+
+// applyConfig hands validated settings to the packages that use them.
+func applyConfig(cfg *config.Config) {
+	level, _ := logging.ParseLevel(cfg.Log.Level)
+	subsystems := map[string]slog.Level{}
+	for name, value := range cfg.Log.Subsystems {
+		subsystems[name], _ = logging.ParseLevel(value)
+	}
+	format, _ := logging.ParseFormat(cfg.Log.Format)
+	logging.Configure(os.Stdout, logging.Options{
+		Format:     format,
+		Level:      level,
+		Prefix:     cfg.Log.Prefix,
+		Source:     cfg.Log.Source,
+		Subsystems: subsystems,
+	})
+
+	operators := map[string]permission.Permission{}
+	for name, value := range cfg.Admin.Operators {
+		operators[name], _ = permission.Parse(value)
+	}
+	permission.SetOperators(operators)
+
+	action, _ := server.ParseOutOfPhaseAction(cfg.Limits.OutOfPhaseAction)
+	server.SetOutOfPhaseAction(action)
+	policy, _ := message.ParseResyncPolicy(cfg.Limits.ResyncPolicy)
+	server.SetResyncPolicy(policy)
+	cdkey.SetMaxSpawnsPerKey(cfg.Limits.MaxSpawnsPerKey)
+	crashreport.SetLimits(crashreport.Limits{
+		MaxBytes:       int64(cfg.Limits.MaxCrashReportsMB) << 20,
+		PerAddressHour: cfg.Limits.CrashReportsPerHour,
+	})
+	tracing, _ := util.ParseNetworks(cfg.Trace.Addresses)
+	trace.SetSettings(trace.Settings{
+		Accounts:  cfg.Trace.Accounts,
+		Directory: cfg.Trace.Directory,
+		Enabled:   cfg.Trace.Enabled,
+		Format:    cfg.Trace.Format,
+		Networks:  tracing,
+	})
+	server.SetTimeouts(server.Timeouts{
+		Handshake: time.Duration(cfg.Timeouts.HandshakeSeconds) * time.Second,
+		Idle:      time.Duration(cfg.Timeouts.IdleSeconds) * time.Second,
+		Protocol:  time.Duration(cfg.Timeouts.ProtocolSeconds) * time.Second,
+	})
+
+	exempt, _ := util.ParseNetworks(cfg.Flood.ExemptAddresses)
+	products := map[clientstate.Product]flood.Limits{}
+	for code, value := range cfg.Flood.Products {
+		product, _ := clientstate.CodeToProduct(code)
+		products[product] = flood.Limits(value)
+	}
+	flood.SetSettings(flood.Settings{
+		ConnectionsPerMinute: cfg.Flood.ConnectionsPerMinute,
+		ExemptAccounts:       cfg.Flood.ExemptAccounts,
+		ExemptNetworks:       exempt,
+		Limits:               flood.Limits(cfg.Flood.FloodLimits),
+		MaxConnectionsPerIP:  cfg.Flood.MaxConnectionsPerIP,
+		Products:             products,
+	})
+
+	cfg.ApplyProtocolSettings()
+}
+
+// openListener opens a configured listener, wrapping it to read PROXY protocol
+// headers if enabled.
+func openListener(listener config.Listener) (net.Listener, error) {
+	ln, err := net.Listen("tcp", listener.Address)
+	if err != nil {
+		return nil, err
+	}
+	if !listener.ProxyProtocol {
+		logger.Info("listening", "address", ln.Addr().String())
+		return ln, nil
+	}
+
+	trusted, err := util.ParseNetworks(listener.TrustedProxies)
+	if err != nil {
+		ln.Close()
+		return nil, err
+	}
+	logger.Info("listening", "address", ln.Addr().String(), "proxy_protocol", true)
+	return &proxyproto.Listener{Listener: ln, Trusted: trusted}, nil
+}
 
-	for {
-		conn, _ := ln.Accept()
-		go server.HandleConnection(conn)
+// serveHTTP serves handler until the returned server is closed.
+func serveHTTP(name string, address string, handler http.Handler) (*http.Server, error) {
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
 	}
+	httpServer := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := httpServer.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("http server stopped", "server", name, "error", err)
+		}
+	}()
+	logger.Info("serving "+name, "address", ln.Addr().String())
+	return httpServer, nil
 }
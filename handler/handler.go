@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/message"
+)
+
+// Handler parses a message and acts on it. A returned error terminates the
+// connection.
+type Handler func(state *clientstate.ClientState, m *message.Message) error
+
+// Middleware wraps every dispatched handler, including the fallback.
+type Middleware func(next Handler) Handler
+
+var (
+	fallback     Handler = UnknownMessage
+	handlers             = map[clientstate.ProtocolType]map[message.MessageId]Handler{}
+	middleware   []Middleware
+	handlerMutex = sync.RWMutex{}
+)
+
+// Register installs the handler for a message id of a protocol type, replacing
+// any handler registered before.
+func Register(protocol clientstate.ProtocolType, id message.MessageId, h Handler) {
+	handlerMutex.Lock()
+	defer handlerMutex.Unlock()
+
+	if _, ok := handlers[protocol]; !ok {
+		handlers[protocol] = map[message.MessageId]Handler{}
+	}
+	handlers[protocol][id] = h
+}
+
+func Unregister(protocol clientstate.ProtocolType, id message.MessageId) {
+	handlerMutex.Lock()
+	defer handlerMutex.Unlock()
+	delete(handlers[protocol], id)
+}
+
+// Use appends middleware; the first middleware added is the outermost.
+func Use(mw ...Middleware) {
+	handlerMutex.Lock()
+	defer handlerMutex.Unlock()
+	middleware = append(middleware, mw...)
+}
+
+// SetFallback sets the handler for message ids without a registered handler.
+func SetFallback(h Handler) {
+	handlerMutex.Lock()
+	defer handlerMutex.Unlock()
+	fallback = h
+}
+
+func Lookup(protocol clientstate.ProtocolType, id message.MessageId) (Handler, bool) {
+	handlerMutex.RLock()
+	defer handlerMutex.RUnlock()
+	h, ok := handlers[protocol][id]
+	return h, ok
+}
+
+func Dispatch(state *clientstate.ClientState, m *message.Message) error {
+	handlerMutex.RLock()
+	h, ok := handlers[state.ProtocolType][m.ID]
+	if !ok {
+		h = fallback
+	}
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	handlerMutex.RUnlock()
+
+	return h(state, m)
+}
+
+// UnknownMessage is the default fallback and terminates the connection.
+func UnknownMessage(state *clientstate.ClientState, m *message.Message) error {
+	return fmt.Errorf("unknown message id (0x%02X); terminating connection", m.ID)
+}
+
+// IgnoreMessage is a fallback that drops unknown messages.
+func IgnoreMessage(state *clientstate.ClientState, m *message.Message) error {
+	return nil
+}
@@ -0,0 +1,177 @@
+// Package logging configures structured, leveled logging. Each subsystem logs
+// through its own logger so that its verbosity can be raised or lowered on its
+// own, e.g. to trace every packet only while debugging.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	FORMAT_JSON = "json"
+	FORMAT_TEXT = "text"
+)
+
+// subsystem names; loggers for other names may be created but are not
+// accepted in the per-subsystem levels
+const (
+	ADMIN      = "admin"
+	FLOOD      = "flood"
+	MAIL       = "mail"
+	MAIN       = "main"
+	PACKET     = "packet" // every message sent and received, logged at debug
+	PARSER     = "parser"
+	SERVER     = "server"
+	TOURNAMENT = "tournament"
+	WARDEN     = "warden"
+)
+
+var subsystems = []string{ADMIN, FLOOD, MAIL, MAIN, PACKET, PARSER, SERVER, TOURNAMENT, WARDEN}
+
+type Options struct {
+	Format     string // text or json
+	Level      slog.Level
+	Prefix     string // written before every text record
+	Source     bool   // include the file and line of the call
+	Subsystems map[string]slog.Level
+}
+
+type settings struct {
+	handler    slog.Handler
+	level      slog.Level
+	subsystems map[string]slog.Level
+}
+
+var current atomic.Value
+
+func init() {
+	current.Store(&settings{handler: slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}), level: slog.LevelInfo})
+}
+
+// Configure replaces the output and levels of every logger, including ones
+// created before, and routes the standard log package through it.
+func Configure(w io.Writer, options Options) {
+	handlerOptions := &slog.HandlerOptions{AddSource: options.Source, Level: slog.LevelDebug}
+
+	var h slog.Handler
+	if options.Format == FORMAT_JSON {
+		h = slog.NewJSONHandler(w, handlerOptions)
+	} else {
+		if options.Prefix != "" {
+			w = &prefixWriter{prefix: []byte(options.Prefix), w: w}
+		}
+		h = slog.NewTextHandler(w, handlerOptions)
+	}
+
+	levels := make(map[string]slog.Level, len(options.Subsystems))
+	for name, level := range options.Subsystems {
+		levels[name] = level
+	}
+	current.Store(&settings{handler: h, level: options.Level, subsystems: levels})
+	slog.SetDefault(For(MAIN))
+}
+
+// For returns the logger of a subsystem.
+func For(subsystem string) *slog.Logger {
+	return slog.New(&handler{subsystem: subsystem}).With("subsystem", subsystem)
+}
+
+// Subsystems returns the subsystem names accepted by Options, sorted.
+func Subsystems() []string {
+	names := append([]string{}, subsystems...)
+	sort.Strings(names)
+	return names
+}
+
+func KnownSubsystem(name string) bool {
+	for _, subsystem := range subsystems {
+		if subsystem == name {
+			return true
+		}
+	}
+	return false
+}
+
+func ParseLevel(value string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(value))
+	if err != nil {
+		return 0, fmt.Errorf("unknown level (%s)", value)
+	}
+	return level, nil
+}
+
+// ParseFormat validates an output format name.
+func ParseFormat(value string) (string, error) {
+	switch strings.ToLower(value) {
+	case FORMAT_JSON:
+		return FORMAT_JSON, nil
+	case FORMAT_TEXT, "":
+		return FORMAT_TEXT, nil
+	default:
+		return "", fmt.Errorf("unknown format (%s)", value)
+	}
+}
+
+// handler filters records by the level of its subsystem and hands them to
+// the configured output, which may change after the logger was created.
+type handler struct {
+	subsystem string
+	wrap      []func(slog.Handler) slog.Handler // attributes and groups added by With
+}
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	s := current.Load().(*settings)
+	if subsystemLevel, ok := s.subsystems[h.subsystem]; ok {
+		return level >= subsystemLevel
+	}
+	return level >= s.level
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	out := current.Load().(*settings).handler
+	for _, wrap := range h.wrap {
+		out = wrap(out)
+	}
+	return out.Handle(ctx, r)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(out slog.Handler) slog.Handler { return out.WithAttrs(attrs) })
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return h.with(func(out slog.Handler) slog.Handler { return out.WithGroup(name) })
+}
+
+func (h *handler) with(wrap func(slog.Handler) slog.Handler) slog.Handler {
+	wraps := make([]func(slog.Handler) slog.Handler, len(h.wrap), len(h.wrap)+1)
+	copy(wraps, h.wrap)
+	return &handler{subsystem: h.subsystem, wrap: append(wraps, wrap)}
+}
+
+// prefixWriter prepends a prefix to every record; the text handler writes
+// each record in a single call.
+type prefixWriter struct {
+	mutex  sync.Mutex
+	prefix []byte
+	w      io.Writer
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	_, err := p.w.Write(append(append([]byte{}, p.prefix...), b...))
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
@@ -0,0 +1,84 @@
+package mail
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Sender interface {
+	Send(to string, subject string, body string) error
+}
+
+// MaildirSender delivers messages into a local maildir so that mail can be
+// inspected without an SMTP service.
+type MaildirSender struct {
+	Dir  string
+	From string
+}
+
+var (
+	sender      Sender
+	senderMutex = sync.RWMutex{}
+)
+
+func SetSender(value Sender) {
+	senderMutex.Lock()
+	defer senderMutex.Unlock()
+	sender = value
+}
+
+func Send(to string, subject string, body string) error {
+	senderMutex.RLock()
+	value := sender
+	senderMutex.RUnlock()
+
+	if value == nil {
+		return fmt.Errorf("no mail sender configured")
+	}
+	return value.Send(to, subject, body)
+}
+
+func NewMaildirSender(dir string, from string) (*MaildirSender, error) {
+	for _, sub := range []string{"cur", "new", "tmp"} {
+		err := os.MkdirAll(filepath.Join(dir, sub), 0700)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create maildir: %v", err)
+		}
+	}
+	return &MaildirSender{Dir: dir, From: from}, nil
+}
+
+func (s *MaildirSender) Send(to string, subject string, body string) error {
+	if strings.ContainsAny(to, "\r\n") || strings.ContainsAny(subject, "\r\n") {
+		return fmt.Errorf("invalid mail header value")
+	}
+
+	var unique [8]byte
+	_, err := rand.Read(unique[:])
+	if err != nil {
+		return err
+	}
+	hostname, _ := os.Hostname()
+	now := time.Now()
+	name := fmt.Sprintf("%d.%s.%s", now.Unix(), hex.EncodeToString(unique[:]), hostname)
+
+	content := &strings.Builder{}
+	fmt.Fprintf(content, "From: %s\r\n", s.From)
+	fmt.Fprintf(content, "To: %s\r\n", to)
+	fmt.Fprintf(content, "Subject: %s\r\n", subject)
+	fmt.Fprintf(content, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(content, "\r\n%s\r\n", strings.ReplaceAll(body, "\n", "\r\n"))
+
+	tmp := filepath.Join(s.Dir, "tmp", name)
+	err = os.WriteFile(tmp, []byte(content.String()), 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write mail: %v", err)
+	}
+	return os.Rename(tmp, filepath.Join(s.Dir, "new", name))
+}
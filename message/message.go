@@ -239,19 +239,48 @@ func MessageIdToName(id MessageId) string {
 	return fmt.Sprintf("SID_UNKNOWN_%02X", id)
 }
 
+func ValidateMessage(m *Message) error {
+	if m.Length < 4 || m.Length != uint16(4+len(m.Body)) {
+		return fmt.Errorf("invalid message length (expected %d, got %d)", 4+len(m.Body), m.Length)
+	}
+	return nil
+}
+
+func WriteMessage(w io.Writer, m *Message) error {
+	err := ValidateMessage(m)
+	if err != nil {
+		return err
+	}
+
+	buffer := make([]byte, m.Length)
+	buffer[0] = 0xFF
+	buffer[1] = byte(m.ID)
+	binary.LittleEndian.PutUint16(buffer[2:4], m.Length)
+	copy(buffer[4:], m.Body)
+
+	_, err = w.Write(buffer)
+	return err
+}
+
+// ReadMessage reads a single message without buffering or resynchronising;
+// long-lived streams should use a Reader instead.
 func ReadMessage(conn io.Reader) (*Message, error) {
-	var header [4]byte
+	var header [HEADER_SIZE]byte
 	_, err := io.ReadFull(conn, header[:])
 	if err != nil {
 		return nil, err
 	}
 
 	if header[0] != 0xFF {
-		return nil, fmt.Errorf("invalid message header")
+		return nil, &FramingError{Err: ErrInvalidHeader, Header: header}
 	}
 
 	length := binary.LittleEndian.Uint16(header[2:4])
-	body := make([]byte, length-4)
+	if length < HEADER_SIZE {
+		return nil, &FramingError{Err: ErrLengthTooShort, Header: header}
+	}
+
+	body := make([]byte, length-HEADER_SIZE)
 	_, err = io.ReadFull(conn, body)
 	if err != nil {
 		return nil, err
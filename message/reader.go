@@ -0,0 +1,151 @@
+package message
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	HEADER_SIZE      = 4
+	MAX_BODY_SIZE    = 0xFFFF - HEADER_SIZE
+	MAX_RESYNC_BYTES = 4096 // bytes skipped looking for a header before giving up
+)
+
+type ResyncPolicy int32
+
+const (
+	RESYNC_NONE ResyncPolicy = iota // Fail on the first malformed header
+	RESYNC_SCAN                     // Skip ahead to the next 0xFF and retry
+)
+
+var (
+	ErrInvalidHeader  = errors.New("invalid message header")
+	ErrLengthTooLong  = errors.New("message body exceeds maximum size")
+	ErrLengthTooShort = errors.New("message length shorter than its header")
+	ErrResyncFailed   = errors.New("no message header found while resynchronising")
+)
+
+// FramingError is returned by Reader when the stream does not contain a
+// well-formed message. Header holds the offending header bytes.
+type FramingError struct {
+	Err    error
+	Header [HEADER_SIZE]byte
+}
+
+func (e *FramingError) Error() string {
+	return fmt.Sprintf("%v (header % X)", e.Err, e.Header)
+}
+
+func (e *FramingError) Unwrap() error {
+	return e.Err
+}
+
+// Reader reads framed messages from a buffered stream.
+type Reader struct {
+	discarded   int
+	maxBodySize int
+	reader      *bufio.Reader
+	resync      ResyncPolicy
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{
+		maxBodySize: MAX_BODY_SIZE,
+		reader:      bufio.NewReader(r),
+		resync:      RESYNC_NONE,
+	}
+}
+
+// Read reads unframed bytes, such as the protocol type byte that precedes
+// the message stream.
+func (r *Reader) Read(p []byte) (int, error) {
+	return r.reader.Read(p)
+}
+
+// Discarded returns the number of bytes skipped while resynchronising.
+func (r *Reader) Discarded() int {
+	return r.discarded
+}
+
+func (r *Reader) SetMaxBodySize(size int) {
+	if size <= 0 || size > MAX_BODY_SIZE {
+		size = MAX_BODY_SIZE
+	}
+	r.maxBodySize = size
+}
+
+func (r *Reader) SetResyncPolicy(policy ResyncPolicy) {
+	r.resync = policy
+}
+
+func (r *Reader) ReadMessage() (*Message, error) {
+	skipped := 0
+	for {
+		header, err := r.reader.Peek(HEADER_SIZE)
+		if err != nil {
+			if err == io.EOF && len(header) > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+
+		var framingErr *FramingError
+		length := binary.LittleEndian.Uint16(header[2:4])
+		switch {
+		case header[0] != 0xFF:
+			framingErr = &FramingError{Err: ErrInvalidHeader}
+		case length < HEADER_SIZE:
+			framingErr = &FramingError{Err: ErrLengthTooShort}
+		case int(length)-HEADER_SIZE > r.maxBodySize:
+			// an oversized frame is not resynchronised past; it may be
+			// deliberate, and its body cannot be told apart from the stream
+			framingErr = &FramingError{Err: ErrLengthTooLong}
+			copy(framingErr.Header[:], header)
+			return nil, framingErr
+		}
+
+		if framingErr != nil {
+			copy(framingErr.Header[:], header)
+			if r.resync != RESYNC_SCAN {
+				return nil, framingErr
+			}
+			if skipped >= MAX_RESYNC_BYTES {
+				return nil, &FramingError{Err: ErrResyncFailed, Header: framingErr.Header}
+			}
+			r.reader.Discard(1)
+			r.discarded++
+			skipped++
+			continue
+		}
+
+		r.reader.Discard(HEADER_SIZE)
+		m := &Message{
+			ID:     MessageId(header[1]),
+			Length: length,
+			Body:   make([]byte, length-HEADER_SIZE),
+		}
+		_, err = io.ReadFull(r.reader, m.Body)
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+
+		return m, nil
+	}
+}
+
+func ParseResyncPolicy(value string) (ResyncPolicy, error) {
+	switch value {
+	case "none":
+		return RESYNC_NONE, nil
+	case "scan":
+		return RESYNC_SCAN, nil
+	default:
+		return 0, fmt.Errorf("unknown resync policy (%s)", value)
+	}
+}
@@ -0,0 +1,128 @@
+package message
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func frame(id MessageId, body []byte) []byte {
+	length := HEADER_SIZE + len(body)
+	return append([]byte{0xFF, byte(id), byte(length), byte(length >> 8)}, body...)
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func TestReadMessageFraming(t *testing.T) {
+	tests := []struct {
+		name        string
+		stream      []byte
+		maxBodySize int
+		err         error // of the first read
+		header      []byte
+	}{
+		{"empty body", frame(SID_NULL, nil), 0, nil, nil},
+		{"largest body", frame(SID_CHATCOMMAND, make([]byte, MAX_BODY_SIZE)), 0, nil, nil},
+		{"length below header", []byte{0xFF, 0x0E, 0x03, 0x00}, 0, ErrLengthTooShort, []byte{0xFF, 0x0E, 0x03, 0x00}},
+		{"zero length", []byte{0xFF, 0x0E, 0x00, 0x00}, 0, ErrLengthTooShort, []byte{0xFF, 0x0E, 0x00, 0x00}},
+		{"body over limit", frame(SID_CHATCOMMAND, make([]byte, 17)), 16, ErrLengthTooLong, []byte{0xFF, 0x0E, 0x15, 0x00}},
+		{"body at limit", frame(SID_CHATCOMMAND, make([]byte, 16)), 16, nil, nil},
+		{"bad header byte", concat([]byte{0x00}, frame(SID_NULL, nil)), 0, ErrInvalidHeader, []byte{0x00, 0xFF, 0x00, 0x04}},
+		{"truncated header", []byte{0xFF, 0x0E}, 0, io.ErrUnexpectedEOF, nil},
+		{"truncated body", frame(SID_CHATCOMMAND, []byte("hello"))[:6], 0, io.ErrUnexpectedEOF, nil},
+		{"end of stream", nil, 0, io.EOF, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reader := NewReader(bytes.NewReader(test.stream))
+			reader.SetMaxBodySize(test.maxBodySize)
+
+			m, err := reader.ReadMessage()
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+			if test.err == nil {
+				if !bytes.Equal(frame(m.ID, m.Body), test.stream) || int(m.Length) != len(test.stream) {
+					t.Errorf("message does not match the frame")
+				}
+				return
+			}
+
+			var framingErr *FramingError
+			if errors.As(err, &framingErr) != (test.header != nil) {
+				t.Fatalf("expected a framing error: %v, got %T", test.header != nil, err)
+			}
+			if test.header != nil && !bytes.Equal(framingErr.Header[:], test.header) {
+				t.Errorf("expected header % X, got % X", test.header, framingErr.Header)
+			}
+		})
+	}
+}
+
+func TestReadMessageResync(t *testing.T) {
+	garbage := []byte{0x00, 0x01, 0x02}
+	tests := []struct {
+		name      string
+		policy    ResyncPolicy
+		stream    []byte
+		ids       []MessageId // read before err
+		err       error
+		discarded int
+	}{
+		{"none fails on a bad header byte", RESYNC_NONE, concat(frame(SID_NULL, nil), garbage, frame(SID_PING, make([]byte, 4))), []MessageId{SID_NULL}, ErrInvalidHeader, 0},
+		{"scan skips to the next header", RESYNC_SCAN, concat(frame(SID_NULL, nil), garbage, frame(SID_PING, make([]byte, 4))), []MessageId{SID_NULL, SID_PING}, io.EOF, len(garbage)},
+		{"scan skips a short length", RESYNC_SCAN, concat([]byte{0xFF, 0x0E, 0x02, 0x00}, frame(SID_NULL, nil)), []MessageId{SID_NULL}, io.EOF, 4},
+		{"scan stops at an oversized length", RESYNC_SCAN, concat(garbage, []byte{0xFF, 0x0E, 0xFF, 0xFF}), nil, ErrLengthTooLong, len(garbage)},
+		{"scan gives up", RESYNC_SCAN, concat(bytes.Repeat([]byte{0x00}, MAX_RESYNC_BYTES+1), frame(SID_NULL, nil)), nil, ErrResyncFailed, MAX_RESYNC_BYTES},
+		{"scan counts across messages", RESYNC_SCAN, concat(garbage, frame(SID_NULL, nil), garbage, garbage, frame(SID_NULL, nil)), []MessageId{SID_NULL, SID_NULL}, io.EOF, 3 * len(garbage)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reader := NewReader(bytes.NewReader(test.stream))
+			reader.SetMaxBodySize(16)
+			reader.SetResyncPolicy(test.policy)
+
+			var ids []MessageId
+			var err error
+			for {
+				var m *Message
+				m, err = reader.ReadMessage()
+				if err != nil {
+					break
+				}
+				ids = append(ids, m.ID)
+			}
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+			if len(ids) != len(test.ids) {
+				t.Fatalf("expected messages %v, got %v", test.ids, ids)
+			}
+			for i := range ids {
+				if ids[i] != test.ids[i] {
+					t.Fatalf("expected messages %v, got %v", test.ids, ids)
+				}
+			}
+			if reader.Discarded() != test.discarded {
+				t.Errorf("expected %d bytes discarded, got %d", test.discarded, reader.Discarded())
+			}
+		})
+	}
+}
+
+func TestParseResyncPolicy(t *testing.T) {
+	for value, expected := range map[string]ResyncPolicy{"none": RESYNC_NONE, "scan": RESYNC_SCAN} {
+		policy, err := ParseResyncPolicy(value)
+		if err != nil || policy != expected {
+			t.Errorf("%s: expected %d, got %d (%v)", value, expected, policy, err)
+		}
+	}
+	if _, err := ParseResyncPolicy("skip"); err == nil {
+		t.Error("accepted an unknown policy")
+	}
+}
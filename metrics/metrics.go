@@ -0,0 +1,286 @@
+// Package metrics keeps server counters, gauges and histograms and serves them
+// in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const CONTENT_TYPE = "text/plain; version=0.0.4; charset=utf-8"
+
+// collector is a metric family that writes its samples when scraped.
+type collector interface {
+	describe() *desc
+	write(w *bufio.Writer)
+}
+
+type desc struct {
+	help   string
+	kind   string
+	labels []string
+	name   string
+}
+
+var (
+	collectors      = map[string]collector{}
+	collectorsMutex = sync.RWMutex{}
+)
+
+// register panics on a duplicate name, which can only be a programming error.
+func register(c collector) {
+	collectorsMutex.Lock()
+	defer collectorsMutex.Unlock()
+	name := c.describe().name
+	if _, ok := collectors[name]; ok {
+		panic(fmt.Sprintf("metric %s registered twice", name))
+	}
+	collectors[name] = c
+}
+
+// Counter is a family of monotonically increasing values, one per set of
+// label values.
+type Counter struct {
+	desc
+	mutex  sync.Mutex
+	values map[string]*counterValue
+}
+
+type counterValue struct {
+	labels []string
+	value  float64
+}
+
+func NewCounter(name string, help string, labels ...string) *Counter {
+	c := &Counter{desc: desc{help: help, kind: "counter", labels: labels, name: name}, values: map[string]*counterValue{}}
+	register(c)
+	return c
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increases the counter; negative deltas are ignored.
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		return
+	}
+	key := c.key(labelValues)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	v, ok := c.values[key]
+	if !ok {
+		v = &counterValue{labels: labelValues}
+		c.values[key] = v
+	}
+	v.value += delta
+}
+
+func (c *Counter) describe() *desc {
+	return &c.desc
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, key := range sortedKeys(c.values) {
+		v := c.values[key]
+		writeSample(w, c.name, c.labels, v.labels, "", "", v.value)
+	}
+}
+
+// Histogram counts observations into cumulative buckets, one set per set of
+// label values.
+type Histogram struct {
+	desc
+	buckets []float64
+	mutex   sync.Mutex
+	values  map[string]*histogramValue
+}
+
+type histogramValue struct {
+	counts []uint64 // per bucket, not cumulative; the last is +Inf
+	labels []string
+	sum    float64
+}
+
+// NewHistogram takes the upper bounds of the buckets in increasing order; a
+// +Inf bucket is always added.
+func NewHistogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{
+		desc:    desc{help: help, kind: "histogram", labels: labels, name: name},
+		buckets: buckets,
+		values:  map[string]*histogramValue{},
+	}
+	register(h)
+	return h
+}
+
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	key := h.key(labelValues)
+	bucket := sort.SearchFloat64s(h.buckets, value)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	v, ok := h.values[key]
+	if !ok {
+		v = &histogramValue{counts: make([]uint64, len(h.buckets)+1), labels: labelValues}
+		h.values[key] = v
+	}
+	v.counts[bucket]++
+	v.sum += value
+}
+
+func (h *Histogram) describe() *desc {
+	return &h.desc
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for _, key := range sortedKeys(h.values) {
+		v := h.values[key]
+		var count uint64
+		for i, n := range v.counts {
+			count += n
+			bound := math.Inf(1)
+			if i < len(h.buckets) {
+				bound = h.buckets[i]
+			}
+			writeSample(w, h.name+"_bucket", h.labels, v.labels, "le", formatFloat(bound), float64(count))
+		}
+		writeSample(w, h.name+"_sum", h.labels, v.labels, "", "", v.sum)
+		writeSample(w, h.name+"_count", h.labels, v.labels, "", "", float64(count))
+	}
+}
+
+// GaugeFunc reports values computed when scraped, for state the server
+// already keeps such as connected clients.
+type GaugeFunc struct {
+	desc
+	collect func(set func(value float64, labelValues ...string))
+}
+
+// NewGaugeFunc registers a gauge whose collect function calls set once per
+// set of label values.
+func NewGaugeFunc(name string, help string, labels []string, collect func(set func(value float64, labelValues ...string))) *GaugeFunc {
+	g := &GaugeFunc{desc: desc{help: help, kind: "gauge", labels: labels, name: name}, collect: collect}
+	register(g)
+	return g
+}
+
+func (g *GaugeFunc) describe() *desc {
+	return &g.desc
+}
+
+func (g *GaugeFunc) write(w *bufio.Writer) {
+	values := map[string]*counterValue{}
+	g.collect(func(value float64, labelValues ...string) {
+		key := g.key(labelValues)
+		if v, ok := values[key]; ok {
+			v.value += value
+			return
+		}
+		values[key] = &counterValue{labels: labelValues, value: value}
+	})
+	for _, key := range sortedKeys(values) {
+		v := values[key]
+		writeSample(w, g.name, g.labels, v.labels, "", "", v.value)
+	}
+}
+
+// key panics if the number of label values does not match the family.
+func (d *desc) key(labelValues []string) string {
+	if len(labelValues) != len(d.labels) {
+		panic(fmt.Sprintf("metric %s: expected %d label values, got %d", d.name, len(d.labels), len(labelValues)))
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+// Write writes every registered metric, ordered by name.
+func Write(out io.Writer) error {
+	collectorsMutex.RLock()
+	names := sortedKeys(collectors)
+	families := make([]collector, 0, len(names))
+	for _, name := range names {
+		families = append(families, collectors[name])
+	}
+	collectorsMutex.RUnlock()
+
+	w := bufio.NewWriter(out)
+	for _, c := range families {
+		d := c.describe()
+		fmt.Fprintf(w, "# HELP %s %s\n", d.name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(d.help))
+		fmt.Fprintf(w, "# TYPE %s %s\n", d.name, d.kind)
+		c.write(w)
+	}
+	return w.Flush()
+}
+
+// Handler serves the metrics to scrapers.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", CONTENT_TYPE)
+		Write(w)
+	})
+}
+
+func writeSample(w *bufio.Writer, name string, labels []string, values []string, extraLabel string, extraValue string, value float64) {
+	w.WriteString(name)
+	if len(labels) > 0 || extraLabel != "" {
+		w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			writeLabel(w, label, values[i])
+		}
+		if extraLabel != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			writeLabel(w, extraLabel, extraValue)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func writeLabel(w *bufio.Writer, label string, value string) {
+	w.WriteString(label)
+	w.WriteString(`="`)
+	labelEscaper.WriteString(w, value)
+	w.WriteByte('"')
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
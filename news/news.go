@@ -0,0 +1,62 @@
+// Package news holds the news and message of the day that clients request
+// with SID_NEWS_INFO.
+package news
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+type Entry struct {
+	Text string    `json:"text"`
+	Time time.Time `json:"time"` // zero for the message of the day
+}
+
+var (
+	entries      []Entry
+	entriesMutex = sync.RWMutex{}
+)
+
+// Load replaces the news with the entries in a JSON file. A missing file is
+// treated as no news.
+func Load(path string) error {
+	var loaded []Entry
+	raw, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to read news: %v", err)
+	}
+	if err == nil {
+		if err = json.Unmarshal(raw, &loaded); err != nil {
+			return fmt.Errorf("failed to parse news: %v", err)
+		}
+	}
+	Set(loaded)
+	return nil
+}
+
+// Set replaces the news, kept oldest first.
+func Set(list []Entry) {
+	sorted := make([]Entry, len(list))
+	copy(sorted, list)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Time.Before(sorted[j].Time) })
+
+	entriesMutex.Lock()
+	defer entriesMutex.Unlock()
+	entries = sorted
+}
+
+// List returns the news, oldest first, with the message of the day (if any)
+// at the start.
+func List() []Entry {
+	entriesMutex.RLock()
+	defer entriesMutex.RUnlock()
+	list := make([]Entry, len(entries))
+	copy(list, entries)
+	return list
+}
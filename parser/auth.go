@@ -0,0 +1,163 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/carlbennett/gobncs/cdkey"
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/codec"
+	"github.com/carlbennett/gobncs/datafile"
+	"github.com/carlbennett/gobncs/message"
+	"github.com/carlbennett/gobncs/versioncheck"
+)
+
+const (
+	LOGON_TYPE_BROKEN_SHA1 = 0x00
+	LOGON_TYPE_NLS_V1      = 0x01
+	LOGON_TYPE_NLS_V2      = 0x02
+)
+
+const (
+	AUTH_CHECK_OK              = 0x000
+	AUTH_CHECK_OLD_VERSION     = 0x100 // Info is the patch MPQ
+	AUTH_CHECK_INVALID_VERSION = 0x101
+	AUTH_CHECK_INVALID_KEY     = 0x200
+	AUTH_CHECK_KEY_IN_USE      = 0x201 // Info is the holder's key owner
+	AUTH_CHECK_KEY_BANNED      = 0x202
+	AUTH_CHECK_WRONG_PRODUCT   = 0x203
+	AUTH_CHECK_INVALID_EXP_KEY = 0x210
+	AUTH_CHECK_EXP_KEY_BANNED  = 0x212
+)
+
+func ParseSID_AUTH_CHECK(state *clientstate.ClientState, payload *message.Message) error {
+	/** Client->Server Format:
+	 * (UINT32)    Client Token
+	 * (UINT32)    EXE Version
+	 * (UINT32)    EXE Hash
+	 * (UINT32)    Number of CD-keys
+	 * (UINT32)    Spawn (0/1)
+	 * For each key:
+	 *   (UINT32)    Key Length
+	 *   (UINT32)    CD-Key Product
+	 *   (UINT32)    CD-Key Public Value
+	 *   (UINT32)    Unknown (0)
+	 *   (UINT32)[5] Hashed Key Data
+	 * (STRING)    EXE Information
+	 * (STRING)    Key Owner
+	 */
+
+	var fields codec.ClientSID_AUTH_CHECK
+	err := decodeMessage(payload, &fields)
+	if err != nil {
+		return err
+	}
+
+	state.ClientToken = fields.ClientToken
+	state.ExeVersion = fields.ExeVersion
+	state.ExeHash = fields.ExeHash
+	state.ExeInfo = fields.ExeInfo
+
+	var result uint32 = AUTH_CHECK_OK
+	var info []byte
+	switch versioncheck.Check(state.Product, state.VersionId, state.ExeVersion, state.ExeHash) {
+	case versioncheck.RESULT_SUCCESS:
+	case versioncheck.RESULT_OLD_VERSION:
+		result = AUTH_CHECK_OLD_VERSION
+		if settings, ok := versioncheck.GetSettings(state.Product); ok {
+			info = []byte(settings.PatchPath)
+		}
+	default:
+		result = AUTH_CHECK_INVALID_VERSION
+	}
+	if result != AUTH_CHECK_OK {
+		state.Logger(logger).Info("version check failed", "version_byte", fmt.Sprintf("0x%02X", state.VersionId), "exe_version", fmt.Sprintf("0x%08X", state.ExeVersion), "exe_hash", fmt.Sprintf("0x%08X", state.ExeHash))
+	}
+
+	if required := cdkey.KeyCount(state.Product); result == AUTH_CHECK_OK && len(fields.Keys) != required {
+		state.Logger(logger).Info("cd-key rejected; wrong number of keys", "expected", required, "received", len(fields.Keys))
+		result = AUTH_CHECK_INVALID_KEY
+		if len(fields.Keys) > 0 && len(fields.Keys) < required {
+			result = AUTH_CHECK_INVALID_EXP_KEY
+		}
+	}
+
+	// expansion keys are accepted without being registered, since a
+	// connection holds a single key, but may still be banned
+	if result == AUTH_CHECK_OK && len(fields.Keys) > 1 {
+		key := fields.Keys[1]
+		if cdkey.Banned(cdkey.HashedKeyIdentity(key.Product, key.PublicValue)) {
+			state.Logger(logger).Info("cd-key rejected; expansion key banned")
+			result = AUTH_CHECK_EXP_KEY_BANNED
+		}
+	}
+	keyAcquired := false
+	if result == AUTH_CHECK_OK && len(fields.Keys) > 0 {
+		key := fields.Keys[0]
+		identity := cdkey.HashedKeyIdentity(key.Product, key.PublicValue)
+		keyResult, holder := acquireKey(state, identity, fields.KeyOwner, fields.Spawn)
+		switch keyResult {
+		case cdkey.RESULT_OK:
+			state.CDKeyHash = key.Hash
+			keyAcquired = true
+		case cdkey.RESULT_BAD_PRODUCT:
+			result = AUTH_CHECK_WRONG_PRODUCT
+		case cdkey.RESULT_BANNED:
+			result = AUTH_CHECK_KEY_BANNED
+		case cdkey.RESULT_IN_USE:
+			result, info = AUTH_CHECK_KEY_IN_USE, holder
+		default:
+			result = AUTH_CHECK_INVALID_KEY
+		}
+	}
+
+	state.VersionChecked = result == AUTH_CHECK_OK
+	if state.VersionChecked {
+		state.Phase = clientstate.PHASE_AWAITING_LOGON
+	}
+
+	reply, err := codec.Encode(codec.ServerSID_AUTH_CHECK{Result: result, Info: info})
+	if err == nil {
+		err = WriteSID(state, reply)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write auth check reply: %v", err)
+	}
+
+	if keyAcquired {
+		return StartWarden(state)
+	}
+
+	return nil
+}
+
+// versionCheckChallenge returns the CheckRevision archive and formula handed
+// to clients of the product, along with the archive's file time.
+func versionCheckChallenge(product clientstate.Product) (versioncheck.Settings, uint64, error) {
+	settings, ok := versioncheck.GetSettings(product)
+	if !ok {
+		return settings, 0, fmt.Errorf("no version check settings for product (%s)", clientstate.ProductToName(product))
+	}
+
+	var fileTime uint64
+	if file, ok := datafile.Get(settings.MPQFileName); ok {
+		fileTime = file.FileTime
+	}
+
+	return settings, fileTime, nil
+}
+
+func WriteSID_AUTH_INFO(state *clientstate.ClientState) (*message.Message, error) {
+	settings, fileTime, err := versionCheckChallenge(state.Product)
+	if err != nil {
+		return nil, err
+	}
+
+	return codec.Encode(codec.ServerSID_AUTH_INFO{
+		LogonType:   LOGON_TYPE_BROKEN_SHA1,
+		MPQFileName: []byte(settings.MPQFileName),
+		MPQFileTime: codec.FileTime(fileTime),
+		ServerToken: state.ServerToken,
+		UDPValue:    state.UDPValue,
+		ValueString: []byte(settings.ValueString),
+	})
+}
@@ -0,0 +1,142 @@
+package parser
+
+import (
+	"net"
+	"testing"
+
+	"github.com/carlbennett/gobncs/cdkey"
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/codec"
+	"github.com/carlbennett/gobncs/message"
+	"github.com/carlbennett/gobncs/versioncheck"
+)
+
+// newTestState returns the state of a connection that has identified itself
+// as product and is waiting for its version check. Replies are read from
+// state.Outbound().
+func newTestState(t *testing.T, product clientstate.Product) *clientstate.ClientState {
+	t.Helper()
+	conn, peer := net.Pipe()
+	state := clientstate.NewClientState(conn)
+	state.Phase = clientstate.PHASE_AWAITING_VERSION_CHECK
+	state.Product = product
+	state.UpdateCapabilities()
+	if settings, ok := versioncheck.GetSettings(product); ok {
+		state.VersionId = settings.VersionByte
+	}
+	t.Cleanup(func() {
+		cdkey.Release(state)
+		state.Close()
+		peer.Close()
+	})
+	return state
+}
+
+// dispatch encodes p and passes it to h as if the client sent it.
+func dispatch(t *testing.T, state *clientstate.ClientState, h func(*clientstate.ClientState, *message.Message) error, p codec.Payload) error {
+	t.Helper()
+	m, err := codec.Encode(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h(state, m)
+}
+
+// nextReply decodes the next queued reply into p.
+func nextReply(t *testing.T, state *clientstate.ClientState, p codec.Payload) {
+	t.Helper()
+	select {
+	case m := <-state.Outbound():
+		if err := codec.Decode(m, p); err != nil {
+			t.Fatal(err)
+		}
+	default:
+		t.Fatalf("no reply queued; expected %s", message.MessageIdToName(p.MessageID()))
+	}
+}
+
+func testKeys(count int) []codec.AuthCheckKey {
+	keys := make([]codec.AuthCheckKey, count)
+	for i := range keys {
+		keys[i] = codec.AuthCheckKey{KeyLength: 26, Product: uint32(i + 1), PublicValue: 0x00ABCDEF + uint32(i)}
+	}
+	return keys
+}
+
+func TestAuthCheckKeyCount(t *testing.T) {
+	tests := []struct {
+		name    string
+		product clientstate.Product
+		keys    int
+		result  uint32
+	}{
+		{"no key", clientstate.PRODUCT_STAR, 0, AUTH_CHECK_INVALID_KEY},
+		{"one key", clientstate.PRODUCT_STAR, 1, AUTH_CHECK_OK},
+		{"extra key", clientstate.PRODUCT_STAR, 2, AUTH_CHECK_INVALID_KEY},
+		{"expansion without keys", clientstate.PRODUCT_D2XP, 0, AUTH_CHECK_INVALID_KEY},
+		{"expansion without its own key", clientstate.PRODUCT_D2XP, 1, AUTH_CHECK_INVALID_EXP_KEY},
+		{"expansion with both keys", clientstate.PRODUCT_D2XP, 2, AUTH_CHECK_OK},
+		{"shareware", clientstate.PRODUCT_SSHR, 0, AUTH_CHECK_OK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state := newTestState(t, test.product)
+			keys := testKeys(test.keys)
+			err := dispatch(t, state, ParseSID_AUTH_CHECK, codec.ClientSID_AUTH_CHECK{KeyCount: uint32(len(keys)), Keys: keys})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var reply codec.ServerSID_AUTH_CHECK
+			nextReply(t, state, &reply)
+			if reply.Result != test.result {
+				t.Fatalf("expected result 0x%03X, got 0x%03X", test.result, reply.Result)
+			}
+			if passed := test.result == AUTH_CHECK_OK; state.VersionChecked != passed || (state.Phase == clientstate.PHASE_AWAITING_LOGON) != passed {
+				t.Errorf("expected the check to pass: %v, got phase %s", passed, clientstate.PhaseToName(state.Phase))
+			}
+		})
+	}
+}
+
+func TestAuthCheckExe(t *testing.T) {
+	settings, _ := versioncheck.GetSettings(clientstate.PRODUCT_STAR)
+	original := settings
+	settings.ExeVersion, settings.ExeHash = 0x01100000, 0xCAFEBABE
+	versioncheck.SetSettings(clientstate.PRODUCT_STAR, settings)
+	t.Cleanup(func() { versioncheck.SetSettings(clientstate.PRODUCT_STAR, original) })
+
+	tests := []struct {
+		name    string
+		version uint32
+		hash    uint32
+		result  uint32
+	}{
+		{"matching", 0x01100000, 0xCAFEBABE, AUTH_CHECK_OK},
+		{"old exe", 0x01090000, 0xCAFEBABE, AUTH_CHECK_OLD_VERSION},
+		{"modified exe", 0x01100000, 0xDEADBEEF, AUTH_CHECK_INVALID_VERSION},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state := newTestState(t, clientstate.PRODUCT_STAR)
+			keys := testKeys(1)
+			err := dispatch(t, state, ParseSID_AUTH_CHECK, codec.ClientSID_AUTH_CHECK{
+				ExeHash:    test.hash,
+				ExeVersion: test.version,
+				KeyCount:   uint32(len(keys)),
+				Keys:       keys,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var reply codec.ServerSID_AUTH_CHECK
+			nextReply(t, state, &reply)
+			if reply.Result != test.result {
+				t.Fatalf("expected result 0x%03X, got 0x%03X", test.result, reply.Result)
+			}
+		})
+	}
+}
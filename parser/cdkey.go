@@ -0,0 +1,150 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/carlbennett/gobncs/cdkey"
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/codec"
+	"github.com/carlbennett/gobncs/message"
+)
+
+func ParseSID_CDKEY(state *clientstate.ClientState, payload *message.Message) error {
+	/** Client->Server Format:
+	 * (UINT32) Spawn (0/1)
+	 * (STRING) CD-Key
+	 * (STRING) Key Owner
+	 */
+
+	var fields codec.ClientSID_CDKEY
+	err := decodeMessage(payload, &fields)
+	if err != nil {
+		return err
+	}
+
+	result, holder := acquireKey(state, cdkey.PlainKeyIdentity(fields.Key), fields.KeyOwner, fields.Spawn)
+	err = writeKeyResult(state, false, result, holder)
+	if err != nil || result != cdkey.RESULT_OK {
+		return err
+	}
+
+	awaitLogon(state)
+	return nil
+}
+
+func ParseSID_CDKEY2(state *clientstate.ClientState, payload *message.Message) error {
+	/** Client->Server Format:
+	 * (UINT32)    Spawn (0/1)
+	 * (UINT32)    Key Length
+	 * (UINT32)    CD-Key Product
+	 * (UINT32)    CD-Key Public Value
+	 * (UINT32)    Server Token
+	 * (UINT32)    Client Token
+	 * (UINT32)[5] Hashed Data
+	 * (STRING)    Key Owner
+	 */
+
+	var fields codec.ClientSID_CDKEY2
+	err := decodeMessage(payload, &fields)
+	if err != nil {
+		return err
+	}
+
+	if fields.ServerToken != state.ServerToken {
+		state.Logger(logger).Info("cd-key rejected; server token mismatch")
+		return writeKeyResult(state, true, cdkey.RESULT_INVALID, nil)
+	}
+	state.ClientToken = fields.ClientToken
+	state.CDKeyHash = fields.Hash
+
+	// the hashed key data cannot be verified without the private key value,
+	// so keys are identified by their product and public value only
+	identity := cdkey.HashedKeyIdentity(fields.KeyProduct, fields.PublicValue)
+	result, holder := acquireKey(state, identity, fields.KeyOwner, fields.Spawn)
+	err = writeKeyResult(state, true, result, holder)
+	if err != nil || result != cdkey.RESULT_OK {
+		return err
+	}
+
+	awaitLogon(state)
+	return StartWarden(state)
+}
+
+// awaitLogon lets a legacy client log on once its version was checked and it
+// holds the CD-key its product needs. The key is sent after the version, so
+// this is checked after both.
+func awaitLogon(state *clientstate.ClientState) {
+	if _, ok := cdkey.IdentityOf(state); state.VersionChecked && (ok || cdkey.KeyCount(state.Product) == 0) {
+		state.Phase = clientstate.PHASE_AWAITING_LOGON
+	}
+}
+
+func ParseSID_SWITCHPRODUCT(state *clientstate.ClientState, payload *message.Message) error {
+	/** Client->Server Format:
+	 * (UINT32) Product code
+	 */
+
+	var fields codec.ClientSID_SWITCHPRODUCT
+	err := decodeMessage(payload, &fields)
+	if err != nil {
+		return err
+	}
+
+	product := clientstate.Product(fields.Product)
+	if _, ok := clientstate.CodeToProduct(clientstate.ProductToCode(product)); !ok {
+		return fmt.Errorf("cannot switch to unknown product (%s)", clientstate.ProductToCode(product))
+	}
+	if state.Spawn && !cdkey.SpawnSupported(product) {
+		return fmt.Errorf("spawned install cannot switch to product (%s)", clientstate.ProductToName(product))
+	}
+
+	// the version was checked for the product the client started with, which
+	// also covers the other edition of the same game
+	if clientstate.BaseProduct(product) != clientstate.BaseProduct(state.Product) {
+		return fmt.Errorf("cannot switch from product (%s) to another game (%s)", clientstate.ProductToName(state.Product), clientstate.ProductToName(product))
+	}
+
+	state.Logger(logger).Info("switching product", "to", clientstate.ProductToCode(product))
+	state.Product = product
+	state.UpdateCapabilities()
+
+	return nil
+}
+
+func acquireKey(state *clientstate.ClientState, identity string, owner []byte, spawn bool) (cdkey.Result, []byte) {
+	holder, err := cdkey.Acquire(state, identity, string(owner), spawn)
+	switch {
+	case err == nil:
+		state.CDKeyOwner = owner
+		state.Spawn = spawn
+		state.UpdateCapabilities()
+		return cdkey.RESULT_OK, owner
+	case errors.Is(err, cdkey.ErrSpawnDisabled):
+		state.Logger(logger).Info("cd-key rejected", "error", err)
+		return cdkey.RESULT_BAD_PRODUCT, nil
+	case errors.Is(err, cdkey.ErrKeyBanned):
+		state.Logger(logger).Info("cd-key rejected", "error", err)
+		return cdkey.RESULT_BANNED, nil
+	default:
+		state.Logger(logger).Info("cd-key rejected", "error", err)
+		return cdkey.RESULT_IN_USE, []byte(holder)
+	}
+}
+
+func writeKeyResult(state *clientstate.ClientState, extended bool, result cdkey.Result, owner []byte) error {
+	var fields codec.Payload = codec.ServerSID_CDKEY{Result: uint32(result), KeyOwner: owner}
+	if extended {
+		fields = codec.ServerSID_CDKEY2{Result: uint32(result), KeyOwner: owner}
+	}
+
+	reply, err := codec.Encode(fields)
+	if err == nil {
+		err = WriteSID(state, reply)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write cd-key reply: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+package parser
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/carlbennett/gobncs/ban"
+	"github.com/carlbennett/gobncs/cdkey"
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/codec"
+	"github.com/carlbennett/gobncs/versioncheck"
+)
+
+// reportVersion passes a legacy client's version check.
+func reportVersion(t *testing.T, state *clientstate.ClientState) {
+	t.Helper()
+	settings, _ := versioncheck.GetSettings(state.Product)
+	err := dispatch(t, state, ParseSID_STARTVERSIONING, codec.ClientSID_STARTVERSIONING{
+		Platform:    codec.FourCC(clientstate.PLATFORM_IX86),
+		Product:     codec.FourCC(state.Product),
+		VersionByte: settings.VersionByte,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var challenge codec.ServerSID_STARTVERSIONING
+	nextReply(t, state, &challenge)
+
+	err = dispatch(t, state, ParseSID_REPORTVERSION, codec.ClientSID_REPORTVERSION{
+		Platform:    codec.FourCC(clientstate.PLATFORM_IX86),
+		Product:     codec.FourCC(state.Product),
+		VersionByte: settings.VersionByte,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reply codec.ServerSID_REPORTVERSION
+	nextReply(t, state, &reply)
+	if !state.VersionChecked {
+		t.Fatalf("version check failed with result 0x%02X", reply.Result)
+	}
+}
+
+func TestReportVersionNeedsChallenge(t *testing.T) {
+	state := newTestState(t, clientstate.PRODUCT_STAR)
+	state.Phase = clientstate.PHASE_AWAITING_AUTH_INFO
+	settings, _ := versioncheck.GetSettings(state.Product)
+	err := dispatch(t, state, ParseSID_REPORTVERSION, codec.ClientSID_REPORTVERSION{
+		Platform:    codec.FourCC(clientstate.PLATFORM_IX86),
+		Product:     codec.FourCC(state.Product),
+		VersionByte: settings.VersionByte,
+	})
+	if err == nil {
+		t.Fatal("version report accepted without SID_STARTVERSIONING")
+	}
+	if state.VersionChecked {
+		t.Fatal("version check passed without SID_STARTVERSIONING")
+	}
+}
+
+func TestLegacyLogonNeedsKey(t *testing.T) {
+	state := newTestState(t, clientstate.PRODUCT_STAR)
+	reportVersion(t, state)
+	if state.Phase != clientstate.PHASE_AWAITING_VERSION_CHECK {
+		t.Fatalf("client may log on without a cd-key (phase %s)", clientstate.PhaseToName(state.Phase))
+	}
+
+	if err := dispatch(t, state, ParseSID_CDKEY, codec.ClientSID_CDKEY{Key: []byte("1234-5678-90123"), KeyOwner: []byte("tester")}); err != nil {
+		t.Fatal(err)
+	}
+	var reply codec.ServerSID_CDKEY
+	nextReply(t, state, &reply)
+	if reply.Result != uint32(cdkey.RESULT_OK) || state.Phase != clientstate.PHASE_AWAITING_LOGON {
+		t.Fatalf("expected the key to let the client log on, got result 0x%02X and phase %s", reply.Result, clientstate.PhaseToName(state.Phase))
+	}
+
+	// Diablo has no key and may go on straight away
+	diablo := newTestState(t, clientstate.PRODUCT_DRTL)
+	reportVersion(t, diablo)
+	if diablo.Phase != clientstate.PHASE_AWAITING_LOGON {
+		t.Fatalf("expected a client without a key to go on, got phase %s", clientstate.PhaseToName(diablo.Phase))
+	}
+}
+
+func TestBannedKey(t *testing.T) {
+	if err := ban.Open(filepath.Join(t.TempDir(), "bans.json")); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ban.Open("") })
+	if _, err := ban.Add(ban.KIND_KEY, cdkey.PlainKeyIdentity([]byte("1234567890123")), "shared", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	state := newTestState(t, clientstate.PRODUCT_STAR)
+	reportVersion(t, state)
+	if err := dispatch(t, state, ParseSID_CDKEY, codec.ClientSID_CDKEY{Key: []byte("1234-5678-90123"), KeyOwner: []byte("tester")}); err != nil {
+		t.Fatal(err)
+	}
+	var reply codec.ServerSID_CDKEY
+	nextReply(t, state, &reply)
+	if reply.Result != uint32(cdkey.RESULT_BANNED) || state.Phase == clientstate.PHASE_AWAITING_LOGON {
+		t.Fatalf("expected the banned key to be refused, got result 0x%02X and phase %s", reply.Result, clientstate.PhaseToName(state.Phase))
+	}
+}
+
+func TestSwitchProduct(t *testing.T) {
+	tests := []struct {
+		name string
+		from clientstate.Product
+		to   clientstate.Product
+		ok   bool
+	}{
+		{"to the expansion", clientstate.PRODUCT_STAR, clientstate.PRODUCT_SEXP, true},
+		{"to the original game", clientstate.PRODUCT_D2XP, clientstate.PRODUCT_D2DV, true},
+		{"to another game", clientstate.PRODUCT_STAR, clientstate.PRODUCT_W2BN, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state := newTestState(t, test.from)
+			state.Phase = clientstate.PHASE_AWAITING_LOGON
+			err := dispatch(t, state, ParseSID_SWITCHPRODUCT, codec.ClientSID_SWITCHPRODUCT{Product: codec.FourCC(test.to)})
+			if (err == nil) != test.ok {
+				t.Fatalf("expected the switch to succeed: %v, got %v", test.ok, err)
+			}
+			if test.ok && state.Product != test.to {
+				t.Fatalf("product is still %s", clientstate.ProductToCode(state.Product))
+			}
+		})
+	}
+}
@@ -0,0 +1,292 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/carlbennett/gobncs/account"
+	"github.com/carlbennett/gobncs/channel"
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/codec"
+	"github.com/carlbennett/gobncs/message"
+)
+
+const (
+	EID_SHOWUSER            = 0x01
+	EID_JOIN                = 0x02
+	EID_LEAVE               = 0x03
+	EID_WHISPER             = 0x04
+	EID_TALK                = 0x05
+	EID_BROADCAST           = 0x06
+	EID_CHANNEL             = 0x07
+	EID_USERFLAGS           = 0x09
+	EID_WHISPERSENT         = 0x0A
+	EID_CHANNELFULL         = 0x0D
+	EID_CHANNELDOESNOTEXIST = 0x0E
+	EID_CHANNELRESTRICTED   = 0x0F
+	EID_INFO                = 0x12
+	EID_ERROR               = 0x13
+	EID_EMOTE               = 0x17
+)
+
+// the longest line a client may send in chat
+const CHAT_MAX_LENGTH = 223
+
+// the channel for clients that join without naming one
+const DEFAULT_CHANNEL = "Chat"
+
+func ParseSID_ENTERCHAT(state *clientstate.ClientState, payload *message.Message) error {
+	/** Client->Server Format:
+	 * (STRING) Username (ignored unless the product has no accounts; the
+	 *          logged on account is used)
+	 * (STRING) Statstring
+	 */
+
+	var fields codec.ClientSID_ENTERCHAT
+	err := decodeMessage(payload, &fields)
+	if err != nil {
+		return err
+	}
+
+	// Diablo clients never log on and enter chat straight from the version
+	// check, under the character name they send here
+	if state.Phase == clientstate.PHASE_AWAITING_LOGON {
+		if clientstate.ProductRequiresLogon(state.Product) || !state.VersionChecked {
+			return fmt.Errorf("entered chat before logging on")
+		}
+		if err = account.ValidateUsername(string(fields.Username)); err != nil {
+			return fmt.Errorf("invalid character name: %v", err)
+		}
+		state.Username = fields.Username
+		state.Phase = clientstate.PHASE_CHAT
+	}
+	if !state.HasCapability(clientstate.CAPABILITY_CHAT) {
+		return fmt.Errorf("product (%s) may not enter chat", clientstate.ProductToCode(state.Product))
+	}
+
+	// clients without a statstring of their own are shown by product code,
+	// reversed the same way it appears on the wire
+	statstring := fields.Statstring
+	if len(statstring) == 0 {
+		code := clientstate.ProductToCode(state.Product)
+		statstring = []byte{code[3], code[2], code[1], code[0]}
+	}
+	state.Statstring = statstring
+
+	reply, err := codec.Encode(codec.ServerSID_ENTERCHAT{
+		AccountName: state.Username,
+		Statstring:  statstring,
+		UniqueName:  state.Username,
+	})
+	if err == nil {
+		err = WriteSID(state, reply)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write enter chat reply: %v", err)
+	}
+
+	return nil
+}
+
+func ParseSID_GETCHANNELLIST(state *clientstate.ClientState, payload *message.Message) error {
+	/** Client->Server Format:
+	 * (UINT32) Product code
+	 */
+
+	var fields codec.ClientSID_GETCHANNELLIST
+	err := decodeMessage(payload, &fields)
+	if err != nil {
+		return err
+	}
+
+	// the public channels are the ones in use; the list ends with an empty name
+	names := [][]byte{}
+	for _, c := range channel.List() {
+		names = append(names, []byte(c.Name))
+	}
+	names = append(names, []byte{})
+
+	reply, err := codec.Encode(codec.ServerSID_GETCHANNELLIST{Channels: names})
+	if err == nil {
+		err = WriteSID(state, reply)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write channel list reply: %v", err)
+	}
+
+	return nil
+}
+
+func ParseSID_JOINCHANNEL(state *clientstate.ClientState, payload *message.Message) error {
+	/** Client->Server Format:
+	 * (UINT32) Flags
+	 * (STRING) Channel
+	 */
+
+	var fields codec.ClientSID_JOINCHANNEL
+	err := decodeMessage(payload, &fields)
+	if err != nil {
+		return err
+	}
+
+	// the first join after entering chat may leave the name to the server
+	name := string(fields.Channel)
+	if len(name) == 0 {
+		name = DEFAULT_CHANNEL
+	}
+	return joinChannel(state, name)
+}
+
+func ParseSID_CHATCOMMAND(state *clientstate.ClientState, payload *message.Message) error {
+	/** Client->Server Format:
+	 * (STRING) Text
+	 */
+
+	var fields codec.ClientSID_CHATCOMMAND
+	err := decodeMessage(payload, &fields)
+	if err != nil {
+		return err
+	}
+
+	text := fields.Text
+	switch {
+	case len(text) == 0:
+		return nil
+	case len(text) > CHAT_MAX_LENGTH:
+		return writeChatEvent(state, EID_ERROR, []byte("Your message is too long."))
+	case text[0] == '/':
+		return chatCommand(state, string(text[1:]))
+	}
+
+	c, ok := channel.Of(state)
+	if !ok {
+		return writeChatEvent(state, EID_ERROR, []byte("You are not in a channel."))
+	}
+	// clients echo their own chat locally
+	event, err := WriteSID_CHATEVENT(EID_TALK, 0, uint32(state.Ping), state.Username, text)
+	if err != nil {
+		return fmt.Errorf("failed to write chat event: %v", err)
+	}
+	sendToMembers(c.Members, state, event)
+
+	return nil
+}
+
+func ParseSID_LEAVECHAT(state *clientstate.ClientState, payload *message.Message) error {
+	var fields codec.ClientSID_LEAVECHAT
+	err := decodeMessage(payload, &fields)
+	if err != nil {
+		return err
+	}
+
+	LeaveChannel(state)
+
+	return nil
+}
+
+// joinChannel moves the client into a channel, shows it the members already
+// there and announces it to them.
+func joinChannel(state *clientstate.ClientState, name string) error {
+	if len(name) > channel.NAME_MAX_LENGTH {
+		return writeChatEvent(state, EID_CHANNELRESTRICTED, []byte(name))
+	}
+
+	LeaveChannel(state)
+	member := channel.Member{
+		Ping:       uint32(state.Ping),
+		State:      state,
+		Statstring: state.Statstring,
+		Username:   state.Username,
+	}
+	c, _ := channel.Join(name, member)
+	state.Logger(logger).Info("joined channel", "channel", c.Name)
+
+	if err := writeChatEvent(state, EID_CHANNEL, []byte(c.Name)); err != nil {
+		return err
+	}
+	for _, m := range c.Members {
+		event, err := WriteSID_CHATEVENT(EID_SHOWUSER, m.Flags, m.Ping, m.Username, m.Statstring)
+		if err == nil {
+			err = WriteSID(state, event)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write channel member: %v", err)
+		}
+	}
+
+	event, err := WriteSID_CHATEVENT(EID_JOIN, member.Flags, member.Ping, member.Username, member.Statstring)
+	if err != nil {
+		return fmt.Errorf("failed to write chat event: %v", err)
+	}
+	sendToMembers(c.Members, state, event)
+
+	return nil
+}
+
+// LeaveChannel removes the client from its channel, if any, and tells the
+// members that remain. It reads nothing but the channel registry, so it may be
+// called without the client's lock once the connection has ended.
+func LeaveChannel(state *clientstate.ClientState) {
+	c, ok := channel.Of(state)
+	if !ok {
+		return
+	}
+	var left channel.Member
+	for _, m := range c.Members {
+		if m.State == state {
+			left = m
+		}
+	}
+	if c, ok = channel.Leave(state); !ok {
+		return
+	}
+
+	event, err := WriteSID_CHATEVENT(EID_LEAVE, left.Flags, left.Ping, left.Username, nil)
+	if err != nil {
+		logger.Warn("failed to write chat event", "error", err)
+		return
+	}
+	sendToMembers(c.Members, state, event)
+}
+
+// sendToMembers queues an event for every member other than the sender.
+// Members whose connection has closed are skipped.
+func sendToMembers(members []channel.Member, sender *clientstate.ClientState, event *message.Message) {
+	for _, m := range members {
+		if m.State != sender {
+			WriteSID(m.State, event)
+		}
+	}
+}
+
+// writeChatEvent sends the client a chat event from the server.
+func writeChatEvent(state *clientstate.ClientState, eventId uint32, text []byte) error {
+	event, err := WriteSID_CHATEVENT(eventId, 0, 0, state.Username, text)
+	if err == nil {
+		err = WriteSID(state, event)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write chat event: %v", err)
+	}
+	return nil
+}
+
+func WriteSID_CHATEVENT(eventId uint32, flags uint32, ping uint32, username []byte, text []byte) (*message.Message, error) {
+	/** Server->Client Format:
+	 * (UINT32) Event ID
+	 * (UINT32) User's Flags
+	 * (UINT32) Ping
+	 * (UINT32) IP Address (Defunct)
+	 * (UINT32) Account number (Defunct)
+	 * (UINT32) Registration Authority (Defunct)
+	 * (STRING) Username
+	 * (STRING) Text
+	 */
+
+	return codec.Encode(codec.ServerSID_CHATEVENT{
+		EventId:  eventId,
+		Flags:    flags,
+		Ping:     ping,
+		Username: username,
+		Text:     text,
+	})
+}
@@ -0,0 +1,111 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/codec"
+	"github.com/carlbennett/gobncs/message"
+)
+
+// newChatState returns the state of a client logged on as username and in
+// chat, but not yet in a channel.
+func newChatState(t *testing.T, username string) *clientstate.ClientState {
+	t.Helper()
+	state := newTestState(t, clientstate.PRODUCT_STAR)
+	state.Phase = clientstate.PHASE_CHAT
+	state.Username = []byte(username)
+	state.Statstring = []byte("RATS")
+	t.Cleanup(func() { LeaveChannel(state) })
+	return state
+}
+
+// nextChatEvent decodes the next queued reply as a chat event.
+func nextChatEvent(t *testing.T, state *clientstate.ClientState) codec.ServerSID_CHATEVENT {
+	t.Helper()
+	var event codec.ServerSID_CHATEVENT
+	nextReply(t, state, &event)
+	return event
+}
+
+func expectNoReply(t *testing.T, state *clientstate.ClientState) {
+	t.Helper()
+	select {
+	case m := <-state.Outbound():
+		t.Fatalf("unexpected %s", message.MessageIdToName(m.ID))
+	default:
+	}
+}
+
+func TestChannelChat(t *testing.T) {
+	alice := newChatState(t, "alice")
+	bob := newChatState(t, "bob")
+
+	if err := dispatch(t, alice, ParseSID_JOINCHANNEL, codec.ClientSID_JOINCHANNEL{Channel: []byte("Lobby")}); err != nil {
+		t.Fatal(err)
+	}
+	if event := nextChatEvent(t, alice); event.EventId != EID_CHANNEL || string(event.Text) != "Lobby" {
+		t.Fatalf("expected to enter Lobby, got %+v", event)
+	}
+	if event := nextChatEvent(t, alice); event.EventId != EID_SHOWUSER || string(event.Username) != "alice" {
+		t.Fatalf("expected to be shown in the channel, got %+v", event)
+	}
+
+	if err := dispatch(t, bob, ParseSID_JOINCHANNEL, codec.ClientSID_JOINCHANNEL{Channel: []byte("lobby")}); err != nil {
+		t.Fatal(err)
+	}
+	nextChatEvent(t, bob)
+	if first, second := nextChatEvent(t, bob), nextChatEvent(t, bob); string(first.Username) != "alice" || string(second.Username) != "bob" {
+		t.Fatalf("expected alice and bob in the channel, got %q and %q", first.Username, second.Username)
+	}
+	if event := nextChatEvent(t, alice); event.EventId != EID_JOIN || string(event.Username) != "bob" || string(event.Text) != "RATS" {
+		t.Fatalf("expected bob's join, got %+v", event)
+	}
+
+	if err := dispatch(t, bob, ParseSID_CHATCOMMAND, codec.ClientSID_CHATCOMMAND{Text: []byte("hello")}); err != nil {
+		t.Fatal(err)
+	}
+	if event := nextChatEvent(t, alice); event.EventId != EID_TALK || string(event.Username) != "bob" || string(event.Text) != "hello" {
+		t.Fatalf("expected bob's chat, got %+v", event)
+	}
+	expectNoReply(t, bob)
+
+	if err := dispatch(t, bob, ParseSID_CHATCOMMAND, codec.ClientSID_CHATCOMMAND{Text: []byte("/w alice psst")}); err != nil {
+		t.Fatal(err)
+	}
+	if event := nextChatEvent(t, alice); event.EventId != EID_WHISPER || string(event.Text) != "psst" {
+		t.Fatalf("expected bob's whisper, got %+v", event)
+	}
+	if event := nextChatEvent(t, bob); event.EventId != EID_WHISPERSENT || string(event.Username) != "alice" {
+		t.Fatalf("expected the whisper to be confirmed, got %+v", event)
+	}
+
+	if err := dispatch(t, bob, ParseSID_LEAVECHAT, codec.ClientSID_LEAVECHAT{}); err != nil {
+		t.Fatal(err)
+	}
+	if event := nextChatEvent(t, alice); event.EventId != EID_LEAVE || string(event.Username) != "bob" {
+		t.Fatalf("expected bob to leave, got %+v", event)
+	}
+}
+
+func TestChatCommandOutsideChannel(t *testing.T) {
+	state := newChatState(t, "alice")
+	tests := []struct {
+		text    string
+		eventId uint32
+	}{
+		{"hello", EID_ERROR},
+		{"/me waves", EID_ERROR},
+		{"/whoami", EID_INFO},
+		{"/unknown", EID_ERROR},
+		{"/w nobody hi", EID_ERROR},
+	}
+	for _, test := range tests {
+		if err := dispatch(t, state, ParseSID_CHATCOMMAND, codec.ClientSID_CHATCOMMAND{Text: []byte(test.text)}); err != nil {
+			t.Fatalf("%s: %v", test.text, err)
+		}
+		if event := nextChatEvent(t, state); event.EventId != test.eventId {
+			t.Errorf("%s: expected event 0x%02X, got 0x%02X", test.text, test.eventId, event.EventId)
+		}
+	}
+}
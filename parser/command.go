@@ -0,0 +1,181 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/carlbennett/gobncs/channel"
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/permission"
+)
+
+// OperatorCommand is a chat command reserved for accounts holding Permission,
+// the same grants that the admin API checks.
+type OperatorCommand struct {
+	Permission permission.Permission
+	// Run is called with the client's lock held and returns the text shown to
+	// the operator. A CommandError is shown as an error instead; any other
+	// error disconnects the client.
+	Run func(state *clientstate.ClientState, args string) (string, error)
+}
+
+// CommandError is a command failure shown to the client that ran it.
+type CommandError string
+
+func (e CommandError) Error() string {
+	return string(e)
+}
+
+var (
+	operatorCommands      = map[string]OperatorCommand{}
+	operatorCommandsMutex = sync.RWMutex{}
+)
+
+// RegisterOperatorCommand adds an operator command under each of names. It
+// lets packages that parser cannot import, such as server, act on clients.
+func RegisterOperatorCommand(command OperatorCommand, names ...string) {
+	operatorCommandsMutex.Lock()
+	defer operatorCommandsMutex.Unlock()
+	for _, name := range names {
+		operatorCommands[strings.ToLower(name)] = command
+	}
+}
+
+func lookupOperatorCommand(name string) (OperatorCommand, bool) {
+	operatorCommandsMutex.RLock()
+	defer operatorCommandsMutex.RUnlock()
+	command, ok := operatorCommands[strings.ToLower(name)]
+	return command, ok
+}
+
+// allowedOperatorCommands lists the names of the operator commands the
+// client's account may run.
+func allowedOperatorCommands(state *clientstate.ClientState) []string {
+	operatorCommandsMutex.RLock()
+	defer operatorCommandsMutex.RUnlock()
+	var names []string
+	for name, command := range operatorCommands {
+		if permission.Allowed(string(state.Username), command.Permission) {
+			names = append(names, "/"+name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// chatCommand runs a line of chat that starts with a slash, without the slash.
+func chatCommand(state *clientstate.ClientState, line string) error {
+	name, args, _ := strings.Cut(line, " ")
+	args = strings.TrimSpace(args)
+
+	switch strings.ToLower(name) {
+	case "w", "whisper", "m", "msg":
+		return whisperCommand(state, args)
+	case "me", "emote":
+		return emoteCommand(state, args)
+	case "j", "join":
+		if args == "" {
+			return writeChatEvent(state, EID_ERROR, []byte("What channel do you want to join?"))
+		}
+		return joinChannel(state, args)
+	case "who":
+		return whoCommand(state, args)
+	case "whoami":
+		text := fmt.Sprintf("You are %s, using %s.", state.Username, clientstate.ProductToName(state.Product))
+		if c, ok := channel.Of(state); ok {
+			text = fmt.Sprintf("You are %s, using %s in channel %s.", state.Username, clientstate.ProductToName(state.Product), c.Name)
+		}
+		return writeChatEvent(state, EID_INFO, []byte(text))
+	case "help", "?":
+		text := "Commands: /whisper, /emote, /join, /who, /whoami"
+		if names := allowedOperatorCommands(state); len(names) > 0 {
+			text += "; operator commands: " + strings.Join(names, ", ")
+		}
+		return writeChatEvent(state, EID_INFO, []byte(text))
+	}
+
+	command, ok := lookupOperatorCommand(name)
+	if !ok {
+		return writeChatEvent(state, EID_ERROR, []byte("That is not a valid command. Type /help or /? for more info."))
+	}
+	if !permission.Allowed(string(state.Username), command.Permission) {
+		state.Logger(logger).Warn("permission denied", "command", strings.ToLower(name))
+		return writeChatEvent(state, EID_ERROR, []byte("You do not have permission to use that command."))
+	}
+
+	reply, err := command.Run(state, args)
+	var commandErr CommandError
+	if errors.As(err, &commandErr) {
+		return writeChatEvent(state, EID_ERROR, []byte(commandErr))
+	}
+	if err != nil || reply == "" {
+		return err
+	}
+	return writeChatEvent(state, EID_INFO, []byte(reply))
+}
+
+func whisperCommand(state *clientstate.ClientState, args string) error {
+	target, text, _ := strings.Cut(args, " ")
+	if target == "" || text == "" {
+		return writeChatEvent(state, EID_ERROR, []byte("What do you want to say?"))
+	}
+	// only users in chat can be found; users in games are not listed anywhere
+	recipient, _, ok := channel.Find(target)
+	if !ok {
+		return writeChatEvent(state, EID_ERROR, []byte("That user is not logged on."))
+	}
+
+	event, err := WriteSID_CHATEVENT(EID_WHISPER, 0, uint32(state.Ping), state.Username, []byte(text))
+	if err == nil {
+		WriteSID(recipient.State, event)
+		event, err = WriteSID_CHATEVENT(EID_WHISPERSENT, recipient.Flags, recipient.Ping, recipient.Username, []byte(text))
+	}
+	if err == nil {
+		err = WriteSID(state, event)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write whisper: %v", err)
+	}
+	return nil
+}
+
+func emoteCommand(state *clientstate.ClientState, text string) error {
+	c, ok := channel.Of(state)
+	if !ok {
+		return writeChatEvent(state, EID_ERROR, []byte("You are not in a channel."))
+	}
+
+	// unlike talk, emotes are echoed to the sender as well
+	event, err := WriteSID_CHATEVENT(EID_EMOTE, 0, uint32(state.Ping), state.Username, []byte(text))
+	if err == nil {
+		sendToMembers(c.Members, nil, event)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write emote: %v", err)
+	}
+	return nil
+}
+
+func whoCommand(state *clientstate.ClientState, name string) error {
+	c, ok := channel.Of(state)
+	if name != "" {
+		ok = false
+		for _, listed := range channel.List() {
+			if strings.EqualFold(listed.Name, name) {
+				c, ok = listed, true
+			}
+		}
+	}
+	if !ok {
+		return writeChatEvent(state, EID_ERROR, []byte("That channel does not exist."))
+	}
+
+	names := make([]string, len(c.Members))
+	for i, m := range c.Members {
+		names[i] = string(m.Username)
+	}
+	return writeChatEvent(state, EID_INFO, []byte(fmt.Sprintf("Users in channel %s: %s", c.Name, strings.Join(names, ", "))))
+}
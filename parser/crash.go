@@ -0,0 +1,50 @@
+package parser
+
+import (
+	"errors"
+	"time"
+
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/codec"
+	"github.com/carlbennett/gobncs/crashreport"
+	"github.com/carlbennett/gobncs/message"
+)
+
+func ParseSID_REPORTCRASH(state *clientstate.ClientState, payload *message.Message) error {
+	/** Client->Server Format:
+	 * (UINT32) Report version (0x10A0027)
+	 * (UINT32) Exception code
+	 * (UINT32) Unknown
+	 * (UINT32) Unknown
+	 */
+
+	var fields codec.ClientSID_REPORTCRASH
+	err := decodeMessage(payload, &fields)
+	if err != nil {
+		return err
+	}
+
+	report := &crashreport.Report{
+		Account:       string(state.Username),
+		ExceptionCode: fields.ExceptionCode,
+		ExceptionInfo: fields.ExceptionInfo,
+		ExeInfo:       string(state.ExeInfo),
+		ExeVersion:    state.ExeVersion,
+		Platform:      clientstate.PlatformToName(state.Platform),
+		Product:       clientstate.ProductToCode(state.Product),
+		ReceivedAt:    time.Now().UTC(),
+		RemoteIP:      state.RemoteIP(),
+		ReportVersion: fields.ReportVersion,
+		VersionByte:   state.VersionId,
+	}
+
+	state.Logger(logger).Info("crash report received", "signature", report.Signature())
+	err = crashreport.Store(report)
+	if errors.Is(err, crashreport.ErrAddressLimit) || errors.Is(err, crashreport.ErrDirectoryFull) {
+		state.Logger(logger).Warn("crash report dropped", "reason", err)
+	} else if err != nil {
+		state.Logger(logger).Error("failed to store crash report", "error", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/codec"
+	"github.com/carlbennett/gobncs/datafile"
+	"github.com/carlbennett/gobncs/message"
+)
+
+func ParseSID_GETICONDATA(state *clientstate.ClientState, payload *message.Message) error {
+	/** Client->Server Format:
+	 * [blank]
+	 */
+
+	var fields codec.ClientSID_GETICONDATA
+	err := decodeMessage(payload, &fields)
+	if err != nil {
+		return err
+	}
+
+	fileName := datafile.IconFileName(state.Product)
+	var fileTime uint64
+	if file, ok := datafile.Get(fileName); ok {
+		fileTime = file.FileTime
+	}
+
+	reply, err := WriteSID_GETICONDATA(fileTime, []byte(fileName))
+	if err == nil {
+		err = WriteSID(state, reply)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write icon data reply: %v", err)
+	}
+
+	return nil
+}
+
+func ParseSID_GETFILETIME(state *clientstate.ClientState, payload *message.Message) error {
+	/** Client->Server Format:
+	 * (UINT32) Request ID
+	 * (UINT32) Unknown
+	 * (STRING) Filename
+	 */
+
+	var fields codec.ClientSID_GETFILETIME
+	err := decodeMessage(payload, &fields)
+	if err != nil {
+		return err
+	}
+	fileName := fields.FileName
+
+	var fileTime uint64
+	if file, ok := datafile.Get(string(fileName)); ok {
+		fileTime = file.FileTime
+	}
+
+	reply, err := WriteSID_GETFILETIME(fields.RequestId, fields.Unknown, fileTime, fileName)
+	if err == nil {
+		err = WriteSID(state, reply)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write file time reply: %v", err)
+	}
+
+	return nil
+}
+
+func ParseSID_CHECKDATAFILE2(state *clientstate.ClientState, payload *message.Message) error {
+	/** Client->Server Format:
+	 * (UINT32)    File size in bytes
+	 * (UINT32)[5] File hash (SHA-1)
+	 * (STRING)    Filename
+	 */
+
+	var fields codec.ClientSID_CHECKDATAFILE2
+	err := decodeMessage(payload, &fields)
+	if err != nil {
+		return err
+	}
+	fileName := fields.FileName
+
+	result := datafile.Validate(string(fileName), fields.FileSize, fields.Hash)
+	if result == datafile.APPROVAL_NONE {
+		state.Logger(logger).Info("data file rejected; unknown file or checksum mismatch", "file", string(fileName))
+	}
+
+	reply, err := WriteSID_CHECKDATAFILE2(result)
+	if err == nil {
+		err = WriteSID(state, reply)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write data file reply: %v", err)
+	}
+
+	return nil
+}
+
+func WriteSID_GETICONDATA(fileTime uint64, fileName []byte) (*message.Message, error) {
+	return codec.Encode(codec.ServerSID_GETICONDATA{FileTime: codec.FileTime(fileTime), FileName: fileName})
+}
+
+func WriteSID_GETFILETIME(requestId uint32, unknown uint32, fileTime uint64, fileName []byte) (*message.Message, error) {
+	return codec.Encode(codec.ServerSID_GETFILETIME{
+		FileName:  fileName,
+		FileTime:  codec.FileTime(fileTime),
+		RequestId: requestId,
+		Unknown:   unknown,
+	})
+}
+
+func WriteSID_CHECKDATAFILE2(result datafile.Approval) (*message.Message, error) {
+	return codec.Encode(codec.ServerSID_CHECKDATAFILE2{Result: uint32(result)})
+}
@@ -0,0 +1,102 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/carlbennett/gobncs/account"
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/codec"
+	"github.com/carlbennett/gobncs/mail"
+	"github.com/carlbennett/gobncs/message"
+)
+
+func ParseSID_SETEMAIL(state *clientstate.ClientState, payload *message.Message) error {
+	/** Client->Server Format:
+	 * (STRING) Email Address
+	 */
+
+	var fields codec.ClientSID_SETEMAIL
+	err := decodeMessage(payload, &fields)
+	if err != nil {
+		return err
+	}
+
+	if len(state.Username) == 0 {
+		return fmt.Errorf("email address sent before logon")
+	}
+
+	err = account.SetEmail(string(state.Username), string(fields.Email))
+	if err != nil {
+		state.Logger(mailLogger).Info("email registration rejected", "error", err)
+		return nil
+	}
+
+	state.Logger(mailLogger).Info("email registered")
+	return nil
+}
+
+func ParseSID_CHANGEEMAIL(state *clientstate.ClientState, payload *message.Message) error {
+	/** Client->Server Format:
+	 * (STRING) Account Name
+	 * (STRING) Old Email Address
+	 * (STRING) New Email Address
+	 */
+
+	var fields codec.ClientSID_CHANGEEMAIL
+	err := decodeMessage(payload, &fields)
+	if err != nil {
+		return err
+	}
+	username := fields.Username
+
+	// only the account's own, logged on owner may change its email, since the
+	// address receives password resets
+	if len(state.Username) == 0 || !strings.EqualFold(string(state.Username), string(username)) {
+		state.Logger(mailLogger).Info("email change rejected; not logged on as the account", "username", string(username))
+		return nil
+	}
+
+	err = account.ChangeEmail(string(username), string(fields.OldEmail), string(fields.NewEmail))
+	if err != nil {
+		state.Logger(mailLogger).Info("email change rejected", "username", string(username), "error", err)
+		return nil
+	}
+
+	state.Logger(mailLogger).Info("email changed", "username", string(username))
+	return nil
+}
+
+func ParseSID_RESETPASSWORD(state *clientstate.ClientState, payload *message.Message) error {
+	/** Client->Server Format:
+	 * (STRING) Account Name
+	 * (STRING) Email Address
+	 */
+
+	var fields codec.ClientSID_RESETPASSWORD
+	err := decodeMessage(payload, &fields)
+	if err != nil {
+		return err
+	}
+	username := fields.Username
+
+	acct, token, err := account.CreateResetToken(string(username), string(fields.Email))
+	if err != nil {
+		state.Logger(mailLogger).Info("password reset rejected", "username", string(username), "error", err)
+		return nil
+	}
+
+	body := fmt.Sprintf("A password reset was requested for the account %s.\n\nReset token: %s\n\nTo choose a new password, change your password and enter the token as the old password. The token expires in %s.", acct.Username, token, account.RESET_TOKEN_LIFETIME)
+	err = mail.Send(acct.Email, "Battle.net password reset", body)
+	if err != nil {
+		state.Logger(mailLogger).Error("failed to send password reset mail", "username", acct.Username, "error", err)
+		return nil
+	}
+
+	state.Logger(mailLogger).Info("password reset mail sent", "username", acct.Username)
+	return nil
+}
+
+func WriteSID_SETEMAIL() (*message.Message, error) {
+	return codec.Encode(codec.ServerSID_SETEMAIL{})
+}
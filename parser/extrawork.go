@@ -0,0 +1,77 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/codec"
+	"github.com/carlbennett/gobncs/extrawork"
+	"github.com/carlbennett/gobncs/message"
+)
+
+func ParseSID_EXTRAWORK(state *clientstate.ClientState, payload *message.Message) error {
+	/** Client->Server Format:
+	 * (UINT16) Game type
+	 * (UINT16) Length
+	 * (VOID)   Work returned data
+	 */
+
+	var fields codec.ClientSID_EXTRAWORK
+	err := decodeMessage(payload, &fields)
+	if err != nil {
+		return err
+	}
+	data := fields.Data
+
+	// results are only stored for work the logged on client was asked to run
+	if len(state.Username) == 0 || !state.ExtraWorkPending {
+		state.Logger(logger).Info("extra work result rejected; not requested", "game_type", fmt.Sprintf("0x%04X", fields.GameType))
+		return nil
+	}
+	state.ExtraWorkPending = false
+
+	result := &extrawork.Result{
+		Fields:     extrawork.ParseFields(data),
+		GameType:   fields.GameType,
+		Platform:   clientstate.PlatformToName(state.Platform),
+		Product:    clientstate.ProductToCode(state.Product),
+		Raw:        string(bytes.TrimRight(data, "\x00")),
+		ReceivedAt: time.Now().UTC(),
+		RemoteIP:   state.RemoteIP(),
+	}
+
+	state.Logger(logger).Info("extra work result received", "game_type", fmt.Sprintf("0x%04X", fields.GameType), "bytes", fields.Length)
+	err = extrawork.Store(string(state.Username), result)
+	if err != nil {
+		state.Logger(logger).Error("failed to store extra work result", "error", err)
+	}
+
+	return nil
+}
+
+// RequestExtraWork asks the client to run the extra work archive configured
+// for its product, if any.
+func RequestExtraWork(state *clientstate.ClientState) error {
+	settings, ok := extrawork.GetSettings(state.Product)
+	if !ok || settings.MPQFileName == "" {
+		return nil
+	}
+
+	var fields codec.Payload = codec.ServerSID_OPTIONALWORK{MPQFileName: []byte(settings.MPQFileName)}
+	if settings.Required {
+		fields = codec.ServerSID_REQUIREDWORK{MPQFileName: []byte(settings.MPQFileName)}
+	}
+
+	reply, err := codec.Encode(fields)
+	if err == nil {
+		err = WriteSID(state, reply)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write extra work request: %v", err)
+	}
+	state.ExtraWorkPending = true
+
+	return nil
+}
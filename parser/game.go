@@ -0,0 +1,261 @@
+package parser
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/codec"
+	"github.com/carlbennett/gobncs/game"
+	"github.com/carlbennett/gobncs/message"
+)
+
+const (
+	STARTADVEX3_SUCCESS = 0x00
+	STARTADVEX3_FAILURE = 0x01
+)
+
+const (
+	GETADVLISTEX_OK             = 0x00
+	GETADVLISTEX_NOT_FOUND      = 0x01
+	GETADVLISTEX_WRONG_PASSWORD = 0x02
+)
+
+const GAME_NAME_MAX_LENGTH = 31
+
+// the most games listed in one reply, and the port hosts use unless they
+// send SID_NETGAMEPORT
+const (
+	GETADVLISTEX_MAX_GAMES = 100
+	DEFAULT_GAME_PORT      = 6112
+)
+
+func ParseSID_STARTADVEX3(state *clientstate.ClientState, payload *message.Message) error {
+	/** Client->Server Format:
+	 * (UINT32) Game state
+	 * (UINT32) Game elapsed time
+	 * (UINT16) Game type
+	 * (UINT16) Game parameter
+	 * (UINT32) Unknown (0x1F)
+	 * (UINT32) Ladder
+	 * (STRING) Game name
+	 * (STRING) Game password
+	 * (STRING) Game statstring
+	 */
+
+	var fields codec.ClientSID_STARTADVEX3
+	err := decodeMessage(payload, &fields)
+	if err != nil {
+		return err
+	}
+
+	// the host sends this again whenever the game's state changes
+	var status uint32 = STARTADVEX3_SUCCESS
+	switch {
+	case !state.HasCapability(clientstate.CAPABILITY_CREATE_GAMES):
+		state.Logger(logger).Info("game creation rejected; product may not create games")
+		status = STARTADVEX3_FAILURE
+	case fields.Ladder != 0 && !state.HasCapability(clientstate.CAPABILITY_LADDER):
+		state.Logger(logger).Info("game creation rejected; product may not play ladder games")
+		status = STARTADVEX3_FAILURE
+	case len(fields.GameName) == 0 || len(fields.GameName) > GAME_NAME_MAX_LENGTH:
+		state.Logger(logger).Info("game creation rejected; invalid game name")
+		status = STARTADVEX3_FAILURE
+	default:
+		err = game.Advertise(game.Game{
+			Host:       state,
+			HostName:   string(state.Username),
+			IP:         hostIP(state),
+			Ladder:     fields.Ladder != 0,
+			Name:       string(fields.GameName),
+			Parameter:  fields.Parameter,
+			Password:   string(fields.Password),
+			Port:       hostPort(state),
+			Product:    state.Product,
+			State:      fields.GameState,
+			Statstring: fields.Statstring,
+			Type:       fields.GameType,
+		})
+		if err != nil {
+			state.Logger(logger).Info("game creation rejected", "game", string(fields.GameName), "error", err)
+			status = STARTADVEX3_FAILURE
+			break
+		}
+		LeaveChannel(state)
+		state.Phase = clientstate.PHASE_GAME
+	}
+
+	reply, err := codec.Encode(codec.ServerSID_STARTADVEX3{Status: status})
+	if err == nil {
+		err = WriteSID(state, reply)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write game creation reply: %v", err)
+	}
+
+	return nil
+}
+
+func ParseSID_NOTIFYJOIN(state *clientstate.ClientState, payload *message.Message) error {
+	/** Client->Server Format:
+	 * (UINT32) Product code
+	 * (UINT32) Product version
+	 * (STRING) Game name
+	 * (STRING) Game password
+	 */
+
+	var fields codec.ClientSID_NOTIFYJOIN
+	err := decodeMessage(payload, &fields)
+	if err != nil {
+		return err
+	}
+
+	// joining needs no more than being allowed in chat, where games are found
+	if !state.HasCapability(clientstate.CAPABILITY_CHAT) {
+		return fmt.Errorf("product (%s) may not join games", clientstate.ProductToCode(state.Product))
+	}
+	LeaveChannel(state)
+	state.Phase = clientstate.PHASE_GAME
+
+	return nil
+}
+
+func ParseSID_STOPADV(state *clientstate.ClientState, payload *message.Message) error {
+	var fields codec.ClientSID_STOPADV
+	err := decodeMessage(payload, &fields)
+	if err != nil {
+		return err
+	}
+
+	// the game keeps running once it is no longer advertised
+	game.Stop(state)
+
+	return nil
+}
+
+func ParseSID_LEAVEGAME(state *clientstate.ClientState, payload *message.Message) error {
+	var fields codec.ClientSID_LEAVEGAME
+	err := decodeMessage(payload, &fields)
+	if err != nil {
+		return err
+	}
+
+	// clients re-enter chat with SID_ENTERCHAT after leaving
+	game.Stop(state)
+	state.Phase = clientstate.PHASE_CHAT
+
+	return nil
+}
+
+func ParseSID_GETADVLISTEX(state *clientstate.ClientState, payload *message.Message) error {
+	/** Client->Server Format:
+	 * (UINT16) Game type (0 for any)
+	 * (UINT16) Sub game type
+	 * (UINT32) Viewing filter
+	 * (UINT32) Reserved
+	 * (UINT32) Number of games to list
+	 * (STRING) Game name
+	 * (STRING) Game password
+	 * (STRING) Game statstring
+	 */
+
+	var fields codec.ClientSID_GETADVLISTEX
+	err := decodeMessage(payload, &fields)
+	if err != nil {
+		return err
+	}
+
+	var games []game.Game
+	var status uint32 = GETADVLISTEX_OK
+	if len(fields.GameName) > 0 {
+		// a request for one game by name, as sent when joining it
+		g, ok := game.Find(string(fields.GameName))
+		switch {
+		case !ok || g.Product != state.Product:
+			status = GETADVLISTEX_NOT_FOUND
+		case g.Password != string(fields.Password):
+			status = GETADVLISTEX_WRONG_PASSWORD
+		default:
+			games = append(games, g)
+		}
+	} else {
+		limit := int(fields.ListCount)
+		if limit <= 0 || limit > GETADVLISTEX_MAX_GAMES {
+			limit = GETADVLISTEX_MAX_GAMES
+		}
+		// games with a password are only found by name
+		for _, g := range game.List() {
+			if len(games) < limit && g.Product == state.Product && g.Password == "" && (fields.Condition1 == 0 || fields.Condition1 == g.Type) {
+				games = append(games, g)
+			}
+		}
+	}
+
+	listReply := codec.ServerSID_GETADVLISTEX{GameCount: uint32(len(games))}
+	if len(games) == 0 {
+		listReply.Status = []uint32{status}
+	}
+	for _, g := range games {
+		listReply.Games = append(listReply.Games, advListGame(g))
+	}
+
+	reply, err := codec.Encode(listReply)
+	if err == nil {
+		err = WriteSID(state, reply)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write game list reply: %v", err)
+	}
+
+	return nil
+}
+
+func ParseSID_NETGAMEPORT(state *clientstate.ClientState, payload *message.Message) error {
+	/** Client->Server Format:
+	 * (UINT16) Port
+	 */
+
+	var fields codec.ClientSID_NETGAMEPORT
+	err := decodeMessage(payload, &fields)
+	if err != nil {
+		return err
+	}
+
+	state.GamePort = fields.Port
+
+	return nil
+}
+
+func advListGame(g game.Game) codec.AdvListGame {
+	listed := codec.AdvListGame{
+		GameType:   g.Type,
+		Parameter:  g.Parameter,
+		GameStatus: g.State,
+		Elapsed:    uint32(time.Since(g.Created) / time.Second),
+		GameName:   []byte(g.Name),
+		Statstring: g.Statstring,
+	}
+	// AF_INET, with the port in network byte order
+	listed.Host.Family = 2
+	binary.BigEndian.PutUint16(listed.Host.Port[:], g.Port)
+	copy(listed.Host.Address[:], g.IP.To4())
+	return listed
+}
+
+// hostIP returns the IPv4 address other players reach the client at. Clients
+// connected over IPv6 cannot be listed with an address.
+func hostIP(state *clientstate.ClientState) net.IP {
+	if ip := net.ParseIP(state.RemoteIP()).To4(); ip != nil {
+		return ip
+	}
+	return net.IPv4zero.To4()
+}
+
+func hostPort(state *clientstate.ClientState) uint16 {
+	if state.GamePort == 0 {
+		return DEFAULT_GAME_PORT
+	}
+	return state.GamePort
+}
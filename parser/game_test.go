@@ -0,0 +1,70 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/codec"
+	"github.com/carlbennett/gobncs/game"
+)
+
+func TestGameList(t *testing.T) {
+	host := newChatState(t, "host")
+	host.GamePort = 6113
+	t.Cleanup(func() { game.Stop(host) })
+
+	advertise := func(name string, password string) uint32 {
+		t.Helper()
+		err := dispatch(t, host, ParseSID_STARTADVEX3, codec.ClientSID_STARTADVEX3{GameName: []byte(name), Password: []byte(password), Statstring: []byte(",,,,")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var reply codec.ServerSID_STARTADVEX3
+		nextReply(t, host, &reply)
+		return reply.Status
+	}
+	if status := advertise("melee", ""); status != STARTADVEX3_SUCCESS || host.Phase != clientstate.PHASE_GAME {
+		t.Fatalf("game creation failed with status 0x%02X", status)
+	}
+
+	tests := []struct {
+		name    string
+		request codec.ClientSID_GETADVLISTEX
+		product clientstate.Product
+		games   int
+		status  uint32
+	}{
+		{"public list", codec.ClientSID_GETADVLISTEX{}, clientstate.PRODUCT_STAR, 1, GETADVLISTEX_OK},
+		{"other product", codec.ClientSID_GETADVLISTEX{}, clientstate.PRODUCT_W2BN, 0, GETADVLISTEX_OK},
+		{"by name", codec.ClientSID_GETADVLISTEX{GameName: []byte("MELEE")}, clientstate.PRODUCT_STAR, 1, GETADVLISTEX_OK},
+		{"unknown name", codec.ClientSID_GETADVLISTEX{GameName: []byte("ladder")}, clientstate.PRODUCT_STAR, 0, GETADVLISTEX_NOT_FOUND},
+		{"wrong password", codec.ClientSID_GETADVLISTEX{GameName: []byte("melee"), Password: []byte("x")}, clientstate.PRODUCT_STAR, 0, GETADVLISTEX_WRONG_PASSWORD},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state := newTestState(t, test.product)
+			state.Phase = clientstate.PHASE_CHAT
+			if err := dispatch(t, state, ParseSID_GETADVLISTEX, test.request); err != nil {
+				t.Fatal(err)
+			}
+			var reply codec.ServerSID_GETADVLISTEX
+			nextReply(t, state, &reply)
+			if len(reply.Games) != test.games {
+				t.Fatalf("expected %d games, got %d", test.games, len(reply.Games))
+			}
+			if test.games == 0 && (len(reply.Status) != 1 || reply.Status[0] != test.status) {
+				t.Fatalf("expected status 0x%02X, got %v", test.status, reply.Status)
+			}
+			if test.games == 1 && (string(reply.Games[0].GameName) != "melee" || reply.Games[0].Host.Port != [2]byte{0x17, 0xE1}) {
+				t.Fatalf("unexpected game listing: %+v", reply.Games[0])
+			}
+		})
+	}
+
+	if err := dispatch(t, host, ParseSID_STOPADV, codec.ClientSID_STOPADV{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := game.Find("melee"); ok {
+		t.Fatal("game is still listed after the host stopped advertising it")
+	}
+}
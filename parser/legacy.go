@@ -0,0 +1,299 @@
+package parser
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/codec"
+	"github.com/carlbennett/gobncs/message"
+	"github.com/carlbennett/gobncs/versioncheck"
+)
+
+func ParseSID_CLIENTID(state *clientstate.ClientState, payload *message.Message) error {
+	/** Client->Server Format:
+	 * (UINT32) Registration Version
+	 * (UINT32) Registration Authority
+	 * (UINT32) Account Number
+	 * (UINT32) Registration Token
+	 * (STRING) LAN Computer Name
+	 * (STRING) LAN Username
+	 */
+
+	var fields codec.ClientSID_CLIENTID
+	err := decodeMessage(payload, &fields)
+	if err != nil {
+		return err
+	}
+
+	state.Registration = clientstate.Registration{
+		AccountNumber: fields.AccountNumber,
+		Authority:     fields.RegistrationAuthority,
+		Token:         fields.RegistrationToken,
+		Version:       fields.RegistrationVersion,
+	}
+	state.LANComputerName = fields.LANComputerName
+	state.LANUsername = fields.LANUsername
+
+	reply, err := WriteSID_CLIENTID(state.Registration)
+	if err == nil {
+		err = WriteSID(state, reply)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write client id reply: %v", err)
+	}
+
+	return writeLegacyChallenge(state, false)
+}
+
+func ParseSID_CLIENTID2(state *clientstate.ClientState, payload *message.Message) error {
+	/** Client->Server Format:
+	 * (UINT32) Server Version
+	 * For Server Version 1:
+	 *   (UINT32) Registration Version
+	 *   (UINT32) Registration Authority
+	 * For Server Version 0:
+	 *   (UINT32) Registration Authority
+	 *   (UINT32) Registration Version
+	 * (UINT32) Account Number
+	 * (UINT32) Registration Token
+	 * (STRING) LAN Computer Name
+	 * (STRING) LAN Username
+	 */
+
+	var fields codec.ClientSID_CLIENTID2
+	err := decodeMessage(payload, &fields)
+	if err != nil {
+		return err
+	}
+
+	state.Registration = clientstate.Registration{
+		AccountNumber: fields.AccountNumber,
+		Authority:     fields.RegistrationFirst,
+		Token:         fields.RegistrationToken,
+		Version:       fields.RegistrationSecond,
+	}
+	if fields.ServerVersion == 1 {
+		state.Registration.Authority = fields.RegistrationSecond
+		state.Registration.Version = fields.RegistrationFirst
+	}
+	state.LANComputerName = fields.LANComputerName
+	state.LANUsername = fields.LANUsername
+
+	return writeLegacyChallenge(state, true)
+}
+
+func ParseSID_STARTVERSIONING(state *clientstate.ClientState, payload *message.Message) error {
+	/** Client->Server Format:
+	 * (UINT32) Platform code
+	 * (UINT32) Product code
+	 * (UINT32) Version byte
+	 * (UINT32) Unknown (0)
+	 */
+
+	var fields codec.ClientSID_STARTVERSIONING
+	err := decodeMessage(payload, &fields)
+	if err != nil {
+		return err
+	}
+
+	state.Platform = clientstate.Platform(fields.Platform)
+	state.Product = clientstate.Product(fields.Product)
+	state.UpdateCapabilities()
+	state.VersionId = fields.VersionByte
+
+	settings, fileTime, err := versionCheckChallenge(state.Product)
+	if err != nil {
+		return err
+	}
+	state.VersioningStarted = true
+	if state.Phase == clientstate.PHASE_AWAITING_AUTH_INFO {
+		state.Phase = clientstate.PHASE_AWAITING_VERSION_CHECK
+	}
+
+	reply, err := WriteSID_STARTVERSIONING(fileTime, []byte(settings.MPQFileName), []byte(settings.ValueString))
+	if err == nil {
+		err = WriteSID(state, reply)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write versioning reply: %v", err)
+	}
+
+	return nil
+}
+
+func ParseSID_REPORTVERSION(state *clientstate.ClientState, payload *message.Message) error {
+	/** Client->Server Format:
+	 * (UINT32) Platform code
+	 * (UINT32) Product code
+	 * (UINT32) Version byte
+	 * (UINT32) EXE Version
+	 * (UINT32) EXE Hash
+	 * (STRING) EXE Information
+	 */
+
+	var fields codec.ClientSID_REPORTVERSION
+	err := decodeMessage(payload, &fields)
+	if err != nil {
+		return err
+	}
+	// the EXE hash answers the formula handed out by SID_STARTVERSIONING
+	if !state.VersioningStarted {
+		return fmt.Errorf("version report received before SID_STARTVERSIONING")
+	}
+
+	state.Platform = clientstate.Platform(fields.Platform)
+	state.Product = clientstate.Product(fields.Product)
+	state.UpdateCapabilities()
+	state.VersionId = fields.VersionByte
+	state.ExeVersion = fields.ExeVersion
+	state.ExeHash = fields.ExeHash
+	state.ExeInfo = fields.ExeInfo
+
+	result := versioncheck.Check(state.Product, state.VersionId, state.ExeVersion, state.ExeHash)
+	state.VersionChecked = result == versioncheck.RESULT_SUCCESS
+	awaitLogon(state)
+
+	var patchPath []byte
+	if !state.VersionChecked {
+		state.Logger(logger).Info("version check failed", "version_byte", fmt.Sprintf("0x%02X", state.VersionId), "exe_version", fmt.Sprintf("0x%08X", state.ExeVersion), "exe_hash", fmt.Sprintf("0x%08X", state.ExeHash))
+		if settings, ok := versioncheck.GetSettings(state.Product); ok {
+			patchPath = []byte(settings.PatchPath)
+		}
+	}
+
+	reply, err := WriteSID_REPORTVERSION(result, patchPath)
+	if err == nil {
+		err = WriteSID(state, reply)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write version report reply: %v", err)
+	}
+
+	return nil
+}
+
+func ParseSID_LOCALEINFO(state *clientstate.ClientState, payload *message.Message) error {
+	/** Client->Server Format:
+	 * (FILETIME) System time
+	 * (FILETIME) Local time
+	 * (UINT32)   Time zone bias
+	 * (UINT32)   System default LCID
+	 * (UINT32)   User default LCID
+	 * (UINT32)   User default language ID
+	 * (STRING)   Abbreviated language name
+	 * (STRING)   Country name
+	 * (STRING)   Abbreviated country name
+	 * (STRING)   Country (English)
+	 */
+
+	var fields codec.ClientSID_LOCALEINFO
+	err := decodeMessage(payload, &fields)
+	if err != nil {
+		return err
+	}
+
+	state.TimezoneBias = fields.TimezoneBias
+	state.LocaleSystemLCID = fields.SystemLCID
+	state.LocaleUserLCID = fields.UserLCID
+	state.LocaleUserLanguageId = fields.UserLanguageId
+	state.LocaleLanguageAbbr = fields.LanguageAbbr
+	state.CountryNameLocal = fields.CountryNameLocal
+	state.CountryCode = fields.CountryAbbr
+	state.CountryName = fields.Country
+
+	return nil
+}
+
+func ParseSID_SYSTEMINFO(state *clientstate.ClientState, payload *message.Message) error {
+	/** Client->Server Format:
+	 * (UINT32) Number of processors
+	 * (UINT32) Processor architecture
+	 * (UINT32) Processor level
+	 * (UINT32) Processor timing
+	 * (UINT32) Total physical memory
+	 * (UINT32) Total page file
+	 * (UINT32) Free disk space
+	 */
+
+	var fields codec.ClientSID_SYSTEMINFO
+	err := decodeMessage(payload, &fields)
+	if err != nil {
+		return err
+	}
+
+	state.SystemInfo = clientstate.SystemInfo{
+		FreeDiskSpace:         fields.FreeDiskSpace,
+		NumberOfProcessors:    fields.NumberOfProcessors,
+		ProcessorArchitecture: fields.ProcessorArchitecture,
+		ProcessorLevel:        fields.ProcessorLevel,
+		ProcessorTiming:       fields.ProcessorTiming,
+		TotalPageFile:         fields.TotalPageFile,
+		TotalPhysicalMemory:   fields.TotalPhysicalMemory,
+	}
+
+	return nil
+}
+
+// legacy clients are issued a server token and then pinged, the same as
+// SID_AUTH_INFO does for newer clients. Clients that already passed the
+// version check keep their phase.
+func writeLegacyChallenge(state *clientstate.ClientState, extended bool) error {
+	if state.Phase == clientstate.PHASE_AWAITING_AUTH_INFO {
+		state.Phase = clientstate.PHASE_AWAITING_VERSION_CHECK
+	}
+
+	var challenge *message.Message
+	var err error
+	if extended {
+		challenge, err = WriteSID_LOGONCHALLENGEEX(state.UDPValue, state.ServerToken)
+	} else {
+		challenge, err = WriteSID_LOGONCHALLENGE(state.ServerToken)
+	}
+	if err == nil {
+		err = WriteSID(state, challenge)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write logon challenge: %v", err)
+	}
+
+	state.PingSent = time.Now()
+	pingReply, err := WriteSID_PING(state.PingCookie)
+	if err == nil {
+		err = WriteSID(state, pingReply)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write ping reply: %v", err)
+	}
+
+	return nil
+}
+
+func WriteSID_CLIENTID(registration clientstate.Registration) (*message.Message, error) {
+	return codec.Encode(codec.ServerSID_CLIENTID{
+		AccountNumber:         registration.AccountNumber,
+		RegistrationAuthority: registration.Authority,
+		RegistrationToken:     registration.Token,
+		RegistrationVersion:   registration.Version,
+	})
+}
+
+func WriteSID_LOGONCHALLENGE(serverToken uint32) (*message.Message, error) {
+	return codec.Encode(codec.ServerSID_LOGONCHALLENGE{ServerToken: serverToken})
+}
+
+func WriteSID_LOGONCHALLENGEEX(udpValue uint32, serverToken uint32) (*message.Message, error) {
+	return codec.Encode(codec.ServerSID_LOGONCHALLENGEEX{UDPValue: udpValue, ServerToken: serverToken})
+}
+
+func WriteSID_STARTVERSIONING(fileTime uint64, mpqFileName []byte, valueString []byte) (*message.Message, error) {
+	return codec.Encode(codec.ServerSID_STARTVERSIONING{
+		MPQFileName: mpqFileName,
+		MPQFileTime: codec.FileTime(fileTime),
+		ValueString: valueString,
+	})
+}
+
+func WriteSID_REPORTVERSION(result versioncheck.Result, patchPath []byte) (*message.Message, error) {
+	return codec.Encode(codec.ServerSID_REPORTVERSION{Result: uint32(result), PatchPath: patchPath})
+}
@@ -0,0 +1,302 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/carlbennett/gobncs/account"
+	"github.com/carlbennett/gobncs/ban"
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/codec"
+	"github.com/carlbennett/gobncs/message"
+)
+
+const (
+	LOGONRESPONSE_FAILURE = 0x00
+	LOGONRESPONSE_SUCCESS = 0x01
+)
+
+const (
+	LOGONRESPONSE2_SUCCESS        = 0x00
+	LOGONRESPONSE2_NO_ACCOUNT     = 0x01
+	LOGONRESPONSE2_BAD_PASSWORD   = 0x02
+	LOGONRESPONSE2_ACCOUNT_CLOSED = 0x06 // Info is the reason
+)
+
+const (
+	CREATEACCOUNT_FAILURE = 0x00
+	CREATEACCOUNT_SUCCESS = 0x01
+)
+
+const (
+	CREATEACCOUNT2_SUCCESS            = 0x00
+	CREATEACCOUNT2_TOO_SHORT          = 0x01
+	CREATEACCOUNT2_INVALID_CHARACTERS = 0x02
+	CREATEACCOUNT2_EXISTS             = 0x04
+	CREATEACCOUNT2_NOT_CREATED        = 0x05 // reported as still being created
+)
+
+const (
+	CHANGEPASSWORD_FAILURE = 0x00
+	CHANGEPASSWORD_SUCCESS = 0x01
+)
+
+func ParseSID_LOGONRESPONSE(state *clientstate.ClientState, payload *message.Message) error {
+	/** Client->Server Format:
+	 * (UINT32)    Client Token
+	 * (UINT32)    Server Token
+	 * (UINT32)[5] Password Hash
+	 * (STRING)    Username
+	 */
+
+	var fields codec.ClientSID_LOGONRESPONSE
+	err := decodeMessage(payload, &fields)
+	if err != nil {
+		return err
+	}
+
+	var result uint32 = LOGONRESPONSE_SUCCESS
+	if logon(state, fields) != nil {
+		result = LOGONRESPONSE_FAILURE
+	}
+
+	reply, err := codec.Encode(codec.ServerSID_LOGONRESPONSE{Result: result})
+	if err == nil {
+		err = WriteSID(state, reply)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write logon reply: %v", err)
+	}
+
+	if result == LOGONRESPONSE_SUCCESS {
+		return afterLogon(state)
+	}
+
+	return nil
+}
+
+func ParseSID_LOGONRESPONSE2(state *clientstate.ClientState, payload *message.Message) error {
+	/** Client->Server Format:
+	 * (UINT32)    Client Token
+	 * (UINT32)    Server Token
+	 * (UINT32)[5] Password Hash
+	 * (STRING)    Username
+	 */
+
+	var fields codec.ClientSID_LOGONRESPONSE2
+	err := decodeMessage(payload, &fields)
+	if err != nil {
+		return err
+	}
+
+	var status uint32 = LOGONRESPONSE2_SUCCESS
+	var info []byte
+	var closed *accountClosedError
+	err = logon(state, codec.ClientSID_LOGONRESPONSE(fields))
+	switch {
+	case err == nil:
+	case errors.Is(err, account.ErrAccountNotFound):
+		status = LOGONRESPONSE2_NO_ACCOUNT
+	case errors.As(err, &closed):
+		status, info = LOGONRESPONSE2_ACCOUNT_CLOSED, []byte(closed.reason)
+	default:
+		status = LOGONRESPONSE2_BAD_PASSWORD
+	}
+
+	reply, err := codec.Encode(codec.ServerSID_LOGONRESPONSE2{Status: status, Info: info})
+	if err == nil {
+		err = WriteSID(state, reply)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write logon reply: %v", err)
+	}
+
+	if status == LOGONRESPONSE2_SUCCESS {
+		return afterLogon(state)
+	}
+
+	return nil
+}
+
+func ParseSID_CREATEACCOUNT(state *clientstate.ClientState, payload *message.Message) error {
+	/** Client->Server Format:
+	 * (UINT32)[5] Hashed password
+	 * (STRING)    Username
+	 */
+
+	var fields codec.ClientSID_CREATEACCOUNT
+	err := decodeMessage(payload, &fields)
+	if err != nil {
+		return err
+	}
+	username := fields.Username
+
+	var result uint32 = CREATEACCOUNT_FAILURE
+	if acct, err := account.Create(string(username), fields.PasswordHash); err != nil {
+		state.Logger(logger).Info("account creation rejected", "username", string(username), "error", err)
+	} else {
+		state.Logger(logger).Info("account created", "username", acct.Username)
+		result = CREATEACCOUNT_SUCCESS
+	}
+
+	reply, err := codec.Encode(codec.ServerSID_CREATEACCOUNT{Result: result})
+	if err == nil {
+		err = WriteSID(state, reply)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write account creation reply: %v", err)
+	}
+
+	return nil
+}
+
+func ParseSID_CREATEACCOUNT2(state *clientstate.ClientState, payload *message.Message) error {
+	/** Client->Server Format:
+	 * (UINT32)[5] Hashed password
+	 * (STRING)    Username
+	 */
+
+	var fields codec.ClientSID_CREATEACCOUNT2
+	err := decodeMessage(payload, &fields)
+	if err != nil {
+		return err
+	}
+	username := fields.Username
+
+	var status uint32 = CREATEACCOUNT2_SUCCESS
+	acct, err := account.Create(string(username), fields.PasswordHash)
+	switch {
+	case err == nil:
+		state.Logger(logger).Info("account created", "username", acct.Username)
+	case errors.Is(err, account.ErrAccountExists):
+		status = CREATEACCOUNT2_EXISTS
+	case errors.Is(err, account.ErrInvalidUsername) && len(username) < account.USERNAME_MIN_LENGTH:
+		status = CREATEACCOUNT2_TOO_SHORT
+	case errors.Is(err, account.ErrInvalidUsername):
+		status = CREATEACCOUNT2_INVALID_CHARACTERS
+	default:
+		status = CREATEACCOUNT2_NOT_CREATED
+	}
+	if err != nil {
+		state.Logger(logger).Info("account creation rejected", "username", string(username), "error", err)
+	}
+
+	reply, err := codec.Encode(codec.ServerSID_CREATEACCOUNT2{Status: status})
+	if err == nil {
+		err = WriteSID(state, reply)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write account creation reply: %v", err)
+	}
+
+	return nil
+}
+
+func ParseSID_CHANGEPASSWORD(state *clientstate.ClientState, payload *message.Message) error {
+	/** Client->Server Format:
+	 * (UINT32)    Client Token
+	 * (UINT32)    Server Token
+	 * (UINT32)[5] Old password hash
+	 * (UINT32)[5] New password hash
+	 * (STRING)    Account name
+	 */
+
+	var fields codec.ClientSID_CHANGEPASSWORD
+	err := decodeMessage(payload, &fields)
+	if err != nil {
+		return err
+	}
+	username := fields.Username
+
+	var result uint32 = CHANGEPASSWORD_FAILURE
+	if fields.ServerToken != state.ServerToken {
+		state.Logger(logger).Info("password change rejected; server token mismatch", "username", string(username))
+	} else if err := account.ChangePassword(string(username), fields.ClientToken, fields.ServerToken, fields.OldPasswordProof, fields.NewPasswordHash); err != nil {
+		state.Logger(logger).Info("password change rejected", "username", string(username), "error", err)
+	} else {
+		state.Logger(logger).Info("password changed", "username", string(username))
+		result = CHANGEPASSWORD_SUCCESS
+	}
+
+	reply, err := codec.Encode(codec.ServerSID_CHANGEPASSWORD{Result: result})
+	if err == nil {
+		err = WriteSID(state, reply)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write password change reply: %v", err)
+	}
+
+	return nil
+}
+
+type accountClosedError struct {
+	reason string
+}
+
+func (e *accountClosedError) Error() string {
+	return fmt.Sprintf("account closed: %s", e.reason)
+}
+
+// logon verifies the password proof and moves the connection to the chat
+// phase. Rejections are logged here and returned to pick a reply status.
+func logon(state *clientstate.ClientState, fields codec.ClientSID_LOGONRESPONSE) error {
+	username := fields.Username
+	product := clientstate.ProductToCode(state.Product)
+
+	if fields.ServerToken != state.ServerToken {
+		state.Logger(logger).Info("logon rejected; server token mismatch", "username", string(username))
+		logons.Inc(product, "bad_password")
+		return account.ErrInvalidPassword
+	}
+	if entry, banned := ban.Get(ban.KIND_ACCOUNT, string(username)); banned {
+		state.Logger(logger).Info("logon rejected; account banned", "username", string(username), "reason", entry.Reason)
+		logons.Inc(product, "banned")
+		return &accountClosedError{reason: entry.Reason}
+	}
+	acct, err := account.Logon(string(username), fields.ClientToken, fields.ServerToken, fields.PasswordProof)
+	if err != nil {
+		state.Logger(logger).Info("logon rejected", "username", string(username), "error", err)
+		switch {
+		case errors.Is(err, account.ErrAccountNotFound):
+			logons.Inc(product, "no_account")
+		case errors.Is(err, account.ErrInvalidPassword):
+			logons.Inc(product, "bad_password")
+		default:
+			logons.Inc(product, "error")
+		}
+		return err
+	}
+	logons.Inc(product, "success")
+
+	state.ClientToken = fields.ClientToken
+	state.Username = []byte(acct.Username)
+	state.Logger(logger).Info("logged on")
+	state.Phase = clientstate.PHASE_CHAT
+	return nil
+}
+
+func afterLogon(state *clientstate.ClientState) error {
+	err := requestEmail(state)
+	if err != nil {
+		return err
+	}
+	return RequestExtraWork(state)
+}
+
+// clients prompt the user to register an email when the account has none
+func requestEmail(state *clientstate.ClientState) error {
+	acct, ok := account.Get(string(state.Username))
+	if !ok || acct.Email != "" {
+		return nil
+	}
+
+	reply, err := WriteSID_SETEMAIL()
+	if err == nil {
+		err = WriteSID(state, reply)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write email request: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/codec"
+	"github.com/carlbennett/gobncs/message"
+	"github.com/carlbennett/gobncs/news"
+)
+
+func ParseSID_NEWS_INFO(state *clientstate.ClientState, payload *message.Message) error {
+	/** Client->Server Format:
+	 * (UINT32) News timestamp
+	 */
+
+	var fields codec.ClientSID_NEWS_INFO
+	err := decodeMessage(payload, &fields)
+	if err != nil {
+		return err
+	}
+
+	// the message of the day is always sent, news only if it is newer than
+	// what the client has already seen
+	newsReply := codec.ServerSID_NEWS_INFO{LastLogon: uint32(time.Now().Unix())}
+	for _, entry := range news.List() {
+		var timestamp uint32
+		if !entry.Time.IsZero() {
+			timestamp = uint32(entry.Time.Unix())
+			if newsReply.OldestTimestamp == 0 {
+				newsReply.OldestTimestamp = timestamp
+			}
+			newsReply.NewestTimestamp = timestamp
+			if timestamp <= fields.NewsTimestamp {
+				continue
+			}
+		}
+		newsReply.Entries = append(newsReply.Entries, codec.NewsEntry{Timestamp: timestamp, Text: []byte(entry.Text)})
+	}
+	// the entry count is a single byte; the newest news is kept
+	if len(newsReply.Entries) > math.MaxUint8 {
+		newsReply.Entries = newsReply.Entries[len(newsReply.Entries)-math.MaxUint8:]
+	}
+	newsReply.EntryCount = uint8(len(newsReply.Entries))
+
+	reply, err := codec.Encode(newsReply)
+	if err == nil {
+		err = WriteSID(state, reply)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write news reply: %v", err)
+	}
+
+	return nil
+}
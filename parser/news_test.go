@@ -0,0 +1,31 @@
+package parser
+
+import (
+	"testing"
+	"time"
+
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/codec"
+	"github.com/carlbennett/gobncs/news"
+)
+
+func TestNewsInfo(t *testing.T) {
+	older := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(24 * time.Hour)
+	news.Set([]news.Entry{{Text: "newer", Time: newer}, {Text: "welcome"}, {Text: "older", Time: older}})
+	t.Cleanup(func() { news.Set(nil) })
+
+	state := newTestState(t, clientstate.PRODUCT_WAR3)
+	if err := dispatch(t, state, ParseSID_NEWS_INFO, codec.ClientSID_NEWS_INFO{NewsTimestamp: uint32(older.Unix())}); err != nil {
+		t.Fatal(err)
+	}
+	var reply codec.ServerSID_NEWS_INFO
+	nextReply(t, state, &reply)
+
+	if reply.OldestTimestamp != uint32(older.Unix()) || reply.NewestTimestamp != uint32(newer.Unix()) {
+		t.Errorf("unexpected news range: %d to %d", reply.OldestTimestamp, reply.NewestTimestamp)
+	}
+	if len(reply.Entries) != 2 || string(reply.Entries[0].Text) != "welcome" || reply.Entries[0].Timestamp != 0 || string(reply.Entries[1].Text) != "newer" {
+		t.Fatalf("expected the message of the day and the unseen news, got %+v", reply.Entries)
+	}
+}
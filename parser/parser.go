@@ -1,55 +1,71 @@
 package parser
 
 import (
-	"bytes"
-	"encoding/binary"
 	"fmt"
-	"io"
-	"log"
 	"math/rand"
-	"net"
+	"time"
 
 	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/codec"
+	"github.com/carlbennett/gobncs/logging"
 	"github.com/carlbennett/gobncs/message"
+	"github.com/carlbennett/gobncs/metrics"
 )
 
-func ParseSID_NULL(state *clientstate.ClientState, message *message.Message) error {
-	if message.Length != 4 {
-		return fmt.Errorf("invalid message length (expected 4, got %d)", message.Length)
-	}
+var (
+	logger           = logging.For(logging.PARSER)
+	mailLogger       = logging.For(logging.MAIL)
+	tournamentLogger = logging.For(logging.TOURNAMENT)
+	wardenLogger     = logging.For(logging.WARDEN)
+)
 
-	return nil
+var (
+	logons      = metrics.NewCounter("gobncs_logons_total", "Logon attempts by product and result.", "product", "result")
+	pingSeconds = metrics.NewHistogram("gobncs_ping_seconds", "Round trip time of SID_PING by product.", []float64{0.025, 0.05, 0.1, 0.2, 0.4, 0.8, 1.6, 3.2}, "product")
+)
+
+func ParseSID_NULL(state *clientstate.ClientState, payload *message.Message) error {
+	var fields codec.ClientSID_NULL
+	return decodeMessage(payload, &fields)
 }
 
-func ParseSID_PING(state *clientstate.ClientState, message *message.Message) error {
-	if message.Length != 8 {
-		return fmt.Errorf("invalid message length (expected 8, got %d)", message.Length)
-	}
+func ParseSID_UDPPINGRESPONSE(state *clientstate.ClientState, payload *message.Message) error {
+	/** Client->Server Format:
+	 * (UINT32) UDP code
+	 */
+
+	// only tells whether the client received the UDP test packet, which is
+	// never sent
+	var fields codec.ClientSID_UDPPINGRESPONSE
+	return decodeMessage(payload, &fields)
+}
 
+func ParseSID_PING(state *clientstate.ClientState, payload *message.Message) error {
 	/** Client<->Server Format:
 	 * (UINT32) Ping Cookie
 	 */
 
-	var cookie uint32
-	err := binary.Read(bytes.NewReader(message.Body), binary.LittleEndian, &cookie)
+	var fields codec.ClientSID_PING
+	err := decodeMessage(payload, &fields)
 	if err != nil {
-		return fmt.Errorf("failed to read cookie from message body: %v", err)
+		return err
 	}
 
-	if state.PingCookie != cookie {
-		log.Printf("(%s) stale ping cookie; rejecting late SID_PING response", state.RemoteAddr)
+	if state.PingCookie != fields.Cookie {
+		state.Logger(logger).Debug("stale ping cookie; rejecting late SID_PING response")
 		return nil
 	}
 
+	if !state.PingSent.IsZero() {
+		elapsed := time.Since(state.PingSent)
+		state.Ping = int32(elapsed.Milliseconds())
+		pingSeconds.Observe(elapsed.Seconds(), clientstate.ProductToCode(state.Product))
+	}
 	state.PingCookie = rand.Uint32() // change cookie so that repeated reply is considered stale
 	return nil
 }
 
 func ParseSID_AUTH_INFO(state *clientstate.ClientState, payload *message.Message) error {
-	if payload.Length < 38 {
-		return fmt.Errorf("invalid message length (expected at least 38, got %d)", payload.Length)
-	}
-
 	/** Client->Server Format:
 	 * (UINT32) Protocol ID
 	 * (UINT32) Platform code
@@ -64,146 +80,68 @@ func ParseSID_AUTH_INFO(state *clientstate.ClientState, payload *message.Message
 	 * (STRING) Country
 	 */
 
-	reader := bytes.NewReader(payload.Body)
-
-	var protocolId uint32
-	err := binary.Read(reader, binary.LittleEndian, &protocolId)
+	var fields codec.ClientSID_AUTH_INFO
+	err := decodeMessage(payload, &fields)
 	if err != nil {
-		return fmt.Errorf("failed to read protocol id: %v", err)
+		return err
 	}
-	if protocolId != 0 {
-		return fmt.Errorf("unknown protocol id (expected 0, got %d)", protocolId)
+	if fields.ProtocolId != 0 {
+		return fmt.Errorf("unknown protocol id (expected 0, got %d)", fields.ProtocolId)
 	}
 
-	var platformId uint32
-	err = binary.Read(reader, binary.LittleEndian, &platformId)
-	if err != nil {
-		return fmt.Errorf("failed to read platform id: %v", err)
-	}
-	state.Platform = clientstate.Platform(platformId)
-
-	var productId uint32
-	err = binary.Read(reader, binary.LittleEndian, &productId)
-	if err != nil {
-		return fmt.Errorf("failed to read platform id: %v", err)
-	}
-	state.Product = clientstate.Product(productId)
-
-	var versionId uint32
-	err = binary.Read(reader, binary.LittleEndian, &versionId)
-	if err != nil {
-		return fmt.Errorf("failed to read version id: %v", err)
-	}
-	state.VersionId = versionId
+	state.Platform = clientstate.Platform(fields.Platform)
+	state.Product = clientstate.Product(fields.Product)
+	state.UpdateCapabilities()
+	state.VersionId = fields.VersionByte
+	state.ClientLocalIP = fields.LocalIP
+	state.TimezoneBias = fields.TimezoneBias
+	state.LocaleUserLanguageId = fields.UserLanguageId
+	state.CountryCode = fields.CountryAbbr
+	state.CountryName = fields.Country
 
-	var languageCode uint32
-	err = binary.Read(reader, binary.LittleEndian, &languageCode)
-	if err != nil {
-		return fmt.Errorf("failed to read language code: %v", err)
-	}
+	state.Phase = clientstate.PHASE_AWAITING_VERSION_CHECK
 
-	var localIP uint32
-	err = binary.Read(reader, binary.LittleEndian, &localIP)
-	if err != nil {
-		return fmt.Errorf("failed to read local IP: %v", err)
-	}
-	state.ClientLocalIP = localIP
-
-	var timezoneBias int32
-	err = binary.Read(reader, binary.LittleEndian, &timezoneBias)
-	if err != nil {
-		return fmt.Errorf("failed to read time zone bias: %v", err)
-	}
-	state.TimezoneBias = timezoneBias
-
-	var mpqLocaleId uint32
-	err = binary.Read(reader, binary.LittleEndian, &mpqLocaleId)
-	if err != nil {
-		return fmt.Errorf("failed to read MPQ locale ID: %v", err)
-	}
-
-	var userLanguageId uint32
-	err = binary.Read(reader, binary.LittleEndian, &userLanguageId)
-	if err != nil {
-		return fmt.Errorf("failed to read user language ID: %v", err)
-	}
-	state.LocaleUserLanguageId = userLanguageId
-
-	state.CountryCode, err = ReadNullTerminatedByteArray(reader)
-	if err != nil {
-		return fmt.Errorf("failed to read country code: %v", err)
+	state.PingCookie = rand.Uint32()
+	state.PingSent = time.Now()
+	pingReply, err := WriteSID_PING(state.PingCookie)
+	if err == nil {
+		err = WriteSID(state, pingReply)
 	}
-
-	state.CountryName, err = ReadNullTerminatedByteArray(reader)
 	if err != nil {
-		return fmt.Errorf("failed to read country name: %v", err)
+		return fmt.Errorf("failed to write ping reply: %v", err)
 	}
 
-	state.PingCookie = rand.Uint32()
-	pingReply, err := WriteSID_PING(state.PingCookie)
+	reply, err := WriteSID_AUTH_INFO(state)
 	if err == nil {
-		err = WriteSID(state.Conn, pingReply)
+		err = WriteSID(state, reply)
 	}
 	if err != nil {
-		return fmt.Errorf("failed to write ping reply: %v", err)
+		return fmt.Errorf("failed to write auth info reply: %v", err)
 	}
 
 	return nil
 }
 
-func ReadNullTerminatedByteArray(r io.Reader) ([]byte, error) {
-	var buf []byte
-	var b [1]byte
-	for {
-		_, err := r.Read(b[:])
-		if err != nil {
-			return nil, err
-		}
-		if b[0] == 0 {
-			break
-		}
-		buf = append(buf, b[0])
+func WriteSID(state *clientstate.ClientState, reply *message.Message) error {
+	if len(reply.Body) > 0xFFFF-4 || reply.Length != uint16(4+len(reply.Body)) {
+		return fmt.Errorf("invalid message reply length (expected 4-65535, got %d)", 4+len(reply.Body))
 	}
-	return buf, nil
-}
 
-func WriteSID(conn net.Conn, reply *message.Message) error {
-	if reply.Length < 4 || reply.Length > 0xFFFF || reply.Length != uint16(4+len(reply.Body)) {
-		return fmt.Errorf("invalid message reply length (expected 4-65535, got %d)", reply.Length)
-	}
-
-	buffer := make([]byte, reply.Length)
-	buffer[0] = 0xFF
-	buffer[1] = byte(reply.ID)
-	buffer[2] = byte(reply.Length & 0xFF)
-	buffer[3] = byte((reply.Length >> 8) & 0xFF)
-	copy(buffer[4:], reply.Body)
+	return state.Send(reply)
+}
 
-	_, err := conn.Write(buffer)
-	if err == nil {
-		log.Printf("(%s) message ([0x%02X] %s) sent", conn.RemoteAddr(), reply.ID, message.MessageIdToName(reply.ID))
+func decodeMessage(payload *message.Message, fields codec.Payload) error {
+	err := codec.Decode(payload, fields)
+	if err != nil {
+		return fmt.Errorf("failed to decode %s: %v", message.MessageIdToName(payload.ID), err)
 	}
-	return err
+	return nil
 }
 
 func WriteSID_NULL() (*message.Message, error) {
-	return &message.Message{
-		ID:     message.SID_NULL,
-		Length: 4,
-		Body:   make([]byte, 0),
-	}, nil
+	return codec.Encode(codec.ServerSID_NULL{})
 }
 
 func WriteSID_PING(cookie uint32) (*message.Message, error) {
-	buffer := &bytes.Buffer{}
-	err := binary.Write(buffer, binary.LittleEndian, &cookie)
-	if err != nil {
-		return nil, err
-	}
-
-	return &message.Message{
-		ID:     message.SID_PING,
-		Length: uint16(4 + buffer.Len()),
-		Body:   buffer.Bytes(),
-	}, nil
+	return codec.Encode(codec.ServerSID_PING{Cookie: cookie})
 }
@@ -0,0 +1,126 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/carlbennett/gobncs/account"
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/codec"
+	"github.com/carlbennett/gobncs/message"
+)
+
+const (
+	PROFILE_SUCCESS = 0x00
+	PROFILE_FAILURE = 0x01
+)
+
+// Profiles, user data, friends and ads are not stored, but clients request
+// them in chat as a matter of course, so they are answered as empty.
+
+func ParseSID_PROFILE(state *clientstate.ClientState, payload *message.Message) error {
+	/** Client->Server Format:
+	 * (UINT32) Cookie
+	 * (STRING) Username
+	 */
+
+	var fields codec.ClientSID_PROFILE
+	err := decodeMessage(payload, &fields)
+	if err != nil {
+		return err
+	}
+
+	var success uint8 = PROFILE_FAILURE
+	if _, ok := account.Get(string(fields.Username)); ok {
+		success = PROFILE_SUCCESS
+	}
+
+	reply, err := codec.Encode(codec.ServerSID_PROFILE{Cookie: fields.Cookie, Success: success})
+	if err == nil {
+		err = WriteSID(state, reply)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write profile reply: %v", err)
+	}
+
+	return nil
+}
+
+func ParseSID_READUSERDATA(state *clientstate.ClientState, payload *message.Message) error {
+	/** Client->Server Format:
+	 * (UINT32)   Number of accounts
+	 * (UINT32)   Number of keys
+	 * (UINT32)   Request ID
+	 * (STRING)[] Requested accounts
+	 * (STRING)[] Requested keys
+	 */
+
+	var fields codec.ClientSID_READUSERDATA
+	err := decodeMessage(payload, &fields)
+	if err != nil {
+		return err
+	}
+
+	values := make([][]byte, len(fields.Accounts)*len(fields.Keys))
+	for i := range values {
+		values[i] = []byte{}
+	}
+
+	reply, err := codec.Encode(codec.ServerSID_READUSERDATA{
+		AccountCount: uint32(len(fields.Accounts)),
+		KeyCount:     uint32(len(fields.Keys)),
+		RequestId:    fields.RequestId,
+		Values:       values,
+	})
+	if err == nil {
+		err = WriteSID(state, reply)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write user data reply: %v", err)
+	}
+
+	return nil
+}
+
+func ParseSID_WRITEUSERDATA(state *clientstate.ClientState, payload *message.Message) error {
+	var fields codec.ClientSID_WRITEUSERDATA
+	return decodeMessage(payload, &fields)
+}
+
+func ParseSID_FRIENDSLIST(state *clientstate.ClientState, payload *message.Message) error {
+	var fields codec.ClientSID_FRIENDSLIST
+	err := decodeMessage(payload, &fields)
+	if err != nil {
+		return err
+	}
+
+	reply, err := codec.Encode(codec.ServerSID_FRIENDSLIST{})
+	if err == nil {
+		err = WriteSID(state, reply)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write friends list reply: %v", err)
+	}
+
+	return nil
+}
+
+func ParseSID_CHECKAD(state *clientstate.ClientState, payload *message.Message) error {
+	// with no ads to show, the request goes unanswered
+	var fields codec.ClientSID_CHECKAD
+	return decodeMessage(payload, &fields)
+}
+
+func ParseSID_DISPLAYAD(state *clientstate.ClientState, payload *message.Message) error {
+	var fields codec.ClientSID_DISPLAYAD
+	return decodeMessage(payload, &fields)
+}
+
+func ParseSID_CLICKAD(state *clientstate.ClientState, payload *message.Message) error {
+	var fields codec.ClientSID_CLICKAD
+	return decodeMessage(payload, &fields)
+}
+
+func ParseSID_QUERYADURL(state *clientstate.ClientState, payload *message.Message) error {
+	var fields codec.ClientSID_QUERYADURL
+	return decodeMessage(payload, &fields)
+}
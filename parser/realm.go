@@ -0,0 +1,115 @@
+package parser
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/carlbennett/gobncs/bsha1"
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/codec"
+	"github.com/carlbennett/gobncs/message"
+	"github.com/carlbennett/gobncs/realm"
+)
+
+const (
+	LOGONREALMEX_SUCCESS     = 0x00000000
+	LOGONREALMEX_UNAVAILABLE = 0x80000001
+	LOGONREALMEX_FAILED      = 0x80000002
+)
+
+// every client hashes this fixed realm password rather than its own
+var realmPassword = []byte("password")
+
+func ParseSID_QUERYREALMS2(state *clientstate.ClientState, payload *message.Message) error {
+	/** Client->Server Format:
+	 * (blank)
+	 */
+
+	var fields codec.ClientSID_QUERYREALMS2
+	err := decodeMessage(payload, &fields)
+	if err != nil {
+		return err
+	}
+
+	realms := []codec.Realm{}
+	for _, r := range realm.List() {
+		realms = append(realms, codec.Realm{Unknown: 1, Title: []byte(r.Name), Description: []byte(r.Description)})
+	}
+
+	reply, err := codec.Encode(codec.ServerSID_QUERYREALMS2{RealmCount: uint32(len(realms)), Realms: realms})
+	if err == nil {
+		err = WriteSID(state, reply)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write realm list reply: %v", err)
+	}
+
+	return nil
+}
+
+func ParseSID_LOGONREALMEX(state *clientstate.ClientState, payload *message.Message) error {
+	/** Client->Server Format:
+	 * (UINT32)    Client Token
+	 * (UINT32)[5] Hashed realm password
+	 * (STRING)    Realm title
+	 */
+
+	var fields codec.ClientSID_LOGONREALMEX
+	err := decodeMessage(payload, &fields)
+	if err != nil {
+		return err
+	}
+
+	status := uint32(LOGONREALMEX_SUCCESS)
+	r, ok := realm.Get(string(fields.RealmTitle))
+	passwordHash := bsha1.Sum(realmPassword)
+	switch {
+	case !ok:
+		state.Logger(logger).Info("realm logon rejected; unknown realm", "realm", string(fields.RealmTitle))
+		status = LOGONREALMEX_UNAVAILABLE
+	case len(state.Username) == 0:
+		state.Logger(logger).Info("realm logon rejected; not logged on", "realm", r.Name)
+		status = LOGONREALMEX_FAILED
+	case fields.PasswordHash != bsha1.SumTokens(passwordHash[:], fields.ClientToken, state.ServerToken):
+		state.Logger(logger).Info("realm logon rejected; bad realm password proof", "realm", r.Name)
+		status = LOGONREALMEX_FAILED
+	}
+
+	logonReply := codec.ServerSID_LOGONREALMEX{Cookie: fields.ClientToken, Status: status}
+	if status == LOGONREALMEX_SUCCESS {
+		state.Logger(logger).Info("handing client to realm", "realm", r.Name)
+		logonReply.Logon = []codec.RealmLogon{realmLogon(state, fields.ClientToken, r)}
+	}
+
+	reply, err := codec.Encode(logonReply)
+	if err == nil {
+		err = WriteSID(state, reply)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write realm logon reply: %v", err)
+	}
+
+	return nil
+}
+
+// realmLogon fills the MCP chunks the client presents to the realm server.
+// They carry the tokens and a hash of the account name under them, which a
+// realm server that knows the tokens can verify.
+func realmLogon(state *clientstate.ClientState, clientToken uint32, r realm.Realm) codec.RealmLogon {
+	logon := codec.RealmLogon{
+		Chunk1:     [2]uint32{clientToken, state.ServerToken},
+		UniqueName: state.Username,
+	}
+	copy(logon.IP[:], r.IP.To4())
+
+	// sent big-endian in a 32-bit field
+	var port [4]byte
+	binary.BigEndian.PutUint32(port[:], uint32(r.Port))
+	logon.Port = binary.LittleEndian.Uint32(port[:])
+
+	hash := bsha1.SumTokens(state.Username, clientToken, state.ServerToken)
+	for i := 0; i < len(hash)/4; i++ {
+		logon.Chunk2[i] = binary.LittleEndian.Uint32(hash[i*4:])
+	}
+	return logon
+}
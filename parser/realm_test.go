@@ -0,0 +1,89 @@
+package parser
+
+import (
+	"net"
+	"testing"
+
+	"github.com/carlbennett/gobncs/bsha1"
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/codec"
+	"github.com/carlbennett/gobncs/realm"
+)
+
+func setTestRealms(t *testing.T) {
+	t.Helper()
+	realm.Set([]realm.Realm{{Description: "Test realm", IP: net.IPv4(192, 0, 2, 7), Name: "USEast", Port: 6112}})
+	t.Cleanup(func() { realm.Set(nil) })
+}
+
+func TestQueryRealms(t *testing.T) {
+	setTestRealms(t)
+	state := newTestState(t, clientstate.PRODUCT_D2DV)
+
+	if err := dispatch(t, state, ParseSID_QUERYREALMS2, codec.ClientSID_QUERYREALMS2{}); err != nil {
+		t.Fatal(err)
+	}
+	var reply codec.ServerSID_QUERYREALMS2
+	nextReply(t, state, &reply)
+	if len(reply.Realms) != 1 || string(reply.Realms[0].Title) != "USEast" || string(reply.Realms[0].Description) != "Test realm" {
+		t.Fatalf("unexpected realm list: %+v", reply.Realms)
+	}
+}
+
+func TestLogonRealm(t *testing.T) {
+	setTestRealms(t)
+	const clientToken = 0x0BADF00D
+	passwordHash := bsha1.Sum(realmPassword)
+	proof := func(state *clientstate.ClientState) [20]byte {
+		return bsha1.SumTokens(passwordHash[:], clientToken, state.ServerToken)
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		realm    string
+		proof    func(state *clientstate.ClientState) [20]byte
+		status   uint32
+	}{
+		{"logged on", "tester", "useast", proof, LOGONREALMEX_SUCCESS},
+		{"unknown realm", "tester", "Europe", proof, LOGONREALMEX_UNAVAILABLE},
+		{"not logged on", "", "USEast", proof, LOGONREALMEX_FAILED},
+		{"bad proof", "tester", "USEast", func(*clientstate.ClientState) [20]byte { return [20]byte{} }, LOGONREALMEX_FAILED},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state := newTestState(t, clientstate.PRODUCT_D2DV)
+			state.ServerToken = 0x12345678
+			state.Username = []byte(test.username)
+
+			err := dispatch(t, state, ParseSID_LOGONREALMEX, codec.ClientSID_LOGONREALMEX{
+				ClientToken:  clientToken,
+				PasswordHash: test.proof(state),
+				RealmTitle:   []byte(test.realm),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var reply codec.ServerSID_LOGONREALMEX
+			nextReply(t, state, &reply)
+			if reply.Cookie != clientToken || reply.Status != test.status {
+				t.Fatalf("expected cookie 0x%08X and status 0x%08X, got 0x%08X and 0x%08X", uint32(clientToken), test.status, reply.Cookie, reply.Status)
+			}
+			if test.status != LOGONREALMEX_SUCCESS {
+				if len(reply.Logon) != 0 {
+					t.Error("failed realm logon carries an address")
+				}
+				return
+			}
+			if len(reply.Logon) != 1 {
+				t.Fatal("successful realm logon carries no address")
+			}
+			logon := reply.Logon[0]
+			if net.IP(logon.IP[:]).String() != "192.0.2.7" || logon.Port != 0xE0170000 || string(logon.UniqueName) != "tester" {
+				t.Errorf("unexpected realm address: %+v", logon)
+			}
+		})
+	}
+}
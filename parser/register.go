@@ -0,0 +1,61 @@
+package parser
+
+import (
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/handler"
+	"github.com/carlbennett/gobncs/message"
+)
+
+func init() {
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_NULL, ParseSID_NULL)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_PING, ParseSID_PING)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_AUTH_INFO, ParseSID_AUTH_INFO)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_AUTH_CHECK, ParseSID_AUTH_CHECK)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_CLIENTID, ParseSID_CLIENTID)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_CLIENTID2, ParseSID_CLIENTID2)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_STARTVERSIONING, ParseSID_STARTVERSIONING)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_REPORTVERSION, ParseSID_REPORTVERSION)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_LOCALEINFO, ParseSID_LOCALEINFO)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_SYSTEMINFO, ParseSID_SYSTEMINFO)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_LOGONRESPONSE, ParseSID_LOGONRESPONSE)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_LOGONRESPONSE2, ParseSID_LOGONRESPONSE2)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_CREATEACCOUNT, ParseSID_CREATEACCOUNT)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_CREATEACCOUNT2, ParseSID_CREATEACCOUNT2)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_CHANGEPASSWORD, ParseSID_CHANGEPASSWORD)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_SETEMAIL, ParseSID_SETEMAIL)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_CHANGEEMAIL, ParseSID_CHANGEEMAIL)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_RESETPASSWORD, ParseSID_RESETPASSWORD)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_CDKEY, ParseSID_CDKEY)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_CDKEY2, ParseSID_CDKEY2)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_SWITCHPRODUCT, ParseSID_SWITCHPRODUCT)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_WARDEN, ParseSID_WARDEN)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_REPORTCRASH, ParseSID_REPORTCRASH)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_EXTRAWORK, ParseSID_EXTRAWORK)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_GAMERESULT, ParseSID_GAMERESULT)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_CHECKDATAFILE2, ParseSID_CHECKDATAFILE2)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_GETFILETIME, ParseSID_GETFILETIME)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_GETICONDATA, ParseSID_GETICONDATA)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_ENTERCHAT, ParseSID_ENTERCHAT)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_GETCHANNELLIST, ParseSID_GETCHANNELLIST)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_JOINCHANNEL, ParseSID_JOINCHANNEL)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_CHATCOMMAND, ParseSID_CHATCOMMAND)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_LEAVECHAT, ParseSID_LEAVECHAT)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_FRIENDSLIST, ParseSID_FRIENDSLIST)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_PROFILE, ParseSID_PROFILE)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_READUSERDATA, ParseSID_READUSERDATA)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_WRITEUSERDATA, ParseSID_WRITEUSERDATA)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_CHECKAD, ParseSID_CHECKAD)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_DISPLAYAD, ParseSID_DISPLAYAD)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_CLICKAD, ParseSID_CLICKAD)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_QUERYADURL, ParseSID_QUERYADURL)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_UDPPINGRESPONSE, ParseSID_UDPPINGRESPONSE)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_QUERYREALMS2, ParseSID_QUERYREALMS2)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_LOGONREALMEX, ParseSID_LOGONREALMEX)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_NEWS_INFO, ParseSID_NEWS_INFO)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_STARTADVEX3, ParseSID_STARTADVEX3)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_NOTIFYJOIN, ParseSID_NOTIFYJOIN)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_STOPADV, ParseSID_STOPADV)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_GETADVLISTEX, ParseSID_GETADVLISTEX)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_NETGAMEPORT, ParseSID_NETGAMEPORT)
+	handler.Register(clientstate.PROTOCOL_TYPE_GAME, message.SID_LEAVEGAME, ParseSID_LEAVEGAME)
+}
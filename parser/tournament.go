@@ -0,0 +1,55 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/codec"
+	"github.com/carlbennett/gobncs/message"
+	"github.com/carlbennett/gobncs/tournament"
+)
+
+func ParseSID_GAMERESULT(state *clientstate.ClientState, payload *message.Message) error {
+	/** Client->Server Format:
+	 * (UINT32)    Game type
+	 * (UINT32)    Number of results (always 8)
+	 * (UINT32)[]  Results
+	 * (STRING)[]  Game players
+	 * (STRING)    Map name
+	 * (STRING)    Player score
+	 */
+
+	var fields codec.ClientSID_GAMERESULT
+	err := decodeMessage(payload, &fields)
+	if err != nil {
+		return err
+	}
+	if fields.ResultCount > 8 {
+		return fmt.Errorf("invalid game result count (expected at most 8, got %d)", fields.ResultCount)
+	}
+
+	players := make([]string, len(fields.Players))
+	for i, player := range fields.Players {
+		players[i] = string(player)
+	}
+
+	t, err := tournament.RecordGameResult(string(state.Username), players, fields.Results)
+	if err != nil {
+		state.Logger(tournamentLogger).Warn("game result rejected", "tournament", t.Name, "error", err)
+	} else if t != nil {
+		state.Logger(tournamentLogger).Info("game result recorded", "tournament", t.Name, "map", string(fields.MapName))
+	}
+
+	return nil
+}
+
+func WriteSID_TOURNAMENT(status byte, games byte) (*message.Message, error) {
+	/** Server->Client Format:
+	 * (UINT8)  Tournament status
+	 * (UINT8)  Number of games
+	 * (UINT16) Unknown
+	 * (UINT8)  Unknown
+	 */
+
+	return codec.Encode(codec.ServerSID_TOURNAMENT{Status: status, Games: games})
+}
@@ -0,0 +1,163 @@
+package parser
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/carlbennett/gobncs/ban"
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/codec"
+	"github.com/carlbennett/gobncs/message"
+	"github.com/carlbennett/gobncs/warden"
+)
+
+func ParseSID_WARDEN(state *clientstate.ClientState, payload *message.Message) error {
+	/** Client->Server Format:
+	 * (VOID) Encrypted Warden packet
+	 */
+
+	var fields codec.ClientSID_WARDEN
+	err := decodeMessage(payload, &fields)
+	if err != nil {
+		return err
+	}
+	if len(fields.Data) == 0 {
+		return fmt.Errorf("empty warden packet")
+	}
+
+	// a late reply after the session ended, or a client that runs Warden
+	// while the server does not; neither can be checked
+	session, ok := warden.GetSession(state)
+	if !ok {
+		state.Logger(logger).Warn("warden message received without an active warden session; dropping message")
+		return nil
+	}
+
+	sent, err := session.Handle(fields.Data)
+	var violation *warden.Violation
+	if errors.As(err, &violation) {
+		// a logged violation keeps the session, and with it the scans
+		if err = applyWardenViolation(state, violation); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	if sent {
+		watchWarden(state, session)
+	} else {
+		scheduleWarden(state, session)
+	}
+
+	return nil
+}
+
+// StartWarden begins a Warden session seeded from the first DWORD of the
+// client's CD-key hash, if Warden is enabled.
+func StartWarden(state *clientstate.ClientState) error {
+	if !warden.Enabled() {
+		return nil
+	}
+
+	seed := binary.LittleEndian.Uint32(state.CDKeyHash[:4])
+	session, err := warden.NewSession(state, seed, func(data []byte) error {
+		return writeWarden(state, data)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to start warden session: %v", err)
+	}
+
+	watchWarden(state, session)
+	return nil
+}
+
+// scheduleWarden issues the next scan after the session's interval, if the
+// configuration asks for repeated scans.
+func scheduleWarden(state *clientstate.ClientState, session *warden.Session) {
+	if session.Interval() <= 0 {
+		return
+	}
+	time.AfterFunc(session.Interval(), func() {
+		scanWarden(state, session)
+	})
+}
+
+func scanWarden(state *clientstate.ClientState, session *warden.Session) {
+	if current, ok := warden.GetSession(state); !ok || current != session {
+		return
+	}
+
+	sent, err := session.Scan()
+	if err == nil && sent {
+		watchWarden(state, session)
+	}
+	if err != nil {
+		state.RLock()
+		state.Logger(wardenLogger).Warn("failed to issue warden scan", "error", err)
+		state.RUnlock()
+	}
+}
+
+// watchWarden applies the configured action to a client that leaves the
+// request just sent unanswered past the session's timeout.
+func watchWarden(state *clientstate.ClientState, session *warden.Session) {
+	time.AfterFunc(session.Timeout(), func() {
+		if current, ok := warden.GetSession(state); !ok || current != session {
+			return
+		}
+		violation := session.Overdue(time.Now())
+		if violation == nil {
+			return
+		}
+
+		state.Lock()
+		err := applyWardenViolation(state, violation)
+		state.Unlock()
+		if err != nil {
+			state.Close()
+			return
+		}
+		scheduleWarden(state, session)
+	})
+}
+
+func applyWardenViolation(state *clientstate.ClientState, violation *warden.Violation) error {
+	state.Logger(wardenLogger).Warn("warden violation", "action", violation.Action, "reason", violation.Reason)
+
+	switch violation.Action {
+	case warden.ACTION_LOG:
+		return nil
+	case warden.ACTION_BAN:
+		if len(state.Username) > 0 {
+			_, err := ban.Add(ban.KIND_ACCOUNT, string(state.Username), violation.Reason, 0)
+			if err != nil {
+				state.Logger(wardenLogger).Error("failed to ban account", "error", err)
+			}
+		}
+		_, err := ban.Add(ban.KIND_IP, state.RemoteIP(), violation.Reason, 0)
+		if err != nil {
+			state.Logger(wardenLogger).Error("failed to ban address", "error", err)
+		}
+	}
+
+	return violation
+}
+
+func writeWarden(state *clientstate.ClientState, data []byte) error {
+	reply, err := WriteSID_WARDEN(data)
+	if err == nil {
+		err = WriteSID(state, reply)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write warden packet: %v", err)
+	}
+
+	return nil
+}
+
+func WriteSID_WARDEN(data []byte) (*message.Message, error) {
+	return codec.Encode(codec.ServerSID_WARDEN{Data: data})
+}
@@ -0,0 +1,97 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/codec"
+	"github.com/carlbennett/gobncs/warden"
+)
+
+// loadWarden enables Warden with a single memory check that scans every
+// second.
+func loadWarden(t *testing.T, action warden.Action) {
+	t.Helper()
+	dir := t.TempDir()
+
+	modulePath := filepath.Join(dir, "module.bin")
+	if err := os.WriteFile(modulePath, []byte{0x5A}, 0600); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := json.Marshal(warden.Config{
+		Action:                 action,
+		Checks:                 []warden.Check{{Type: warden.CHECK_MEMORY, Address: 0x1000, Length: 2, Expected: warden.Bytes{0x90, 0x90}}},
+		IntervalSeconds:        1,
+		ModuleKey:              bytes.Repeat([]byte{0x01}, 16),
+		ModulePath:             modulePath,
+		Opcodes:                warden.Opcodes{MemoryCheck: 0xF3, PageCheck: 0xB2},
+		ResponseTimeoutSeconds: 30,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	configPath := filepath.Join(dir, "warden.json")
+	if err = os.WriteFile(configPath, raw, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = warden.Load(configPath); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { warden.Load("") })
+}
+
+// answerWarden passes the next queued Warden packet to client and its reply,
+// if any, back to ParseSID_WARDEN.
+func answerWarden(t *testing.T, state *clientstate.ClientState, client *warden.RecordedClient, wait time.Duration) error {
+	t.Helper()
+	var packet codec.ServerSID_WARDEN
+	select {
+	case m := <-state.Outbound():
+		if err := codec.Decode(m, &packet); err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(wait):
+		t.Fatal("no warden packet queued")
+	}
+
+	reply, err := client.Handle(packet.Data)
+	if err != nil {
+		t.Fatalf("client failed to handle packet: %v", err)
+	}
+	if reply == nil {
+		return nil
+	}
+	return dispatch(t, state, ParseSID_WARDEN, &codec.ClientSID_WARDEN{Data: reply})
+}
+
+func TestWardenLogKeepsScanning(t *testing.T) {
+	loadWarden(t, warden.ACTION_LOG)
+	state := newTestState(t, clientstate.PRODUCT_STAR)
+	t.Cleanup(func() { warden.RemoveSession(state) })
+
+	client := warden.NewRecordedClient(binary.LittleEndian.Uint32(state.CDKeyHash[:4]))
+	client.HasModule = true
+	client.Memory[warden.MemoryKey("", 0x1000)] = []byte{0xCC, 0xCC}
+
+	if err := StartWarden(state); err != nil {
+		t.Fatal(err)
+	}
+	// module info, then the first scan, which the client fails
+	for i := 0; i < 2; i++ {
+		if err := answerWarden(t, state, client, time.Second); err != nil {
+			t.Fatalf("logged violation disconnected the client: %v", err)
+		}
+	}
+
+	// the next scan is still issued after the interval
+	if err := answerWarden(t, state, client, 3*time.Second); err != nil {
+		t.Fatalf("logged violation disconnected the client: %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+// Package permission decides which operator actions an account may take. The
+// same grants apply whether the action comes from the admin API or from a
+// client in game.
+package permission
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type Permission uint32
+
+const (
+	PERMISSION_VIEW     Permission = 0x01 // list clients, accounts, channels, games and bans
+	PERMISSION_KICK     Permission = 0x02 // disconnect clients
+	PERMISSION_ANNOUNCE Permission = 0x04 // broadcast to every logged on client
+	PERMISSION_BAN      Permission = 0x08 // add and remove bans
+	PERMISSION_CONFIG   Permission = 0x10 // view server settings such as version checks
+
+	PERMISSION_NONE Permission = 0x00
+	PERMISSION_ALL  Permission = PERMISSION_VIEW | PERMISSION_KICK | PERMISSION_ANNOUNCE | PERMISSION_BAN | PERMISSION_CONFIG
+)
+
+var permissionNames = map[string]Permission{
+	"all":      PERMISSION_ALL,
+	"announce": PERMISSION_ANNOUNCE,
+	"ban":      PERMISSION_BAN,
+	"config":   PERMISSION_CONFIG,
+	"kick":     PERMISSION_KICK,
+	"view":     PERMISSION_VIEW,
+}
+
+var (
+	operators      = map[string]Permission{}
+	operatorsMutex = sync.RWMutex{}
+)
+
+// Parse combines permission names, e.g. ["view", "kick"].
+func Parse(names []string) (Permission, error) {
+	var value Permission
+	for _, name := range names {
+		p, ok := permissionNames[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return PERMISSION_NONE, fmt.Errorf("unknown permission (%s); expected one of %s", name, strings.Join(Names(), ", "))
+		}
+		value |= p
+	}
+	return value, nil
+}
+
+// Names lists the permission names accepted by Parse.
+func Names() []string {
+	names := make([]string, 0, len(permissionNames))
+	for name := range permissionNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Strings names each permission in value, for display.
+func (p Permission) Strings() []string {
+	names := []string{}
+	for _, name := range Names() {
+		if name != "all" && p&permissionNames[name] != 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// SetOperators replaces every grant; accounts not listed have no permissions.
+func SetOperators(value map[string]Permission) {
+	grants := make(map[string]Permission, len(value))
+	for account, p := range value {
+		grants[strings.ToLower(account)] = p
+	}
+	operatorsMutex.Lock()
+	defer operatorsMutex.Unlock()
+	operators = grants
+}
+
+// Get returns the permissions granted to an account.
+func Get(account string) Permission {
+	operatorsMutex.RLock()
+	defer operatorsMutex.RUnlock()
+	return operators[strings.ToLower(account)]
+}
+
+// Allowed reports whether an account holds every permission in required.
+func Allowed(account string, required Permission) bool {
+	return account != "" && Get(account)&required == required
+}
@@ -0,0 +1,188 @@
+// Package proxyproto recovers client addresses from the HAProxy PROXY protocol
+// header (versions 1 and 2) sent by load balancers in front of the server.
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/carlbennett/gobncs/util"
+)
+
+const DEFAULT_HEADER_TIMEOUT = 5 * time.Second
+
+const maxV1HeaderLength = 107
+
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+var (
+	ErrInvalidHeader = errors.New("invalid PROXY protocol header")
+	ErrMissingHeader = errors.New("missing PROXY protocol header")
+)
+
+// Listener wraps accepted connections from trusted proxies so that their
+// RemoteAddr reports the client address from the PROXY header. Connections
+// from other sources are passed through unchanged.
+type Listener struct {
+	net.Listener
+	HeaderTimeout time.Duration // zero means DEFAULT_HEADER_TIMEOUT
+	Trusted       []*net.IPNet  // empty trusts no source
+}
+
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !l.trusts(conn.RemoteAddr()) {
+		return conn, nil
+	}
+
+	timeout := l.HeaderTimeout
+	if timeout <= 0 {
+		timeout = DEFAULT_HEADER_TIMEOUT
+	}
+	return &Conn{Conn: conn, reader: bufio.NewReader(conn), timeout: timeout}, nil
+}
+
+func (l *Listener) trusts(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	return util.NetworksContain(l.Trusted, tcpAddr.IP)
+}
+
+// Conn reads the PROXY header on first use, from the goroutine that handles
+// the connection rather than the accept loop.
+type Conn struct {
+	net.Conn
+	err        error
+	once       sync.Once
+	reader     *bufio.Reader
+	remoteAddr net.Addr
+	timeout    time.Duration
+}
+
+func (c *Conn) init() {
+	c.once.Do(func() {
+		c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+		c.remoteAddr, c.err = readHeader(c.reader)
+		c.Conn.SetReadDeadline(time.Time{})
+	})
+}
+
+// Err returns the error from reading the PROXY header, if any.
+func (c *Conn) Err() error {
+	c.init()
+	return c.err
+}
+
+func (c *Conn) Read(p []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(p)
+}
+
+// RemoteAddr returns the client address from the PROXY header, or the proxy's
+// address for LOCAL and UNKNOWN headers or when the header is invalid.
+func (c *Conn) RemoteAddr() net.Addr {
+	c.init()
+	if c.remoteAddr == nil {
+		return c.Conn.RemoteAddr()
+	}
+	return c.remoteAddr
+}
+
+func readHeader(r *bufio.Reader) (net.Addr, error) {
+	start, err := r.Peek(len(v2Signature))
+	if err != nil && len(start) < 6 {
+		return nil, ErrMissingHeader
+	}
+	if bytes.Equal(start, v2Signature) {
+		return readV2(r)
+	}
+	if bytes.HasPrefix(start, []byte("PROXY ")) {
+		return readV1(r)
+	}
+	return nil, ErrMissingHeader
+}
+
+func readV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for len(line) < maxV1HeaderLength {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, ErrInvalidHeader
+		}
+		line = append(line, b)
+		if bytes.HasSuffix(line, []byte("\r\n")) {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, ErrInvalidHeader
+	}
+
+	fields := strings.Split(strings.TrimSuffix(string(line), "\r\n"), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, ErrInvalidHeader
+	}
+
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil || (fields[1] == "TCP4") != (ip.To4() != nil) {
+		return nil, ErrInvalidHeader
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+func readV2(r *bufio.Reader) (net.Addr, error) {
+	var header [16]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, ErrInvalidHeader
+	}
+	if header[12]>>4 != 2 {
+		return nil, ErrInvalidHeader
+	}
+	command, family := header[12]&0x0F, header[13]
+	body := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, ErrInvalidHeader
+	}
+
+	switch {
+	case command == 0x0: // LOCAL: health checks from the proxy itself
+		return nil, nil
+	case command != 0x1:
+		return nil, ErrInvalidHeader
+	}
+
+	switch family {
+	case 0x11: // TCP over IPv4
+		if len(body) < 12 {
+			return nil, ErrInvalidHeader
+		}
+		return &net.TCPAddr{IP: net.IP(append([]byte{}, body[0:4]...)), Port: int(binary.BigEndian.Uint16(body[8:10]))}, nil
+	case 0x21: // TCP over IPv6
+		if len(body) < 36 {
+			return nil, ErrInvalidHeader
+		}
+		return &net.TCPAddr{IP: net.IP(append([]byte{}, body[0:16]...)), Port: int(binary.BigEndian.Uint16(body[32:34]))}, nil
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,221 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// v2Header builds a version 2 header with the given command, family and
+// address block.
+func v2Header(command byte, family byte, body []byte) []byte {
+	header := append([]byte{}, v2Signature...)
+	header = append(header, 0x20|command, family, 0, 0)
+	binary.BigEndian.PutUint16(header[14:16], uint16(len(body)))
+	return append(header, body...)
+}
+
+func v2IPv4(source net.IP, sourcePort uint16) []byte {
+	body := append([]byte{}, source.To4()...)
+	body = append(body, 192, 0, 2, 1)
+	body = binary.BigEndian.AppendUint16(body, sourcePort)
+	return binary.BigEndian.AppendUint16(body, 6112)
+}
+
+func v2IPv6(source net.IP, sourcePort uint16) []byte {
+	body := append([]byte{}, source.To16()...)
+	body = append(body, net.ParseIP("2001:db8::1").To16()...)
+	body = binary.BigEndian.AppendUint16(body, sourcePort)
+	return binary.BigEndian.AppendUint16(body, 6112)
+}
+
+func TestReadHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		addr   string // empty when the proxy's own address is kept
+		err    error
+	}{
+		{"v1 TCP4", []byte("PROXY TCP4 198.51.100.7 192.0.2.1 51234 6112\r\n"), "198.51.100.7:51234", nil},
+		{"v1 TCP6", []byte("PROXY TCP6 2001:db8::7 2001:db8::1 51234 6112\r\n"), "[2001:db8::7]:51234", nil},
+		{"v1 UNKNOWN", []byte("PROXY UNKNOWN\r\n"), "", nil},
+		{"v1 without CRLF", []byte("PROXY TCP4 198.51.100.7 192.0.2.1 51234 6112\n"), "", ErrInvalidHeader},
+		{"v1 too long", append([]byte("PROXY TCP4 "), bytes.Repeat([]byte("1"), maxV1HeaderLength)...), "", ErrInvalidHeader},
+		{"v1 truncated", []byte("PROXY TCP4 198.51.100.7"), "", ErrInvalidHeader},
+		{"v1 missing fields", []byte("PROXY TCP4 198.51.100.7 192.0.2.1 51234\r\n"), "", ErrInvalidHeader},
+		{"v1 unknown protocol", []byte("PROXY UDP4 198.51.100.7 192.0.2.1 51234 6112\r\n"), "", ErrInvalidHeader},
+		{"v1 bad address", []byte("PROXY TCP4 198.51.100.300 192.0.2.1 51234 6112\r\n"), "", ErrInvalidHeader},
+		{"v1 family mismatch", []byte("PROXY TCP4 2001:db8::7 192.0.2.1 51234 6112\r\n"), "", ErrInvalidHeader},
+		{"v1 bad port", []byte("PROXY TCP4 198.51.100.7 192.0.2.1 65536 6112\r\n"), "", ErrInvalidHeader},
+		{"v2 IPv4", v2Header(0x1, 0x11, v2IPv4(net.ParseIP("198.51.100.7"), 51234)), "198.51.100.7:51234", nil},
+		{"v2 IPv6", v2Header(0x1, 0x21, v2IPv6(net.ParseIP("2001:db8::7"), 51234)), "[2001:db8::7]:51234", nil},
+		{"v2 LOCAL", v2Header(0x0, 0x00, nil), "", nil},
+		{"v2 LOCAL with addresses", v2Header(0x0, 0x11, v2IPv4(net.ParseIP("198.51.100.7"), 51234)), "", nil},
+		{"v2 unspecified family", v2Header(0x1, 0x00, nil), "", nil},
+		{"v2 unknown command", v2Header(0x2, 0x11, v2IPv4(net.ParseIP("198.51.100.7"), 51234)), "", ErrInvalidHeader},
+		{"v2 wrong version", append(append(append([]byte{}, v2Signature...), 0x11, 0x11, 0, 12), v2IPv4(net.ParseIP("198.51.100.7"), 51234)...), "", ErrInvalidHeader},
+		{"v2 short IPv4 block", v2Header(0x1, 0x11, make([]byte, 11)), "", ErrInvalidHeader},
+		{"v2 short IPv6 block", v2Header(0x1, 0x21, make([]byte, 35)), "", ErrInvalidHeader},
+		{"v2 truncated header", v2Header(0x1, 0x11, nil)[:14], "", ErrInvalidHeader},
+		{"v2 truncated body", v2Header(0x1, 0x11, v2IPv4(net.ParseIP("198.51.100.7"), 51234))[:20], "", ErrInvalidHeader},
+		{"no header", []byte{0x01, 0xFF, 0x50, 0x00}, "", ErrMissingHeader},
+		{"empty", nil, "", ErrMissingHeader},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			trailer := []byte{0x01, 0xFF}
+			r := bufio.NewReader(bytes.NewReader(append(append([]byte{}, test.header...), trailer...)))
+
+			addr, err := readHeader(r)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+			if test.addr == "" {
+				if addr != nil {
+					t.Errorf("expected the proxy's address to be kept, got %v", addr)
+				}
+			} else if addr == nil || addr.String() != test.addr {
+				t.Errorf("expected address %s, got %v", test.addr, addr)
+			}
+
+			if err == nil {
+				rest, _ := io.ReadAll(r)
+				if !bytes.Equal(rest, trailer) {
+					t.Errorf("expected the stream to continue after the header with % X, got % X", trailer, rest)
+				}
+			}
+		})
+	}
+}
+
+// accept dials a listener that trusts trusted and writes data, and returns
+// the accepted connection.
+func accept(t *testing.T, trusted string, data []byte) net.Conn {
+	t.Helper()
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { inner.Close() })
+	listener := &Listener{Listener: inner, HeaderTimeout: time.Second}
+	if trusted != "" {
+		_, network, _ := net.ParseCIDR(trusted)
+		listener.Trusted = []*net.IPNet{network}
+	}
+
+	client, err := net.Dial("tcp", inner.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	if _, err = client.Write(data); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestListenerTrustedProxy(t *testing.T) {
+	conn := accept(t, "127.0.0.0/8", []byte("PROXY TCP4 198.51.100.7 192.0.2.1 51234 6112\r\n\x01"))
+
+	proxied, ok := conn.(*Conn)
+	if !ok {
+		t.Fatalf("connection from a trusted proxy was not wrapped (%T)", conn)
+	}
+	if err := proxied.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if addr := conn.RemoteAddr().String(); addr != "198.51.100.7:51234" {
+		t.Errorf("expected the client address from the header, got %s", addr)
+	}
+	b := make([]byte, 1)
+	if _, err := io.ReadFull(conn, b); err != nil || b[0] != 0x01 {
+		t.Errorf("expected the protocol byte after the header, got % X (%v)", b, err)
+	}
+}
+
+func TestListenerUntrustedPeer(t *testing.T) {
+	for _, trusted := range []string{"", "192.0.2.0/24"} {
+		// a forged header is read as client data, not as an address
+		data := []byte("PROXY TCP4 198.51.100.7 192.0.2.1 51234 6112\r\n")
+		conn := accept(t, trusted, data)
+
+		if _, ok := conn.(*Conn); ok {
+			t.Fatalf("trusted %q: connection from an untrusted peer was wrapped", trusted)
+		}
+		if host, _, _ := net.SplitHostPort(conn.RemoteAddr().String()); host != "127.0.0.1" {
+			t.Errorf("trusted %q: expected the peer address, got %s", trusted, conn.RemoteAddr())
+		}
+		received := make([]byte, len(data))
+		if _, err := io.ReadFull(conn, received); err != nil || !bytes.Equal(received, data) {
+			t.Errorf("trusted %q: expected the header to be passed through, got %q (%v)", trusted, received, err)
+		}
+	}
+}
+
+func TestConnErr(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"missing header", []byte{0x01, 0xFF, 0x50, 0x00, 0x3A, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, ErrMissingHeader},
+		{"malformed header", []byte("PROXY TCP4 nonsense\r\n"), ErrInvalidHeader},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conn := accept(t, "127.0.0.0/8", test.data)
+
+			if err := conn.(*Conn).Err(); !errors.Is(err, test.err) {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+			if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, test.err) {
+				t.Errorf("expected reads to fail with %v, got %v", test.err, err)
+			}
+			if host, _, _ := net.SplitHostPort(conn.RemoteAddr().String()); host != "127.0.0.1" {
+				t.Errorf("expected the proxy's address, got %s", conn.RemoteAddr())
+			}
+		})
+	}
+}
+
+func TestConnHeaderTimeout(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inner.Close()
+	_, loopback, _ := net.ParseCIDR("127.0.0.0/8")
+	listener := &Listener{Listener: inner, HeaderTimeout: 50 * time.Millisecond, Trusted: []*net.IPNet{loopback}}
+
+	client, err := net.Dial("tcp", inner.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	// a proxy that stalls partway through the header
+	if _, err = client.Write([]byte("PROXY TCP4 198.51.100.7")); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err = conn.(*Conn).Err(); !errors.Is(err, ErrInvalidHeader) {
+		t.Fatalf("expected ErrInvalidHeader, got %v", err)
+	}
+}
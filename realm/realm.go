@@ -0,0 +1,65 @@
+// Package realm lists the Diablo II realm servers that logged on clients are
+// offered with SID_QUERYREALMS2 and handed to with SID_LOGONREALMEX.
+package realm
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type Realm struct {
+	Description string
+	IP          net.IP // IPv4, as the address is sent in four bytes
+	Name        string
+	Port        uint16
+}
+
+var (
+	realms      []Realm
+	realmsMutex = sync.RWMutex{}
+)
+
+// Parse splits an "ip:port" realm address. Only IPv4 addresses are accepted.
+func Parse(address string) (net.IP, uint16, bool) {
+	host, portValue, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, 0, false
+	}
+	ip := net.ParseIP(host).To4()
+	port, err := strconv.ParseUint(portValue, 10, 16)
+	if ip == nil || err != nil || port == 0 {
+		return nil, 0, false
+	}
+	return ip, uint16(port), true
+}
+
+// Set replaces the list of realms, in the order they are offered to clients.
+func Set(list []Realm) {
+	copied := make([]Realm, len(list))
+	copy(copied, list)
+	realmsMutex.Lock()
+	defer realmsMutex.Unlock()
+	realms = copied
+}
+
+func List() []Realm {
+	realmsMutex.RLock()
+	defer realmsMutex.RUnlock()
+	list := make([]Realm, len(realms))
+	copy(list, realms)
+	return list
+}
+
+// Get looks up a realm by name, ignoring case.
+func Get(name string) (Realm, bool) {
+	realmsMutex.RLock()
+	defer realmsMutex.RUnlock()
+	for _, r := range realms {
+		if strings.EqualFold(r.Name, name) {
+			return r, true
+		}
+	}
+	return Realm{}, false
+}
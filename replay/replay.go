@@ -0,0 +1,231 @@
+// Package replay feeds a recorded client session through an in-process server
+// and compares the server's replies with the recorded ones, to catch protocol
+// regressions before they are deployed.
+package replay
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"reflect"
+	"time"
+
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/codec"
+	"github.com/carlbennett/gobncs/message"
+	"github.com/carlbennett/gobncs/server"
+	"github.com/carlbennett/gobncs/trace"
+)
+
+// how long to wait for each recorded reply, and for unexpected ones once the
+// session is over
+const DEFAULT_TIMEOUT = 2 * time.Second
+
+type volatile struct {
+	payload func() codec.Payload
+	fields  []string
+}
+
+// reply fields that differ between runs without indicating a regression
+var volatileFields = map[message.MessageId]volatile{
+	message.SID_AUTH_INFO: {
+		payload: func() codec.Payload { return &codec.ServerSID_AUTH_INFO{} },
+		fields:  []string{"MPQFileTime", "ServerToken", "UDPValue"},
+	},
+	message.SID_CHATEVENT: {
+		payload: func() codec.Payload { return &codec.ServerSID_CHATEVENT{} },
+		fields:  []string{"Ping"},
+	},
+	message.SID_GETFILETIME: {
+		payload: func() codec.Payload { return &codec.ServerSID_GETFILETIME{} },
+		fields:  []string{"FileTime"},
+	},
+	message.SID_LOGONCHALLENGE: {
+		payload: func() codec.Payload { return &codec.ServerSID_LOGONCHALLENGE{} },
+		fields:  []string{"ServerToken"},
+	},
+	message.SID_LOGONCHALLENGEEX: {
+		payload: func() codec.Payload { return &codec.ServerSID_LOGONCHALLENGEEX{} },
+		fields:  []string{"ServerToken", "UDPValue"},
+	},
+	message.SID_PING: {
+		payload: func() codec.Payload { return &codec.ServerSID_PING{} },
+		fields:  []string{"Cookie"},
+	},
+	message.SID_STARTVERSIONING: {
+		payload: func() codec.Payload { return &codec.ServerSID_STARTVERSIONING{} },
+		fields:  []string{"MPQFileTime"},
+	},
+}
+
+type Options struct {
+	Protocol clientstate.ProtocolType // zero means the game protocol
+	Timeout  time.Duration            // zero means DEFAULT_TIMEOUT
+}
+
+// Divergence is a recorded reply the server did not send as recorded, or a
+// reply it sent that was not recorded.
+type Divergence struct {
+	Actual   *message.Message // nil if the server sent nothing
+	Expected *message.Message // nil if the reply was not recorded
+	Frame    int              // index of the recorded frame, or -1 after the session
+	Reason   string
+}
+
+func (d Divergence) String() string {
+	if d.Frame < 0 {
+		return fmt.Sprintf("after session: %s", d.Reason)
+	}
+	return fmt.Sprintf("frame %d: %s", d.Frame, d.Reason)
+}
+
+type Result struct {
+	Compared    int // recorded replies compared
+	Divergences []Divergence
+	Sent        int // recorded client messages sent
+}
+
+// Run replays the client side of frames against server.HandleConnection over
+// net.Pipe. The server's tokens are taken from the recording so that password
+// proofs still verify. Run changes the server's token source and must not be
+// called concurrently.
+func Run(frames []trace.Frame, options Options) (*Result, error) {
+	if options.Protocol == 0 {
+		options.Protocol = clientstate.PROTOCOL_TYPE_GAME
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = DEFAULT_TIMEOUT
+	}
+
+	tokens := recordedTokens(frames)
+	server.SetTokenSource(func() server.Tokens { return tokens })
+	defer server.SetTokenSource(nil)
+
+	conn, serverConn := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		server.HandleConnection(serverConn)
+		close(done)
+	}()
+	defer func() {
+		conn.Close()
+		<-done
+	}()
+
+	replies := make(chan *message.Message, clientstate.OUTBOUND_QUEUE_SIZE)
+	go func() {
+		defer close(replies)
+		reader := message.NewReader(conn)
+		for {
+			m, err := reader.ReadMessage()
+			if err != nil {
+				return
+			}
+			replies <- m
+		}
+	}()
+
+	if _, err := conn.Write([]byte{byte(options.Protocol)}); err != nil {
+		return nil, fmt.Errorf("failed to send protocol type: %v", err)
+	}
+
+	result := &Result{}
+	for i, f := range frames {
+		if f.Direction == trace.INBOUND {
+			err := message.WriteMessage(conn, f.Message)
+			if err != nil {
+				result.Divergences = append(result.Divergences, Divergence{Expected: f.Message, Frame: i, Reason: fmt.Sprintf("connection closed before %s could be sent", message.MessageIdToName(f.Message.ID))})
+				return result, nil
+			}
+			result.Sent++
+			continue
+		}
+
+		result.Compared++
+		select {
+		case actual, ok := <-replies:
+			if !ok {
+				result.Divergences = append(result.Divergences, Divergence{Expected: f.Message, Frame: i, Reason: fmt.Sprintf("connection closed; expected %s", message.MessageIdToName(f.Message.ID))})
+				return result, nil
+			}
+			if equal, reason := Equal(f.Message, actual); !equal {
+				result.Divergences = append(result.Divergences, Divergence{Actual: actual, Expected: f.Message, Frame: i, Reason: reason})
+			}
+		case <-time.After(options.Timeout):
+			result.Divergences = append(result.Divergences, Divergence{Expected: f.Message, Frame: i, Reason: fmt.Sprintf("no reply within %s; expected %s", options.Timeout, message.MessageIdToName(f.Message.ID))})
+		}
+	}
+
+	// replies to the last messages that were not recorded
+	for {
+		select {
+		case actual, ok := <-replies:
+			if !ok {
+				return result, nil
+			}
+			result.Divergences = append(result.Divergences, Divergence{Actual: actual, Frame: -1, Reason: fmt.Sprintf("unexpected %s", message.MessageIdToName(actual.ID))})
+		case <-time.After(options.Timeout):
+			return result, nil
+		}
+	}
+}
+
+// Equal compares a recorded reply with an actual one, ignoring tokens,
+// cookies, pings and file times. The reason describes the first difference.
+func Equal(expected *message.Message, actual *message.Message) (bool, string) {
+	if expected.ID != actual.ID {
+		return false, fmt.Sprintf("expected %s, got %s", message.MessageIdToName(expected.ID), message.MessageIdToName(actual.ID))
+	}
+
+	v, ok := volatileFields[expected.ID]
+	if !ok {
+		if bytes.Equal(expected.Body, actual.Body) {
+			return true, ""
+		}
+		return false, fmt.Sprintf("%s body differs", message.MessageIdToName(expected.ID))
+	}
+
+	want, got := v.payload(), v.payload()
+	if err := codec.Decode(expected, want); err != nil {
+		return false, fmt.Sprintf("recorded %s does not decode: %v", message.MessageIdToName(expected.ID), err)
+	}
+	if err := codec.Decode(actual, got); err != nil {
+		return false, fmt.Sprintf("%s does not decode: %v", message.MessageIdToName(actual.ID), err)
+	}
+	wantValue, gotValue := reflect.ValueOf(want).Elem(), reflect.ValueOf(got).Elem()
+	for _, name := range v.fields {
+		field := wantValue.FieldByName(name)
+		field.Set(reflect.Zero(field.Type()))
+		field = gotValue.FieldByName(name)
+		field.Set(reflect.Zero(field.Type()))
+	}
+	for i := 0; i < wantValue.NumField(); i++ {
+		if !reflect.DeepEqual(wantValue.Field(i).Interface(), gotValue.Field(i).Interface()) {
+			return false, fmt.Sprintf("%s field %s differs", message.MessageIdToName(expected.ID), wantValue.Type().Field(i).Name)
+		}
+	}
+	return true, ""
+}
+
+// recordedTokens returns the tokens from the first recorded SID_AUTH_INFO or
+// SID_LOGONCHALLENGEEX reply, or zero tokens if there is none.
+func recordedTokens(frames []trace.Frame) server.Tokens {
+	for _, f := range frames {
+		if f.Direction != trace.OUTBOUND {
+			continue
+		}
+		switch f.Message.ID {
+		case message.SID_AUTH_INFO:
+			var fields codec.ServerSID_AUTH_INFO
+			if codec.Decode(f.Message, &fields) == nil {
+				return server.Tokens{ServerToken: fields.ServerToken, UDPValue: fields.UDPValue}
+			}
+		case message.SID_LOGONCHALLENGEEX:
+			var fields codec.ServerSID_LOGONCHALLENGEEX
+			if codec.Decode(f.Message, &fields) == nil {
+				return server.Tokens{ServerToken: fields.ServerToken, UDPValue: fields.UDPValue}
+			}
+		}
+	}
+	return server.Tokens{}
+}
@@ -0,0 +1,76 @@
+package replay
+
+import (
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/carlbennett/gobncs/account"
+	"github.com/carlbennett/gobncs/config"
+	"github.com/carlbennett/gobncs/logging"
+	"github.com/carlbennett/gobncs/message"
+	"github.com/carlbennett/gobncs/trace"
+)
+
+// TestRecordedTraces replays every trace under testdata, each against an empty
+// account store and the default settings.
+func TestRecordedTraces(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "*.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no traces under testdata")
+	}
+
+	logging.Configure(io.Discard, logging.Options{})
+	config.Default().ApplyProtocolSettings()
+
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			frames, err := trace.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = account.Open(filepath.Join(t.TempDir(), "accounts.json")); err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := Run(frames, Options{Timeout: 500 * time.Millisecond})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, d := range result.Divergences {
+				t.Error(d)
+			}
+			if result.Compared == 0 {
+				t.Error("no replies were compared")
+			}
+		})
+	}
+}
+
+func TestEqual(t *testing.T) {
+	ping := &message.Message{ID: message.SID_PING, Body: []byte{0x01, 0x02, 0x03, 0x04}}
+	otherPing := &message.Message{ID: message.SID_PING, Body: []byte{0x05, 0x06, 0x07, 0x08}}
+	check := &message.Message{ID: message.SID_AUTH_CHECK, Body: []byte{0x00, 0x00, 0x00, 0x00, 0x00}}
+	failedCheck := &message.Message{ID: message.SID_AUTH_CHECK, Body: []byte{0x00, 0x01, 0x00, 0x00, 0x00}}
+
+	tests := []struct {
+		name     string
+		expected *message.Message
+		actual   *message.Message
+		equal    bool
+	}{
+		{"volatile field", ping, otherPing, true},
+		{"same body", check, check, true},
+		{"different body", check, failedCheck, false},
+		{"different message", ping, check, false},
+	}
+	for _, test := range tests {
+		if equal, reason := Equal(test.expected, test.actual); equal != test.equal {
+			t.Errorf("%s: expected %v, got %v (%s)", test.name, test.equal, equal, reason)
+		}
+	}
+}
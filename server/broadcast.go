@@ -0,0 +1,131 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/logging"
+	"github.com/carlbennett/gobncs/message"
+	"github.com/carlbennett/gobncs/parser"
+	"github.com/carlbennett/gobncs/tournament"
+)
+
+var tournamentLogger = logging.For(logging.TOURNAMENT)
+
+// readLock read locks state and returns the matching unlock, unless state is
+// held: a client whose lock the caller already holds, such as the one whose
+// message is being handled. Taking the lock of held again would deadlock.
+func readLock(state *clientstate.ClientState, held *clientstate.ClientState) func() {
+	if state == held {
+		return func() {}
+	}
+	state.RLock()
+	return state.RUnlock
+}
+
+// sendToClients queues a message for every logged on client matching filter,
+// which is called with the client's read lock held. held is as for Broadcast.
+func sendToClients(held *clientstate.ClientState, reply *message.Message, filter func(state *clientstate.ClientState) bool) {
+	clientstate.EachClientState(func(state *clientstate.ClientState) bool {
+		unlock := readLock(state, held)
+		matches := len(state.Username) > 0 && (filter == nil || filter(state))
+		unlock()
+		if !matches {
+			return true
+		}
+		err := parser.WriteSID(state, reply)
+		if err != nil {
+			unlock = readLock(state, held)
+			state.Logger(logger).Warn("failed to write message", "message", message.MessageIdToName(reply.ID), "error", err)
+			unlock()
+		}
+		return true
+	})
+}
+
+// Broadcast sends a server broadcast chat event to every logged on client.
+// Every client's lock is taken in turn, except that of held, a client whose
+// lock the caller already holds; handlers must pass the client they handle,
+// other callers nil.
+func Broadcast(held *clientstate.ClientState, text string) error {
+	reply, err := parser.WriteSID_CHATEVENT(parser.EID_BROADCAST, 0, 0, []byte("Battle.net"), []byte(text))
+	if err != nil {
+		return err
+	}
+	sendToClients(held, reply, nil)
+	return nil
+}
+
+// Kick disconnects every client matching filter, which is called with the
+// client's read lock held. Logged on clients are told the reason first. It
+// returns the number of clients disconnected. held is as for Broadcast.
+func Kick(held *clientstate.ClientState, reason string, filter func(state *clientstate.ClientState) bool) int {
+	text := "You have been disconnected by an administrator."
+	if reason != "" {
+		text = fmt.Sprintf("You have been disconnected by an administrator: %s", reason)
+	}
+	notice, err := parser.WriteSID_CHATEVENT(parser.EID_ERROR, 0, 0, []byte("Battle.net"), []byte(text))
+	if err != nil {
+		logger.Warn("failed to write kick notice", "error", err)
+	}
+
+	kicked := 0
+	clientstate.EachClientState(func(state *clientstate.ClientState) bool {
+		unlock := readLock(state, held)
+		matches := filter(state)
+		loggedOn := len(state.Username) > 0
+		if matches {
+			state.Logger(logger).Info("kicking client", "reason", reason)
+		}
+		unlock()
+		if !matches {
+			return true
+		}
+		kicked++
+		if notice == nil || !loggedOn || state.SendAndClose(notice) != nil {
+			state.Close()
+		}
+		return true
+	})
+	return kicked
+}
+
+func NotifyTournament(event tournament.Event, t *tournament.Tournament) {
+	eligible := func(state *clientstate.ClientState) bool {
+		return t.Eligible(state.Product)
+	}
+
+	var status byte = tournament.STATUS_INACTIVE
+	var text string
+	switch event {
+	case tournament.EVENT_START:
+		var players []string
+		clientstate.EachClientState(func(state *clientstate.ClientState) bool {
+			state.RLock()
+			defer state.RUnlock()
+			if len(state.Username) > 0 && eligible(state) {
+				players = append(players, string(state.Username))
+			}
+			return true
+		})
+		tournament.Enroll(t, players)
+		status = tournament.STATUS_ACTIVE
+		text = fmt.Sprintf("The %s tournament has started with %d players.", t.Name, len(players))
+	case tournament.EVENT_STOP:
+		text = fmt.Sprintf("The %s tournament has ended.", t.Name)
+		if champion := t.CurrentChampion(); champion != "" {
+			text = fmt.Sprintf("The %s tournament has ended. Congratulations to %s!", t.Name, champion)
+		}
+	}
+
+	tournamentLogger.Info(text, "tournament", t.Name)
+
+	reply, err := parser.WriteSID_TOURNAMENT(status, 0)
+	if err == nil {
+		sendToClients(nil, reply, eligible)
+		err = Broadcast(nil, text)
+	}
+	if err != nil {
+		tournamentLogger.Warn("failed to announce tournament", "tournament", t.Name, "error", err)
+	}
+}
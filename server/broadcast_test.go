@@ -0,0 +1,89 @@
+package server
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/codec"
+	"github.com/carlbennett/gobncs/logging"
+	"github.com/carlbennett/gobncs/message"
+)
+
+// registered returns a logged on client that Broadcast and Kick can see.
+func registered(t *testing.T, username string) *clientstate.ClientState {
+	t.Helper()
+	state := newPhaseState(t, clientstate.PHASE_CHAT, clientstate.PRODUCT_STAR)
+	state.Username = []byte(username)
+	clientstate.AddClientState(state.Conn, state)
+	t.Cleanup(func() { clientstate.RemoveClientState(state.Conn) })
+	return state
+}
+
+// withinHandler runs fn with the lock of state held, as the dispatcher does
+// while a handler runs, and fails if fn does not return.
+func withinHandler(t *testing.T, state *clientstate.ClientState, fn func()) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		state.Lock()
+		defer state.Unlock()
+		fn()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("deadlocked on the handled client's lock")
+	}
+}
+
+func TestBroadcastFromHandler(t *testing.T) {
+	logging.Configure(io.Discard, logging.Options{})
+	sender := registered(t, "sender")
+	other := registered(t, "other")
+
+	withinHandler(t, sender, func() {
+		if err := Broadcast(sender, "hello"); err != nil {
+			t.Error(err)
+		}
+	})
+
+	for _, state := range []*clientstate.ClientState{sender, other} {
+		var event codec.ServerSID_CHATEVENT
+		select {
+		case m := <-state.Outbound():
+			if err := codec.Decode(m, &event); err != nil {
+				t.Fatal(err)
+			}
+		default:
+			t.Fatalf("%s was not sent the broadcast", state.Username)
+		}
+		if string(event.Text) != "hello" {
+			t.Errorf("%s: expected the broadcast text, got %q", state.Username, event.Text)
+		}
+	}
+}
+
+func TestKickFromHandler(t *testing.T) {
+	logging.Configure(io.Discard, logging.Options{})
+	sender := registered(t, "sender")
+	target := registered(t, "target")
+
+	var kicked int
+	withinHandler(t, sender, func() {
+		kicked = Kick(sender, "testing", func(state *clientstate.ClientState) bool {
+			return state == target || state == sender
+		})
+	})
+	if kicked != 2 {
+		t.Fatalf("expected 2 clients kicked, got %d", kicked)
+	}
+
+	for _, state := range []*clientstate.ClientState{sender, target} {
+		if ids := drain(state); len(ids) != 2 || ids[0] != message.SID_CHATEVENT || ids[1] != 0xFF {
+			t.Errorf("%s: expected a notice and a close, got %v", state.Username, ids)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/codec"
+	"github.com/carlbennett/gobncs/flood"
+	"github.com/carlbennett/gobncs/handler"
+	"github.com/carlbennett/gobncs/message"
+)
+
+type limiter struct {
+	*flood.Limiter
+	flooded bool
+}
+
+// per connection limiters, keyed by *clientstate.ClientState
+var limiters = sync.Map{}
+
+// LimitFlood charges every message against the connection's token buckets.
+// A client that exceeds them is sent SID_FLOODDETECTED and disconnected once
+// it was written; anything it sends meanwhile is dropped.
+func LimitFlood(next handler.Handler) handler.Handler {
+	return func(state *clientstate.ClientState, m *message.Message) error {
+		if flood.Exempt(state.RemoteIP(), string(state.Username)) {
+			return next(state, m)
+		}
+
+		now := time.Now()
+		value, _ := limiters.LoadOrStore(state, &limiter{Limiter: flood.NewLimiter(flood.ProductLimits(state.Product), now)})
+		l := value.(*limiter)
+		if l.flooded {
+			return nil
+		}
+		if l.Allow(flood.ProductLimits(state.Product), m.ID == message.SID_CHATCOMMAND, now) {
+			return next(state, m)
+		}
+
+		l.flooded = true
+		state.Logger(floodLogger).Warn("flood detected; terminating connection", "message", message.MessageIdToName(m.ID))
+		reply, err := codec.Encode(codec.ServerSID_FLOODDETECTED{})
+		if err == nil {
+			err = state.SendAndClose(reply)
+		}
+		return err
+	}
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"io"
+	"testing"
+
+	"github.com/carlbennett/gobncs/channel"
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/codec"
+	"github.com/carlbennett/gobncs/flood"
+	"github.com/carlbennett/gobncs/handler"
+	"github.com/carlbennett/gobncs/logging"
+	"github.com/carlbennett/gobncs/message"
+	"github.com/carlbennett/gobncs/parser"
+)
+
+// setChatBurst limits clients to burst chat lines and practically no refill,
+// while leaving other messages unlimited.
+func setChatBurst(t *testing.T, burst int) {
+	t.Helper()
+	logging.Configure(io.Discard, logging.Options{})
+	previous := flood.GetSettings()
+	flood.SetSettings(flood.Settings{Limits: flood.Limits{ChatBurst: burst, ChatRate: 0.001}})
+	t.Cleanup(func() { flood.SetSettings(previous) })
+}
+
+// send dispatches p through the middleware as if the client sent it.
+func send(t *testing.T, state *clientstate.ClientState, p codec.Payload) {
+	t.Helper()
+	m, err := codec.Encode(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = handler.Dispatch(state, m); err != nil {
+		t.Fatalf("%s: %v", message.MessageIdToName(m.ID), err)
+	}
+}
+
+// drain returns the ids of every queued reply.
+func drain(state *clientstate.ClientState) []message.MessageId {
+	var ids []message.MessageId
+	for {
+		select {
+		case m := <-state.Outbound():
+			if m == nil {
+				ids = append(ids, 0xFF) // marks SendAndClose
+				continue
+			}
+			ids = append(ids, m.ID)
+		default:
+			return ids
+		}
+	}
+}
+
+// talkEvents counts the chat events queued for state that carry talk.
+func talkEvents(t *testing.T, state *clientstate.ClientState) int {
+	t.Helper()
+	count := 0
+	for {
+		select {
+		case m := <-state.Outbound():
+			var event codec.ServerSID_CHATEVENT
+			if m.ID == message.SID_CHATEVENT && codec.Decode(m, &event) == nil && event.EventId == parser.EID_TALK {
+				count++
+			}
+		default:
+			return count
+		}
+	}
+}
+
+func TestChatFlood(t *testing.T) {
+	setChatBurst(t, 3)
+
+	speaker := newPhaseState(t, clientstate.PHASE_CHAT, clientstate.PRODUCT_STAR)
+	listener := newPhaseState(t, clientstate.PHASE_CHAT, clientstate.PRODUCT_STAR)
+	listener.Username = []byte("listener")
+	send(t, speaker, codec.ClientSID_JOINCHANNEL{Channel: []byte("Flood")})
+	send(t, listener, codec.ClientSID_JOINCHANNEL{Channel: []byte("Flood")})
+	drain(speaker)
+	drain(listener)
+
+	// other messages do not use up the chat bucket
+	for i := 0; i < 10; i++ {
+		send(t, speaker, codec.ClientSID_NULL{})
+	}
+
+	for i := 0; i < 3; i++ {
+		send(t, speaker, codec.ClientSID_CHATCOMMAND{Text: []byte("hello")})
+	}
+	if count := talkEvents(t, listener); count != 3 {
+		t.Fatalf("expected 3 lines to reach the channel, got %d", count)
+	}
+	drain(speaker)
+
+	send(t, speaker, codec.ClientSID_CHATCOMMAND{Text: []byte("one line too many")})
+	if count := talkEvents(t, listener); count != 0 {
+		t.Fatal("flooding line reached the channel")
+	}
+	replies := drain(speaker)
+	if len(replies) != 2 || replies[0] != message.SID_FLOODDETECTED || replies[1] != 0xFF {
+		t.Fatalf("expected SID_FLOODDETECTED and a close, got %v", replies)
+	}
+
+	// nothing else is handled once the client flooded
+	send(t, speaker, codec.ClientSID_LEAVECHAT{})
+	if replies = drain(speaker); len(replies) != 0 {
+		t.Fatalf("handled a message after the flood: %v", replies)
+	}
+	if _, ok := channel.Of(speaker); !ok {
+		t.Fatal("handled SID_LEAVECHAT after the flood")
+	}
+}
+
+func TestChatFloodCountsCommands(t *testing.T) {
+	setChatBurst(t, 2)
+
+	state := newPhaseState(t, clientstate.PHASE_CHAT, clientstate.PRODUCT_STAR)
+	send(t, state, codec.ClientSID_JOINCHANNEL{Channel: []byte("Flood")})
+	drain(state)
+
+	send(t, state, codec.ClientSID_CHATCOMMAND{Text: []byte("/whoami")})
+	send(t, state, codec.ClientSID_CHATCOMMAND{Text: []byte("/whoami")})
+	drain(state)
+	send(t, state, codec.ClientSID_CHATCOMMAND{Text: []byte("/whoami")})
+	if replies := drain(state); len(replies) == 0 || replies[0] != message.SID_FLOODDETECTED {
+		t.Fatalf("expected SID_FLOODDETECTED, got %v", replies)
+	}
+}
@@ -0,0 +1,18 @@
+package server
+
+import (
+	"sync/atomic"
+
+	"github.com/carlbennett/gobncs/message"
+)
+
+var resyncPolicy = int32(message.RESYNC_NONE)
+
+func GetResyncPolicy() message.ResyncPolicy {
+	return message.ResyncPolicy(atomic.LoadInt32(&resyncPolicy))
+}
+
+// SetResyncPolicy applies to connections accepted afterwards.
+func SetResyncPolicy(policy message.ResyncPolicy) {
+	atomic.StoreInt32(&resyncPolicy, int32(policy))
+}
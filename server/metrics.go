@@ -0,0 +1,53 @@
+package server
+
+import (
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/handler"
+	"github.com/carlbennett/gobncs/message"
+	"github.com/carlbennett/gobncs/metrics"
+)
+
+var (
+	connectionsTotal   = metrics.NewCounter("gobncs_connections_total", "Connections by requested protocol type.", "protocol")
+	messagesReceived   = metrics.NewCounter("gobncs_messages_received_total", "Messages received by message id.", "message")
+	messagesSent       = metrics.NewCounter("gobncs_messages_sent_total", "Messages sent by message id.", "message")
+	outboundQueueDepth = metrics.NewHistogram("gobncs_outbound_queue_depth", "Messages still queued for a client each time one is written.", []float64{0, 1, 2, 4, 8, 16, 32, 64, 128, clientstate.OUTBOUND_QUEUE_SIZE})
+	parseErrors        = metrics.NewCounter("gobncs_parse_errors_total", "Messages whose handler failed, terminating the connection, by message id.", "message")
+)
+
+func init() {
+	metrics.NewGaugeFunc("gobncs_clients", "Connected clients by protocol type and product.", []string{"protocol", "product"}, func(set func(value float64, labelValues ...string)) {
+		clientstate.EachClientState(func(state *clientstate.ClientState) bool {
+			state.RLock()
+			protocol, product := state.ProtocolType, state.Product
+			state.RUnlock()
+			set(1, protocolLabel(protocol), productLabel(product))
+			return true
+		})
+	})
+}
+
+// CountMessages counts every message received, including those later dropped
+// for flooding or being out of phase.
+func CountMessages(next handler.Handler) handler.Handler {
+	return func(state *clientstate.ClientState, m *message.Message) error {
+		messagesReceived.Inc(message.MessageIdToName(m.ID))
+		return next(state, m)
+	}
+}
+
+// protocolLabel names a connection that has not requested a protocol yet
+// "none".
+func protocolLabel(protocol clientstate.ProtocolType) string {
+	if protocol == 0 {
+		return "none"
+	}
+	return clientstate.ProtocolTypeToName(protocol)
+}
+
+func productLabel(product clientstate.Product) string {
+	if product == clientstate.PRODUCT_ZERO {
+		return "none"
+	}
+	return clientstate.ProductToCode(product)
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/handler"
+	"github.com/carlbennett/gobncs/message"
+)
+
+func init() {
+	handler.Use(CountMessages, LogMessages, LimitFlood, CheckPhase)
+}
+
+// LogMessages traces every message received when the packet subsystem logs
+// at debug level.
+func LogMessages(next handler.Handler) handler.Handler {
+	return func(state *clientstate.ClientState, m *message.Message) error {
+		if packetLogger.Enabled(context.Background(), slog.LevelDebug) {
+			state.Logger(packetLogger).Debug("message received", "message", message.MessageIdToName(m.ID), "length", m.Length)
+		}
+		return next(state, m)
+	}
+}
+
+// CheckPhase applies the out of phase action to messages that are not legal
+// in the connection's current phase.
+func CheckPhase(next handler.Handler) handler.Handler {
+	return func(state *clientstate.ClientState, m *message.Message) error {
+		if MessageAllowed(state.Phase, m.ID) {
+			return next(state, m)
+		}
+
+		messageName := message.MessageIdToName(m.ID)
+		switch GetOutOfPhaseAction() {
+		case OUT_OF_PHASE_IGNORE:
+			return nil
+		case OUT_OF_PHASE_ERROR:
+			state.Logger(logger).Warn("message not allowed in phase; dropping message", "message", messageName, "phase", clientstate.PhaseToName(state.Phase))
+			return nil
+		default:
+			return fmt.Errorf("message not allowed while %s; terminating connection", clientstate.PhaseToName(state.Phase))
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/carlbennett/gobncs/account"
+	"github.com/carlbennett/gobncs/ban"
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/parser"
+	"github.com/carlbennett/gobncs/permission"
+)
+
+// in-game counterparts of the admin API's kick, ban and announcement routes,
+// checked against the same operator permissions
+func init() {
+	parser.RegisterOperatorCommand(parser.OperatorCommand{Permission: permission.PERMISSION_ANNOUNCE, Run: announceCommand}, "announce", "broadcast")
+	parser.RegisterOperatorCommand(parser.OperatorCommand{Permission: permission.PERMISSION_BAN, Run: banCommand}, "ban")
+	parser.RegisterOperatorCommand(parser.OperatorCommand{Permission: permission.PERMISSION_KICK, Run: kickCommand}, "kick")
+	parser.RegisterOperatorCommand(parser.OperatorCommand{Permission: permission.PERMISSION_BAN, Run: unbanCommand}, "unban")
+}
+
+func announceCommand(state *clientstate.ClientState, text string) (string, error) {
+	if text == "" {
+		return "", parser.CommandError("What do you want to announce?")
+	}
+	if err := Broadcast(state, text); err != nil {
+		return "", err
+	}
+	state.Logger(logger).Info("announcement sent", "text", text)
+	return "", nil
+}
+
+// banCommand bans an account and disconnects its clients.
+func banCommand(state *clientstate.ClientState, args string) (string, error) {
+	username, reason, _ := strings.Cut(args, " ")
+	reason = strings.TrimSpace(reason)
+	if account.ValidateUsername(username) != nil {
+		return "", parser.CommandError("Usage: /ban <account> [reason]")
+	}
+
+	if _, err := ban.Add(ban.KIND_ACCOUNT, username, reason, 0); err != nil {
+		return "", err
+	}
+	kicked := kickUser(state, username, reason)
+	state.Logger(logger).Info("ban added", "kind", ban.KIND_ACCOUNT, "target", username, "reason", reason, "kicked", kicked)
+	return fmt.Sprintf("%s was banned.", username), nil
+}
+
+func kickCommand(state *clientstate.ClientState, args string) (string, error) {
+	username, reason, _ := strings.Cut(args, " ")
+	reason = strings.TrimSpace(reason)
+	if username == "" {
+		return "", parser.CommandError("Usage: /kick <account> [reason]")
+	}
+
+	kicked := kickUser(state, username, reason)
+	if kicked == 0 {
+		return "", parser.CommandError("That user is not logged on.")
+	}
+	state.Logger(logger).Info("user kicked", "username", username, "clients", kicked, "reason", reason)
+	return fmt.Sprintf("%s was kicked.", username), nil
+}
+
+func unbanCommand(state *clientstate.ClientState, username string) (string, error) {
+	if account.ValidateUsername(username) != nil {
+		return "", parser.CommandError("Usage: /unban <account>")
+	}
+
+	err := ban.Remove(ban.KIND_ACCOUNT, username)
+	if errors.Is(err, ban.ErrBanNotFound) {
+		return "", parser.CommandError("That account is not banned.")
+	}
+	if err != nil {
+		return "", err
+	}
+	state.Logger(logger).Info("ban removed", "kind", ban.KIND_ACCOUNT, "target", username)
+	return fmt.Sprintf("%s was unbanned.", username), nil
+}
+
+// kickUser disconnects every client logged on as username on behalf of the
+// operator, whose lock the caller holds.
+func kickUser(operator *clientstate.ClientState, username string, reason string) int {
+	return Kick(operator, reason, func(state *clientstate.ClientState) bool {
+		return strings.EqualFold(string(state.Username), username)
+	})
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/carlbennett/gobncs/ban"
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/codec"
+	"github.com/carlbennett/gobncs/handler"
+	"github.com/carlbennett/gobncs/logging"
+	"github.com/carlbennett/gobncs/message"
+	"github.com/carlbennett/gobncs/parser"
+	"github.com/carlbennett/gobncs/permission"
+)
+
+// runCommand sends a chat line through the dispatcher with the client's lock
+// held, as the connection's reader does.
+func runCommand(t *testing.T, state *clientstate.ClientState, line string) {
+	t.Helper()
+	m, err := codec.Encode(codec.ClientSID_CHATCOMMAND{Text: []byte(line)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	withinHandler(t, state, func() {
+		if err := handler.Dispatch(state, m); err != nil {
+			t.Errorf("%s: %v", line, err)
+		}
+	})
+}
+
+// nextEvent decodes the next queued chat event for state.
+func nextEvent(t *testing.T, state *clientstate.ClientState) codec.ServerSID_CHATEVENT {
+	t.Helper()
+	var event codec.ServerSID_CHATEVENT
+	select {
+	case m := <-state.Outbound():
+		if m == nil || m.ID != message.SID_CHATEVENT {
+			t.Fatalf("%s: expected a chat event, got %v", state.Username, m)
+		}
+		if err := codec.Decode(m, &event); err != nil {
+			t.Fatal(err)
+		}
+	default:
+		t.Fatalf("%s: no chat event queued", state.Username)
+	}
+	return event
+}
+
+func setupOperators(t *testing.T, grants map[string]permission.Permission) {
+	t.Helper()
+	logging.Configure(io.Discard, logging.Options{})
+	if err := ban.Open(filepath.Join(t.TempDir(), "bans.json")); err != nil {
+		t.Fatal(err)
+	}
+	permission.SetOperators(grants)
+	t.Cleanup(func() { permission.SetOperators(nil) })
+}
+
+func TestOperatorCommandPermissions(t *testing.T) {
+	setupOperators(t, map[string]permission.Permission{"viewer": permission.PERMISSION_VIEW})
+	viewer := registered(t, "viewer")
+	target := registered(t, "target")
+
+	for _, line := range []string{"/kick target", "/ban target", "/unban target", "/announce hello"} {
+		runCommand(t, viewer, line)
+		if event := nextEvent(t, viewer); event.EventId != parser.EID_ERROR || !strings.Contains(string(event.Text), "permission") {
+			t.Errorf("%s: expected a permission error, got %q", line, event.Text)
+		}
+	}
+	if ids := drain(target); len(ids) != 0 {
+		t.Errorf("denied commands reached the target: %v", ids)
+	}
+	if _, banned := ban.Get(ban.KIND_ACCOUNT, "target"); banned {
+		t.Error("denied ban was added")
+	}
+
+	runCommand(t, viewer, "/help")
+	if event := nextEvent(t, viewer); strings.Contains(string(event.Text), "/kick") {
+		t.Errorf("help lists commands the account may not run: %q", event.Text)
+	}
+}
+
+func TestOperatorKick(t *testing.T) {
+	setupOperators(t, map[string]permission.Permission{"ops": permission.PERMISSION_KICK})
+	ops := registered(t, "ops")
+	target := registered(t, "target")
+
+	runCommand(t, ops, "/help")
+	if event := nextEvent(t, ops); !strings.Contains(string(event.Text), "/kick") || strings.Contains(string(event.Text), "/ban") {
+		t.Errorf("expected help to list /kick only, got %q", event.Text)
+	}
+
+	runCommand(t, ops, "/kick target flooding")
+	if event := nextEvent(t, ops); event.EventId != parser.EID_INFO {
+		t.Errorf("expected confirmation, got %q", event.Text)
+	}
+	if event := nextEvent(t, target); !strings.Contains(string(event.Text), "flooding") {
+		t.Errorf("expected the kick reason, got %q", event.Text)
+	}
+	if ids := drain(target); len(ids) != 1 || ids[0] != 0xFF {
+		t.Errorf("expected the target to be closed, got %v", ids)
+	}
+
+	runCommand(t, ops, "/kick nobody")
+	if event := nextEvent(t, ops); event.EventId != parser.EID_ERROR {
+		t.Errorf("expected an error for a user not logged on, got %q", event.Text)
+	}
+}
+
+func TestOperatorBanAndAnnounce(t *testing.T) {
+	setupOperators(t, map[string]permission.Permission{"ops": permission.PERMISSION_ALL})
+	ops := registered(t, "ops")
+	target := registered(t, "target")
+
+	runCommand(t, ops, "/announce maintenance at noon")
+	for _, state := range []*clientstate.ClientState{ops, target} {
+		if event := nextEvent(t, state); event.EventId != parser.EID_BROADCAST || string(event.Text) != "maintenance at noon" {
+			t.Errorf("%s: expected the announcement, got %q", state.Username, event.Text)
+		}
+	}
+
+	runCommand(t, ops, "/ban target cheating")
+	if entry, banned := ban.Get(ban.KIND_ACCOUNT, "target"); !banned || entry.Reason != "cheating" {
+		t.Fatalf("expected the account to be banned, got %+v", entry)
+	}
+	if ids := drain(target); len(ids) != 2 || ids[1] != 0xFF {
+		t.Errorf("expected the target to be kicked, got %v", ids)
+	}
+	drain(ops)
+
+	runCommand(t, ops, "/unban target")
+	if _, banned := ban.Get(ban.KIND_ACCOUNT, "target"); banned {
+		t.Error("ban was not removed")
+	}
+	if event := nextEvent(t, ops); event.EventId != parser.EID_INFO {
+		t.Errorf("expected confirmation, got %q", event.Text)
+	}
+}
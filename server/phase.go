@@ -0,0 +1,132 @@
+package server
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/message"
+)
+
+type OutOfPhaseAction int32
+
+const (
+	OUT_OF_PHASE_DISCONNECT OutOfPhaseAction = iota // Close the connection
+	OUT_OF_PHASE_ERROR                              // Log an error and drop the message
+	OUT_OF_PHASE_IGNORE                             // Silently drop the message
+)
+
+var outOfPhaseAction = int32(OUT_OF_PHASE_DISCONNECT)
+
+// messages that are legal in every phase after the protocol type was selected
+var anyPhaseMessages = map[message.MessageId]bool{
+	message.SID_GETFILETIME:     true,
+	message.SID_GETICONDATA:     true,
+	message.SID_LOCALEINFO:      true,
+	message.SID_NULL:            true,
+	message.SID_PING:            true,
+	message.SID_SYSTEMINFO:      true,
+	message.SID_UDPPINGRESPONSE: true,
+	message.SID_WARDEN:          true,
+}
+
+// messages that are legal in each phase; every one of them has a handler.
+// Warcraft III account logons (SID_AUTH_ACCOUNT*) are not supported.
+var phaseMessages = map[clientstate.Phase]map[message.MessageId]bool{
+	clientstate.PHASE_AWAITING_AUTH_INFO: {
+		message.SID_AUTH_INFO:       true,
+		message.SID_CLIENTID:        true,
+		message.SID_CLIENTID2:       true,
+		message.SID_STARTVERSIONING: true, // legacy clients may version before SID_CLIENTID
+	},
+	clientstate.PHASE_AWAITING_VERSION_CHECK: {
+		message.SID_AUTH_CHECK:      true,
+		message.SID_CDKEY:           true, // legacy clients, after SID_REPORTVERSION
+		message.SID_CDKEY2:          true,
+		message.SID_CLIENTID:        true, // legacy clients that sent SID_STARTVERSIONING first
+		message.SID_CLIENTID2:       true,
+		message.SID_REPORTVERSION:   true,
+		message.SID_STARTVERSIONING: true,
+	},
+	clientstate.PHASE_AWAITING_LOGON: {
+		message.SID_CHANGEPASSWORD: true,
+		message.SID_CLIENTID:       true,
+		message.SID_CLIENTID2:      true,
+		message.SID_CREATEACCOUNT:  true,
+		message.SID_CREATEACCOUNT2: true,
+		message.SID_ENTERCHAT:      true, // clients without accounts, see ParseSID_ENTERCHAT
+		message.SID_GETCHANNELLIST: true,
+		message.SID_LOGONRESPONSE:  true,
+		message.SID_LOGONRESPONSE2: true,
+		message.SID_QUERYREALMS2:   true,
+		message.SID_REPORTCRASH:    true, // only from clients that passed the version check
+		message.SID_RESETPASSWORD:  true,
+		message.SID_SWITCHPRODUCT:  true,
+	},
+	clientstate.PHASE_CHAT: {
+		message.SID_CHANGEEMAIL:    true,
+		message.SID_CHATCOMMAND:    true,
+		message.SID_CHECKAD:        true,
+		message.SID_CHECKDATAFILE2: true,
+		message.SID_CLICKAD:        true,
+		message.SID_DISPLAYAD:      true,
+		message.SID_ENTERCHAT:      true,
+		message.SID_EXTRAWORK:      true,
+		message.SID_FRIENDSLIST:    true,
+		message.SID_GAMERESULT:     true,
+		message.SID_GETADVLISTEX:   true,
+		message.SID_GETCHANNELLIST: true,
+		message.SID_JOINCHANNEL:    true,
+		message.SID_LEAVECHAT:      true,
+		message.SID_LOGONREALMEX:   true,
+		message.SID_NEWS_INFO:      true,
+		message.SID_NOTIFYJOIN:     true,
+		message.SID_PROFILE:        true,
+		message.SID_QUERYADURL:     true,
+		message.SID_QUERYREALMS2:   true,
+		message.SID_READUSERDATA:   true,
+		message.SID_REPORTCRASH:    true,
+		message.SID_SETEMAIL:       true,
+		message.SID_STARTADVEX3:    true,
+		message.SID_WRITEUSERDATA:  true,
+	},
+	clientstate.PHASE_GAME: {
+		message.SID_CHECKDATAFILE2: true,
+		message.SID_EXTRAWORK:      true,
+		message.SID_FRIENDSLIST:    true,
+		message.SID_GAMERESULT:     true,
+		message.SID_LEAVEGAME:      true,
+		message.SID_NETGAMEPORT:    true,
+		message.SID_REPORTCRASH:    true,
+		message.SID_STARTADVEX3:    true,
+		message.SID_STOPADV:        true,
+	},
+}
+
+func ParseOutOfPhaseAction(value string) (OutOfPhaseAction, error) {
+	switch value {
+	case "disconnect":
+		return OUT_OF_PHASE_DISCONNECT, nil
+	case "error":
+		return OUT_OF_PHASE_ERROR, nil
+	case "ignore":
+		return OUT_OF_PHASE_IGNORE, nil
+	default:
+		return 0, fmt.Errorf("unknown out of phase action (%s)", value)
+	}
+}
+
+func GetOutOfPhaseAction() OutOfPhaseAction {
+	return OutOfPhaseAction(atomic.LoadInt32(&outOfPhaseAction))
+}
+
+func SetOutOfPhaseAction(action OutOfPhaseAction) {
+	atomic.StoreInt32(&outOfPhaseAction, int32(action))
+}
+
+func MessageAllowed(phase clientstate.Phase, id message.MessageId) bool {
+	if phase == clientstate.PHASE_AWAITING_PROTOCOL {
+		return false
+	}
+	return anyPhaseMessages[id] || phaseMessages[phase][id]
+}
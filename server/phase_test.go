@@ -0,0 +1,188 @@
+package server
+
+import (
+	"io"
+	"net"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/carlbennett/gobncs/account"
+	"github.com/carlbennett/gobncs/cdkey"
+	"github.com/carlbennett/gobncs/channel"
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/codec"
+	"github.com/carlbennett/gobncs/config"
+	"github.com/carlbennett/gobncs/crashreport"
+	"github.com/carlbennett/gobncs/game"
+	"github.com/carlbennett/gobncs/handler"
+	"github.com/carlbennett/gobncs/logging"
+	"github.com/carlbennett/gobncs/message"
+	"github.com/carlbennett/gobncs/parser"
+)
+
+// inPhasePayloads holds a well-formed message for every message id that some
+// phase allows, as a client in that phase would send it.
+var inPhasePayloads = map[message.MessageId]codec.Payload{
+	message.SID_AUTH_CHECK:      codec.ClientSID_AUTH_CHECK{KeyCount: 1, Keys: []codec.AuthCheckKey{{KeyLength: 26, Product: 1, PublicValue: 0x00ABCDEF}}},
+	message.SID_AUTH_INFO:       codec.ClientSID_AUTH_INFO{LanguageCode: codec.NewFourCC("enUS"), Platform: codec.NewFourCC("IX86"), Product: codec.NewFourCC("STAR"), VersionByte: 0xD3},
+	message.SID_CDKEY:           codec.ClientSID_CDKEY{Key: []byte("1234567890123"), KeyOwner: []byte("tester")},
+	message.SID_CDKEY2:          codec.ClientSID_CDKEY2{KeyLength: 13, KeyOwner: []byte("tester")},
+	message.SID_CHANGEEMAIL:     codec.ClientSID_CHANGEEMAIL{Username: []byte("tester"), OldEmail: []byte("old@example.com"), NewEmail: []byte("new@example.com")},
+	message.SID_CHANGEPASSWORD:  codec.ClientSID_CHANGEPASSWORD{Username: []byte("tester")},
+	message.SID_CHATCOMMAND:     codec.ClientSID_CHATCOMMAND{Text: []byte("hello")},
+	message.SID_CHECKAD:         codec.ClientSID_CHECKAD{Platform: codec.NewFourCC("IX86"), Product: codec.NewFourCC("STAR")},
+	message.SID_CHECKDATAFILE2:  codec.ClientSID_CHECKDATAFILE2{FileName: []byte("tos.txt")},
+	message.SID_CLICKAD:         codec.ClientSID_CLICKAD{},
+	message.SID_CLIENTID:        codec.ClientSID_CLIENTID{},
+	message.SID_CLIENTID2:       codec.ClientSID_CLIENTID2{},
+	message.SID_CREATEACCOUNT:   codec.ClientSID_CREATEACCOUNT{Username: []byte("newcomer")},
+	message.SID_CREATEACCOUNT2:  codec.ClientSID_CREATEACCOUNT2{Username: []byte("newcomer")},
+	message.SID_DISPLAYAD:       codec.ClientSID_DISPLAYAD{Platform: codec.NewFourCC("IX86"), Product: codec.NewFourCC("STAR")},
+	message.SID_ENTERCHAT:       codec.ClientSID_ENTERCHAT{Username: []byte("tester")},
+	message.SID_EXTRAWORK:       codec.ClientSID_EXTRAWORK{},
+	message.SID_FRIENDSLIST:     codec.ClientSID_FRIENDSLIST{},
+	message.SID_GAMERESULT:      codec.ClientSID_GAMERESULT{},
+	message.SID_GETADVLISTEX:    codec.ClientSID_GETADVLISTEX{ListCount: 20},
+	message.SID_GETCHANNELLIST:  codec.ClientSID_GETCHANNELLIST{Product: codec.NewFourCC("STAR")},
+	message.SID_GETFILETIME:     codec.ClientSID_GETFILETIME{FileName: []byte("tos.txt")},
+	message.SID_GETICONDATA:     codec.ClientSID_GETICONDATA{},
+	message.SID_JOINCHANNEL:     codec.ClientSID_JOINCHANNEL{Channel: []byte("Lobby")},
+	message.SID_LEAVECHAT:       codec.ClientSID_LEAVECHAT{},
+	message.SID_LEAVEGAME:       codec.ClientSID_LEAVEGAME{},
+	message.SID_LOCALEINFO:      codec.ClientSID_LOCALEINFO{},
+	message.SID_LOGONREALMEX:    codec.ClientSID_LOGONREALMEX{RealmTitle: []byte("USEast")},
+	message.SID_LOGONRESPONSE:   codec.ClientSID_LOGONRESPONSE{Username: []byte("tester")},
+	message.SID_LOGONRESPONSE2:  codec.ClientSID_LOGONRESPONSE2{Username: []byte("tester")},
+	message.SID_NETGAMEPORT:     codec.ClientSID_NETGAMEPORT{Port: 6112},
+	message.SID_NEWS_INFO:       codec.ClientSID_NEWS_INFO{},
+	message.SID_NOTIFYJOIN:      codec.ClientSID_NOTIFYJOIN{Product: codec.NewFourCC("STAR"), GameName: []byte("melee")},
+	message.SID_NULL:            codec.ClientSID_NULL{},
+	message.SID_PING:            codec.ClientSID_PING{},
+	message.SID_PROFILE:         codec.ClientSID_PROFILE{Username: []byte("tester")},
+	message.SID_QUERYADURL:      codec.ClientSID_QUERYADURL{},
+	message.SID_QUERYREALMS2:    codec.ClientSID_QUERYREALMS2{},
+	message.SID_READUSERDATA:    codec.ClientSID_READUSERDATA{AccountCount: 1, KeyCount: 1, Accounts: [][]byte{[]byte("tester")}, Keys: [][]byte{[]byte("profile\\location")}},
+	message.SID_REPORTCRASH:     codec.ClientSID_REPORTCRASH{},
+	message.SID_REPORTVERSION:   codec.ClientSID_REPORTVERSION{Platform: codec.NewFourCC("IX86"), Product: codec.NewFourCC("STAR"), VersionByte: 0xD3},
+	message.SID_RESETPASSWORD:   codec.ClientSID_RESETPASSWORD{Username: []byte("tester"), Email: []byte("tester@example.com")},
+	message.SID_SETEMAIL:        codec.ClientSID_SETEMAIL{Email: []byte("tester@example.com")},
+	message.SID_STARTADVEX3:     codec.ClientSID_STARTADVEX3{GameName: []byte("melee"), Statstring: []byte(",,,,")},
+	message.SID_STARTVERSIONING: codec.ClientSID_STARTVERSIONING{Platform: codec.NewFourCC("IX86"), Product: codec.NewFourCC("STAR"), VersionByte: 0xD3},
+	message.SID_STOPADV:         codec.ClientSID_STOPADV{},
+	message.SID_SWITCHPRODUCT:   codec.ClientSID_SWITCHPRODUCT{Product: codec.NewFourCC("STAR")},
+	message.SID_SYSTEMINFO:      codec.ClientSID_SYSTEMINFO{},
+	message.SID_UDPPINGRESPONSE: codec.ClientSID_UDPPINGRESPONSE{},
+	message.SID_WARDEN:          codec.ClientSID_WARDEN{Data: []byte{0x00}},
+	message.SID_WRITEUSERDATA:   codec.ClientSID_WRITEUSERDATA{},
+}
+
+// products that send a message in a phase where Starcraft would not
+var inPhaseProducts = map[clientstate.Phase]map[message.MessageId]clientstate.Product{
+	clientstate.PHASE_AWAITING_LOGON: {message.SID_ENTERCHAT: clientstate.PRODUCT_DRTL},
+}
+
+// allowedMessages returns every message id allowed in a phase.
+func allowedMessages(phase clientstate.Phase) []message.MessageId {
+	var ids []message.MessageId
+	for id := range anyPhaseMessages {
+		ids = append(ids, id)
+	}
+	for id := range phaseMessages[phase] {
+		if !anyPhaseMessages[id] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func TestAllowedMessagesHaveHandlers(t *testing.T) {
+	for phase := range phaseMessages {
+		for _, id := range allowedMessages(phase) {
+			if _, ok := handler.Lookup(clientstate.PROTOCOL_TYPE_GAME, id); !ok {
+				t.Errorf("%s is allowed while %s but has no handler", message.MessageIdToName(id), clientstate.PhaseToName(phase))
+			}
+		}
+	}
+}
+
+// newPhaseState returns the state of a client that has reached phase, logged
+// on as tester once it is past the logon.
+func newPhaseState(t *testing.T, phase clientstate.Phase, product clientstate.Product) *clientstate.ClientState {
+	t.Helper()
+	conn, peer := net.Pipe()
+	state := clientstate.NewClientState(conn)
+	state.ProtocolType = clientstate.PROTOCOL_TYPE_GAME
+	state.Phase = phase
+	if phase != clientstate.PHASE_AWAITING_AUTH_INFO {
+		state.Platform = clientstate.PLATFORM_IX86
+		state.Product = product
+		state.VersionId = 0xD3
+		state.VersioningStarted = true
+		state.UpdateCapabilities()
+	}
+	if phase == clientstate.PHASE_AWAITING_LOGON || phase == clientstate.PHASE_CHAT || phase == clientstate.PHASE_GAME {
+		state.VersionChecked = true
+	}
+	if phase == clientstate.PHASE_CHAT || phase == clientstate.PHASE_GAME {
+		state.Username = []byte("tester")
+		state.Statstring = []byte("RATS")
+	}
+	t.Cleanup(func() {
+		parser.LeaveChannel(state)
+		game.Stop(state)
+		cdkey.Release(state)
+		limiters.Delete(state)
+		state.Close()
+		peer.Close()
+	})
+	return state
+}
+
+func TestAllowedMessagesKeepConnection(t *testing.T) {
+	logging.Configure(io.Discard, logging.Options{})
+	config.Default().ApplyProtocolSettings()
+	dir := t.TempDir()
+	if err := account.Open(filepath.Join(dir, "accounts.json")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := account.Create("tester", account.HashPassword("password")); err != nil {
+		t.Fatal(err)
+	}
+	crashreport.SetDirectory(filepath.Join(dir, "crashes"))
+
+	for phase := range phaseMessages {
+		for _, id := range allowedMessages(phase) {
+			name := clientstate.PhaseToName(phase) + "/" + message.MessageIdToName(id)
+			t.Run(name, func(t *testing.T) {
+				payload, ok := inPhasePayloads[id]
+				if !ok {
+					t.Fatal("no payload to send")
+				}
+				m, err := codec.Encode(payload)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				product, ok := inPhaseProducts[phase][id]
+				if !ok {
+					product = clientstate.PRODUCT_STAR
+				}
+				state := newPhaseState(t, phase, product)
+				if err = handler.Dispatch(state, m); err != nil {
+					t.Fatalf("connection would be closed: %v", err)
+				}
+				select {
+				case <-state.Done():
+					t.Fatal("connection was closed")
+				default:
+				}
+			})
+		}
+	}
+
+	if len(channel.List()) != 0 || len(game.List()) != 0 {
+		t.Error("channels or games were left behind")
+	}
+}
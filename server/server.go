@@ -1,80 +1,226 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"math/rand"
 	"net"
+	"time"
 
+	"github.com/carlbennett/gobncs/ban"
+	"github.com/carlbennett/gobncs/cdkey"
 	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/flood"
+	"github.com/carlbennett/gobncs/game"
+	"github.com/carlbennett/gobncs/handler"
+	"github.com/carlbennett/gobncs/logging"
 	"github.com/carlbennett/gobncs/message"
 	"github.com/carlbennett/gobncs/parser"
+	"github.com/carlbennett/gobncs/proxyproto"
+	"github.com/carlbennett/gobncs/trace"
+	"github.com/carlbennett/gobncs/warden"
 )
 
+var (
+	floodLogger  = logging.For(logging.FLOOD)
+	logger       = logging.For(logging.SERVER)
+	packetLogger = logging.For(logging.PACKET)
+)
+
+// Serve accepts connections on ln and handles each one in its own goroutine
+// until the listener is closed.
+func Serve(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			logger.Warn("failed to accept connection", "address", ln.Addr().String(), "error", err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		// registered before the goroutine starts so that Shutdown cannot miss it
+		connections.Add(1)
+		go func() {
+			defer connections.Done()
+			HandleConnection(conn)
+		}()
+	}
+}
+
 func HandleConnection(conn net.Conn) error {
-	defer conn.Close()
-
-	remoteAddr := conn.RemoteAddr()
-	log.Printf("(%s) connection established; waiting for protocol type request\n", remoteAddr)
-	defer log.Printf("(%s) connection terminated\n", remoteAddr)
-
-	state := &clientstate.ClientState{
-		Conn:         conn,
-		Ping:         -1,
-		PingCookie:   rand.Uint32(),
-		Platform:     clientstate.PLATFORM_ZERO,
-		Product:      clientstate.PRODUCT_ZERO,
-		RemoteAddr:   remoteAddr,
-		TimezoneBias: 0,
+	if proxied, ok := conn.(*proxyproto.Conn); ok {
+		if err := proxied.Err(); err != nil {
+			logger.Warn("terminating connection", "remote", conn.RemoteAddr().String(), "reason", err)
+			conn.Close()
+			return err
+		}
 	}
+
+	tokens := newTokens()
+	state := clientstate.NewClientState(conn)
+	state.Ping = -1
+	state.PingCookie = rand.Uint32()
+	state.Platform = clientstate.PLATFORM_ZERO
+	state.Product = clientstate.PRODUCT_ZERO
+	state.ServerToken = tokens.ServerToken
+	state.TimezoneBias = 0
+	state.UDPValue = tokens.UDPValue
+	defer state.Close()
+
+	state.Logger(logger).Info("connection established; waiting for protocol type request")
+	defer func() {
+		state.Logger(logger).Info("connection terminated")
+	}()
+
+	if entry, banned := ban.Get(ban.KIND_IP, state.RemoteIP()); banned {
+		state.Logger(logger).Info("address banned; terminating connection", "reason", entry.Reason)
+		return nil
+	}
+
+	release, err := flood.Connect(state.RemoteIP(), time.Now())
+	if err != nil {
+		state.Logger(floodLogger).Warn("terminating connection", "reason", err)
+		return nil
+	}
+	defer release()
+
 	clientstate.AddClientState(conn, state)
 	defer clientstate.RemoveClientState(conn)
+	defer cdkey.Release(state)
+	defer warden.RemoveSession(state)
+	defer limiters.Delete(state)
+	defer parser.LeaveChannel(state)
+	defer game.Stop(state)
+
+	tracer, err := trace.Start(state.ID, state.RemoteAddr, time.Now())
+	if err != nil {
+		state.Logger(logger).Error("failed to start trace", "error", err)
+	} else if name := tracer.Name(); name != "" {
+		state.Logger(logger).Info("tracing connection", "file", name)
+	}
+	defer tracer.Close()
 
-	protocol, err := clientstate.ReadProtocolType(conn)
+	go writeMessages(state, tracer)
+
+	reader := message.NewReader(conn)
+	reader.SetResyncPolicy(GetResyncPolicy())
+
+	connected := time.Now()
+	if timeout := GetTimeouts().Protocol; timeout > 0 {
+		conn.SetReadDeadline(connected.Add(timeout))
+	}
+	protocol, err := clientstate.ReadProtocolType(reader)
+	if isTimeout(err) {
+		state.Logger(logger).Info("no protocol type received in time; terminating connection", "timeout", GetTimeouts().Protocol)
+	}
 	if err != nil {
 		return err
 	}
 	state.ProtocolType = protocol
+	connectionsTotal.Inc(protocolLabel(protocol))
 
 	switch protocol {
-	case 0x01:
-		log.Printf("(%s) protocol type (0x%02X) requested", remoteAddr, protocol)
+	case clientstate.PROTOCOL_TYPE_GAME:
+		state.Logger(logger).Debug("protocol type requested", "protocol", fmt.Sprintf("0x%02X", protocol))
+		state.Phase = clientstate.PHASE_AWAITING_AUTH_INFO
 	default:
-		log.Printf("(%s) unknown protocol type (0x%02X) requested; terminating connection", remoteAddr, protocol)
+		state.Logger(logger).Info("unknown protocol type requested; terminating connection", "protocol", fmt.Sprintf("0x%02X", protocol))
 		return err
 	}
 
-	// begin game protocol message stream
+	// begin game protocol message stream; messages are handled in order, one
+	// at a time, so that protocol state transitions are deterministic
+	traceDecided := false
 	for {
-		message, err := message.ReadMessage(conn)
-		if message == nil || err != nil {
+		reader.SetMaxBodySize(clientstate.ProductMaxBodySize(state.Product))
+		discarded := reader.Discarded()
+		deadline, reason := readDeadline(state, connected, time.Now())
+		conn.SetReadDeadline(deadline)
+
+		messageData, err := reader.ReadMessage()
+		if isTimeout(err) {
+			state.Logger(logger).Info("terminating connection", "reason", reason)
+		}
+		var framingErr *message.FramingError
+		if errors.As(err, &framingErr) {
+			state.Logger(logger).Warn("terminating connection", "reason", framingErr)
+		}
+		if messageData == nil || err != nil {
 			return err
 		}
-		go HandleMessage(state, message)
+
+		recordTrace(state, tracer, trace.INBOUND, messageData)
+		if skipped := reader.Discarded() - discarded; skipped > 0 {
+			state.Logger(logger).Warn("discarded bytes while resynchronising message stream", "bytes", skipped)
+		}
+		HandleMessage(state, messageData)
+
+		if !traceDecided && len(state.Username) > 0 {
+			traceDecided = true
+			traced, err := tracer.Logon(string(state.Username))
+			if err != nil {
+				state.Logger(logger).Error("failed to write trace", "error", err)
+			} else if traced {
+				state.Logger(logger).Info("tracing connection", "file", tracer.Name())
+			}
+		}
 	}
 }
 
-func HandleMessage(state *clientstate.ClientState, messageData *message.Message) {
-	remoteAddr := state.RemoteAddr
-	messageId := messageData.ID
-	messageName := message.MessageIdToName(messageId)
-
-	log.Printf("(%s) message ([0x%02X] %s) received from client; parsing", remoteAddr, messageId, messageName)
-
-	var err error
-	switch messageId {
-	case message.SID_NULL:
-		err = parser.ParseSID_NULL(state, messageData)
-	case message.SID_PING:
-		err = parser.ParseSID_PING(state, messageData)
-	case message.SID_AUTH_INFO:
-		err = parser.ParseSID_AUTH_INFO(state, messageData)
-	default:
-		err = fmt.Errorf("unknown message id (0x%02X); terminating connection", messageId)
+func recordTrace(state *clientstate.ClientState, tracer *trace.Trace, direction trace.Direction, m *message.Message) {
+	if err := tracer.Record(direction, m, time.Now()); err != nil {
+		state.RLock()
+		state.Logger(logger).Error("failed to write trace", "error", err)
+		state.RUnlock()
+	}
+}
+
+// writeMessages is the only writer to the connection, so that replies queued
+// from different goroutines never interleave on the socket.
+func writeMessages(state *clientstate.ClientState, tracer *trace.Trace) {
+	for {
+		select {
+		case <-state.Done():
+			return
+		case reply := <-state.Outbound():
+			if reply == nil {
+				state.Close()
+				return
+			}
+			// recorded before writing so that the last reply is not lost to
+			// the trace closing once the client hangs up
+			recordTrace(state, tracer, trace.OUTBOUND, reply)
+			outboundQueueDepth.Observe(float64(state.Pending()))
+			err := message.WriteMessage(state.Conn, reply)
+			if err != nil {
+				state.RLock()
+				state.Logger(logger).Warn("failed to send message", "message", message.MessageIdToName(reply.ID), "error", err)
+				state.RUnlock()
+				state.Close()
+				return
+			}
+			messagesSent.Inc(message.MessageIdToName(reply.ID))
+			if packetLogger.Enabled(context.Background(), slog.LevelDebug) {
+				state.RLock()
+				state.Logger(packetLogger).Debug("message sent", "message", message.MessageIdToName(reply.ID), "length", reply.Length)
+				state.RUnlock()
+			}
+		}
 	}
+}
+
+func HandleMessage(state *clientstate.ClientState, messageData *message.Message) {
+	state.Lock()
+	defer state.Unlock()
 
+	err := handler.Dispatch(state, messageData)
 	if err != nil {
-		log.Printf("(%s) error parsing message ([0x%02X] %s): %s", remoteAddr, messageId, messageName, err)
-		state.Conn.Close()
+		parseErrors.Inc(message.MessageIdToName(messageData.ID))
+		state.Logger(logger).Warn("error parsing message; terminating connection", "message", message.MessageIdToName(messageData.ID), "error", err)
+		state.Close()
 	}
 }
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/carlbennett/gobncs/clientstate"
+)
+
+// connections tracks connections accepted by Serve so that Shutdown can wait
+// for their cleanup to finish.
+var connections = sync.WaitGroup{}
+
+// Shutdown broadcasts notice to every logged on client, waits up to timeout
+// for outbound queues to drain, then closes every connection and waits for
+// them to be cleaned up. Listeners must be closed beforehand.
+func Shutdown(notice string, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+
+	if notice != "" {
+		err := Broadcast(nil, notice)
+		if err != nil {
+			logger.Warn("failed to broadcast shutdown notice", "error", err)
+		}
+	}
+
+	for pendingMessages() > 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	clientstate.EachClientState(func(state *clientstate.ClientState) bool {
+		state.Close()
+		return true
+	})
+
+	done := make(chan struct{})
+	go func() {
+		connections.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Until(deadline) + time.Second):
+		logger.Warn("timed out waiting for connections to close")
+	}
+}
+
+func pendingMessages() int {
+	pending := 0
+	clientstate.EachClientState(func(state *clientstate.ClientState) bool {
+		pending += state.Pending()
+		return true
+	})
+	return pending
+}
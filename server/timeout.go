@@ -0,0 +1,56 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/carlbennett/gobncs/clientstate"
+)
+
+// Timeouts bound how long a connection may go without progress; zero disables
+// a timeout.
+type Timeouts struct {
+	Handshake time.Duration // from connecting until logged on
+	Idle      time.Duration // between messages once logged on
+	Protocol  time.Duration // from connecting until the protocol type byte
+}
+
+var timeouts atomic.Value
+
+func init() {
+	timeouts.Store(Timeouts{})
+}
+
+func GetTimeouts() Timeouts {
+	return timeouts.Load().(Timeouts)
+}
+
+// SetTimeouts applies to the next read of every connection.
+func SetTimeouts(value Timeouts) {
+	timeouts.Store(value)
+}
+
+// readDeadline returns when the connection's next message must arrive by and
+// the reason logged if it does not, or a zero time if there is no limit. It
+// is called from the dispatcher goroutine, which owns the state.
+func readDeadline(state *clientstate.ClientState, connected time.Time, now time.Time) (time.Time, string) {
+	current := GetTimeouts()
+	if state.Phase < clientstate.PHASE_CHAT {
+		if current.Handshake > 0 {
+			return connected.Add(current.Handshake), fmt.Sprintf("handshake not completed within %s", current.Handshake)
+		}
+		return time.Time{}, ""
+	}
+	if current.Idle > 0 {
+		return now.Add(current.Idle), fmt.Sprintf("idle for %s", current.Idle)
+	}
+	return time.Time{}, ""
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
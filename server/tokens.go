@@ -0,0 +1,34 @@
+package server
+
+import (
+	"math/rand"
+	"sync/atomic"
+)
+
+// Tokens are the random values a connection is challenged with.
+type Tokens struct {
+	ServerToken uint32
+	UDPValue    uint32
+}
+
+var tokenSource atomic.Value
+
+func init() {
+	SetTokenSource(nil)
+}
+
+// SetTokenSource replaces how connections accepted afterwards pick their
+// tokens, so that a recorded session can be replayed with the tokens its
+// password proofs were computed from. nil restores random tokens.
+func SetTokenSource(source func() Tokens) {
+	if source == nil {
+		source = func() Tokens {
+			return Tokens{ServerToken: rand.Uint32(), UDPValue: rand.Uint32()}
+		}
+	}
+	tokenSource.Store(source)
+}
+
+func newTokens() Tokens {
+	return tokenSource.Load().(func() Tokens)()
+}
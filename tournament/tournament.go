@@ -0,0 +1,425 @@
+package tournament
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/carlbennett/gobncs/clientstate"
+	"github.com/carlbennett/gobncs/logging"
+)
+
+type Event int
+
+const (
+	EVENT_START Event = iota
+	EVENT_STOP
+)
+
+const (
+	STATUS_INACTIVE = 0x00
+	STATUS_ACTIVE   = 0x01
+)
+
+const (
+	GAME_RESULT_NONE       = 0x00
+	GAME_RESULT_WIN        = 0x01
+	GAME_RESULT_LOSS       = 0x02
+	GAME_RESULT_DRAW       = 0x03
+	GAME_RESULT_DISCONNECT = 0x04
+)
+
+type Schedule struct {
+	DurationMinutes int          `json:"duration_minutes"`
+	Start           string       `json:"start"` // "HH:MM" in UTC
+	Weekday         time.Weekday `json:"weekday"`
+}
+
+type Match struct {
+	PlayerA string            `json:"player_a"`
+	PlayerB string            `json:"player_b"`          // empty for a bye
+	Reports map[string]string `json:"reports,omitempty"` // winner reported by each player, keyed by lowercased name
+	Winner  string            `json:"winner,omitempty"`
+}
+
+type Tournament struct {
+	Active   bool       `json:"-"`
+	Champion string     `json:"champion,omitempty"`
+	Name     string     `json:"name"`
+	Products []string   `json:"products"` // product codes, e.g. "STAR"
+	Rounds   [][]*Match `json:"rounds,omitempty"`
+	Schedule Schedule   `json:"schedule"`
+	Started  time.Time  `json:"started,omitempty"`
+}
+
+var ErrContradictoryResult = errors.New("game result contradicts the opponent's report")
+
+// Notifier is called when a tournament starts or stops.
+type Notifier func(event Event, t *Tournament)
+
+var (
+	directory    string
+	logger       = logging.For(logging.TOURNAMENT)
+	notifier     Notifier
+	tournaments  []*Tournament
+	stateMutex   = sync.Mutex{}
+	stopSchedule chan struct{}
+)
+
+// Load reads the tournament definitions from a JSON file. It may be called
+// again to reload them while the scheduler runs.
+func Load(path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read tournaments: %v", err)
+	}
+
+	var loaded []*Tournament
+	if err = json.Unmarshal(raw, &loaded); err != nil {
+		return fmt.Errorf("failed to parse tournaments: %v", err)
+	}
+	for _, t := range loaded {
+		if _, err = time.Parse("15:04", t.Schedule.Start); err != nil {
+			return fmt.Errorf("invalid start time for tournament (%s): %v", t.Name, err)
+		}
+		if t.Schedule.DurationMinutes <= 0 {
+			return fmt.Errorf("invalid duration for tournament (%s)", t.Name)
+		}
+		for _, code := range t.Products {
+			if _, ok := clientstate.CodeToProduct(code); !ok {
+				return fmt.Errorf("unknown product (%s) for tournament (%s)", code, t.Name)
+			}
+		}
+	}
+
+	// Reloading keeps each tournament that is still defined, with its running
+	// bracket, and only takes its new schedule and products. A running
+	// tournament that is no longer defined is stopped.
+	stateMutex.Lock()
+	var stopped []*Tournament
+	for i, t := range loaded {
+		for _, current := range tournaments {
+			if strings.EqualFold(current.Name, t.Name) {
+				current.Name, current.Products, current.Schedule = t.Name, t.Products, t.Schedule
+				loaded[i] = current
+				break
+			}
+		}
+	}
+	for _, current := range tournaments {
+		if current.Active && !containsTournament(loaded, current) {
+			current.Active = false
+			saveLocked(current)
+			stopped = append(stopped, current)
+		}
+	}
+	tournaments = loaded
+	stateMutex.Unlock()
+
+	for _, t := range stopped {
+		dispatch(EVENT_STOP, t)
+	}
+	return nil
+}
+
+func containsTournament(list []*Tournament, t *Tournament) bool {
+	for _, entry := range list {
+		if entry == t {
+			return true
+		}
+	}
+	return false
+}
+
+func SetDirectory(dir string) {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+	directory = dir
+}
+
+func (t *Tournament) Eligible(product clientstate.Product) bool {
+	code := clientstate.ProductToCode(product)
+	for _, value := range t.Products {
+		if value == code {
+			return true
+		}
+	}
+	return false
+}
+
+// CurrentChampion returns the winner of the tournament's latest run, or an
+// empty string while it is undecided.
+func (t *Tournament) CurrentChampion() string {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+	return t.Champion
+}
+
+// window returns the most recent scheduled start at or before now and its end.
+func (s Schedule) window(now time.Time) (time.Time, time.Time) {
+	clock, _ := time.Parse("15:04", s.Start)
+	now = now.UTC()
+	start := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, time.UTC)
+	start = start.AddDate(0, 0, -((int(now.Weekday()) - int(s.Weekday) + 7) % 7))
+	if start.After(now) {
+		start = start.AddDate(0, 0, -7)
+	}
+	return start, start.Add(time.Duration(s.DurationMinutes) * time.Minute)
+}
+
+// Run starts the scheduler, checking schedules every interval.
+func Run(interval time.Duration, notify Notifier) {
+	stateMutex.Lock()
+	notifier = notify
+	if stopSchedule != nil {
+		close(stopSchedule)
+	}
+	stop := make(chan struct{})
+	stopSchedule = stop
+	stateMutex.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			tick(time.Now())
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func Stop() {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+	if stopSchedule != nil {
+		close(stopSchedule)
+		stopSchedule = nil
+	}
+}
+
+func tick(now time.Time) {
+	stateMutex.Lock()
+	var events []func()
+	for _, t := range tournaments {
+		start, end := t.Schedule.window(now)
+		active := !now.Before(start) && now.Before(end)
+		if active == t.Active {
+			continue
+		}
+
+		t.Active = active
+		if active {
+			t.Started = start
+			t.Champion = ""
+			t.Rounds = nil
+			t := t
+			events = append(events, func() { dispatch(EVENT_START, t) })
+		} else {
+			saveLocked(t)
+			t := t
+			events = append(events, func() { dispatch(EVENT_STOP, t) })
+		}
+	}
+	stateMutex.Unlock()
+
+	for _, event := range events {
+		event()
+	}
+}
+
+func dispatch(event Event, t *Tournament) {
+	stateMutex.Lock()
+	notify := notifier
+	stateMutex.Unlock()
+	if notify != nil {
+		notify(event, t)
+	}
+}
+
+// Enroll seeds the first round of an active tournament with the given players.
+func Enroll(t *Tournament, players []string) {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	shuffled := append([]string{}, players...)
+	rand.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+	t.Rounds = [][]*Match{pair(shuffled)}
+	advanceLocked(t)
+	saveLocked(t)
+}
+
+func pair(players []string) []*Match {
+	var round []*Match
+	for i := 0; i < len(players); i += 2 {
+		match := &Match{PlayerA: players[i]}
+		if i+1 < len(players) {
+			match.PlayerB = players[i+1]
+		} else {
+			match.Winner = players[i] // bye
+		}
+		round = append(round, match)
+	}
+	return round
+}
+
+// advanceLocked creates the next round once every match of the current round
+// has a winner.
+func advanceLocked(t *Tournament) {
+	for len(t.Rounds) > 0 && t.Champion == "" {
+		current := t.Rounds[len(t.Rounds)-1]
+		var winners []string
+		for _, match := range current {
+			if match.Winner == "" {
+				return
+			}
+			winners = append(winners, match.Winner)
+		}
+		if len(winners) <= 1 {
+			if len(winners) == 1 {
+				t.Champion = winners[0]
+			}
+			return
+		}
+		t.Rounds = append(t.Rounds, pair(winners))
+	}
+}
+
+// RecordGameResult applies a game result reported by one of the players of an
+// active tournament match. A player conceding decides the match at once, while
+// a claimed win waits for the opponent to confirm it. It returns a copy of the
+// tournament the report was recorded for, if any, and ErrContradictoryResult
+// if it disagrees with the opponent's report.
+func RecordGameResult(reporter string, players []string, results []uint32) (*Tournament, error) {
+	winner := ""
+	for i, result := range results {
+		if result == GAME_RESULT_WIN && i < len(players) {
+			winner = players[i]
+		}
+	}
+	if winner == "" {
+		return nil, nil
+	}
+
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	for _, t := range tournaments {
+		if !t.Active || len(t.Rounds) == 0 {
+			continue
+		}
+		for _, match := range t.Rounds[len(t.Rounds)-1] {
+			if match.Winner != "" || !contains(players, match.PlayerA) || !contains(players, match.PlayerB) {
+				continue
+			}
+			if !strings.EqualFold(reporter, match.PlayerA) && !strings.EqualFold(reporter, match.PlayerB) {
+				continue
+			}
+			if !strings.EqualFold(winner, match.PlayerA) && !strings.EqualFold(winner, match.PlayerB) {
+				continue
+			}
+			err := recordReportLocked(t, match, reporter, winner)
+			recorded := copyLocked(t)
+			return &recorded, err
+		}
+	}
+	return nil, nil
+}
+
+func recordReportLocked(t *Tournament, match *Match, reporter string, winner string) error {
+	opponent := match.PlayerA
+	if strings.EqualFold(reporter, match.PlayerA) {
+		opponent = match.PlayerB
+	}
+	if earlier, ok := match.Reports[strings.ToLower(reporter)]; ok && !strings.EqualFold(earlier, winner) {
+		return ErrContradictoryResult
+	}
+	if other, ok := match.Reports[strings.ToLower(opponent)]; ok && !strings.EqualFold(other, winner) {
+		return ErrContradictoryResult
+	}
+
+	if match.Reports == nil {
+		match.Reports = map[string]string{}
+	}
+	match.Reports[strings.ToLower(reporter)] = winner
+	_, confirmed := match.Reports[strings.ToLower(opponent)]
+	if confirmed || strings.EqualFold(winner, opponent) {
+		if strings.EqualFold(winner, match.PlayerA) {
+			match.Winner = match.PlayerA
+		} else {
+			match.Winner = match.PlayerB
+		}
+		advanceLocked(t)
+	}
+	saveLocked(t)
+	return nil
+}
+
+func contains(list []string, value string) bool {
+	for _, entry := range list {
+		if strings.EqualFold(entry, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// List returns copies of every tournament that share nothing with the live
+// brackets, so they can be read while results are recorded.
+func List() []Tournament {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+	list := make([]Tournament, 0, len(tournaments))
+	for _, t := range tournaments {
+		list = append(list, copyLocked(t))
+	}
+	return list
+}
+
+// copyLocked deep-copies a tournament, including its matches and their reports.
+func copyLocked(t *Tournament) Tournament {
+	c := *t
+	c.Products = append([]string(nil), t.Products...)
+	c.Rounds = make([][]*Match, len(t.Rounds))
+	for i, round := range t.Rounds {
+		c.Rounds[i] = make([]*Match, len(round))
+		for j, match := range round {
+			m := *match
+			if match.Reports != nil {
+				m.Reports = make(map[string]string, len(match.Reports))
+				for reporter, winner := range match.Reports {
+					m.Reports[reporter] = winner
+				}
+			}
+			c.Rounds[i][j] = &m
+		}
+	}
+	return c
+}
+
+// saveLocked records the bracket of a tournament run, keyed by its start time.
+func saveLocked(t *Tournament) {
+	if directory == "" || t.Started.IsZero() {
+		return
+	}
+	raw, err := json.MarshalIndent(t, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(directory, 0750)
+	}
+	if err == nil {
+		name := fmt.Sprintf("%s-%s.json", strings.ReplaceAll(strings.ToLower(t.Name), " ", "_"), t.Started.Format("20060102T1504Z"))
+		err = os.WriteFile(filepath.Join(directory, filepath.Base(name)), raw, 0640)
+	}
+	if err != nil {
+		logger.Error("failed to record bracket", "tournament", t.Name, "error", err)
+	}
+}
@@ -0,0 +1,133 @@
+package tournament
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// activeMatch installs a single active tournament whose only match is between
+// alice and bob.
+func activeMatch(t *testing.T) *Match {
+	t.Helper()
+	match := &Match{PlayerA: "alice", PlayerB: "bob"}
+	stateMutex.Lock()
+	tournaments = []*Tournament{{Active: true, Name: "test", Rounds: [][]*Match{{match}}}}
+	stateMutex.Unlock()
+	t.Cleanup(func() {
+		stateMutex.Lock()
+		tournaments = nil
+		stateMutex.Unlock()
+	})
+	return match
+}
+
+var (
+	players   = []string{"alice", "bob"}
+	aliceWins = []uint32{GAME_RESULT_WIN, GAME_RESULT_LOSS}
+	bobWins   = []uint32{GAME_RESULT_LOSS, GAME_RESULT_WIN}
+)
+
+func TestRecordGameResultRequiresPlayer(t *testing.T) {
+	match := activeMatch(t)
+	recorded, err := RecordGameResult("mallory", players, aliceWins)
+	if recorded != nil || err != nil {
+		t.Fatalf("report from a spectator was accepted (%v)", err)
+	}
+	if len(match.Reports) != 0 || match.Winner != "" {
+		t.Fatalf("report from a spectator changed the match: %+v", match)
+	}
+}
+
+func TestRecordGameResultConcession(t *testing.T) {
+	match := activeMatch(t)
+	if _, err := RecordGameResult("Bob", players, aliceWins); err != nil {
+		t.Fatal(err)
+	}
+	if match.Winner != "alice" {
+		t.Fatalf("expected alice to win after bob conceded, got %q", match.Winner)
+	}
+}
+
+func TestRecordGameResultClaimNeedsConfirmation(t *testing.T) {
+	match := activeMatch(t)
+	if _, err := RecordGameResult("alice", players, aliceWins); err != nil {
+		t.Fatal(err)
+	}
+	if match.Winner != "" {
+		t.Fatalf("unconfirmed claim decided the match for %q", match.Winner)
+	}
+
+	_, err := RecordGameResult("bob", players, bobWins)
+	if !errors.Is(err, ErrContradictoryResult) {
+		t.Fatalf("expected a contradictory result, got %v", err)
+	}
+	if match.Winner != "" {
+		t.Fatalf("disputed match was decided for %q", match.Winner)
+	}
+
+	if _, err = RecordGameResult("alice", players, bobWins); !errors.Is(err, ErrContradictoryResult) {
+		t.Fatalf("expected a player changing their report to be rejected, got %v", err)
+	}
+}
+
+func TestRecordGameResultConfirmed(t *testing.T) {
+	match := activeMatch(t)
+	for _, reporter := range players {
+		if _, err := RecordGameResult(reporter, players, aliceWins); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if match.Winner != "alice" {
+		t.Fatalf("expected alice to win, got %q", match.Winner)
+	}
+}
+
+func TestLoadKeepsRunningBracket(t *testing.T) {
+	match := activeMatch(t)
+	path := filepath.Join(t.TempDir(), "tournaments.json")
+	definitions := `[{"name": "Test", "products": ["WAR3"], "schedule": {"duration_minutes": 90, "start": "18:00", "weekday": 6}}]`
+	if err := os.WriteFile(path, []byte(definitions), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Load(path); err != nil {
+		t.Fatal(err)
+	}
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+	if len(tournaments) != 1 {
+		t.Fatalf("expected one tournament, got %d", len(tournaments))
+	}
+	reloaded := tournaments[0]
+	if !reloaded.Active || len(reloaded.Rounds) != 1 || reloaded.Rounds[0][0] != match {
+		t.Fatalf("reload dropped the running bracket: %+v", reloaded)
+	}
+	if reloaded.Schedule.DurationMinutes != 90 || len(reloaded.Products) != 1 {
+		t.Fatalf("reload did not apply the new definition: %+v", reloaded)
+	}
+}
+
+func TestListCopiesMatches(t *testing.T) {
+	activeMatch(t)
+	list := List()
+	if len(list) != 1 || len(list[0].Rounds) != 1 || len(list[0].Rounds[0]) != 1 {
+		t.Fatalf("expected the test tournament, got %+v", list)
+	}
+	listed := list[0].Rounds[0][0]
+
+	for _, reporter := range players {
+		if _, err := RecordGameResult(reporter, players, aliceWins); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if listed.Winner != "" || len(listed.Reports) != 0 {
+		t.Fatalf("listed match changed with the live bracket: %+v", listed)
+	}
+
+	listed.Winner = "bob"
+	if live := List()[0].Rounds[0][0]; live.Winner != "alice" {
+		t.Fatalf("changing a listed match changed the live bracket: %+v", live)
+	}
+}
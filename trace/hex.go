@@ -0,0 +1,62 @@
+package trace
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/carlbennett/gobncs/message"
+)
+
+const (
+	hexInbound    = "C>S"
+	hexOutbound   = "S>C"
+	hexTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+// hexWriter writes a heading per frame followed by its hex dump:
+//
+//	2026-10-19T00:16:00.521000Z C>S SID_PING (0x25) 8 bytes
+//	00000000  ff 25 08 00 5a 3c 11 09                           |.%..Z<..|
+type hexWriter struct {
+	buffer *bufio.Writer
+	file   *os.File
+}
+
+func newHexWriter(file *os.File, description string, started time.Time) (*hexWriter, error) {
+	w := &hexWriter{buffer: bufio.NewWriter(file), file: file}
+	_, err := fmt.Fprintf(w.buffer, "# %s, started %s\n\n", description, started.UTC().Format(hexTimeFormat))
+	if err == nil {
+		err = w.buffer.Flush()
+	}
+	return w, err
+}
+
+// Note writes a comment line.
+func (w *hexWriter) Note(text string) {
+	fmt.Fprintf(w.buffer, "# %s\n\n", text)
+}
+
+func (w *hexWriter) WriteFrame(f Frame) error {
+	direction := hexInbound
+	if f.Direction == OUTBOUND {
+		direction = hexOutbound
+	}
+	data := f.encode()
+	_, err := fmt.Fprintf(w.buffer, "%s %s %s (0x%02X) %d bytes\n%s\n", f.At.UTC().Format(hexTimeFormat), direction, message.MessageIdToName(f.Message.ID), f.Message.ID, len(data), hex.Dump(data))
+	if err != nil {
+		return err
+	}
+	// flushed per frame so that the trace survives a crash mid-connection
+	return w.buffer.Flush()
+}
+
+func (w *hexWriter) Close() error {
+	err := w.buffer.Flush()
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
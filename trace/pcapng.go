@@ -0,0 +1,105 @@
+package trace
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+
+	"github.com/carlbennett/gobncs/message"
+)
+
+// pcapng block types and options, see
+// https://www.ietf.org/archive/id/draft-tuexen-opsawg-pcapng-05.html
+const (
+	pcapngSectionHeader        = 0x0A0D0D0A
+	pcapngInterfaceDesc        = 0x00000001
+	pcapngEnhancedPacket       = 0x00000006
+	pcapngByteOrderMagic       = 0x1A2B3C4D
+	pcapngLinkTypeUser0        = 147 // frames are BNCS messages without TCP/IP headers
+	pcapngOptionEnd            = 0
+	pcapngOptionComment        = 1
+	pcapngOptionInterfaceName  = 2
+	pcapngOptionFlags          = 2 // epb_flags; the low two bits hold the direction
+	pcapngOptionTimeResolution = 9
+)
+
+// pcapngWriter writes one section with a single interface describing the
+// connection. Each frame is an enhanced packet block carrying its direction
+// and message name, which Wireshark shows as a packet comment.
+type pcapngWriter struct {
+	file *os.File
+}
+
+func newPcapngWriter(file *os.File, description string) (*pcapngWriter, error) {
+	w := &pcapngWriter{file: file}
+
+	section := &bytes.Buffer{}
+	binary.Write(section, binary.LittleEndian, uint32(pcapngByteOrderMagic))
+	binary.Write(section, binary.LittleEndian, uint16(1)) // major version
+	binary.Write(section, binary.LittleEndian, uint16(0)) // minor version
+	binary.Write(section, binary.LittleEndian, int64(-1)) // section length unknown
+	err := w.writeBlock(pcapngSectionHeader, section.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	iface := &bytes.Buffer{}
+	binary.Write(iface, binary.LittleEndian, uint16(pcapngLinkTypeUser0))
+	binary.Write(iface, binary.LittleEndian, uint16(0)) // reserved
+	binary.Write(iface, binary.LittleEndian, uint32(0)) // no snapshot length limit
+	writeOption(iface, pcapngOptionInterfaceName, []byte(description))
+	writeOption(iface, pcapngOptionTimeResolution, []byte{6}) // microseconds
+	writeOption(iface, pcapngOptionEnd, nil)
+	return w, w.writeBlock(pcapngInterfaceDesc, iface.Bytes())
+}
+
+func (w *pcapngWriter) WriteFrame(f Frame) error {
+	timestamp := uint64(f.At.UnixMicro())
+	data := f.encode()
+
+	packet := &bytes.Buffer{}
+	binary.Write(packet, binary.LittleEndian, uint32(0)) // interface id
+	binary.Write(packet, binary.LittleEndian, uint32(timestamp>>32))
+	binary.Write(packet, binary.LittleEndian, uint32(timestamp))
+	binary.Write(packet, binary.LittleEndian, uint32(len(data))) // captured length
+	binary.Write(packet, binary.LittleEndian, uint32(len(data))) // original length
+	packet.Write(data)
+	packet.Write(make([]byte, padding(len(data))))
+
+	flags := make([]byte, 4)
+	binary.LittleEndian.PutUint32(flags, uint32(f.Direction))
+	writeOption(packet, pcapngOptionFlags, flags)
+	writeOption(packet, pcapngOptionComment, []byte(fmt.Sprintf("%s (0x%02X)", message.MessageIdToName(f.Message.ID), f.Message.ID)))
+	writeOption(packet, pcapngOptionEnd, nil)
+
+	return w.writeBlock(pcapngEnhancedPacket, packet.Bytes())
+}
+
+func (w *pcapngWriter) Close() error {
+	return w.file.Close()
+}
+
+// writeBlock frames a block body, which must be padded to 32 bits, with its
+// type and length.
+func (w *pcapngWriter) writeBlock(blockType uint32, body []byte) error {
+	length := uint32(12 + len(body))
+	block := make([]byte, 0, length)
+	block = binary.LittleEndian.AppendUint32(block, blockType)
+	block = binary.LittleEndian.AppendUint32(block, length)
+	block = append(block, body...)
+	block = binary.LittleEndian.AppendUint32(block, length)
+	_, err := w.file.Write(block)
+	return err
+}
+
+func writeOption(buffer *bytes.Buffer, code uint16, value []byte) {
+	binary.Write(buffer, binary.LittleEndian, code)
+	binary.Write(buffer, binary.LittleEndian, uint16(len(value)))
+	buffer.Write(value)
+	buffer.Write(make([]byte, padding(len(value))))
+}
+
+func padding(length int) int {
+	return (4 - length%4) % 4
+}
@@ -0,0 +1,211 @@
+package trace
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/carlbennett/gobncs/message"
+)
+
+var ErrInvalidTrace = errors.New("invalid trace")
+
+// ReadFile reads a trace written in either format.
+func ReadFile(path string) ([]Frame, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var frames []Frame
+	if len(raw) >= 4 && binary.LittleEndian.Uint32(raw) == pcapngSectionHeader {
+		frames, err = readPcapng(raw)
+	} else {
+		frames, err = readHex(raw)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trace %s: %w", path, err)
+	}
+	return frames, nil
+}
+
+func readHex(raw []byte) ([]Frame, error) {
+	var frames []Frame
+	var heading []string
+	var data []byte
+	lineNumber := 0
+
+	finish := func() error {
+		if heading == nil {
+			return nil
+		}
+		f, err := newFrame(heading[0], heading[1], data)
+		if err != nil {
+			return fmt.Errorf("%w: frame ending on line %d: %v", ErrInvalidTrace, lineNumber, err)
+		}
+		frames = append(frames, f)
+		heading, data = nil, nil
+		return nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "#"):
+		case line == "":
+			if err := finish(); err != nil {
+				return nil, err
+			}
+		case heading == nil:
+			heading = strings.Fields(line)
+			if len(heading) < 2 {
+				return nil, fmt.Errorf("%w: line %d: expected a frame heading", ErrInvalidTrace, lineNumber)
+			}
+		default:
+			// "00000000  ff 25 08 00 ...  |.%..|"; the dump ends at the first bar
+			dump, _, _ := strings.Cut(line, "|")
+			fields := strings.Fields(dump)
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("%w: line %d: expected a hex dump", ErrInvalidTrace, lineNumber)
+			}
+			for _, field := range fields[1:] {
+				b, err := hex.DecodeString(field)
+				if err != nil || len(b) != 1 {
+					return nil, fmt.Errorf("%w: line %d: invalid byte (%s)", ErrInvalidTrace, lineNumber, field)
+				}
+				data = append(data, b[0])
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := finish(); err != nil {
+		return nil, err
+	}
+	return frames, nil
+}
+
+func newFrame(at string, direction string, data []byte) (Frame, error) {
+	f := Frame{}
+	var err error
+	f.At, err = time.Parse(hexTimeFormat, at)
+	if err != nil {
+		return f, fmt.Errorf("invalid time (%s)", at)
+	}
+	switch direction {
+	case hexInbound:
+		f.Direction = INBOUND
+	case hexOutbound:
+		f.Direction = OUTBOUND
+	default:
+		return f, fmt.Errorf("invalid direction (%s)", direction)
+	}
+	f.Message, err = decodeFrame(data)
+	return f, err
+}
+
+// decodeFrame parses a single message that must span the whole frame.
+func decodeFrame(data []byte) (*message.Message, error) {
+	m, err := message.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if int(m.Length) != len(data) {
+		return nil, fmt.Errorf("frame is %d bytes but the message is %d", len(data), m.Length)
+	}
+	return m, nil
+}
+
+func readPcapng(raw []byte) ([]Frame, error) {
+	var frames []Frame
+	resolution := time.Microsecond
+
+	for offset := 0; offset < len(raw); {
+		if len(raw)-offset < 12 {
+			return nil, fmt.Errorf("%w: truncated block at offset %d", ErrInvalidTrace, offset)
+		}
+		blockType := binary.LittleEndian.Uint32(raw[offset:])
+		length := int(binary.LittleEndian.Uint32(raw[offset+4:]))
+		if length < 12 || length%4 != 0 || offset+length > len(raw) {
+			return nil, fmt.Errorf("%w: invalid block length at offset %d", ErrInvalidTrace, offset)
+		}
+		body := raw[offset+8 : offset+length-4]
+		offset += length
+
+		switch blockType {
+		case pcapngSectionHeader:
+			if len(body) < 4 || binary.LittleEndian.Uint32(body) != pcapngByteOrderMagic {
+				return nil, fmt.Errorf("%w: only little-endian sections are supported", ErrInvalidTrace)
+			}
+		case pcapngInterfaceDesc:
+			if len(body) < 8 {
+				return nil, fmt.Errorf("%w: truncated interface description", ErrInvalidTrace)
+			}
+			for code, value := range readOptions(body[8:]) {
+				if code == pcapngOptionTimeResolution && len(value) == 1 && value[0] < 0x80 {
+					resolution = time.Second
+					for i := byte(0); i < value[0]; i++ {
+						resolution /= 10
+					}
+				}
+			}
+		case pcapngEnhancedPacket:
+			f, err := readPacket(body, resolution)
+			if err != nil {
+				return nil, fmt.Errorf("%w: packet %d: %v", ErrInvalidTrace, len(frames), err)
+			}
+			frames = append(frames, f)
+		}
+	}
+	return frames, nil
+}
+
+func readPacket(body []byte, resolution time.Duration) (Frame, error) {
+	if len(body) < 20 {
+		return Frame{}, errors.New("truncated packet block")
+	}
+	timestamp := uint64(binary.LittleEndian.Uint32(body[4:]))<<32 | uint64(binary.LittleEndian.Uint32(body[8:]))
+	captured := int(binary.LittleEndian.Uint32(body[12:]))
+	if 20+captured > len(body) {
+		return Frame{}, errors.New("truncated packet data")
+	}
+	data := body[20 : 20+captured]
+
+	f := Frame{At: time.Unix(0, int64(timestamp)*int64(resolution))}
+	flags, ok := readOptions(body[20+captured+padding(captured):])[pcapngOptionFlags]
+	if !ok || len(flags) != 4 {
+		return f, errors.New("missing direction flags")
+	}
+	f.Direction = Direction(binary.LittleEndian.Uint32(flags) & 0x3)
+	if f.Direction != INBOUND && f.Direction != OUTBOUND {
+		return f, errors.New("unknown direction")
+	}
+
+	var err error
+	f.Message, err = decodeFrame(data)
+	return f, err
+}
+
+// readOptions returns the last value of each option code.
+func readOptions(raw []byte) map[uint16][]byte {
+	options := map[uint16][]byte{}
+	for len(raw) >= 4 {
+		code := binary.LittleEndian.Uint16(raw)
+		length := int(binary.LittleEndian.Uint16(raw[2:]))
+		if code == pcapngOptionEnd || 4+length > len(raw) {
+			break
+		}
+		options[code] = raw[4 : 4+length]
+		raw = raw[4+length+padding(length):]
+	}
+	return options
+}
@@ -0,0 +1,285 @@
+// Package trace records the raw frames of selected connections to files, as
+// annotated hex dumps or pcapng captures, for debugging misbehaving clients.
+package trace
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/carlbennett/gobncs/message"
+	"github.com/carlbennett/gobncs/util"
+)
+
+type Direction byte
+
+const (
+	INBOUND  Direction = 0x01 // client to server
+	OUTBOUND Direction = 0x02 // server to client
+)
+
+const (
+	FORMAT_HEX    = "hex"
+	FORMAT_PCAPNG = "pcapng"
+)
+
+// frames held for a connection waiting for its account to be known; later
+// frames are counted but not kept
+const MAX_PENDING_FRAMES = 256
+
+// Settings select which connections are traced. With neither filter set every
+// connection is traced; otherwise a connection is traced if its address or,
+// once logged on, its account matches.
+type Settings struct {
+	Accounts  []string
+	Directory string
+	Enabled   bool
+	Format    string
+	Networks  []*net.IPNet
+}
+
+// Frame is a complete message as it was sent on the wire.
+type Frame struct {
+	At        time.Time
+	Direction Direction
+	Message   *message.Message
+}
+
+// writer stores frames in one of the file formats.
+type writer interface {
+	WriteFrame(f Frame) error
+	Close() error
+}
+
+// Trace records the frames of one connection. It is safe for concurrent use
+// by the connection's reader and writer; a nil Trace records nothing.
+type Trace struct {
+	mutex   sync.Mutex
+	dropped int
+	err     error
+	id      uint64
+	name    string
+	out     writer
+	pending []Frame // frames recorded before the account was known
+	remote  net.Addr
+	started time.Time
+}
+
+var (
+	settings      = Settings{}
+	settingsMutex = sync.RWMutex{}
+)
+
+func GetSettings() Settings {
+	settingsMutex.RLock()
+	defer settingsMutex.RUnlock()
+	return settings
+}
+
+// SetSettings applies to connections accepted afterwards.
+func SetSettings(value Settings) {
+	settingsMutex.Lock()
+	defer settingsMutex.Unlock()
+	settings = value
+}
+
+func ParseFormat(value string) (string, error) {
+	switch value {
+	case FORMAT_HEX, FORMAT_PCAPNG:
+		return value, nil
+	default:
+		return "", fmt.Errorf("unknown trace format (%s)", value)
+	}
+}
+
+// Start begins tracing a connection whose address matches, or holds its
+// frames until Logon if only an account could match. It returns nil if the
+// connection is not traced.
+func Start(id uint64, remote net.Addr, now time.Time) (*Trace, error) {
+	current := GetSettings()
+	if !current.Enabled {
+		return nil, nil
+	}
+
+	t := &Trace{id: id, remote: remote, started: now}
+	if (len(current.Accounts) == 0 && len(current.Networks) == 0) || matchesAddress(current.Networks, remote) {
+		return t, t.open()
+	}
+	if len(current.Accounts) > 0 {
+		t.pending = []Frame{}
+		return t, nil
+	}
+	return nil, nil
+}
+
+// Name returns the file the trace is written to, or an empty string if it is
+// still pending.
+func (t *Trace) Name() string {
+	if t == nil {
+		return ""
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.name
+}
+
+func (t *Trace) Record(direction Direction, m *message.Message, now time.Time) error {
+	if t == nil {
+		return nil
+	}
+	if err := message.ValidateMessage(m); err != nil {
+		return err
+	}
+	f := Frame{At: now, Direction: direction, Message: m}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	switch {
+	case t.err != nil:
+		return nil
+	case t.pending != nil:
+		if len(t.pending) < MAX_PENDING_FRAMES {
+			t.pending = append(t.pending, f)
+		} else {
+			t.dropped++
+		}
+		return nil
+	case t.out == nil:
+		return nil
+	}
+	return t.write(f)
+}
+
+// Logon decides a pending trace once the connection's account is known,
+// writing the frames held so far if the account matches and discarding them
+// otherwise. It returns whether the connection is now traced.
+func (t *Trace) Logon(account string) (bool, error) {
+	if t == nil {
+		return false, nil
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.pending == nil {
+		return t.out != nil, nil
+	}
+
+	pending := t.pending
+	t.pending = nil
+	if !matchesAccount(GetSettings().Accounts, account) {
+		return false, nil
+	}
+	if err := t.openLocked(); err != nil {
+		return false, err
+	}
+	if t.dropped > 0 {
+		if annotated, ok := t.out.(*hexWriter); ok {
+			annotated.Note(fmt.Sprintf("%d frames before logon were not kept", t.dropped))
+		}
+	}
+	for _, f := range pending {
+		if err := t.write(f); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+func (t *Trace) Close() error {
+	if t == nil {
+		return nil
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.pending = nil
+	if t.out == nil {
+		return nil
+	}
+	err := t.out.Close()
+	t.out = nil
+	return err
+}
+
+func (t *Trace) open() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.openLocked()
+}
+
+func (t *Trace) openLocked() error {
+	current := GetSettings()
+	err := os.MkdirAll(current.Directory, 0750)
+	if err != nil {
+		t.err = err
+		return fmt.Errorf("failed to create trace directory: %v", err)
+	}
+
+	host := strings.NewReplacer(":", "_", "[", "", "]", "").Replace(t.remote.String())
+	base := fmt.Sprintf("%s-conn%d-%s", t.started.UTC().Format("20060102T150405Z"), t.id, host)
+	format := current.Format
+	if format == FORMAT_PCAPNG {
+		t.name = filepath.Join(current.Directory, base+".pcapng")
+	} else {
+		t.name = filepath.Join(current.Directory, base+".txt")
+	}
+
+	file, err := os.OpenFile(t.name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0640)
+	if err != nil {
+		t.err = err
+		return fmt.Errorf("failed to create trace file: %v", err)
+	}
+	description := fmt.Sprintf("conn %d %s", t.id, t.remote)
+	if format == FORMAT_PCAPNG {
+		t.out, err = newPcapngWriter(file, description)
+	} else {
+		t.out, err = newHexWriter(file, description, t.started)
+	}
+	if err != nil {
+		file.Close()
+		t.err, t.out = err, nil
+		return fmt.Errorf("failed to write trace header: %v", err)
+	}
+	return nil
+}
+
+// write stops the trace after the first error so that a full disk is
+// reported once rather than for every frame.
+func (t *Trace) write(f Frame) error {
+	err := t.out.WriteFrame(f)
+	if err != nil {
+		t.err = err
+		t.out.Close()
+		t.out = nil
+		return fmt.Errorf("failed to write trace: %v", err)
+	}
+	return nil
+}
+
+// encode returns the frame as it was sent on the wire.
+func (f Frame) encode() []byte {
+	buffer := &bytes.Buffer{}
+	message.WriteMessage(buffer, f.Message)
+	return buffer.Bytes()
+}
+
+func matchesAddress(networks []*net.IPNet, remote net.Addr) bool {
+	host, _, err := net.SplitHostPort(remote.String())
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && util.NetworksContain(networks, ip)
+}
+
+func matchesAccount(accounts []string, account string) bool {
+	for _, name := range accounts {
+		if strings.EqualFold(name, account) {
+			return true
+		}
+	}
+	return false
+}
@@ -1 +1,61 @@
 package util
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// number of 100-nanosecond intervals between 1601-01-01 and 1970-01-01
+const fileTimeEpochOffset = 116444736000000000
+
+func TimeToFileTime(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.UnixNano()/100) + fileTimeEpochOffset
+}
+
+func FileTimeToTime(ft uint64) time.Time {
+	if ft == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(ft-fileTimeEpochOffset)*100)
+}
+
+// ParseNetworks parses a list of CIDRs or bare IP addresses, which match only
+// themselves.
+func ParseNetworks(values []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address (%s)", value)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network (%s)", value)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// NetworksContain reports whether ip is in any of networks.
+func NetworksContain(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
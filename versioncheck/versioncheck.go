@@ -0,0 +1,107 @@
+package versioncheck
+
+import (
+	"sync"
+
+	"github.com/carlbennett/gobncs/clientstate"
+)
+
+type Result uint32
+
+const (
+	RESULT_FAILED      Result = 0x00 // Failed version check
+	RESULT_OLD_VERSION Result = 0x01 // Old game version
+	RESULT_SUCCESS     Result = 0x02 // Success
+	RESULT_REINSTALL   Result = 0x03 // Reinstall required
+)
+
+type Settings struct {
+	ExeHash     uint32 // expected CheckRevision checksum; zero accepts any
+	ExeVersion  uint32 // expected EXE version; zero accepts any
+	MPQFileName string
+	PatchPath   string // offered to clients with an old version
+	ValueString string // CheckRevision formula handed to the client
+	VersionByte uint32
+}
+
+const defaultMPQFileName = "IX86ver1.mpq"
+const defaultValueString = "A=3845581634 B=880823580 C=1363937103 4 A=A-S B=B-C C=C-A A=A-B"
+
+var (
+	settings      = defaultSettings()
+	settingsMutex = sync.RWMutex{}
+)
+
+func defaultSettings() map[clientstate.Product]Settings {
+	return map[clientstate.Product]Settings{
+		clientstate.PRODUCT_D2DV: {MPQFileName: defaultMPQFileName, ValueString: defaultValueString, VersionByte: 0x0E},
+		clientstate.PRODUCT_D2XP: {MPQFileName: defaultMPQFileName, ValueString: defaultValueString, VersionByte: 0x0E},
+		clientstate.PRODUCT_DRTL: {MPQFileName: defaultMPQFileName, ValueString: defaultValueString, VersionByte: 0x2A},
+		clientstate.PRODUCT_DSHR: {MPQFileName: defaultMPQFileName, ValueString: defaultValueString, VersionByte: 0x2A},
+		clientstate.PRODUCT_JSTR: {MPQFileName: defaultMPQFileName, ValueString: defaultValueString, VersionByte: 0xA9},
+		clientstate.PRODUCT_SEXP: {MPQFileName: defaultMPQFileName, ValueString: defaultValueString, VersionByte: 0xD3},
+		clientstate.PRODUCT_SSHR: {MPQFileName: defaultMPQFileName, ValueString: defaultValueString, VersionByte: 0xA5},
+		clientstate.PRODUCT_STAR: {MPQFileName: defaultMPQFileName, ValueString: defaultValueString, VersionByte: 0xD3},
+		clientstate.PRODUCT_W2BN: {MPQFileName: defaultMPQFileName, ValueString: defaultValueString, VersionByte: 0x4F},
+		clientstate.PRODUCT_W3DM: {MPQFileName: defaultMPQFileName, ValueString: defaultValueString, VersionByte: 0x1C},
+		clientstate.PRODUCT_W3XP: {MPQFileName: defaultMPQFileName, ValueString: defaultValueString, VersionByte: 0x1C},
+		clientstate.PRODUCT_WAR3: {MPQFileName: defaultMPQFileName, ValueString: defaultValueString, VersionByte: 0x1C},
+	}
+}
+
+func GetSettings(product clientstate.Product) (Settings, bool) {
+	settingsMutex.RLock()
+	defer settingsMutex.RUnlock()
+	value, ok := settings[product]
+	return value, ok
+}
+
+// ListSettings returns a copy of the settings of every product.
+func ListSettings() map[clientstate.Product]Settings {
+	settingsMutex.RLock()
+	defer settingsMutex.RUnlock()
+	list := make(map[clientstate.Product]Settings, len(settings))
+	for product, value := range settings {
+		list[product] = value
+	}
+	return list
+}
+
+// ReplaceSettings restores the built-in settings of every product and applies
+// the given ones over them in a single step, so no check sees a partial set.
+func ReplaceSettings(values map[clientstate.Product]Settings) {
+	replacement := defaultSettings()
+	for product, value := range values {
+		replacement[product] = value
+	}
+	settingsMutex.Lock()
+	defer settingsMutex.Unlock()
+	settings = replacement
+}
+
+func SetSettings(product clientstate.Product, value Settings) {
+	settingsMutex.Lock()
+	defer settingsMutex.Unlock()
+	settings[product] = value
+}
+
+// Check compares the version byte, EXE version and CheckRevision checksum
+// reported by the client against the configured ones. A client with another
+// version byte or EXE version is out of date; a client whose checksum differs
+// runs a modified game.
+func Check(product clientstate.Product, versionByte uint32, exeVersion uint32, exeHash uint32) Result {
+	value, ok := GetSettings(product)
+	if !ok {
+		return RESULT_FAILED
+	}
+	if versionByte != value.VersionByte {
+		return RESULT_OLD_VERSION
+	}
+	if value.ExeVersion != 0 && exeVersion != value.ExeVersion {
+		return RESULT_OLD_VERSION
+	}
+	if value.ExeHash != 0 && exeHash != value.ExeHash {
+		return RESULT_FAILED
+	}
+	return RESULT_SUCCESS
+}
@@ -0,0 +1,42 @@
+package warden
+
+import "crypto/sha1"
+
+// Random is the SHA-1 based byte generator Warden uses to derive the RC4 keys
+// for a session from a seed.
+type Random struct {
+	data     [sha1.Size]byte
+	position int
+	source1  [sha1.Size]byte
+	source2  [sha1.Size]byte
+}
+
+func NewRandom(seed []byte) *Random {
+	half := len(seed) / 2
+	r := &Random{
+		source1: sha1.Sum(seed[:half]),
+		source2: sha1.Sum(seed[half:]),
+	}
+	r.update()
+	return r
+}
+
+func (r *Random) update() {
+	hash := sha1.New()
+	hash.Write(r.source1[:])
+	hash.Write(r.data[:])
+	hash.Write(r.source2[:])
+	copy(r.data[:], hash.Sum(nil))
+}
+
+func (r *Random) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = r.data[r.position]
+		r.position++
+		if r.position >= len(r.data) {
+			r.position = 0
+			r.update()
+		}
+	}
+	return len(p), nil
+}
@@ -0,0 +1,160 @@
+package warden
+
+import (
+	"bytes"
+	"crypto/rc4"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// RecordedClient is a stand-in for a game client that answers Warden requests
+// from recorded memory contents instead of a running process.
+type RecordedClient struct {
+	HasModule bool
+	Memory    map[string][]byte // keyed by MemoryKey(module, address)
+	Opcodes   Opcodes
+	Pages     map[uint32]bool // page addresses whose signature is present
+
+	in           *rc4.Cipher
+	moduleLength uint32
+	received     uint32
+	out          *rc4.Cipher
+}
+
+func MemoryKey(module string, address uint32) string {
+	return fmt.Sprintf("%s+%08X", strings.ToLower(module), address)
+}
+
+func NewRecordedClient(seed uint32) *RecordedClient {
+	// the client encrypts with the key the server decrypts with, and vice versa
+	serverIn, serverOut, _ := newCiphers(seed)
+	return &RecordedClient{
+		in:      serverOut,
+		Memory:  map[string][]byte{},
+		Opcodes: defaultOpcodes,
+		out:     serverIn,
+		Pages:   map[uint32]bool{},
+	}
+}
+
+func (c *RecordedClient) encrypt(data []byte) []byte {
+	encrypted := make([]byte, len(data))
+	c.out.XORKeyStream(encrypted, data)
+	return encrypted
+}
+
+// Handle decrypts a server packet and returns the encrypted reply, if any.
+func (c *RecordedClient) Handle(packet []byte) ([]byte, error) {
+	if len(packet) == 0 {
+		return nil, fmt.Errorf("empty warden packet")
+	}
+	data := make([]byte, len(packet))
+	c.in.XORKeyStream(data, packet)
+
+	switch data[0] {
+	case OPCODE_MODULE_INFO:
+		if len(data) != 37 {
+			return nil, fmt.Errorf("invalid module info length (%d)", len(data))
+		}
+		c.moduleLength = binary.LittleEndian.Uint32(data[33:])
+		if c.HasModule {
+			return c.encrypt([]byte{RESPONSE_MODULE_LOADED}), nil
+		}
+		return c.encrypt([]byte{RESPONSE_MODULE_MISSING}), nil
+	case OPCODE_MODULE_TRANSFER:
+		if len(data) < 3 {
+			return nil, fmt.Errorf("invalid module transfer length (%d)", len(data))
+		}
+		c.received += uint32(binary.LittleEndian.Uint16(data[1:3]))
+		if c.received < c.moduleLength {
+			return nil, nil
+		}
+		c.HasModule = true
+		return c.encrypt([]byte{RESPONSE_MODULE_LOADED}), nil
+	case OPCODE_CHEAT_CHECKS:
+		results, err := c.answerChecks(data[1:])
+		if err != nil {
+			return nil, err
+		}
+		reply := &bytes.Buffer{}
+		reply.WriteByte(RESPONSE_CHEAT_CHECKS)
+		binary.Write(reply, binary.LittleEndian, uint16(len(results)))
+		binary.Write(reply, binary.LittleEndian, Checksum(results))
+		reply.Write(results)
+		return c.encrypt(reply.Bytes()), nil
+	default:
+		return nil, fmt.Errorf("unknown warden opcode (0x%02X)", data[0])
+	}
+}
+
+func (c *RecordedClient) answerChecks(data []byte) ([]byte, error) {
+	if len(data) < 2 {
+		return nil, fmt.Errorf("truncated cheat check request")
+	}
+	xor := data[len(data)-1]
+	reader := bytes.NewReader(data[:len(data)-1])
+
+	modules := []string{""}
+	for {
+		length, err := reader.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("truncated module table: %v", err)
+		}
+		if length == 0 {
+			break
+		}
+		name := make([]byte, length)
+		if _, err = io.ReadFull(reader, name); err != nil {
+			return nil, fmt.Errorf("truncated module name: %v", err)
+		}
+		modules = append(modules, string(name))
+	}
+
+	results := &bytes.Buffer{}
+	for reader.Len() > 0 {
+		opcode, _ := reader.ReadByte()
+		opcode ^= xor
+
+		var fields struct {
+			Seed    uint32
+			Hash    [20]byte
+			Address uint32
+			Length  uint8
+		}
+		switch opcode {
+		case c.Opcodes.MemoryCheck:
+			index, err := reader.ReadByte()
+			if err != nil || int(index) >= len(modules) {
+				return nil, fmt.Errorf("invalid module index in memory check")
+			}
+			if err = binary.Read(reader, binary.LittleEndian, &fields.Address); err == nil {
+				err = binary.Read(reader, binary.LittleEndian, &fields.Length)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("truncated memory check: %v", err)
+			}
+			memory, ok := c.Memory[MemoryKey(modules[index], fields.Address)]
+			if !ok || len(memory) < int(fields.Length) {
+				results.WriteByte(0x01)
+				continue
+			}
+			results.WriteByte(0x00)
+			results.Write(memory[:fields.Length])
+		case c.Opcodes.PageCheck:
+			if err := binary.Read(reader, binary.LittleEndian, &fields); err != nil {
+				return nil, fmt.Errorf("truncated page check: %v", err)
+			}
+			if c.Pages[fields.Address] {
+				results.WriteByte(PAGE_RESULT_FOUND)
+			} else {
+				results.WriteByte(PAGE_RESULT_NOT_FOUND)
+			}
+		default:
+			return nil, fmt.Errorf("unknown check opcode (0x%02X)", opcode)
+		}
+	}
+
+	return results.Bytes(), nil
+}
@@ -0,0 +1,467 @@
+package warden
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rc4"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/carlbennett/gobncs/clientstate"
+)
+
+type Action string
+
+const (
+	ACTION_BAN  Action = "ban"
+	ACTION_KICK Action = "kick"
+	ACTION_LOG  Action = "log"
+)
+
+type CheckType string
+
+const (
+	CHECK_MEMORY CheckType = "memory"
+	CHECK_PAGE   CheckType = "page"
+)
+
+const (
+	OPCODE_MODULE_INFO     = 0x00
+	OPCODE_MODULE_TRANSFER = 0x01
+	OPCODE_CHEAT_CHECKS    = 0x02
+)
+
+const (
+	RESPONSE_MODULE_MISSING = 0x00
+	RESPONSE_MODULE_LOADED  = 0x01
+	RESPONSE_CHEAT_CHECKS   = 0x02
+)
+
+const (
+	PAGE_RESULT_FOUND     = 0x00
+	PAGE_RESULT_NOT_FOUND = 0xE9
+)
+
+// largest module chunk sent in a single transfer packet
+const MODULE_CHUNK_SIZE = 500
+
+// Bytes is a byte slice represented as a hex string in configuration files.
+type Bytes []byte
+
+func (b Bytes) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(b)), nil
+}
+
+func (b *Bytes) UnmarshalText(text []byte) error {
+	value, err := hex.DecodeString(string(text))
+	if err != nil {
+		return err
+	}
+	*b = value
+	return nil
+}
+
+type Check struct {
+	Address     uint32    `json:"address"`                // memory offset or page address
+	ExpectFound bool      `json:"expect_found,omitempty"` // page: whether the signature is expected to be present
+	Expected    Bytes     `json:"expected,omitempty"`     // memory: bytes expected at the address
+	Hash        Bytes     `json:"hash,omitempty"`         // page: SHA-1 of the signature
+	Length      uint8     `json:"length"`
+	Module      string    `json:"module,omitempty"` // memory: module name, empty for the game executable
+	Seed        uint32    `json:"seed,omitempty"`   // page: signature seed
+	Type        CheckType `json:"type"`
+}
+
+// check opcodes are defined by the module in use, so they are configurable
+type Opcodes struct {
+	MemoryCheck byte `json:"memory_check"`
+	PageCheck   byte `json:"page_check"`
+}
+
+type Config struct {
+	Action                 Action  `json:"action"`
+	Checks                 []Check `json:"checks"`
+	ChecksPerScan          int     `json:"checks_per_scan"`
+	IntervalSeconds        int     `json:"interval_seconds"`
+	ModuleKey              Bytes   `json:"module_key"`
+	ModulePath             string  `json:"module_path"`
+	Opcodes                Opcodes `json:"opcodes"`
+	ResponseTimeoutSeconds int     `json:"response_timeout_seconds"` // time a client has to answer a request
+}
+
+type Module struct {
+	Data []byte // RC4-encrypted module as sent to the client
+	Key  [16]byte
+	MD5  [md5.Size]byte
+}
+
+type Violation struct {
+	Action Action
+	Reason string
+}
+
+func (v *Violation) Error() string {
+	return fmt.Sprintf("warden violation (%s): %s", v.Action, v.Reason)
+}
+
+type Session struct {
+	config   *Config
+	deadline time.Time // zero while no answer is awaited
+	in       *rc4.Cipher
+	loaded   bool
+	module   *Module
+	mutex    sync.Mutex
+	out      *rc4.Cipher
+	pending  []Check
+	send     func(data []byte) error
+	xor      byte
+}
+
+var (
+	config      *Config
+	module      *Module
+	configMutex = sync.RWMutex{}
+	sessions    = sync.Map{}
+)
+
+var defaultOpcodes = Opcodes{MemoryCheck: 0xF3, PageCheck: 0xB2}
+
+// Load reads the Warden configuration and the module it references. An empty
+// path disables Warden.
+func Load(path string) error {
+	if path == "" {
+		configMutex.Lock()
+		config, module = nil, nil
+		configMutex.Unlock()
+		return nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read warden config: %v", err)
+	}
+
+	loaded := &Config{
+		Action:                 ACTION_LOG,
+		ChecksPerScan:          4,
+		IntervalSeconds:        300,
+		Opcodes:                defaultOpcodes,
+		ResponseTimeoutSeconds: 120,
+	}
+	if err = json.Unmarshal(raw, loaded); err != nil {
+		return fmt.Errorf("failed to parse warden config: %v", err)
+	}
+
+	switch loaded.Action {
+	case ACTION_BAN, ACTION_KICK, ACTION_LOG:
+	default:
+		return fmt.Errorf("unknown warden action (%s)", loaded.Action)
+	}
+	for i, check := range loaded.Checks {
+		if check.Type != CHECK_MEMORY && check.Type != CHECK_PAGE {
+			return fmt.Errorf("unknown warden check type (%s) at index %d", check.Type, i)
+		}
+		if check.Type == CHECK_MEMORY && len(check.Expected) != int(check.Length) {
+			return fmt.Errorf("warden memory check at index %d expects %d bytes, got %d", i, check.Length, len(check.Expected))
+		}
+		if check.Type == CHECK_PAGE && len(check.Hash) != sha1.Size {
+			return fmt.Errorf("warden page check at index %d has an invalid hash", i)
+		}
+	}
+	if loaded.ResponseTimeoutSeconds <= 0 {
+		return fmt.Errorf("warden response timeout must be positive, got %d", loaded.ResponseTimeoutSeconds)
+	}
+	if len(loaded.ModuleKey) != 16 {
+		return fmt.Errorf("warden module key must be 16 bytes, got %d", len(loaded.ModuleKey))
+	}
+
+	data, err := os.ReadFile(loaded.ModulePath)
+	if err != nil {
+		return fmt.Errorf("failed to read warden module: %v", err)
+	}
+	loadedModule := &Module{Data: data, MD5: md5.Sum(data)}
+	copy(loadedModule.Key[:], loaded.ModuleKey)
+
+	configMutex.Lock()
+	config, module = loaded, loadedModule
+	configMutex.Unlock()
+	return nil
+}
+
+func Enabled() bool {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+	return config != nil
+}
+
+// keys are derived from the first DWORD of the CD-key hash; the first 16
+// bytes encrypt client traffic and the next 16 bytes encrypt server traffic
+func newCiphers(seed uint32) (*rc4.Cipher, *rc4.Cipher, [16]byte) {
+	var seedBytes [4]byte
+	binary.LittleEndian.PutUint32(seedBytes[:], seed)
+	random := NewRandom(seedBytes[:])
+
+	var clientKey, serverKey [16]byte
+	random.Read(clientKey[:])
+	random.Read(serverKey[:])
+
+	in, _ := rc4.NewCipher(clientKey[:])
+	out, _ := rc4.NewCipher(serverKey[:])
+	return in, out, serverKey
+}
+
+// NewSession starts Warden for a client and sends the first packet. Every
+// packet is encrypted and passed to send under the session lock, so packets
+// are queued in keystream order.
+func NewSession(state *clientstate.ClientState, seed uint32, send func(data []byte) error) (*Session, error) {
+	configMutex.RLock()
+	sessionConfig, sessionModule := config, module
+	configMutex.RUnlock()
+	if sessionConfig == nil {
+		return nil, fmt.Errorf("warden is not enabled")
+	}
+
+	in, out, serverKey := newCiphers(seed)
+	session := &Session{
+		config: sessionConfig,
+		in:     in,
+		module: sessionModule,
+		out:    out,
+		send:   send,
+		xor:    serverKey[0],
+	}
+	sessions.Store(state, session)
+
+	buffer := &bytes.Buffer{}
+	buffer.WriteByte(OPCODE_MODULE_INFO)
+	buffer.Write(sessionModule.MD5[:])
+	buffer.Write(sessionModule.Key[:])
+	binary.Write(buffer, binary.LittleEndian, uint32(len(sessionModule.Data)))
+
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	session.awaitLocked()
+	return session, session.sendLocked(buffer.Bytes())
+}
+
+func GetSession(state *clientstate.ClientState) (*Session, bool) {
+	session, ok := sessions.Load(state)
+	if !ok {
+		return nil, false
+	}
+	return session.(*Session), true
+}
+
+func RemoveSession(state *clientstate.ClientState) {
+	sessions.Delete(state)
+}
+
+func (s *Session) Interval() time.Duration {
+	return time.Duration(s.config.IntervalSeconds) * time.Second
+}
+
+func (s *Session) Timeout() time.Duration {
+	return time.Duration(s.config.ResponseTimeoutSeconds) * time.Second
+}
+
+func (s *Session) awaitLocked() {
+	s.deadline = time.Now().Add(s.Timeout())
+}
+
+// Overdue returns a *Violation if the client left a request unanswered past
+// its deadline, and nil otherwise.
+func (s *Session) Overdue(now time.Time) *Violation {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.deadline.IsZero() || now.Before(s.deadline) {
+		return nil
+	}
+	s.deadline = time.Time{}
+	return &Violation{Action: s.config.Action, Reason: "no response to warden request"}
+}
+
+func (s *Session) sendLocked(data []byte) error {
+	encrypted := make([]byte, len(data))
+	s.out.XORKeyStream(encrypted, data)
+	return s.send(encrypted)
+}
+
+// Handle decrypts a client packet and sends the replies. It reports whether a
+// reply was sent that the client must answer. A *Violation error is returned
+// when the client fails a check.
+func (s *Session) Handle(data []byte) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(data) == 0 {
+		return false, fmt.Errorf("empty warden packet")
+	}
+	decrypted := make([]byte, len(data))
+	s.in.XORKeyStream(decrypted, data)
+	s.deadline = time.Time{}
+
+	switch decrypted[0] {
+	case RESPONSE_MODULE_MISSING:
+		for offset := 0; offset < len(s.module.Data); offset += MODULE_CHUNK_SIZE {
+			end := offset + MODULE_CHUNK_SIZE
+			if end > len(s.module.Data) {
+				end = len(s.module.Data)
+			}
+			chunk := &bytes.Buffer{}
+			chunk.WriteByte(OPCODE_MODULE_TRANSFER)
+			binary.Write(chunk, binary.LittleEndian, uint16(end-offset))
+			chunk.Write(s.module.Data[offset:end])
+			if err := s.sendLocked(chunk.Bytes()); err != nil {
+				return false, err
+			}
+		}
+		s.awaitLocked()
+		return true, nil
+	case RESPONSE_MODULE_LOADED:
+		s.loaded = true
+		return s.scanLocked()
+	case RESPONSE_CHEAT_CHECKS:
+		return false, s.verifyLocked(decrypted[1:])
+	default:
+		return false, fmt.Errorf("unknown warden response (0x%02X)", decrypted[0])
+	}
+}
+
+// Scan sends the next cheat check request and reports whether one was sent;
+// nothing is sent if there is nothing to check.
+func (s *Session) Scan() (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.scanLocked()
+}
+
+func (s *Session) scanLocked() (bool, error) {
+	if !s.loaded {
+		return false, fmt.Errorf("warden module not loaded")
+	}
+	if len(s.config.Checks) == 0 {
+		return false, nil
+	}
+
+	count := s.config.ChecksPerScan
+	if count <= 0 || count > len(s.config.Checks) {
+		count = len(s.config.Checks)
+	}
+	s.pending = s.pending[:0]
+	for _, i := range rand.Perm(len(s.config.Checks))[:count] {
+		s.pending = append(s.pending, s.config.Checks[i])
+	}
+
+	buffer := &bytes.Buffer{}
+	buffer.WriteByte(OPCODE_CHEAT_CHECKS)
+
+	moduleIndexes := map[string]byte{}
+	for _, check := range s.pending {
+		if check.Type != CHECK_MEMORY || check.Module == "" {
+			continue
+		}
+		if _, ok := moduleIndexes[check.Module]; ok {
+			continue
+		}
+		moduleIndexes[check.Module] = byte(len(moduleIndexes) + 1)
+		buffer.WriteByte(byte(len(check.Module)))
+		buffer.WriteString(check.Module)
+	}
+	buffer.WriteByte(0x00)
+
+	for _, check := range s.pending {
+		switch check.Type {
+		case CHECK_MEMORY:
+			buffer.WriteByte(s.config.Opcodes.MemoryCheck ^ s.xor)
+			buffer.WriteByte(moduleIndexes[check.Module])
+			binary.Write(buffer, binary.LittleEndian, check.Address)
+			buffer.WriteByte(check.Length)
+		case CHECK_PAGE:
+			buffer.WriteByte(s.config.Opcodes.PageCheck ^ s.xor)
+			binary.Write(buffer, binary.LittleEndian, check.Seed)
+			buffer.Write(check.Hash)
+			binary.Write(buffer, binary.LittleEndian, check.Address)
+			buffer.WriteByte(check.Length)
+		}
+	}
+	buffer.WriteByte(s.xor)
+
+	s.awaitLocked()
+	return true, s.sendLocked(buffer.Bytes())
+}
+
+func Checksum(data []byte) uint32 {
+	sum := sha1.Sum(data)
+	var checksum uint32
+	for i := 0; i < sha1.Size; i += 4 {
+		checksum ^= binary.LittleEndian.Uint32(sum[i:])
+	}
+	return checksum
+}
+
+func (s *Session) verifyLocked(data []byte) error {
+	if len(s.pending) == 0 {
+		return fmt.Errorf("unexpected warden cheat check response")
+	}
+	pending := s.pending
+	s.pending = nil
+
+	/** Client->Server Format (after opcode):
+	 * (UINT16) Length
+	 * (UINT32) Checksum
+	 * (VOID)   Check results
+	 */
+
+	reader := bytes.NewReader(data)
+	var header struct {
+		Length   uint16
+		Checksum uint32
+	}
+	err := binary.Read(reader, binary.LittleEndian, &header)
+	if err != nil {
+		return fmt.Errorf("failed to read warden response header: %v", err)
+	}
+	results := data[6:]
+	if len(results) != int(header.Length) {
+		return fmt.Errorf("invalid warden response length (expected %d, got %d)", header.Length, len(results))
+	}
+	if Checksum(results) != header.Checksum {
+		return &Violation{Action: s.config.Action, Reason: "response checksum mismatch"}
+	}
+
+	reader = bytes.NewReader(results)
+	for _, check := range pending {
+		result, err := reader.ReadByte()
+		if err != nil {
+			return &Violation{Action: s.config.Action, Reason: "truncated check results"}
+		}
+
+		switch check.Type {
+		case CHECK_MEMORY:
+			if result != 0x00 {
+				return &Violation{Action: s.config.Action, Reason: fmt.Sprintf("memory check at %s+0x%08X failed to read", check.Module, check.Address)}
+			}
+			actual := make([]byte, check.Length)
+			if _, err = io.ReadFull(reader, actual); err != nil {
+				return &Violation{Action: s.config.Action, Reason: "truncated memory check result"}
+			}
+			if !bytes.Equal(actual, check.Expected) {
+				return &Violation{Action: s.config.Action, Reason: fmt.Sprintf("memory mismatch at %s+0x%08X", check.Module, check.Address)}
+			}
+		case CHECK_PAGE:
+			if (result == PAGE_RESULT_FOUND) != check.ExpectFound {
+				return &Violation{Action: s.config.Action, Reason: fmt.Sprintf("page check at 0x%08X returned 0x%02X", check.Address, result)}
+			}
+		}
+	}
+
+	return nil
+}
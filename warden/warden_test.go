@@ -0,0 +1,211 @@
+package warden
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/carlbennett/gobncs/clientstate"
+)
+
+const testSeed = 0x12345678
+
+var testChecks = []Check{
+	{Type: CHECK_MEMORY, Address: 0x1000, Length: 4, Expected: Bytes{0xDE, 0xAD, 0xBE, 0xEF}},
+	{Type: CHECK_MEMORY, Module: "storm.dll", Address: 0x2000, Length: 2, Expected: Bytes{0x90, 0x90}},
+	{Type: CHECK_PAGE, Address: 0x3000, Length: 16, Seed: 1, Hash: bytes.Repeat([]byte{0xAB}, 20), ExpectFound: true},
+}
+
+// loadTestConfig enables Warden with testChecks and a module spanning several
+// transfer packets.
+func loadTestConfig(t *testing.T, action Action) {
+	t.Helper()
+	dir := t.TempDir()
+
+	modulePath := filepath.Join(dir, "module.bin")
+	if err := os.WriteFile(modulePath, bytes.Repeat([]byte{0x5A}, MODULE_CHUNK_SIZE*2+100), 0600); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := json.Marshal(Config{
+		Action:                 action,
+		Checks:                 testChecks,
+		IntervalSeconds:        300,
+		ModuleKey:              bytes.Repeat([]byte{0x01}, 16),
+		ModulePath:             modulePath,
+		Opcodes:                defaultOpcodes,
+		ResponseTimeoutSeconds: 30,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	configPath := filepath.Join(dir, "warden.json")
+	if err = os.WriteFile(configPath, raw, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = Load(configPath); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { Load("") })
+}
+
+// newTestClient returns a recorded client whose memory and pages pass every
+// check in testChecks.
+func newTestClient() *RecordedClient {
+	client := NewRecordedClient(testSeed)
+	client.Memory[MemoryKey("", 0x1000)] = []byte{0xDE, 0xAD, 0xBE, 0xEF}
+	client.Memory[MemoryKey("storm.dll", 0x2000)] = []byte{0x90, 0x90}
+	client.Pages[0x3000] = true
+	return client
+}
+
+// outbox collects the packets a session sends, in the order they were sent.
+type outbox struct {
+	packets [][]byte
+}
+
+func (o *outbox) send(data []byte) error {
+	o.packets = append(o.packets, data)
+	return nil
+}
+
+func (o *outbox) take() [][]byte {
+	packets := o.packets
+	o.packets = nil
+	return packets
+}
+
+func newTestSession(t *testing.T) (*Session, *outbox) {
+	t.Helper()
+	state := &clientstate.ClientState{}
+	sent := &outbox{}
+	session, err := NewSession(state, testSeed, sent.send)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { RemoveSession(state) })
+	return session, sent
+}
+
+// exchange passes packets between the session and the client until neither has
+// anything left to send, and returns the session's error, if any.
+func exchange(t *testing.T, session *Session, client *RecordedClient, sent *outbox) error {
+	t.Helper()
+	queue := sent.take()
+	for len(queue) > 0 {
+		reply, err := client.Handle(queue[0])
+		queue = queue[1:]
+		if err != nil {
+			t.Fatalf("client failed to handle packet: %v", err)
+		}
+		if reply == nil {
+			continue
+		}
+		_, err = session.Handle(reply)
+		if err != nil {
+			return err
+		}
+		queue = append(queue, sent.take()...)
+	}
+	return nil
+}
+
+func TestScanPasses(t *testing.T) {
+	loadTestConfig(t, ACTION_KICK)
+	session, sent := newTestSession(t)
+	client := newTestClient()
+
+	if err := exchange(t, session, client, sent); err != nil {
+		t.Fatalf("first scan: %v", err)
+	}
+	if !client.HasModule {
+		t.Fatal("module was not transferred")
+	}
+
+	if _, err := session.Scan(); err != nil {
+		t.Fatal(err)
+	}
+	if err := exchange(t, session, client, sent); err != nil {
+		t.Fatalf("second scan: %v", err)
+	}
+}
+
+func TestScanDetectsMismatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(client *RecordedClient)
+	}{
+		{"memory", func(client *RecordedClient) { client.Memory[MemoryKey("", 0x1000)] = []byte{0, 0, 0, 0} }},
+		{"module memory", func(client *RecordedClient) { delete(client.Memory, MemoryKey("storm.dll", 0x2000)) }},
+		{"page", func(client *RecordedClient) { client.Pages[0x3000] = false }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			loadTestConfig(t, ACTION_BAN)
+			session, sent := newTestSession(t)
+			client := newTestClient()
+			client.HasModule = true
+			test.modify(client)
+
+			var violation *Violation
+			err := exchange(t, session, client, sent)
+			if !errors.As(err, &violation) {
+				t.Fatalf("expected a violation, got %v", err)
+			}
+			if violation.Action != ACTION_BAN {
+				t.Errorf("expected action %s, got %s", ACTION_BAN, violation.Action)
+			}
+		})
+	}
+}
+
+func TestUnexpectedResponse(t *testing.T) {
+	loadTestConfig(t, ACTION_KICK)
+	session, sent := newTestSession(t)
+	client := newTestClient()
+	if err := exchange(t, session, client, sent); err != nil {
+		t.Fatal(err)
+	}
+
+	// check results sent while no scan is outstanding
+	if _, err := session.Handle(client.encrypt([]byte{RESPONSE_CHEAT_CHECKS})); err == nil {
+		t.Fatal("expected an error for an unrequested response")
+	}
+}
+
+func TestOverdue(t *testing.T) {
+	loadTestConfig(t, ACTION_KICK)
+	session, sent := newTestSession(t)
+	client := newTestClient()
+
+	if violation := session.Overdue(time.Now()); violation != nil {
+		t.Fatalf("overdue before the timeout: %v", violation)
+	}
+	late := time.Now().Add(session.Timeout() + time.Second)
+	violation := session.Overdue(late)
+	if violation == nil || violation.Action != ACTION_KICK {
+		t.Fatalf("expected a kick for an unanswered request, got %v", violation)
+	}
+	if violation = session.Overdue(late); violation != nil {
+		t.Fatalf("reported the same request twice: %v", violation)
+	}
+
+	if err := exchange(t, session, client, sent); err != nil {
+		t.Fatal(err)
+	}
+	if violation = session.Overdue(late); violation != nil {
+		t.Fatalf("overdue after every request was answered: %v", violation)
+	}
+
+	if _, err := session.Scan(); err != nil {
+		t.Fatal(err)
+	}
+	if violation = session.Overdue(time.Now().Add(session.Timeout() + time.Second)); violation == nil {
+		t.Fatal("unanswered scan was not reported")
+	}
+}